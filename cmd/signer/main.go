@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/brucetieu/blockchain/services"
+	"github.com/brucetieu/blockchain/signer"
+	"github.com/joho/godotenv"
+	log "github.com/sirupsen/logrus"
+)
+
+// External signer holding the keys of a keystore directory, so they never have to be on the machine running the
+// app. It answers the app's requests on a Unix socket, or on stdin and stdout when the app starts it itself.
+// Keys are encrypted under KEYSTORE_PASSPHRASE
+func main() {
+	keystoreDir := flag.String("keystore", "keystore", "Directory of the encrypted key files")
+	socket := flag.String("socket", "", "Unix socket to listen on. Requests are read from stdin if not set")
+	newKey := flag.Bool("new", false, "Create a key in the keystore, print its address and public key, then exit")
+	flag.Parse()
+
+	// Logs go to stderr, stdout is for responses
+	log.SetOutput(os.Stderr)
+
+	// .env is optional here, the passphrase can come from the environment of the process
+	_ = godotenv.Load()
+
+	keystore, err := signer.OpenKeystore(*keystoreDir, os.Getenv("KEYSTORE_PASSPHRASE"))
+	if err != nil {
+		log.Fatal("Error opening keystore: ", err.Error())
+	}
+
+	if *newKey {
+		address, pubKey, err := createKey(keystore)
+		if err != nil {
+			log.Fatal("Error creating key: ", err.Error())
+		}
+		fmt.Printf("address: %s\npublicKey: %s\n", address, hex.EncodeToString(pubKey))
+		return
+	}
+
+	if *socket == "" {
+		if err := signer.Serve(os.Stdin, os.Stdout, keystore); err != nil {
+			log.Fatal("Error serving requests: ", err.Error())
+		}
+		return
+	}
+
+	if err := listen(*socket, keystore); err != nil {
+		log.Fatal("Error listening on socket: ", err.Error())
+	}
+}
+
+// Create a key pair and save it in the keystore under its address
+func createKey(keystore *signer.Keystore) (string, []byte, error) {
+	walletService := services.NewWalletService(nil)
+	privKey, pubKey := walletService.CreateKeyPair()
+
+	address, err := walletService.CreateAddress(pubKey)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := keystore.Add(string(address), privKey); err != nil {
+		return "", nil, err
+	}
+
+	return string(address), pubKey, nil
+}
+
+// Serve each connection to the socket at path until the process is stopped
+func listen(path string, keystore *signer.Keystore) error {
+	// A socket left behind by a signer that didn't stop cleanly
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	// Only the user running the signer, and so the app running as the same user, can connect
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	log.Info("Signer listening on ", path)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Info("Shutting down signer...")
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			if err := signer.Serve(conn, conn, keystore); err != nil {
+				log.Error("Error serving connection: ", err.Error())
+			}
+		}()
+	}
+}
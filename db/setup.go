@@ -5,26 +5,29 @@ import (
 	"os"
 
 	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
-	"github.com/jinzhu/gorm"
 )
 
+// Unique index allowing only one active block per parent, so two blocks can't both extend the same tip
+const ActivePrevHashIndex = "idx_blocks_active_prev_hash"
+
 var (
 	DB *gorm.DB
 
-	pgUser = "postgres"
-	pgPass = "pass"
+	pgUser   = "postgres"
+	pgPass   = "pass"
 	pgDbName = "blockchain"
-	pgHost = "database"
-	pgPort = "5432"
+	pgHost   = "database"
+	pgPort   = "5432"
 )
 
 type PgEnvVars struct {
 	PostgresUser string
 	PostgresPass string
-	PostgresDB string
+	PostgresDB   string
 	PostgresHost string
 }
 
@@ -44,15 +47,106 @@ func ConnectDatabase() {
 	_ = database.AutoMigrate(&reps.TxnInput{})
 	_ = database.AutoMigrate(&reps.TxnOutput{})
 	_ = database.AutoMigrate(&reps.Wallet{})
+	_ = database.AutoMigrate(&reps.HDWallet{})
+	_ = database.AutoMigrate(&reps.UTXO{})
+
+	backfillBlockHeights(database)
+	backfillBlockStatus(database)
+	migrateTransactionKeys(database)
+	createActivePrevHashIndex(database)
 
 	DB = database
 }
 
-func getPgConnectionString () string {
+// Blocks saved before heights were tracked all have a height of 0. Work the heights out by following prev_hash links from genesis
+func backfillBlockHeights(database *gorm.DB) {
+	var missing int
+	if err := database.Model(&reps.Block{}).Where("height = 0").Count(&missing).Error; err != nil || missing <= 1 {
+		return
+	}
+
+	log.Infof("Backfilling heights for %d blocks", missing)
+	err := database.Exec(`
+		WITH RECURSIVE chain AS (
+			SELECT block_id, hash, 0 AS height FROM blocks WHERE prev_hash = ''
+			UNION ALL
+			SELECT b.block_id, b.hash, chain.height + 1 FROM blocks b JOIN chain ON b.prev_hash = chain.hash
+		)
+		UPDATE blocks SET height = chain.height FROM chain WHERE blocks.block_id = chain.block_id`).Error
+	if err != nil {
+		log.Error("Error backfilling block heights: ", err.Error())
+	}
+}
+
+// Blocks saved before forks were tracked are all on the one linear chain, so they are active.
+// They were all mined with the fixed TargetBits of 12, so each block adds 2^256 / (2^244 + 1) = 4095 to the chain work
+func backfillBlockStatus(database *gorm.DB) {
+	err := database.Exec(`
+		UPDATE blocks SET status = ?, chain_work = lpad(to_hex((height + 1) * 4095), 64, '0')
+		WHERE status IS NULL OR status = ''`, reps.BlockStatusActive).Error
+	if err != nil {
+		log.Error("Error backfilling block status: ", err.Error())
+	}
+}
+
+// The same transaction can be in a block on each competing branch, so transactions, inputs and outputs are keyed by block as well.
+// Tables created before that only have their own id as primary key
+func migrateTransactionKeys(database *gorm.DB) {
+	tables := []struct {
+		name     string
+		idColumn string
+	}{
+		{"transactions", "id"},
+		{"txn_inputs", "input_id"},
+		{"txn_outputs", "output_id"},
+	}
+
+	for _, table := range tables {
+		var keyed int
+		err := database.Raw(`
+			SELECT count(*) FROM information_schema.key_column_usage
+			WHERE table_name = ? AND constraint_name = ? AND column_name = 'block_id'`,
+			table.name, table.name+"_pkey").Row().Scan(&keyed)
+		if err != nil || keyed > 0 {
+			continue
+		}
+
+		log.Infof("Migrating primary key of %s to include block_id", table.name)
+		if table.name != "transactions" {
+			err = database.Exec(fmt.Sprintf(`
+				UPDATE %s SET block_id = transactions.block_id FROM transactions
+				WHERE %s.curr_txn_id = transactions.id AND (%s.block_id IS NULL OR %s.block_id = '')`,
+				table.name, table.name, table.name, table.name)).Error
+			if err != nil {
+				log.Errorf("Error backfilling block_id of %s: %s", table.name, err.Error())
+				continue
+			}
+		}
+
+		err = database.Exec(fmt.Sprintf(`
+			ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s_pkey, ADD PRIMARY KEY (%s, block_id)`,
+			table.name, table.name, table.idColumn)).Error
+		if err != nil {
+			log.Errorf("Error migrating primary key of %s: %s", table.name, err.Error())
+		}
+	}
+}
+
+// Only blocks in the active chain are covered, since any number of forks can share a parent
+func createActivePrevHashIndex(database *gorm.DB) {
+	err := database.Exec(fmt.Sprintf(`
+		CREATE UNIQUE INDEX IF NOT EXISTS %s ON blocks (prev_hash) WHERE status = '%s'`,
+		ActivePrevHashIndex, reps.BlockStatusActive)).Error
+	if err != nil {
+		log.Error("Error creating active prev_hash index: ", err.Error())
+	}
+}
+
+func getPgConnectionString() string {
 	envVars := PgEnvVars{
 		PostgresUser: pgUser,
 		PostgresPass: pgPass,
-		PostgresDB: pgDbName,
+		PostgresDB:   pgDbName,
 		PostgresHost: pgHost,
 	}
 
@@ -71,7 +165,7 @@ func getPgConnectionString () string {
 		envVars.PostgresPass = envPgPass
 	}
 
-	envPgDbName := os.Getenv("POSTGRES_DB");
+	envPgDbName := os.Getenv("POSTGRES_DB")
 	if envPgDbName != "" {
 		envVars.PostgresDB = envPgDbName
 	}
@@ -80,11 +174,11 @@ func getPgConnectionString () string {
 	if envPgHostName != "" {
 		envVars.PostgresHost = envPgHostName
 	}
-	
+
 	dbURL := ""
 	debugMode := os.Getenv("DEBUG")
 	if debugMode == "false" {
-	// Connect to running postgres container. database is the container name
+		// Connect to running postgres container. database is the container name
 		dbURL = fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", envVars.PostgresHost, pgPort, envVars.PostgresUser, envVars.PostgresDB, envVars.PostgresPass)
 	} else {
 		dbURL = fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable password=%s", "localhost", pgPort, envVars.PostgresUser, envVars.PostgresDB, envVars.PostgresPass)
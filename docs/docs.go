@@ -26,11 +26,25 @@ const docTemplate = `{
     "paths": {
         "/blockchain": {
             "get": {
-                "description": "Get all blocks on the blockchain",
+                "description": "Get all blocks on the blockchain, or only the blocks in a range of heights",
                 "tags": [
                     "Blocks"
                 ],
                 "summary": "Get all blocks",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Lowest block height to return",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Highest block height to return",
+                        "name": "to",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
                         "description": "OK",
@@ -41,6 +55,12 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -84,13 +104,19 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handlers.HTTPError"
                         }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
                     }
                 }
             }
         },
         "/blockchain/block": {
             "post": {
-                "description": "Add a block to the end of the blockchain",
+                "description": "Queue a job to mine a block on the end of the blockchain and return it straight away. Send from, to and amount to mine a single transfer, from and outputs to pay several addresses in one transaction, or only miner to mine all pending transactions. Poll the job to find out when the block is mined. Warnings lists addresses paid by the block that coins may be lost to: retired wallets and addresses that aren't wallets in the app",
                 "tags": [
                     "Blocks"
                 ],
@@ -107,10 +133,10 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "202": {
+                        "description": "Accepted",
                         "schema": {
-                            "$ref": "#/definitions/representations.ReadableBlock"
+                            "$ref": "#/definitions/representations.MiningJob"
                         }
                     },
                     "400": {
@@ -119,8 +145,14 @@ const docTemplate = `{
                             "$ref": "#/definitions/handlers.HTTPError"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
                         "schema": {
                             "$ref": "#/definitions/handlers.HTTPError"
                         }
@@ -151,6 +183,44 @@ const docTemplate = `{
                 }
             }
         },
+        "/blockchain/block/height/{height}": {
+            "get": {
+                "description": "Get the block at a given height on the blockchain. The genesis block is at height 0",
+                "tags": [
+                    "Blocks"
+                ],
+                "summary": "Get a block by height",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Block height",
+                        "name": "height",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadableBlock"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
         "/blockchain/block/last": {
             "get": {
                 "description": "Get the last block on the blockchain",
@@ -206,25 +276,22 @@ const docTemplate = `{
                 }
             }
         },
-        "/blockchain/transactions": {
+        "/blockchain/difficulty": {
             "get": {
-                "description": "Get all transactions that exist on the blockchain",
+                "description": "Get the difficulty of the last block, when difficulty is next recalculated, and what it would be recalculated to at the current block rate",
                 "tags": [
-                    "Transactions"
+                    "Blockchain"
                 ],
-                "summary": "Get all transactions",
+                "summary": "Get the difficulty",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/representations.ReadableTransaction"
-                            }
+                            "$ref": "#/definitions/representations.DifficultyInfo"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/handlers.HTTPError"
                         }
@@ -232,31 +299,67 @@ const docTemplate = `{
                 }
             }
         },
-        "/blockchain/transactions/{transactionId}": {
-            "get": {
-                "description": "Get a transaction on the blockchain",
+        "/blockchain/hdwallets": {
+            "post": {
+                "description": "Create a wallet whose keys are all derived from a new 24 word BIP39 mnemonic. The mnemonic is only in this response, write it down to be able to restore the wallet. The seed is stored encrypted under the passphrase",
                 "tags": [
-                    "Transactions"
+                    "HD wallets"
                 ],
-                "summary": "Get a transaction",
+                "summary": "Create an HD wallet",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Transaction ID",
-                        "name": "transactionId",
-                        "in": "path",
-                        "required": true
+                        "description": "Passphrase",
+                        "name": "CreateHDWalletInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.CreateHDWalletInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadableHDWallet"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/hdwallets/restore": {
+            "post": {
+                "description": "Restore an HD wallet and its addresses from its mnemonic. Each chain is scanned until 20 addresses in a row have never been paid to, and every address up to the last used one is restored along with its balance. The seed is stored encrypted under the passphrase, replacing the old one if the wallet already exists",
+                "tags": [
+                    "HD wallets"
+                ],
+                "summary": "Restore an HD wallet",
+                "parameters": [
+                    {
+                        "description": "Mnemonic and passphrase",
+                        "name": "RestoreHDWalletInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.RestoreHDWalletInput"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/representations.ReadableTransaction"
+                            "$ref": "#/definitions/representations.ReadableHDWallet"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "$ref": "#/definitions/handlers.HTTPError"
                         }
@@ -264,42 +367,72 @@ const docTemplate = `{
                 }
             }
         },
-        "/blockchain/wallets": {
+        "/blockchain/hdwallets/{hdWalletId}": {
             "get": {
-                "description": "Get all wallets",
+                "description": "Get an HD wallet with the addresses derived so far, their balances and the balance of the whole wallet",
                 "tags": [
-                    "Wallets"
+                    "HD wallets"
+                ],
+                "summary": "Get an HD wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "HD wallet id",
+                        "name": "hdWalletId",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get all wallets",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/representations.Wallet"
-                            }
+                            "$ref": "#/definitions/representations.ReadableHDWallet"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
                             "$ref": "#/definitions/handlers.HTTPError"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/blockchain/hdwallets/{hdWalletId}/addresses/{chain}": {
             "post": {
-                "description": "Create a wallet to store an address and public / private key information",
+                "description": "Derive the next unused address of an HD wallet on the receive or change chain. It is saved as a wallet, so it can be spent from like any other",
                 "tags": [
-                    "Wallets"
+                    "HD wallets"
+                ],
+                "summary": "Derive an HD wallet address",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "HD wallet id",
+                        "name": "hdWalletId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "receive or change",
+                        "name": "chain",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Create a wallet",
                 "responses": {
                     "201": {
-                        "description": "address",
+                        "description": "Created",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/representations.HDAddress"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
                         }
                     },
                     "404": {
@@ -311,22 +444,25 @@ const docTemplate = `{
                 }
             }
         },
-        "/blockchain/wallets/balances": {
-            "get": {
-                "description": "Get the coin balances for each address on the blockchain",
+        "/blockchain/hdwallets/{hdWalletId}/lock": {
+            "post": {
+                "description": "Forget the decrypted seed of an HD wallet, so none of its addresses can sign until it is unlocked again",
                 "tags": [
-                    "Wallets"
+                    "HD wallets"
+                ],
+                "summary": "Lock an HD wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "HD wallet id",
+                        "name": "hdWalletId",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get coin balances",
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/representations.AddressBalance"
-                            }
-                        }
+                    "204": {
+                        "description": ""
                     },
                     "404": {
                         "description": "Not Found",
@@ -337,22 +473,90 @@ const docTemplate = `{
                 }
             }
         },
-        "/blockchain/wallets/{address}": {
-            "get": {
-                "description": "Get a wallet by address",
+        "/blockchain/hdwallets/{hdWalletId}/passphrase": {
+            "put": {
+                "description": "Encrypt the seed of an HD wallet under a new passphrase. The HD wallet is locked",
                 "tags": [
-                    "Wallets"
+                    "HD wallets"
+                ],
+                "summary": "Change the passphrase of an HD wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "HD wallet id",
+                        "name": "hdWalletId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Current and new passphrase",
+                        "name": "ChangePassphraseInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.ChangePassphraseInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": ""
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/hdwallets/{hdWalletId}/unlock": {
+            "post": {
+                "description": "Decrypt the seed of an HD wallet with its passphrase and keep it in memory for timeout seconds (5 minutes by default, at most an hour), so transfers from any of its addresses can be signed",
+                "tags": [
+                    "HD wallets"
+                ],
+                "summary": "Unlock an HD wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "HD wallet id",
+                        "name": "hdWalletId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Passphrase and timeout",
+                        "name": "UnlockWalletInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.UnlockWalletInput"
+                        }
+                    }
                 ],
-                "summary": "Get a wallet",
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "unlockedUntil",
                         "schema": {
-                            "$ref": "#/definitions/representations.Wallet"
+                            "type": "string"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "$ref": "#/definitions/handlers.HTTPError"
                         }
@@ -360,18 +564,27 @@ const docTemplate = `{
                 }
             }
         },
-        "/blockchain/wallets/{address}/balance": {
+        "/blockchain/mining/jobs/{jobId}": {
             "get": {
-                "description": "Get the coin balance for an address on the blockchain",
+                "description": "Get the status of a mining job, how many nounces it has tried, how long it has been mining, and the id of the block once mined. Responds with 409 if the block was dropped because another block extended the tip first",
                 "tags": [
-                    "Wallets"
+                    "Blocks"
+                ],
+                "summary": "Get a mining job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Mining job id",
+                        "name": "jobId",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
-                "summary": "Get coin balance",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "integer"
+                            "$ref": "#/definitions/representations.MiningJob"
                         }
                     },
                     "404": {
@@ -379,84 +592,1687 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/handlers.HTTPError"
                         }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/representations.MiningJob"
+                        }
                     }
                 }
+            },
+            "delete": {
+                "description": "Stop a mining job that is queued or mining. Transactions it would have mined stay in the mempool",
+                "tags": [
+                    "Blocks"
+                ],
+                "summary": "Cancel a mining job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Mining job id",
+                        "name": "jobId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.MiningJob"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/mining/stats": {
+            "get": {
+                "description": "Get the hashes per second of the last block mined and the average over every block mined since the app started",
+                "tags": [
+                    "Blockchain"
+                ],
+                "summary": "Get mining stats",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.MiningStats"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/multisig/spends": {
+            "post": {
+                "description": "Build a transfer from a multisig wallet, then wait for its cosigners to sign it. Takes the same payload as submitting a transaction, and warns about the same recipients",
+                "tags": [
+                    "Multisig"
+                ],
+                "summary": "Start a multisig spend",
+                "parameters": [
+                    {
+                        "description": "Create transaction",
+                        "name": "TransactionInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.CreateTransactionInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.MultisigSpend"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/multisig/spends/{spendId}": {
+            "get": {
+                "description": "Get a multisig spend, who has signed it so far and whether it is complete",
+                "tags": [
+                    "Multisig"
+                ],
+                "summary": "Get a multisig spend",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Multisig spend id",
+                        "name": "spendId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.MultisigSpend"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/multisig/spends/{spendId}/signatures": {
+            "post": {
+                "description": "Sign a multisig spend with one of its cosigner wallets. Once threshold cosigners have signed, the transaction is submitted to the mempool",
+                "tags": [
+                    "Multisig"
+                ],
+                "summary": "Sign a multisig spend",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Multisig spend id",
+                        "name": "spendId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Cosigner signing the spend",
+                        "name": "SignMultisigInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.SignMultisigSpendInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.MultisigSpend"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/multisig/wallets": {
+            "post": {
+                "description": "Create a wallet whose spends need signatures from threshold of the cosigner wallets. Coins sent to its address are locked to a P2SH script",
+                "tags": [
+                    "Multisig"
+                ],
+                "summary": "Create a multisig wallet",
+                "parameters": [
+                    {
+                        "description": "Create multisig wallet",
+                        "name": "MultisigWalletInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.CreateMultisigWalletInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.MultisigWallet"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/multisig/wallets/{address}": {
+            "get": {
+                "description": "Get the threshold, cosigners and redeem script of a multisig wallet",
+                "tags": [
+                    "Multisig"
+                ],
+                "summary": "Get a multisig wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Multisig wallet address",
+                        "name": "address",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.MultisigWallet"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/psbt": {
+            "post": {
+                "description": "Build an unsigned transfer as a base64 partially signed transaction, carrying the outputs its inputs spend so it can be signed offline. Takes the same payload as submitting a transaction, and warns about the same recipients",
+                "tags": [
+                    "PSBT"
+                ],
+                "summary": "Create a PSBT",
+                "parameters": [
+                    {
+                        "description": "Create transaction",
+                        "name": "TransactionInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.CreateTransactionInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadablePSBT"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/psbt/broadcast": {
+            "post": {
+                "description": "Submit the signed transaction of a finalized PSBT to the mempool, where it waits to be mined",
+                "tags": [
+                    "PSBT"
+                ],
+                "summary": "Broadcast a PSBT",
+                "parameters": [
+                    {
+                        "description": "PSBT",
+                        "name": "PSBTInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.PSBTDocumentInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadableTransaction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/psbt/combine": {
+            "post": {
+                "description": "Merge copies of the same PSBT signed by different signers into one",
+                "tags": [
+                    "PSBT"
+                ],
+                "summary": "Combine PSBTs",
+                "parameters": [
+                    {
+                        "description": "PSBTs",
+                        "name": "CombinePSBTsInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.CombinePSBTsInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadablePSBT"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/psbt/decode": {
+            "post": {
+                "description": "Show the transaction of a PSBT, how many signatures each input has and whether it is finalized",
+                "tags": [
+                    "PSBT"
+                ],
+                "summary": "Decode a PSBT",
+                "parameters": [
+                    {
+                        "description": "PSBT",
+                        "name": "PSBTInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.PSBTDocumentInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadablePSBT"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/psbt/finalize": {
+            "post": {
+                "description": "Turn the signatures of each input into its unlocking script and check it unlocks the output the input spends. Fails if an input doesn't have enough signatures",
+                "tags": [
+                    "PSBT"
+                ],
+                "summary": "Finalize a PSBT",
+                "parameters": [
+                    {
+                        "description": "PSBT",
+                        "name": "PSBTInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.PSBTDocumentInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadablePSBT"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/psbt/sign": {
+            "post": {
+                "description": "Sign every input of a PSBT that the key of the signer wallet can unlock",
+                "tags": [
+                    "PSBT"
+                ],
+                "summary": "Sign a PSBT",
+                "parameters": [
+                    {
+                        "description": "PSBT and signer",
+                        "name": "SignPSBTInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.SignPSBTInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadablePSBT"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/supply": {
+            "get": {
+                "description": "Get the coins in circulation, the most there will ever be, the current block subsidy and how many blocks until it halves",
+                "tags": [
+                    "Blockchain"
+                ],
+                "summary": "Get the coin supply",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.SupplyInfo"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/tips": {
+            "get": {
+                "description": "Get the head of every known branch with its cumulative work and status (active, valid-fork or invalid)",
+                "tags": [
+                    "Blockchain"
+                ],
+                "summary": "Get chain tips",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/representations.ChainTip"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/transactions": {
+            "get": {
+                "description": "Get all transactions that exist on the blockchain",
+                "tags": [
+                    "Transactions"
+                ],
+                "summary": "Get all transactions",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/representations.ReadableTransaction"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create and sign a transfer, then park it in the mempool until the next block is mined. Send to and amount to pay one address, or outputs to pay several addresses in one transaction. Optionally pay the miner a fixed fee, or a fee rate in coins per byte. Warnings lists recipients coins may be lost to: retired wallets and addresses that aren't wallets in the app",
+                "tags": [
+                    "Transactions"
+                ],
+                "summary": "Submit a transaction",
+                "parameters": [
+                    {
+                        "description": "Create transaction",
+                        "name": "TransactionInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.CreateTransactionInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadableTransaction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/transactions/pending": {
+            "get": {
+                "description": "Get all transactions in the mempool that are waiting to be mined",
+                "tags": [
+                    "Transactions"
+                ],
+                "summary": "Get pending transactions",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/representations.ReadableTransaction"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/transactions/raw": {
+            "post": {
+                "description": "Submit a fully signed transaction built by a client, either as hex of its serialized form or as JSON. It is verified, checked for spent outputs and double spends, then parked in the mempool until the next block is mined. The app doesn't need a wallet for the sender",
+                "tags": [
+                    "Transactions"
+                ],
+                "summary": "Submit a signed transaction",
+                "parameters": [
+                    {
+                        "description": "Signed transaction",
+                        "name": "RawTransactionInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.RawTransactionInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadableTransaction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/transactions/{transactionId}": {
+            "get": {
+                "description": "Get a transaction on the blockchain",
+                "tags": [
+                    "Transactions"
+                ],
+                "summary": "Get a transaction",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Transaction ID",
+                        "name": "transactionId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadableTransaction"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/validate": {
+            "get": {
+                "description": "Walk from genesis to the last block, re-running proof of work and checking merkle roots, prevHash links and transaction signatures",
+                "tags": [
+                    "Blocks"
+                ],
+                "summary": "Validate the blockchain",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ChainValidationReport"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets": {
+            "get": {
+                "description": "Get all wallets",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Get all wallets",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/representations.Wallet"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a wallet to store an address and public / private key information. The private key is only stored encrypted under the passphrase, of at least 8 characters",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Create a wallet",
+                "parameters": [
+                    {
+                        "description": "Passphrase",
+                        "name": "CreateWalletInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.CreateWalletInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "address",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/balances": {
+            "get": {
+                "description": "Get the coin balances for each address on the blockchain",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Get coin balances",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/representations.AddressBalance"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/import": {
+            "post": {
+                "description": "Import a wallet from an address or a public key generated elsewhere. It can receive coins and report its balance and transactions, but the app holds no private key for it and never signs for it. Create a PSBT to spend from it",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Import a watch-only wallet",
+                "parameters": [
+                    {
+                        "description": "Address and / or public key",
+                        "name": "ImportWalletInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.ImportWalletInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.Wallet"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/import/key": {
+            "post": {
+                "description": "Recreate a wallet from a private key in WIF or PEM, e.g. exported from another node. The wallet gets the address of the key, and the key is stored encrypted under the passphrase",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Import a wallet from its private key",
+                "parameters": [
+                    {
+                        "description": "Key, format and passphrase",
+                        "name": "ImportKeyInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.ImportKeyInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.Wallet"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/{address}": {
+            "get": {
+                "description": "Get a wallet by address",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Get a wallet",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.Wallet"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/{address}/balance": {
+            "get": {
+                "description": "Get the coin balance for an address on the blockchain, and the group balance of every address of its HD wallet together, change addresses included. An address outside an HD wallet is a group of its own",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Get coin balance",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "integer"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/{address}/export": {
+            "post": {
+                "description": "Get the private key of a wallet in WIF or PEM, to back it up or import it elsewhere. Needs the passphrase of the wallet, or of the HD wallet it belongs to, even if it is unlocked",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Export the private key of a wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Wallet address",
+                        "name": "address",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Passphrase and format",
+                        "name": "ExportKeyInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.ExportKeyInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ExportedKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/{address}/lock": {
+            "post": {
+                "description": "Forget the decrypted key of a wallet, so it can't sign until it is unlocked again",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Lock a wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Wallet address",
+                        "name": "address",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": ""
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/{address}/passphrase": {
+            "put": {
+                "description": "Encrypt the key of a wallet under a new passphrase. Leave passphrase empty to set the first passphrase of a wallet whose key isn't encrypted yet. The wallet is locked",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Change the passphrase of a wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Wallet address",
+                        "name": "address",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Current and new passphrase",
+                        "name": "ChangePassphraseInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.ChangePassphraseInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": ""
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/{address}/sweep": {
+            "post": {
+                "description": "Move every unspent output of a wallet to another address in a single transaction, parked in the mempool until the next block is mined. Leave out to and send a passphrase to sweep into a new wallet with its key encrypted under it. The wallet is then retired: nothing can be sent from it other than another sweep, and transfers paying it come back with a warning. Optionally pay the miner a fixed fee, or a fee rate in coins per byte",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Sweep a wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Wallet address",
+                        "name": "address",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Where to sweep to",
+                        "name": "SweepWalletInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.SweepWalletInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/representations.ReadableTransaction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/{address}/transactions": {
+            "get": {
+                "description": "Get the transactions on the blockchain that pay to an address or spend from it",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Get transaction history",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Wallet address",
+                        "name": "address",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/representations.ReadableTransaction"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        },
+        "/blockchain/wallets/{address}/unlock": {
+            "post": {
+                "description": "Decrypt the key of a wallet with its passphrase and keep it in memory for timeout seconds (5 minutes by default, at most an hour), so transfers from the wallet can be signed. Unlocking an address of an HD wallet unlocks the whole HD wallet",
+                "tags": [
+                    "Wallets"
+                ],
+                "summary": "Unlock a wallet",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Wallet address",
+                        "name": "address",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Passphrase and timeout",
+                        "name": "UnlockWalletInput",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/representations.UnlockWalletInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "unlockedUntil",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HTTPError"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "handlers.HTTPError": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer",
+                    "example": 400
+                },
+                "message": {
+                    "type": "string",
+                    "example": "status bad request"
+                }
+            }
+        },
+        "representations.AddressBalance": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "balance": {
+                    "type": "integer"
+                },
+                "groupBalance": {
+                    "type": "integer"
+                },
+                "hdWalletId": {
+                    "type": "string"
+                },
+                "publicKey": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.BlockValidation": {
+            "type": "object",
+            "properties": {
+                "blockId": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "representations.ChainTip": {
+            "type": "object",
+            "properties": {
+                "blockId": {
+                    "type": "string"
+                },
+                "branchLength": {
+                    "type": "integer"
+                },
+                "chainWork": {
+                    "type": "string"
+                },
+                "hash": {
+                    "type": "string"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.ChainValidationReport": {
+            "type": "object",
+            "properties": {
+                "blocks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/representations.BlockValidation"
+                    }
+                },
+                "blocksChecked": {
+                    "type": "integer"
+                },
+                "firstInvalidBlock": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "representations.ChangePassphraseInput": {
+            "type": "object",
+            "required": [
+                "newPassphrase"
+            ],
+            "properties": {
+                "newPassphrase": {
+                    "type": "string"
+                },
+                "passphrase": {
+                    "type": "string"
+                }
             }
-        }
-    },
-    "definitions": {
-        "handlers.HTTPError": {
+        },
+        "representations.CombinePSBTsInput": {
             "type": "object",
+            "required": [
+                "psbts"
+            ],
             "properties": {
-                "code": {
-                    "type": "integer",
-                    "example": 400
+                "psbts": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "representations.CreateBlockInput": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "integer"
                 },
-                "message": {
-                    "type": "string",
-                    "example": "status bad request"
+                "coinSelection": {
+                    "type": "string"
+                },
+                "fee": {
+                    "type": "integer"
+                },
+                "feeRate": {
+                    "type": "number"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "miner": {
+                    "type": "string"
+                },
+                "outputs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/representations.Payment"
+                    }
+                },
+                "parent": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
                 }
             }
         },
-        "representations.AddressBalance": {
+        "representations.CreateBlockchainInput": {
+            "type": "object",
+            "required": [
+                "to"
+            ],
+            "properties": {
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.CreateHDWalletInput": {
+            "type": "object",
+            "required": [
+                "passphrase"
+            ],
+            "properties": {
+                "passphrase": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.CreateMultisigWalletInput": {
+            "type": "object",
+            "required": [
+                "cosigners",
+                "threshold"
+            ],
+            "properties": {
+                "cosigners": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "threshold": {
+                    "type": "integer"
+                }
+            }
+        },
+        "representations.CreateTransactionInput": {
+            "type": "object",
+            "required": [
+                "from"
+            ],
+            "properties": {
+                "amount": {
+                    "type": "integer"
+                },
+                "coinSelection": {
+                    "type": "string"
+                },
+                "fee": {
+                    "type": "integer"
+                },
+                "feeRate": {
+                    "type": "number"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "outputs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/representations.Payment"
+                    }
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.CreateWalletInput": {
+            "type": "object",
+            "required": [
+                "passphrase"
+            ],
+            "properties": {
+                "passphrase": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.DifficultyInfo": {
+            "type": "object",
+            "properties": {
+                "averageBlockTime": {
+                    "type": "integer"
+                },
+                "bits": {
+                    "type": "string"
+                },
+                "blocksUntilRetarget": {
+                    "type": "integer"
+                },
+                "difficulty": {
+                    "type": "number"
+                },
+                "estimatedNextBits": {
+                    "type": "string"
+                },
+                "estimatedNextDifficulty": {
+                    "type": "number"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "nextRetargetHeight": {
+                    "type": "integer"
+                },
+                "retargetInterval": {
+                    "type": "integer"
+                },
+                "target": {
+                    "type": "string"
+                },
+                "targetBlockTime": {
+                    "type": "integer"
+                }
+            }
+        },
+        "representations.ExportKeyInput": {
+            "type": "object",
+            "required": [
+                "format",
+                "passphrase"
+            ],
+            "properties": {
+                "format": {
+                    "type": "string"
+                },
+                "passphrase": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.ExportedKey": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.HDAddress": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "balance": {
+                    "type": "integer"
+                },
+                "change": {
+                    "type": "boolean"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "path": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.ImportKeyInput": {
+            "type": "object",
+            "required": [
+                "key",
+                "passphrase"
+            ],
+            "properties": {
+                "format": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "passphrase": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.ImportWalletInput": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "publicKey": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.MiningJob": {
+            "type": "object",
+            "properties": {
+                "blockId": {
+                    "type": "string"
+                },
+                "createdAt": {
+                    "type": "integer"
+                },
+                "elapsedMs": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finishedAt": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "miner": {
+                    "type": "string"
+                },
+                "nouncesTried": {
+                    "type": "integer"
+                },
+                "parent": {
+                    "type": "string"
+                },
+                "startedAt": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.MiningStats": {
+            "type": "object",
+            "properties": {
+                "averageHashesPerSecond": {
+                    "type": "number"
+                },
+                "blocksMined": {
+                    "type": "integer"
+                },
+                "durationMs": {
+                    "type": "integer"
+                },
+                "hashes": {
+                    "type": "integer"
+                },
+                "hashesPerSecond": {
+                    "type": "number"
+                },
+                "timestampRolls": {
+                    "type": "integer"
+                },
+                "totalDurationMs": {
+                    "type": "integer"
+                },
+                "totalHashes": {
+                    "type": "integer"
+                },
+                "workers": {
+                    "type": "integer"
+                }
+            }
+        },
+        "representations.MultisigSpend": {
+            "type": "object",
+            "properties": {
+                "complete": {
+                    "type": "boolean"
+                },
+                "from": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "signers": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "threshold": {
+                    "type": "integer"
+                },
+                "transaction": {
+                    "$ref": "#/definitions/representations.ReadableTransaction"
+                }
+            }
+        },
+        "representations.MultisigWallet": {
             "type": "object",
             "properties": {
                 "address": {
                     "type": "string"
                 },
-                "balance": {
-                    "type": "integer"
+                "cosigners": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 },
-                "publicKey": {
+                "publicKeys": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "redeemScript": {
                     "type": "string"
+                },
+                "threshold": {
+                    "type": "integer"
                 }
             }
         },
-        "representations.CreateBlockInput": {
+        "representations.PSBTDocumentInput": {
             "type": "object",
             "required": [
-                "amount",
-                "from",
-                "to"
+                "psbt"
             ],
+            "properties": {
+                "psbt": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.Payment": {
+            "type": "object",
             "properties": {
                 "amount": {
                     "type": "integer"
                 },
-                "from": {
-                    "type": "string"
-                },
                 "to": {
                     "type": "string"
                 }
             }
         },
-        "representations.CreateBlockchainInput": {
+        "representations.RawTransactionInput": {
             "type": "object",
-            "required": [
-                "to"
-            ],
             "properties": {
-                "to": {
+                "hex": {
                     "type": "string"
+                },
+                "transaction": {
+                    "$ref": "#/definitions/representations.Transaction"
                 }
             }
         },
         "representations.ReadableBlock": {
             "type": "object",
             "properties": {
+                "bits": {
+                    "type": "string"
+                },
+                "chainWork": {
+                    "type": "string"
+                },
+                "difficulty": {
+                    "type": "number"
+                },
                 "hash": {
                     "type": "string"
                 },
+                "height": {
+                    "type": "integer"
+                },
                 "id": {
                     "type": "string"
                 },
+                "merkleRoot": {
+                    "type": "string"
+                },
                 "nounce": {
                     "type": "integer"
                 },
                 "prevHash": {
                     "type": "string"
                 },
+                "status": {
+                    "type": "string"
+                },
                 "timestamp": {
                     "type": "integer"
                 },
@@ -468,15 +2284,67 @@ const docTemplate = `{
                 }
             }
         },
+        "representations.ReadableHDWallet": {
+            "type": "object",
+            "properties": {
+                "accountXPub": {
+                    "type": "string"
+                },
+                "addresses": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/representations.HDAddress"
+                    }
+                },
+                "balance": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "mnemonic": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.ReadablePSBT": {
+            "type": "object",
+            "properties": {
+                "finalized": {
+                    "type": "boolean"
+                },
+                "psbt": {
+                    "type": "string"
+                },
+                "signatures": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "transaction": {
+                    "$ref": "#/definitions/representations.ReadableTransaction"
+                }
+            }
+        },
         "representations.ReadableTransaction": {
             "type": "object",
             "properties": {
                 "blockId": {
                     "type": "string"
                 },
+                "fee": {
+                    "type": "integer"
+                },
+                "feeRate": {
+                    "type": "number"
+                },
                 "id": {
                     "type": "string"
                 },
+                "size": {
+                    "type": "integer"
+                },
                 "txnInputs": {
                     "type": "array",
                     "items": {
@@ -506,6 +2374,9 @@ const docTemplate = `{
                 "pubKey": {
                     "type": "string"
                 },
+                "scriptSig": {
+                    "type": "string"
+                },
                 "signature": {
                     "type": "string"
                 }
@@ -520,20 +2391,241 @@ const docTemplate = `{
                 "pubKeyHash": {
                     "type": "string"
                 },
+                "scriptPubKey": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "integer"
+                }
+            }
+        },
+        "representations.RestoreHDWalletInput": {
+            "type": "object",
+            "required": [
+                "mnemonic",
+                "passphrase"
+            ],
+            "properties": {
+                "mnemonic": {
+                    "type": "string"
+                },
+                "passphrase": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.SignMultisigSpendInput": {
+            "type": "object",
+            "required": [
+                "signer"
+            ],
+            "properties": {
+                "signer": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.SignPSBTInput": {
+            "type": "object",
+            "required": [
+                "psbt",
+                "signer"
+            ],
+            "properties": {
+                "psbt": {
+                    "type": "string"
+                },
+                "signer": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.SupplyInfo": {
+            "type": "object",
+            "properties": {
+                "blocksUntilHalving": {
+                    "type": "integer"
+                },
+                "circulating": {
+                    "type": "integer"
+                },
+                "halvingInterval": {
+                    "type": "integer"
+                },
+                "height": {
+                    "type": "integer"
+                },
+                "issued": {
+                    "type": "integer"
+                },
+                "maxSupply": {
+                    "type": "integer"
+                },
+                "nextHalvingHeight": {
+                    "type": "integer"
+                },
+                "nextHalvingSubsidy": {
+                    "type": "integer"
+                },
+                "subsidy": {
+                    "type": "integer"
+                }
+            }
+        },
+        "representations.SweepWalletInput": {
+            "type": "object",
+            "properties": {
+                "coinSelection": {
+                    "type": "string"
+                },
+                "fee": {
+                    "type": "integer"
+                },
+                "feeRate": {
+                    "type": "number"
+                },
+                "passphrase": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "string"
+                }
+            }
+        },
+        "representations.Transaction": {
+            "type": "object",
+            "properties": {
+                "blockId": {
+                    "type": "string"
+                },
+                "fee": {
+                    "type": "integer"
+                },
+                "txnId": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "txnInputs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/representations.TxnInput"
+                    }
+                },
+                "txnOutputs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/representations.TxnOutput"
+                    }
+                }
+            }
+        },
+        "representations.TxnInput": {
+            "type": "object",
+            "properties": {
+                "currTxnId": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "inputId": {
+                    "type": "string"
+                },
+                "outIdx": {
+                    "type": "integer"
+                },
+                "prevTxnId": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "pubKey": {
+                    "description": "not hashed",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "scriptSig": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "signature": {
+                    "description": "signature of the entire transaction",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "representations.TxnOutput": {
+            "type": "object",
+            "properties": {
+                "currTxnId": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "outputId": {
+                    "type": "string"
+                },
+                "pubKeyHash": {
+                    "description": "locks the output",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "scriptPubKey": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
                 "value": {
                     "type": "integer"
                 }
             }
         },
+        "representations.UnlockWalletInput": {
+            "type": "object",
+            "required": [
+                "passphrase"
+            ],
+            "properties": {
+                "passphrase": {
+                    "type": "string"
+                },
+                "timeout": {
+                    "type": "integer"
+                }
+            }
+        },
         "representations.Wallet": {
             "type": "object",
             "properties": {
                 "address": {
                     "type": "string"
                 },
+                "derivationPath": {
+                    "type": "string"
+                },
+                "hdWalletId": {
+                    "type": "string"
+                },
                 "id": {
                     "type": "string"
                 },
+                "keyEncrypted": {
+                    "type": "boolean"
+                },
                 "privateKey": {
                     "type": "array",
                     "items": {
@@ -542,6 +2634,21 @@ const docTemplate = `{
                 },
                 "publicKey": {
                     "type": "string"
+                },
+                "redeemScript": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "retired": {
+                    "type": "boolean"
+                },
+                "sweptTo": {
+                    "type": "string"
+                },
+                "watchOnly": {
+                    "type": "boolean"
                 }
             }
         }
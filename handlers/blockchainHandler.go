@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/brucetieu/blockchain/repository"
 	reps "github.com/brucetieu/blockchain/representations"
 	"github.com/brucetieu/blockchain/services"
 	"github.com/brucetieu/blockchain/utils"
@@ -35,6 +40,7 @@ func (bch *BlockchainHandler) BlockchainHome(ctx *gin.Context) {
 // @Success      201              {object}  representations.ReadableBlock
 // @Success      200              {object}  representations.ReadableBlock
 // @Failure      404              {object}  HTTPError
+// @Failure      409              {object}  HTTPError
 // @Router       /blockchain [post]
 func (bch *BlockchainHandler) CreateBlockchain(ctx *gin.Context) {
 	log.Info("Creating Blockchain")
@@ -48,9 +54,14 @@ func (bch *BlockchainHandler) CreateBlockchain(ctx *gin.Context) {
 	}
 
 	// Create the genesis if it doesn't exist. Otherwise return a message that blockchain already exists
-	decodedGenesis, exists, err := bch.blockchainService.CreateBlockchain(input.To)
+	decodedGenesis, exists, err := bch.blockchainService.CreateBlockchain(ctx.Request.Context(), input.To)
 	if err != nil {
 		log.WithField("error", err.Error()).Error("Error creating blockchain")
+		// Another genesis block was added at the same time
+		if errors.Is(err, repository.ErrChainTipMoved) {
+			NewError(ctx, http.StatusConflict, err)
+			return
+		}
 		NewError(ctx, http.StatusNotFound, err)
 		return
 	}
@@ -65,49 +76,52 @@ func (bch *BlockchainHandler) CreateBlockchain(ctx *gin.Context) {
 	}
 }
 
-// AddToBlockchain ... Mine or add a block to the blockchain
-// @Summary      Add a block
-// @Description  Add a block to the end of the blockchain
-// @Tags         Blocks
-// @Param        BlockInput  body      representations.CreateBlockInput  true  "Mine block"
-// @Success      201         {object}  representations.ReadableBlock
-// @Failure      400         {object}  HTTPError
-// @Failure      500         {object}  HTTPError
-// @Router       /blockchain/block [post]
-func (bch *BlockchainHandler) AddToBlockchain(ctx *gin.Context) {
-	// Validate input
-	var input reps.CreateBlockInput
-	if err := ctx.ShouldBindJSON(&input); err != nil {
-		NewError(ctx, http.StatusBadRequest, err)
-		return
-	}
-
-	log.Info("Adding Block to blockchain: ", utils.Pretty(input))
-
-	// Create block and persist to db
-	newBlock, err := bch.blockchainService.AddToBlockChain(input.From, input.To, input.Amount)
-	if err != nil {
-		log.WithField("error", err.Error()).Error("Error adding block")
-		NewError(ctx, http.StatusInternalServerError, err)
-		return
-	}
-
-	// Format return data to be readable
-	data := bch.assemblerService.ToReadableBlock(newBlock)
-
-	ctx.JSON(http.StatusCreated, gin.H{"block": data})
-}
-
 // GetBlockchain ... Print out all blocks in blockchain
 // @Summary      Get all blocks
-// @Description  Get all blocks on the blockchain
+// @Description  Get all blocks on the blockchain, or only the blocks in a range of heights
 // @Tags         Blocks
-// @Success      200  {array}   representations.ReadableBlock
-// @Failure      500  {object}  HTTPError
+// @Param        from  query     int  false  "Lowest block height to return"
+// @Param        to    query     int  false  "Highest block height to return"
+// @Success      200   {array}   representations.ReadableBlock
+// @Failure      400   {object}  HTTPError
+// @Failure      500   {object}  HTTPError
 // @Router       /blockchain [get]
 func (bch *BlockchainHandler) GetBlockchain(ctx *gin.Context) {
-	log.Info("Printing out the Blockchain")
-	blockchain, err := bch.blockchainService.GetBlockchain()
+	fromParam, hasFrom := ctx.GetQuery("from")
+	toParam, hasTo := ctx.GetQuery("to")
+
+	var blockchain []reps.Block
+	var err error
+
+	if hasFrom || hasTo {
+		from := int64(0)
+		to := int64(math.MaxInt64)
+
+		if hasFrom {
+			if from, err = strconv.ParseInt(fromParam, 10, 64); err != nil {
+				NewError(ctx, http.StatusBadRequest, fmt.Errorf("invalid from height: %s", fromParam))
+				return
+			}
+		}
+		if hasTo {
+			if to, err = strconv.ParseInt(toParam, 10, 64); err != nil {
+				NewError(ctx, http.StatusBadRequest, fmt.Errorf("invalid to height: %s", toParam))
+				return
+			}
+		}
+
+		log.Infof("Printing out blocks from height %d to %d", from, to)
+		blockchain, err = bch.blockchainService.GetBlocksByHeight(from, to)
+		if err != nil {
+			log.WithField("error", err.Error()).Error("Error getting blocks by height")
+			NewError(ctx, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		log.Info("Printing out the Blockchain")
+		blockchain, err = bch.blockchainService.GetBlockchain()
+	}
+
 	if err != nil {
 		log.WithField("error", err.Error()).Error("Error getting blockchain")
 		NewError(ctx, http.StatusInternalServerError, err)
@@ -163,6 +177,34 @@ func (bch *BlockchainHandler) GetBlock(ctx *gin.Context) {
 	}
 }
 
+// GetBlockByHeight ... Get block by height
+// @Summary      Get a block by height
+// @Description  Get the block at a given height on the blockchain. The genesis block is at height 0
+// @Tags         Blocks
+// @Param        height  path      int  true  "Block height"
+// @Success      200     {object}  representations.ReadableBlock
+// @Failure      400     {object}  HTTPError
+// @Failure      404     {object}  HTTPError
+// @Router       /blockchain/block/height/{height} [get]
+func (bch *BlockchainHandler) GetBlockByHeight(ctx *gin.Context) {
+	heightParam := ctx.Param("height")
+	log.Info("Getting block with height: ", heightParam)
+
+	height, err := strconv.ParseInt(heightParam, 10, 64)
+	if err != nil {
+		NewError(ctx, http.StatusBadRequest, fmt.Errorf("invalid height: %s", heightParam))
+		return
+	}
+
+	block, err := bch.blockchainService.GetBlockByHeight(height)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error getting block by height")
+		NewError(ctx, http.StatusNotFound, err)
+	} else {
+		ctx.JSON(http.StatusOK, gin.H{"block": bch.assemblerService.ToReadableBlock(block)})
+	}
+}
+
 // GetLastBlock ... Get last block in blockchain. If it's a genesis, it will return it.
 // @Summary      Get the last block
 // @Description  Get the last block on the blockchain
@@ -181,3 +223,32 @@ func (bch *BlockchainHandler) GetLastBlock(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gin.H{"block": bch.assemblerService.ToReadableBlock(lastBlock)})
 	}
 }
+
+// GetChainTips ... Get the head of every known branch
+// @Summary      Get chain tips
+// @Description  Get the head of every known branch with its cumulative work and status (active, valid-fork or invalid)
+// @Tags         Blockchain
+// @Success      200  {array}   representations.ChainTip
+// @Failure      500  {object}  HTTPError
+// @Router       /blockchain/tips [get]
+func (bch *BlockchainHandler) GetChainTips(ctx *gin.Context) {
+	log.Info("Getting chain tips...")
+
+	tips, err := bch.blockchainService.GetChainTips()
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error getting chain tips")
+		NewError(ctx, http.StatusInternalServerError, err)
+	} else {
+		ctx.JSON(http.StatusOK, gin.H{"tips": tips})
+	}
+}
+
+// GetMiningStats ... Get the hash rate of the miner
+// @Summary      Get mining stats
+// @Description  Get the hashes per second of the last block mined and the average over every block mined since the app started
+// @Tags         Blockchain
+// @Success      200  {object}  representations.MiningStats
+// @Router       /blockchain/mining/stats [get]
+func (bch *BlockchainHandler) GetMiningStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"stats": bch.blockchainService.GetMiningStats()})
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/brucetieu/blockchain/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type DifficultyHandler struct {
+	difficultyService services.DifficultyService
+}
+
+func NewDifficultyHandler(difficultyService services.DifficultyService) *DifficultyHandler {
+	return &DifficultyHandler{
+		difficultyService: difficultyService,
+	}
+}
+
+// GetDifficulty ... Get the current proof of work difficulty
+// @Summary      Get the difficulty
+// @Description  Get the difficulty of the last block, when difficulty is next recalculated, and what it would be recalculated to at the current block rate
+// @Tags         Blockchain
+// @Success      200  {object}  representations.DifficultyInfo
+// @Failure      404  {object}  HTTPError
+// @Router       /blockchain/difficulty [get]
+func (dh *DifficultyHandler) GetDifficulty(ctx *gin.Context) {
+	log.Info("Getting difficulty...")
+
+	difficulty, err := dh.difficultyService.GetDifficulty()
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error getting difficulty")
+		NewError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"difficulty": difficulty})
+}
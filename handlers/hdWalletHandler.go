@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Chains an HD wallet address can be derived on
+const (
+	receiveChain = "receive"
+	changeChain  = "change"
+)
+
+type HDWalletHandler struct {
+	hdWalletService services.HDWalletService
+	walletService   services.WalletService
+}
+
+func NewHDWalletHandler(hdWalletService services.HDWalletService, walletService services.WalletService) *HDWalletHandler {
+	return &HDWalletHandler{
+		hdWalletService: hdWalletService,
+		walletService:   walletService,
+	}
+}
+
+// CreateHDWallet ... Create an HD wallet from a new mnemonic
+// @Summary      Create an HD wallet
+// @Description  Create a wallet whose keys are all derived from a new 24 word BIP39 mnemonic. The mnemonic is only in this response, write it down to be able to restore the wallet. The seed is stored encrypted under the passphrase
+// @Tags         HD wallets
+// @Param        CreateHDWalletInput  body      representations.CreateHDWalletInput  true  "Passphrase"
+// @Success      201                  {object}  representations.ReadableHDWallet
+// @Failure      400                  {object}  HTTPError
+// @Router       /blockchain/hdwallets [post]
+func (hh *HDWalletHandler) CreateHDWallet(ctx *gin.Context) {
+	var input reps.CreateHDWalletInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	hdWallet, err := hh.hdWalletService.CreateHDWallet(input.Passphrase)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error creating HD wallet")
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"hdWallet": hdWallet})
+}
+
+// RestoreHDWallet ... Restore an HD wallet from its mnemonic
+// @Summary      Restore an HD wallet
+// @Description  Restore an HD wallet and its addresses from its mnemonic. Each chain is scanned until 20 addresses in a row have never been paid to, and every address up to the last used one is restored along with its balance. The seed is stored encrypted under the passphrase, replacing the old one if the wallet already exists
+// @Tags         HD wallets
+// @Param        RestoreHDWalletInput  body      representations.RestoreHDWalletInput  true  "Mnemonic and passphrase"
+// @Success      200                   {object}  representations.ReadableHDWallet
+// @Failure      400                   {object}  HTTPError
+// @Router       /blockchain/hdwallets/restore [post]
+func (hh *HDWalletHandler) RestoreHDWallet(ctx *gin.Context) {
+	var input reps.RestoreHDWalletInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	hdWallet, err := hh.hdWalletService.RestoreHDWallet(input.Mnemonic, input.Passphrase)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error restoring HD wallet")
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"hdWallet": hdWallet})
+}
+
+// GetHDWallet ... Get an HD wallet with its addresses
+// @Summary      Get an HD wallet
+// @Description  Get an HD wallet with the addresses derived so far, their balances and the balance of the whole wallet
+// @Tags         HD wallets
+// @Param        hdWalletId  path      string  true  "HD wallet id"
+// @Success      200         {object}  representations.ReadableHDWallet
+// @Failure      404         {object}  HTTPError
+// @Router       /blockchain/hdwallets/{hdWalletId} [get]
+func (hh *HDWalletHandler) GetHDWallet(ctx *gin.Context) {
+	hdWallet, err := hh.hdWalletService.GetHDWallet(ctx.Param("hdWalletId"))
+	if err != nil {
+		NewError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"hdWallet": hdWallet})
+}
+
+// DeriveAddress ... Derive the next address of an HD wallet
+// @Summary      Derive an HD wallet address
+// @Description  Derive the next unused address of an HD wallet on the receive or change chain. It is saved as a wallet, so it can be spent from like any other
+// @Tags         HD wallets
+// @Param        hdWalletId  path      string  true  "HD wallet id"
+// @Param        chain       path      string  true  "receive or change"
+// @Success      201         {object}  representations.HDAddress
+// @Failure      400         {object}  HTTPError
+// @Failure      404         {object}  HTTPError
+// @Router       /blockchain/hdwallets/{hdWalletId}/addresses/{chain} [post]
+func (hh *HDWalletHandler) DeriveAddress(ctx *gin.Context) {
+	chain := ctx.Param("chain")
+	if chain != receiveChain && chain != changeChain {
+		NewError(ctx, http.StatusBadRequest, fmt.Errorf("chain %s is not %s or %s", chain, receiveChain, changeChain))
+		return
+	}
+
+	address, err := hh.hdWalletService.DeriveAddress(ctx.Param("hdWalletId"), chain == changeChain)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error deriving HD wallet address")
+		NewError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"address": address})
+}
+
+// UnlockHDWallet ... Unlock an HD wallet so its addresses can sign
+// @Summary      Unlock an HD wallet
+// @Description  Decrypt the seed of an HD wallet with its passphrase and keep it in memory for timeout seconds (5 minutes by default, at most an hour), so transfers from any of its addresses can be signed
+// @Tags         HD wallets
+// @Param        hdWalletId         path      string                             true  "HD wallet id"
+// @Param        UnlockWalletInput  body      representations.UnlockWalletInput  true  "Passphrase and timeout"
+// @Success      200                {string}  string                             "unlockedUntil"
+// @Failure      400                {object}  HTTPError
+// @Failure      401                {object}  HTTPError
+// @Router       /blockchain/hdwallets/{hdWalletId}/unlock [post]
+func (hh *HDWalletHandler) UnlockHDWallet(ctx *gin.Context) {
+	unlockWallet(ctx, hh.walletService, ctx.Param("hdWalletId"))
+}
+
+// LockHDWallet ... Lock an HD wallet before its unlock times out
+// @Summary      Lock an HD wallet
+// @Description  Forget the decrypted seed of an HD wallet, so none of its addresses can sign until it is unlocked again
+// @Tags         HD wallets
+// @Param        hdWalletId  path  string  true  "HD wallet id"
+// @Success      204
+// @Failure      404  {object}  HTTPError
+// @Router       /blockchain/hdwallets/{hdWalletId}/lock [post]
+func (hh *HDWalletHandler) LockHDWallet(ctx *gin.Context) {
+	lockWallet(ctx, hh.walletService, ctx.Param("hdWalletId"))
+}
+
+// ChangeHDWalletPassphrase ... Encrypt the seed of an HD wallet under a new passphrase
+// @Summary      Change the passphrase of an HD wallet
+// @Description  Encrypt the seed of an HD wallet under a new passphrase. The HD wallet is locked
+// @Tags         HD wallets
+// @Param        hdWalletId             path  string                                 true  "HD wallet id"
+// @Param        ChangePassphraseInput  body  representations.ChangePassphraseInput  true  "Current and new passphrase"
+// @Success      204
+// @Failure      400  {object}  HTTPError
+// @Failure      401  {object}  HTTPError
+// @Router       /blockchain/hdwallets/{hdWalletId}/passphrase [put]
+func (hh *HDWalletHandler) ChangeHDWalletPassphrase(ctx *gin.Context) {
+	changePassphrase(ctx, hh.walletService, ctx.Param("hdWalletId"))
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/services"
+	"github.com/brucetieu/blockchain/utils"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type MempoolHandler struct {
+	mempoolService   services.MempoolService
+	walletService    services.WalletService
+	assemblerService services.TxnAssemblerFac
+}
+
+func NewMempoolHandler(mempoolService services.MempoolService, walletService services.WalletService) *MempoolHandler {
+	return &MempoolHandler{
+		mempoolService:   mempoolService,
+		walletService:    walletService,
+		assemblerService: services.TxnAssembler,
+	}
+}
+
+// CreateTransaction ... Submit a transaction to the mempool
+// @Summary      Submit a transaction
+// @Description  Create and sign a transfer, then park it in the mempool until the next block is mined. Send to and amount to pay one address, or outputs to pay several addresses in one transaction. Optionally pay the miner a fixed fee, or a fee rate in coins per byte. Warnings lists recipients coins may be lost to: retired wallets and addresses that aren't wallets in the app
+// @Tags         Transactions
+// @Param        TransactionInput  body      representations.CreateTransactionInput  true  "Create transaction"
+// @Success      201               {object}  representations.ReadableTransaction
+// @Failure      400               {object}  HTTPError
+// @Failure      403               {object}  HTTPError
+// @Router       /blockchain/transactions [post]
+func (mh *MempoolHandler) CreateTransaction(ctx *gin.Context) {
+	// Validate input
+	var input reps.CreateTransactionInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	payments, err := toPayments(input.To, input.Amount, input.Outputs)
+	if err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	log.Info("Submitting transaction to mempool: ", utils.Pretty(input))
+
+	txn, err := mh.mempoolService.AddTransaction(input.From, payments, input.TransferOptions)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error submitting transaction")
+		if errors.Is(err, services.ErrWalletLocked) {
+			NewError(ctx, http.StatusForbidden, err)
+		} else {
+			NewError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"transaction": mh.assemblerService.ToReadableTransaction(txn),
+		"warnings":    addressWarnings(mh.walletService, paymentAddresses(payments)...),
+	})
+}
+
+// SubmitRawTransaction ... Submit a transaction signed outside the app
+// @Summary      Submit a signed transaction
+// @Description  Submit a fully signed transaction built by a client, either as hex of its serialized form or as JSON. It is verified, checked for spent outputs and double spends, then parked in the mempool until the next block is mined. The app doesn't need a wallet for the sender
+// @Tags         Transactions
+// @Param        RawTransactionInput  body      representations.RawTransactionInput  true  "Signed transaction"
+// @Success      201                  {object}  representations.ReadableTransaction
+// @Failure      400                  {object}  HTTPError
+// @Router       /blockchain/transactions/raw [post]
+func (mh *MempoolHandler) SubmitRawTransaction(ctx *gin.Context) {
+	var input reps.RawTransactionInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	var txn reps.Transaction
+	switch {
+	case input.Hex != "" && input.Transaction != nil:
+		NewError(ctx, http.StatusBadRequest, errors.New("send either hex or transaction, not both"))
+		return
+	case input.Hex != "":
+		txnBytes, err := hex.DecodeString(input.Hex)
+		if err != nil {
+			NewError(ctx, http.StatusBadRequest, fmt.Errorf("%s, hex is not valid", err.Error()))
+			return
+		}
+		txn, err = mh.assemblerService.ToTxnStructure(txnBytes)
+		if err != nil {
+			NewError(ctx, http.StatusBadRequest, fmt.Errorf("%s, hex is not a serialized transaction", err.Error()))
+			return
+		}
+	case input.Transaction != nil:
+		txn = *input.Transaction
+	default:
+		NewError(ctx, http.StatusBadRequest, errors.New("hex or transaction is required"))
+		return
+	}
+
+	log.Info("Submitting raw transaction to mempool: ", hex.EncodeToString(txn.ID))
+
+	txn, err := mh.mempoolService.AddRawTransaction(txn)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error submitting raw transaction")
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"transaction": mh.assemblerService.ToReadableTransaction(txn)})
+}
+
+// SweepWallet ... Sweep a wallet whose key may have leaked
+// @Summary      Sweep a wallet
+// @Description  Move every unspent output of a wallet to another address in a single transaction, parked in the mempool until the next block is mined. Leave out to and send a passphrase to sweep into a new wallet with its key encrypted under it. The wallet is then retired: nothing can be sent from it other than another sweep, and transfers paying it come back with a warning. Optionally pay the miner a fixed fee, or a fee rate in coins per byte
+// @Tags         Wallets
+// @Param        address           path      string                            true  "Wallet address"
+// @Param        SweepWalletInput  body      representations.SweepWalletInput  true  "Where to sweep to"
+// @Success      201               {object}  representations.ReadableTransaction
+// @Failure      400               {object}  HTTPError
+// @Failure      403               {object}  HTTPError
+// @Router       /blockchain/wallets/{address}/sweep [post]
+func (mh *MempoolHandler) SweepWallet(ctx *gin.Context) {
+	var input reps.SweepWalletInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	address := ctx.Param("address")
+	log.WithFields(log.Fields{"address": address, "to": input.To}).Info("Sweeping wallet")
+
+	sweptTo, txn, err := mh.mempoolService.SweepWallet(address, input.To, input.Passphrase, input.TransferOptions)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error sweeping wallet")
+		if errors.Is(err, services.ErrWalletLocked) {
+			NewError(ctx, http.StatusForbidden, err)
+		} else {
+			NewError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"sweptTo":     sweptTo,
+		"transaction": mh.assemblerService.ToReadableTransaction(txn),
+		"warnings":    addressWarnings(mh.walletService, sweptTo),
+	})
+}
+
+// GetPendingTransactions ... Get all transactions waiting to be mined
+// @Summary      Get pending transactions
+// @Description  Get all transactions in the mempool that are waiting to be mined
+// @Tags         Transactions
+// @Success      200  {array}  representations.ReadableTransaction
+// @Router       /blockchain/transactions/pending [get]
+func (mh *MempoolHandler) GetPendingTransactions(ctx *gin.Context) {
+	log.Info("GetPendingTransactions called")
+	txns := mh.mempoolService.GetPendingTransactions()
+
+	data := make([]reps.ReadableTransaction, 0)
+	for _, txn := range txns {
+		data = append(data, mh.assemblerService.ToReadableTransaction(txn))
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"transactions": data})
+}
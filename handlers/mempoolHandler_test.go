@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/brucetieu/blockchain/keycrypt"
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPassphrase = "correct horse battery"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	gin.SetMode(gin.TestMode)
+
+	services.BlockAssembler = services.NewBlockAssemblerFac()
+	services.TxnAssembler = services.NewTxnAssemblerFac()
+	services.WalletAssembler = services.NewWalletAssemblerFac()
+
+	// Keys are encrypted on every wallet created, keep it cheap
+	keycrypt.Argon2Memory, keycrypt.Argon2Time, keycrypt.Argon2Threads = 64, 1, 1
+
+	os.Exit(m.Run())
+}
+
+func TestCreateTransactionWarnsAboutRecipients(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	walletService := services.NewWalletService(repo)
+	mempoolIndex := services.NewMempoolIndex()
+	hdWalletService := services.NewHDWalletService(repo, walletService, mempoolIndex)
+	transactionService := services.NewTransactionService(repo, walletService, mempoolIndex,
+		services.NewDBSigner(walletService), hdWalletService)
+	mempoolService := services.NewMempoolService(transactionService, walletService, mempoolIndex)
+	difficultyService := services.NewDifficultyService(repo)
+	validationService := services.NewValidationService(repo, transactionService, difficultyService)
+	blockService := services.NewBlockService(repo, validationService, mempoolService, difficultyService)
+	blockchainService := services.NewBlockchainService(repo, blockService, transactionService, walletService, mempoolService)
+
+	newWallet := func() string {
+		wallet, err := walletService.CreateWallet(testPassphrase)
+		require.NoError(t, err)
+		_, err = walletService.UnlockWallet(wallet.Address, testPassphrase, time.Hour)
+		require.NoError(t, err)
+		return wallet.Address
+	}
+	miner, retired, safe := newWallet(), newWallet(), newWallet()
+	_, _, err := blockchainService.CreateBlockchain(context.Background(), miner)
+	require.NoError(t, err)
+	require.NoError(t, walletService.RetireWallet(retired, safe))
+	_, pubKey := walletService.CreateKeyPair()
+	foreign, err := walletService.CreateAddress(pubKey)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/transactions", NewMempoolHandler(mempoolService, walletService).CreateTransaction)
+	createTransaction := func(outputs []reps.Payment) []string {
+		body, err := json.Marshal(reps.CreateTransactionInput{From: miner, Outputs: outputs})
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/transactions", bytes.NewReader(body)))
+		require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+
+		var response struct {
+			Warnings []string `json:"warnings"`
+		}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		require.NotNil(t, response.Warnings)
+		return response.Warnings
+	}
+
+	warnings := createTransaction([]reps.Payment{{To: safe, Amount: 1}, {To: retired, Amount: 1}, {To: string(foreign), Amount: 1}})
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "retired wallet")
+	assert.Contains(t, warnings[0], safe)
+	assert.Contains(t, warnings[1], "not a wallet in the app")
+
+	// The first transfer spent the only output, mine it before paying again
+	_, err = blockchainService.MineBlock(context.Background(), miner, "")
+	require.NoError(t, err)
+	assert.Empty(t, createTransaction([]reps.Payment{{To: safe, Amount: 1}}))
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/services"
+	"github.com/brucetieu/blockchain/utils"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type MiningJobHandler struct {
+	miningJobService services.MiningJobService
+	walletService    services.WalletService
+}
+
+func NewMiningJobHandler(miningJobService services.MiningJobService, walletService services.WalletService) *MiningJobHandler {
+	return &MiningJobHandler{
+		miningJobService: miningJobService,
+		walletService:    walletService,
+	}
+}
+
+// AddToBlockchain ... Mine or add a block to the blockchain
+// @Summary      Add a block
+// @Description  Queue a job to mine a block on the end of the blockchain and return it straight away. Send from, to and amount to mine a single transfer, from and outputs to pay several addresses in one transaction, or only miner to mine all pending transactions. Poll the job to find out when the block is mined. Warnings lists addresses paid by the block that coins may be lost to: retired wallets and addresses that aren't wallets in the app
+// @Tags         Blocks
+// @Param        BlockInput  body      representations.CreateBlockInput  true  "Mine block"
+// @Success      202         {object}  representations.MiningJob
+// @Failure      400         {object}  HTTPError
+// @Failure      403         {object}  HTTPError
+// @Failure      503         {object}  HTTPError
+// @Router       /blockchain/block [post]
+func (mjh *MiningJobHandler) AddToBlockchain(ctx *gin.Context) {
+	// Validate input
+	var input reps.CreateBlockInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	var job reps.MiningJob
+	var paidTo []string
+	var err error
+
+	if input.To == "" && input.Amount == 0 && len(input.Outputs) == 0 {
+		// Mine all pending transactions
+		miner := input.Miner
+		if miner == "" {
+			miner = input.From
+		}
+		if miner == "" {
+			NewError(ctx, http.StatusBadRequest, errors.New("miner is required when mining pending transactions"))
+			return
+		}
+
+		log.Info("Queueing pending transactions for miner: ", miner)
+		job, err = mjh.miningJobService.SubmitMiningJob(miner, input.Parent)
+		paidTo = []string{miner}
+	} else {
+		if input.Parent != "" {
+			NewError(ctx, http.StatusBadRequest, errors.New("parent can only be given when mining pending transactions"))
+			return
+		}
+		if input.From == "" {
+			NewError(ctx, http.StatusBadRequest, errors.New("from is required when mining a transfer"))
+			return
+		}
+		payments, paymentsErr := toPayments(input.To, input.Amount, input.Outputs)
+		if paymentsErr != nil {
+			NewError(ctx, http.StatusBadRequest, paymentsErr)
+			return
+		}
+
+		log.Info("Queueing block for transfer: ", utils.Pretty(input))
+		job, err = mjh.miningJobService.SubmitTransferJob(input.From, payments, input.TransferOptions)
+		paidTo = paymentAddresses(payments)
+	}
+
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error queueing mining job")
+		switch {
+		case errors.Is(err, services.ErrMiningQueueFull):
+			NewError(ctx, http.StatusServiceUnavailable, err)
+		case errors.Is(err, services.ErrWalletLocked):
+			NewError(ctx, http.StatusForbidden, err)
+		default:
+			NewError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	ctx.Header("Location", "/bitcoin/blockchain/mining/jobs/"+job.ID)
+	ctx.JSON(http.StatusAccepted, gin.H{"job": job, "warnings": addressWarnings(mjh.walletService, paidTo...)})
+}
+
+// GetMiningJob ... Get a mining job
+// @Summary      Get a mining job
+// @Description  Get the status of a mining job, how many nounces it has tried, how long it has been mining, and the id of the block once mined. Responds with 409 if the block was dropped because another block extended the tip first
+// @Tags         Blocks
+// @Param        jobId  path      string  true  "Mining job id"
+// @Success      200    {object}  representations.MiningJob
+// @Failure      404    {object}  HTTPError
+// @Failure      409    {object}  representations.MiningJob
+// @Router       /blockchain/mining/jobs/{jobId} [get]
+func (mjh *MiningJobHandler) GetMiningJob(ctx *gin.Context) {
+	jobId := ctx.Param("jobId")
+
+	job, err := mjh.miningJobService.GetMiningJob(jobId)
+	if err != nil {
+		NewError(ctx, http.StatusNotFound, err)
+	} else if job.Status == reps.MiningJobTipMoved {
+		// Same as adding a block when another block got to the tip first
+		ctx.JSON(http.StatusConflict, gin.H{"job": job})
+	} else {
+		ctx.JSON(http.StatusOK, gin.H{"job": job})
+	}
+}
+
+// CancelMiningJob ... Cancel a mining job
+// @Summary      Cancel a mining job
+// @Description  Stop a mining job that is queued or mining. Transactions it would have mined stay in the mempool
+// @Tags         Blocks
+// @Param        jobId  path      string  true  "Mining job id"
+// @Success      200    {object}  representations.MiningJob
+// @Failure      404    {object}  HTTPError
+// @Failure      409    {object}  HTTPError
+// @Router       /blockchain/mining/jobs/{jobId} [delete]
+func (mjh *MiningJobHandler) CancelMiningJob(ctx *gin.Context) {
+	jobId := ctx.Param("jobId")
+
+	job, err := mjh.miningJobService.CancelMiningJob(jobId)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error cancelling mining job")
+		if errors.Is(err, services.ErrMiningJobFinished) {
+			NewError(ctx, http.StatusConflict, err)
+		} else {
+			NewError(ctx, http.StatusNotFound, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"job": job})
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/services"
+	"github.com/brucetieu/blockchain/utils"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type MultisigHandler struct {
+	multisigService services.MultisigService
+	walletService   services.WalletService
+}
+
+func NewMultisigHandler(multisigService services.MultisigService, walletService services.WalletService) *MultisigHandler {
+	return &MultisigHandler{
+		multisigService: multisigService,
+		walletService:   walletService,
+	}
+}
+
+// CreateMultisigWallet ... Create an M-of-N multisig wallet
+// @Summary      Create a multisig wallet
+// @Description  Create a wallet whose spends need signatures from threshold of the cosigner wallets. Coins sent to its address are locked to a P2SH script
+// @Tags         Multisig
+// @Param        MultisigWalletInput  body      representations.CreateMultisigWalletInput  true  "Create multisig wallet"
+// @Success      201                  {object}  representations.MultisigWallet
+// @Failure      400                  {object}  HTTPError
+// @Router       /blockchain/multisig/wallets [post]
+func (msh *MultisigHandler) CreateMultisigWallet(ctx *gin.Context) {
+	var input reps.CreateMultisigWalletInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	log.Info("Creating multisig wallet: ", utils.Pretty(input))
+
+	wallet, err := msh.multisigService.CreateMultisigWallet(input.Cosigners, input.Threshold)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error creating multisig wallet")
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"wallet": wallet})
+}
+
+// GetMultisigWallet ... Get a multisig wallet
+// @Summary      Get a multisig wallet
+// @Description  Get the threshold, cosigners and redeem script of a multisig wallet
+// @Tags         Multisig
+// @Param        address  path      string  true  "Multisig wallet address"
+// @Success      200      {object}  representations.MultisigWallet
+// @Failure      404      {object}  HTTPError
+// @Router       /blockchain/multisig/wallets/{address} [get]
+func (msh *MultisigHandler) GetMultisigWallet(ctx *gin.Context) {
+	address := ctx.Param("address")
+
+	wallet, err := msh.multisigService.GetMultisigWallet(address)
+	if err != nil {
+		NewError(ctx, http.StatusNotFound, err)
+	} else {
+		ctx.JSON(http.StatusOK, gin.H{"wallet": wallet})
+	}
+}
+
+// CreateMultisigSpend ... Start a spend from a multisig wallet
+// @Summary      Start a multisig spend
+// @Description  Build a transfer from a multisig wallet, then wait for its cosigners to sign it. Takes the same payload as submitting a transaction, and warns about the same recipients
+// @Tags         Multisig
+// @Param        TransactionInput  body      representations.CreateTransactionInput  true  "Create transaction"
+// @Success      201               {object}  representations.MultisigSpend
+// @Failure      400               {object}  HTTPError
+// @Router       /blockchain/multisig/spends [post]
+func (msh *MultisigHandler) CreateMultisigSpend(ctx *gin.Context) {
+	var input reps.CreateTransactionInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	payments, err := toPayments(input.To, input.Amount, input.Outputs)
+	if err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	log.Info("Creating multisig spend: ", utils.Pretty(input))
+
+	spend, err := msh.multisigService.CreateSpend(input.From, payments, input.TransferOptions)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error creating multisig spend")
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.Header("Location", "/bitcoin/blockchain/multisig/spends/"+spend.ID)
+	ctx.JSON(http.StatusCreated, gin.H{"spend": spend, "warnings": addressWarnings(msh.walletService, paymentAddresses(payments)...)})
+}
+
+// SignMultisigSpend ... Add a cosigner's signature to a multisig spend
+// @Summary      Sign a multisig spend
+// @Description  Sign a multisig spend with one of its cosigner wallets. Once threshold cosigners have signed, the transaction is submitted to the mempool
+// @Tags         Multisig
+// @Param        spendId            path      string                                  true  "Multisig spend id"
+// @Param        SignMultisigInput  body      representations.SignMultisigSpendInput  true  "Cosigner signing the spend"
+// @Success      200                {object}  representations.MultisigSpend
+// @Failure      400                {object}  HTTPError
+// @Failure      403                {object}  HTTPError
+// @Failure      404                {object}  HTTPError
+// @Failure      409                {object}  HTTPError
+// @Router       /blockchain/multisig/spends/{spendId}/signatures [post]
+func (msh *MultisigHandler) SignMultisigSpend(ctx *gin.Context) {
+	spendId := ctx.Param("spendId")
+
+	var input reps.SignMultisigSpendInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	spend, err := msh.multisigService.SignSpend(spendId, input.Signer)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error signing multisig spend")
+		switch {
+		case errors.Is(err, services.ErrMultisigSpendNotFound):
+			NewError(ctx, http.StatusNotFound, err)
+		case errors.Is(err, services.ErrMultisigSpendComplete):
+			NewError(ctx, http.StatusConflict, err)
+		case errors.Is(err, services.ErrWalletLocked):
+			NewError(ctx, http.StatusForbidden, err)
+		default:
+			NewError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"spend": spend})
+}
+
+// GetMultisigSpend ... Get a multisig spend
+// @Summary      Get a multisig spend
+// @Description  Get a multisig spend, who has signed it so far and whether it is complete
+// @Tags         Multisig
+// @Param        spendId  path      string  true  "Multisig spend id"
+// @Success      200      {object}  representations.MultisigSpend
+// @Failure      404      {object}  HTTPError
+// @Router       /blockchain/multisig/spends/{spendId} [get]
+func (msh *MultisigHandler) GetMultisigSpend(ctx *gin.Context) {
+	spendId := ctx.Param("spendId")
+
+	spend, err := msh.multisigService.GetSpend(spendId)
+	if err != nil {
+		NewError(ctx, http.StatusNotFound, err)
+	} else {
+		ctx.JSON(http.StatusOK, gin.H{"spend": spend})
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/services"
+	"github.com/brucetieu/blockchain/utils"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type PSBTHandler struct {
+	psbtService      services.PSBTService
+	walletService    services.WalletService
+	assemblerService services.TxnAssemblerFac
+}
+
+func NewPSBTHandler(psbtService services.PSBTService, walletService services.WalletService) *PSBTHandler {
+	return &PSBTHandler{
+		psbtService:      psbtService,
+		walletService:    walletService,
+		assemblerService: services.TxnAssembler,
+	}
+}
+
+// CreatePSBT ... Create a partially signed transaction
+// @Summary      Create a PSBT
+// @Description  Build an unsigned transfer as a base64 partially signed transaction, carrying the outputs its inputs spend so it can be signed offline. Takes the same payload as submitting a transaction, and warns about the same recipients
+// @Tags         PSBT
+// @Param        TransactionInput  body      representations.CreateTransactionInput  true  "Create transaction"
+// @Success      201               {object}  representations.ReadablePSBT
+// @Failure      400               {object}  HTTPError
+// @Router       /blockchain/psbt [post]
+func (ph *PSBTHandler) CreatePSBT(ctx *gin.Context) {
+	var input reps.CreateTransactionInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	payments, err := toPayments(input.To, input.Amount, input.Outputs)
+	if err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	log.Info("Creating PSBT: ", utils.Pretty(input))
+
+	psbt, err := ph.psbtService.CreatePSBT(input.From, payments, input.TransferOptions)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error creating PSBT")
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"psbt":     ph.assemblerService.ToReadablePSBT(psbt),
+		"warnings": addressWarnings(ph.walletService, paymentAddresses(payments)...),
+	})
+}
+
+// DecodePSBT ... Show what a partially signed transaction contains
+// @Summary      Decode a PSBT
+// @Description  Show the transaction of a PSBT, how many signatures each input has and whether it is finalized
+// @Tags         PSBT
+// @Param        PSBTInput  body      representations.PSBTDocumentInput  true  "PSBT"
+// @Success      200        {object}  representations.ReadablePSBT
+// @Failure      400        {object}  HTTPError
+// @Router       /blockchain/psbt/decode [post]
+func (ph *PSBTHandler) DecodePSBT(ctx *gin.Context) {
+	psbt, ok := bindPSBT(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"psbt": ph.assemblerService.ToReadablePSBT(psbt)})
+}
+
+// SignPSBT ... Sign a partially signed transaction with a wallet's key
+// @Summary      Sign a PSBT
+// @Description  Sign every input of a PSBT that the key of the signer wallet can unlock
+// @Tags         PSBT
+// @Param        SignPSBTInput  body      representations.SignPSBTInput  true  "PSBT and signer"
+// @Success      200            {object}  representations.ReadablePSBT
+// @Failure      400            {object}  HTTPError
+// @Failure      403            {object}  HTTPError
+// @Router       /blockchain/psbt/sign [post]
+func (ph *PSBTHandler) SignPSBT(ctx *gin.Context) {
+	var input reps.SignPSBTInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	psbt, err := services.DecodePSBT(input.PSBT)
+	if err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	psbt, err = ph.psbtService.SignPSBTWithWallet(psbt, input.Signer)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error signing PSBT")
+		if errors.Is(err, services.ErrWalletLocked) {
+			NewError(ctx, http.StatusForbidden, err)
+		} else {
+			NewError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"psbt": ph.assemblerService.ToReadablePSBT(psbt)})
+}
+
+// CombinePSBTs ... Merge the signatures of several copies of a partially signed transaction
+// @Summary      Combine PSBTs
+// @Description  Merge copies of the same PSBT signed by different signers into one
+// @Tags         PSBT
+// @Param        CombinePSBTsInput  body      representations.CombinePSBTsInput  true  "PSBTs"
+// @Success      200                {object}  representations.ReadablePSBT
+// @Failure      400                {object}  HTTPError
+// @Router       /blockchain/psbt/combine [post]
+func (ph *PSBTHandler) CombinePSBTs(ctx *gin.Context) {
+	var input reps.CombinePSBTsInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	psbts := make([]reps.PSBT, 0, len(input.PSBTs))
+	for _, encoded := range input.PSBTs {
+		psbt, err := services.DecodePSBT(encoded)
+		if err != nil {
+			NewError(ctx, http.StatusBadRequest, err)
+			return
+		}
+		psbts = append(psbts, psbt)
+	}
+
+	psbt, err := ph.psbtService.CombinePSBTs(psbts)
+	if err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"psbt": ph.assemblerService.ToReadablePSBT(psbt)})
+}
+
+// FinalizePSBT ... Build the unlocking scripts of a partially signed transaction
+// @Summary      Finalize a PSBT
+// @Description  Turn the signatures of each input into its unlocking script and check it unlocks the output the input spends. Fails if an input doesn't have enough signatures
+// @Tags         PSBT
+// @Param        PSBTInput  body      representations.PSBTDocumentInput  true  "PSBT"
+// @Success      200        {object}  representations.ReadablePSBT
+// @Failure      400        {object}  HTTPError
+// @Router       /blockchain/psbt/finalize [post]
+func (ph *PSBTHandler) FinalizePSBT(ctx *gin.Context) {
+	psbt, ok := bindPSBT(ctx)
+	if !ok {
+		return
+	}
+
+	psbt, err := ph.psbtService.FinalizePSBT(psbt)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error finalizing PSBT")
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"psbt": ph.assemblerService.ToReadablePSBT(psbt)})
+}
+
+// BroadcastPSBT ... Submit the transaction of a finalized PSBT to the mempool
+// @Summary      Broadcast a PSBT
+// @Description  Submit the signed transaction of a finalized PSBT to the mempool, where it waits to be mined
+// @Tags         PSBT
+// @Param        PSBTInput  body      representations.PSBTDocumentInput  true  "PSBT"
+// @Success      201        {object}  representations.ReadableTransaction
+// @Failure      400        {object}  HTTPError
+// @Router       /blockchain/psbt/broadcast [post]
+func (ph *PSBTHandler) BroadcastPSBT(ctx *gin.Context) {
+	psbt, ok := bindPSBT(ctx)
+	if !ok {
+		return
+	}
+
+	txn, err := ph.psbtService.BroadcastPSBT(psbt)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error broadcasting PSBT")
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"transaction": ph.assemblerService.ToReadableTransaction(txn)})
+}
+
+// Bind and decode a payload holding a single PSBT, responding with an error if it isn't valid
+func bindPSBT(ctx *gin.Context) (reps.PSBT, bool) {
+	var input reps.PSBTDocumentInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return reps.PSBT{}, false
+	}
+
+	psbt, err := services.DecodePSBT(input.PSBT)
+	if err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return reps.PSBT{}, false
+	}
+
+	return psbt, true
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/brucetieu/blockchain/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type SupplyHandler struct {
+	supplyService services.SupplyService
+}
+
+func NewSupplyHandler(supplyService services.SupplyService) *SupplyHandler {
+	return &SupplyHandler{
+		supplyService: supplyService,
+	}
+}
+
+// GetSupply ... Get the coin supply
+// @Summary      Get the coin supply
+// @Description  Get the coins in circulation, the most there will ever be, the current block subsidy and how many blocks until it halves
+// @Tags         Blockchain
+// @Success      200  {object}  representations.SupplyInfo
+// @Failure      404  {object}  HTTPError
+// @Router       /blockchain/supply [get]
+func (sh *SupplyHandler) GetSupply(ctx *gin.Context) {
+	log.Info("Getting supply...")
+
+	supply, err := sh.supplyService.GetSupply()
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error getting supply")
+		NewError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"supply": supply})
+}
@@ -80,7 +80,7 @@ func (th *TransactionHandler) GetBalances(ctx *gin.Context) {
 
 // GetBalances ... Get the coin balance for a single address on the blockchain
 // @Summary      Get coin balance
-// @Description  Get the coin balance for an address on the blockchain
+// @Description  Get the coin balance for an address on the blockchain, and the group balance of every address of its HD wallet together, change addresses included. An address outside an HD wallet is a group of its own
 // @Tags         Wallets
 // @Success      200  {integer}  integer
 // @Failure      404  {object}   HTTPError
@@ -93,7 +93,36 @@ func (th *TransactionHandler) GetBalance(ctx *gin.Context) {
 	if err != nil {
 		log.Error("error getting transaction: ", err.Error())
 		NewError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	groupBalance, err := th.transactionService.GetGroupBalance(address)
+	if err != nil {
+		log.Error("error getting group balance: ", err.Error())
+		NewError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"balance": balance, "groupBalance": groupBalance})
+}
+
+// GetAddressTransactions ... Get the transaction history of an address
+// @Summary      Get transaction history
+// @Description  Get the transactions on the blockchain that pay to an address or spend from it
+// @Tags         Wallets
+// @Param        address  path      string  true  "Wallet address"
+// @Success      200      {array}   representations.ReadableTransaction
+// @Failure      404      {object}  HTTPError
+// @Router       /blockchain/wallets/{address}/transactions [get]
+func (th *TransactionHandler) GetAddressTransactions(ctx *gin.Context) {
+	address := ctx.Param("address")
+	log.Info("GetAddressTransactions called with address: ", address)
+
+	txns, err := th.transactionService.GetAddressTransactions(address)
+	if err != nil {
+		log.Error("error getting transactions: ", err.Error())
+		NewError(ctx, http.StatusNotFound, err)
 	} else {
-		ctx.JSON(http.StatusOK, gin.H{"balance": balance})
+		ctx.JSON(http.StatusOK, gin.H{"transactions": th.assemblerService.ToReadableTransactions(txns)})
 	}
 }
@@ -1,6 +1,13 @@
 package handlers
 
-import "github.com/gin-gonic/gin"
+import (
+	"errors"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
 
 // NewError example
 func NewError(ctx *gin.Context, status int, err error) {
@@ -16,3 +23,51 @@ type HTTPError struct {
 	Code    int    `json:"code" example:"400"`
 	Message string `json:"message" example:"status bad request"`
 }
+
+// Recipients of a transfer, given either as a single to and amount or as a list of outputs
+func toPayments(to string, amount int, outputs []reps.Payment) ([]reps.Payment, error) {
+	if len(outputs) > 0 {
+		if to != "" || amount != 0 {
+			return nil, errors.New("send either to and amount, or outputs, not both")
+		}
+		return outputs, nil
+	}
+
+	if to == "" || amount == 0 {
+		return nil, errors.New("to and amount, or outputs, are required")
+	}
+	return []reps.Payment{{To: to, Amount: amount}}, nil
+}
+
+// Warnings about addresses a request paid to, e.g. that one belongs to a retired wallet. Empty rather than nil, so
+// responses always have a list
+func addressWarnings(walletService services.WalletService, addresses ...string) []string {
+	warnings := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, address := range addresses {
+		if seen[address] {
+			continue
+		}
+		seen[address] = true
+
+		validation, err := walletService.ValidateAddress(address)
+		if err != nil {
+			log.WithField("error", err.Error()).Error("Error checking address ", address)
+			continue
+		}
+		if validation.Warning != "" {
+			warnings = append(warnings, validation.Warning)
+		}
+	}
+
+	return warnings
+}
+
+// Addresses paid by payments
+func paymentAddresses(payments []reps.Payment) []string {
+	addresses := make([]string, 0, len(payments))
+	for _, payment := range payments {
+		addresses = append(addresses, payment.To)
+	}
+	return addresses
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/brucetieu/blockchain/services"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type ValidationHandler struct {
+	validationService services.ValidationService
+}
+
+func NewValidationHandler(validationService services.ValidationService) *ValidationHandler {
+	return &ValidationHandler{
+		validationService: validationService,
+	}
+}
+
+// ValidateBlockchain ... Validate every block on the blockchain
+// @Summary      Validate the blockchain
+// @Description  Walk from genesis to the last block, re-running proof of work and checking merkle roots, prevHash links and transaction signatures
+// @Tags         Blocks
+// @Success      200  {object}  representations.ChainValidationReport
+// @Failure      500  {object}  HTTPError
+// @Router       /blockchain/validate [get]
+func (vh *ValidationHandler) ValidateBlockchain(ctx *gin.Context) {
+	log.Info("ValidateBlockchain called")
+
+	report, err := vh.validationService.ValidateBlockchain()
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error validating blockchain")
+		NewError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"report": report})
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
+	reps "github.com/brucetieu/blockchain/representations"
 	"github.com/brucetieu/blockchain/services"
+	"github.com/brucetieu/blockchain/utils"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 )
@@ -20,23 +24,155 @@ func NewWalletHandler(walletService services.WalletService) *WalletHandler {
 
 // CreateWallet ... Create a wallet to store an address and public/private key information
 // @Summary      Create a wallet
-// @Description  Create a wallet to store an address and public / private key information
+// @Description  Create a wallet to store an address and public / private key information. The private key is only stored encrypted under the passphrase, of at least 8 characters
 // @Tags         Wallets
-// @Success      201  {string}  string     "address"
-// @Failure      404  {object}  HTTPError
+// @Param        CreateWalletInput  body      representations.CreateWalletInput  true  "Passphrase"
+// @Success      201                {string}  string                             "address"
+// @Failure      400                {object}  HTTPError
 // @Router       /blockchain/wallets [post]
 func (wh *WalletHandler) CreateWallet(ctx *gin.Context) {
 	log.Info("CreateWallet handler called")
+	var input reps.CreateWalletInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
 	// Create wallet with private / public key pair
-	wallet, err := wh.walletService.CreateWallet()
+	wallet, err := wh.walletService.CreateWallet(input.Passphrase)
 	if err != nil {
 		log.Error("error creating wallet: ", err.Error())
-		NewError(ctx, http.StatusInternalServerError, err)
+		NewError(ctx, http.StatusBadRequest, err)
 	} else {
 		ctx.JSON(http.StatusCreated, gin.H{"address": wallet.Address})
 	}
 }
 
+// UnlockWallet ... Unlock a wallet so it can sign
+// @Summary      Unlock a wallet
+// @Description  Decrypt the key of a wallet with its passphrase and keep it in memory for timeout seconds (5 minutes by default, at most an hour), so transfers from the wallet can be signed. Unlocking an address of an HD wallet unlocks the whole HD wallet
+// @Tags         Wallets
+// @Param        address            path      string                             true  "Wallet address"
+// @Param        UnlockWalletInput  body      representations.UnlockWalletInput  true  "Passphrase and timeout"
+// @Success      200                {string}  string                             "unlockedUntil"
+// @Failure      400                {object}  HTTPError
+// @Failure      401                {object}  HTTPError
+// @Router       /blockchain/wallets/{address}/unlock [post]
+func (wh *WalletHandler) UnlockWallet(ctx *gin.Context) {
+	unlockWallet(ctx, wh.walletService, ctx.Param("address"))
+}
+
+// LockWallet ... Lock a wallet before its unlock times out
+// @Summary      Lock a wallet
+// @Description  Forget the decrypted key of a wallet, so it can't sign until it is unlocked again
+// @Tags         Wallets
+// @Param        address  path  string  true  "Wallet address"
+// @Success      204
+// @Failure      404  {object}  HTTPError
+// @Router       /blockchain/wallets/{address}/lock [post]
+func (wh *WalletHandler) LockWallet(ctx *gin.Context) {
+	lockWallet(ctx, wh.walletService, ctx.Param("address"))
+}
+
+// ChangePassphrase ... Encrypt the key of a wallet under a new passphrase
+// @Summary      Change the passphrase of a wallet
+// @Description  Encrypt the key of a wallet under a new passphrase. Leave passphrase empty to set the first passphrase of a wallet whose key isn't encrypted yet. The wallet is locked
+// @Tags         Wallets
+// @Param        address                path  string                                 true  "Wallet address"
+// @Param        ChangePassphraseInput  body  representations.ChangePassphraseInput  true  "Current and new passphrase"
+// @Success      204
+// @Failure      400  {object}  HTTPError
+// @Failure      401  {object}  HTTPError
+// @Router       /blockchain/wallets/{address}/passphrase [put]
+func (wh *WalletHandler) ChangePassphrase(ctx *gin.Context) {
+	changePassphrase(ctx, wh.walletService, ctx.Param("address"))
+}
+
+// ImportWallet ... Import a watch-only wallet
+// @Summary      Import a watch-only wallet
+// @Description  Import a wallet from an address or a public key generated elsewhere. It can receive coins and report its balance and transactions, but the app holds no private key for it and never signs for it. Create a PSBT to spend from it
+// @Tags         Wallets
+// @Param        ImportWalletInput  body      representations.ImportWalletInput  true  "Address and / or public key"
+// @Success      201                {object}  representations.Wallet
+// @Failure      400                {object}  HTTPError
+// @Router       /blockchain/wallets/import [post]
+func (wh *WalletHandler) ImportWallet(ctx *gin.Context) {
+	var input reps.ImportWalletInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	log.Info("ImportWallet handler called: ", utils.Pretty(input))
+
+	wallet, err := wh.walletService.ImportWatchOnlyWallet(input.Address, input.PublicKey)
+	if err != nil {
+		log.Error("error importing wallet: ", err.Error())
+		NewError(ctx, http.StatusBadRequest, err)
+	} else {
+		ctx.JSON(http.StatusCreated, gin.H{"wallet": wallet})
+	}
+}
+
+// ImportKey ... Import a wallet from its private key
+// @Summary      Import a wallet from its private key
+// @Description  Recreate a wallet from a private key in WIF or PEM, e.g. exported from another node. The wallet gets the address of the key, and the key is stored encrypted under the passphrase
+// @Tags         Wallets
+// @Param        ImportKeyInput  body      representations.ImportKeyInput  true  "Key, format and passphrase"
+// @Success      201             {object}  representations.Wallet
+// @Failure      400             {object}  HTTPError
+// @Router       /blockchain/wallets/import/key [post]
+func (wh *WalletHandler) ImportKey(ctx *gin.Context) {
+	var input reps.ImportKeyInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	wallet, err := wh.walletService.ImportPrivateKey(input.Key, input.Format, input.Passphrase)
+	if err != nil {
+		log.Error("error importing key: ", err.Error())
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	// Don't display private key to user
+	wallet.PrivateKey = nil
+	ctx.JSON(http.StatusCreated, gin.H{"wallet": wallet})
+}
+
+// ExportKey ... Export the private key of a wallet
+// @Summary      Export the private key of a wallet
+// @Description  Get the private key of a wallet in WIF or PEM, to back it up or import it elsewhere. Needs the passphrase of the wallet, or of the HD wallet it belongs to, even if it is unlocked
+// @Tags         Wallets
+// @Param        address         path      string                          true  "Wallet address"
+// @Param        ExportKeyInput  body      representations.ExportKeyInput  true  "Passphrase and format"
+// @Success      200             {object}  representations.ExportedKey
+// @Failure      400             {object}  HTTPError
+// @Failure      401             {object}  HTTPError
+// @Router       /blockchain/wallets/{address}/export [post]
+func (wh *WalletHandler) ExportKey(ctx *gin.Context) {
+	var input reps.ExportKeyInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	address := ctx.Param("address")
+	key, err := wh.walletService.ExportPrivateKey(address, input.Passphrase, input.Format)
+	if err != nil {
+		log.Error("error exporting key: ", err.Error())
+		if errors.Is(err, services.ErrWrongPassphrase) {
+			NewError(ctx, http.StatusUnauthorized, err)
+		} else {
+			NewError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"key": reps.ExportedKey{Address: address, Format: input.Format, Key: key}})
+}
+
 // GetWallet ... Get a wallet by address
 // @Summary      Get a wallet
 // @Description  Get a wallet by address
@@ -84,3 +220,54 @@ func (wh *WalletHandler) GetWallets(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gin.H{"wallets": wallets})
 	}
 }
+
+// Unlock the wallet or HD wallet id with the passphrase in the request
+func unlockWallet(ctx *gin.Context, walletService services.WalletService, id string) {
+	var input reps.UnlockWalletInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	unlockedUntil, err := walletService.UnlockWallet(id, input.Passphrase, time.Duration(input.Timeout)*time.Second)
+	if err != nil {
+		log.Error("error unlocking wallet: ", err.Error())
+		if errors.Is(err, services.ErrWrongPassphrase) {
+			NewError(ctx, http.StatusUnauthorized, err)
+		} else {
+			NewError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"unlockedUntil": unlockedUntil})
+}
+
+func lockWallet(ctx *gin.Context, walletService services.WalletService, id string) {
+	if err := walletService.LockWallet(id); err != nil {
+		NewError(ctx, http.StatusNotFound, err)
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func changePassphrase(ctx *gin.Context, walletService services.WalletService, id string) {
+	var input reps.ChangePassphraseInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		NewError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := walletService.ChangePassphrase(id, input.Passphrase, input.NewPassphrase); err != nil {
+		log.Error("error changing passphrase: ", err.Error())
+		if errors.Is(err, services.ErrWrongPassphrase) {
+			NewError(ctx, http.StatusUnauthorized, err)
+		} else {
+			NewError(ctx, http.StatusBadRequest, err)
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
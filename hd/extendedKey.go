@@ -0,0 +1,285 @@
+package hd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/akamensky/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Child numbers from HardenedOffset up are hardened. Hardened children can only be derived from a private key
+const HardenedOffset uint32 = 0x80000000
+
+// HMAC key for the master key of a P-256 seed, from SLIP-0010
+var masterKey = []byte("Nist256p1 seed")
+
+// Version bytes of serialized extended keys. The same as Bitcoin's xprv and xpub, but the keys are on P-256, so
+// wallets using secp256k1 can't make use of them
+var (
+	privateVersion = []byte{0x04, 0x88, 0xad, 0xe4}
+	publicVersion  = []byte{0x04, 0x88, 0xb2, 0x1e}
+)
+
+var (
+	ErrHardenedFromPublic = errors.New("cannot derive a hardened child from a public key")
+	ErrNotPrivate         = errors.New("extended key has no private key")
+)
+
+// BIP32 extended key on the P-256 curve, derived as described in SLIP-0010.
+// Key -> 32 byte private key, or 33 byte compressed public key if the extended key is public
+// ChainCode -> Extra 32 bytes of entropy mixed into the derivation of children
+// ParentFingerprint -> First 4 bytes of the hash160 of the parent public key, zero for the master key
+type ExtendedKey struct {
+	Key               []byte
+	ChainCode         []byte
+	Depth             byte
+	ParentFingerprint []byte
+	ChildNumber       uint32
+	Private           bool
+}
+
+// Master key of a seed, usually the seed of a BIP39 mnemonic
+func NewMaster(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed is %d bytes, expected between 16 and 64", len(seed))
+	}
+
+	// SLIP-0010 hashes the output again until the left half is a valid private key
+	sum := hmacSHA512(masterKey, seed)
+	for !validPrivateKey(sum[:32]) {
+		sum = hmacSHA512(masterKey, sum)
+	}
+
+	return &ExtendedKey{
+		Key:               sum[:32],
+		ChainCode:         sum[32:],
+		ParentFingerprint: make([]byte, 4),
+		Private:           true,
+	}, nil
+}
+
+// Derive child i. Public keys can only derive normal children, whose public keys match those derived from the
+// private key
+func (key *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	if i >= HardenedOffset && !key.Private {
+		return nil, ErrHardenedFromPublic
+	}
+	if key.Depth == 255 {
+		return nil, fmt.Errorf("cannot derive a key deeper than 255 levels")
+	}
+
+	// Hardened children commit to the private key, normal ones to the public key
+	var data []byte
+	if i >= HardenedOffset {
+		data = append([]byte{0}, key.Key...)
+	} else {
+		data = key.compressedPublicKey()
+	}
+	data = appendUint32(data, i)
+
+	curve := elliptic.P256()
+	n := curve.Params().N
+	for {
+		sum := hmacSHA512(key.ChainCode, data)
+		tweak := new(big.Int).SetBytes(sum[:32])
+
+		child := &ExtendedKey{
+			ChainCode:         sum[32:],
+			Depth:             key.Depth + 1,
+			ParentFingerprint: key.Fingerprint(),
+			ChildNumber:       i,
+			Private:           key.Private,
+		}
+
+		if tweak.Cmp(n) < 0 {
+			if key.Private {
+				k := tweak.Add(tweak, new(big.Int).SetBytes(key.Key))
+				k.Mod(k, n)
+				if k.Sign() != 0 {
+					child.Key = k.FillBytes(make([]byte, 32))
+					return child, nil
+				}
+			} else {
+				parentX, parentY := elliptic.UnmarshalCompressed(curve, key.Key)
+				tweakX, tweakY := curve.ScalarBaseMult(sum[:32])
+				x, y := curve.Add(parentX, parentY, tweakX, tweakY)
+				if x.Sign() != 0 || y.Sign() != 0 {
+					child.Key = elliptic.MarshalCompressed(curve, x, y)
+					return child, nil
+				}
+			}
+		}
+
+		// SLIP-0010 retries an invalid child with the right half of the hash instead of skipping to i + 1
+		data = appendUint32(append([]byte{1}, sum[32:]...), i)
+	}
+}
+
+// Derive the key at the end of a path of child numbers, starting from this key
+func (key *ExtendedKey) Derive(path []uint32) (*ExtendedKey, error) {
+	derived := key
+	for _, i := range path {
+		child, err := derived.Child(i)
+		if err != nil {
+			return nil, err
+		}
+		derived = child
+	}
+	return derived, nil
+}
+
+// Public version of the key, which can be shared to derive addresses without being able to spend from them
+func (key *ExtendedKey) Neuter() *ExtendedKey {
+	if !key.Private {
+		return key
+	}
+
+	return &ExtendedKey{
+		Key:               key.compressedPublicKey(),
+		ChainCode:         key.ChainCode,
+		Depth:             key.Depth,
+		ParentFingerprint: key.ParentFingerprint,
+		ChildNumber:       key.ChildNumber,
+	}
+}
+
+// Private key for signing, in the form wallets keep it
+func (key *ExtendedKey) ECDSAPrivateKey() (ecdsa.PrivateKey, error) {
+	if !key.Private {
+		return ecdsa.PrivateKey{}, ErrNotPrivate
+	}
+
+	curve := elliptic.P256()
+	privKey := ecdsa.PrivateKey{D: new(big.Int).SetBytes(key.Key)}
+	privKey.PublicKey.Curve = curve
+	privKey.PublicKey.X, privKey.PublicKey.Y = curve.ScalarBaseMult(key.Key)
+	return privKey, nil
+}
+
+// Public key as the app uses it for addresses: x and y each padded to 32 bytes
+func (key *ExtendedKey) PublicKey() []byte {
+	x, y := key.point()
+	pubKey := make([]byte, 64)
+	x.FillBytes(pubKey[:32])
+	y.FillBytes(pubKey[32:])
+	return pubKey
+}
+
+// First 4 bytes of the hash160 of the compressed public key, which children use to point back to their parent
+func (key *ExtendedKey) Fingerprint() []byte {
+	sha := sha256.Sum256(key.compressedPublicKey())
+	hasher := ripemd160.New()
+	hasher.Write(sha[:])
+	return hasher.Sum(nil)[:4]
+}
+
+// Serialize the key as BIP32 does, in base58 with a checksum
+// version (4) + depth (1) + parent fingerprint (4) + child number (4) + chain code (32) + key (33)
+func (key *ExtendedKey) String() string {
+	payload := make([]byte, 0, 82)
+	if key.Private {
+		payload = append(payload, privateVersion...)
+	} else {
+		payload = append(payload, publicVersion...)
+	}
+	payload = append(payload, key.Depth)
+	payload = append(payload, key.ParentFingerprint...)
+	payload = appendUint32(payload, key.ChildNumber)
+	payload = append(payload, key.ChainCode...)
+	if key.Private {
+		payload = append(payload, 0)
+	}
+	payload = append(payload, key.Key...)
+
+	checksum := doubleSHA256(payload)
+	return base58.Encode(append(payload, checksum[:4]...))
+}
+
+// Parse a key serialized with String
+func ParseExtendedKey(encoded string) (*ExtendedKey, error) {
+	decoded, err := base58.Decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s, extended key is not valid base58", err.Error())
+	}
+	if len(decoded) != 82 {
+		return nil, fmt.Errorf("extended key is %d bytes, expected 82", len(decoded))
+	}
+
+	payload, checksum := decoded[:78], decoded[78:]
+	expectedChecksum := doubleSHA256(payload)
+	if !bytes.Equal(checksum, expectedChecksum[:4]) {
+		return nil, fmt.Errorf("extended key checksum does not match")
+	}
+
+	key := &ExtendedKey{
+		Depth:             payload[4],
+		ParentFingerprint: payload[5:9],
+		ChildNumber:       binary.BigEndian.Uint32(payload[9:13]),
+		ChainCode:         payload[13:45],
+	}
+
+	switch {
+	case bytes.Equal(payload[:4], privateVersion):
+		if payload[45] != 0 || !validPrivateKey(payload[46:]) {
+			return nil, fmt.Errorf("extended key has an invalid private key")
+		}
+		key.Key = payload[46:]
+		key.Private = true
+	case bytes.Equal(payload[:4], publicVersion):
+		if x, _ := elliptic.UnmarshalCompressed(elliptic.P256(), payload[45:]); x == nil {
+			return nil, fmt.Errorf("extended key has an invalid public key")
+		}
+		key.Key = payload[45:]
+	default:
+		return nil, fmt.Errorf("extended key has unknown version %x", payload[:4])
+	}
+
+	return key, nil
+}
+
+func (key *ExtendedKey) point() (*big.Int, *big.Int) {
+	if key.Private {
+		return elliptic.P256().ScalarBaseMult(key.Key)
+	}
+	return elliptic.UnmarshalCompressed(elliptic.P256(), key.Key)
+}
+
+func (key *ExtendedKey) compressedPublicKey() []byte {
+	if !key.Private {
+		return key.Key
+	}
+	x, y := key.point()
+	return elliptic.MarshalCompressed(elliptic.P256(), x, y)
+}
+
+// A private key has to be between 1 and the order of the curve
+func validPrivateKey(k []byte) bool {
+	d := new(big.Int).SetBytes(k)
+	return d.Sign() > 0 && d.Cmp(elliptic.P256().Params().N) < 0
+}
+
+func hmacSHA512(key []byte, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func doubleSHA256(data []byte) [32]byte {
+	first := sha256.Sum256(data)
+	return sha256.Sum256(first[:])
+}
+
+func appendUint32(data []byte, i uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, i)
+	return append(data, buf...)
+}
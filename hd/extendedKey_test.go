@@ -0,0 +1,192 @@
+package hd
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/akamensky/base58"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors for nist256p1 from SLIP-0010
+func TestSLIP0010Vectors(t *testing.T) {
+	type vector struct {
+		path        string
+		fingerprint string
+		chainCode   string
+		private     string
+		public      string
+	}
+
+	tests := []struct {
+		name    string
+		seed    string
+		vectors []vector
+	}{
+		{
+			name: "test vector 1",
+			seed: "000102030405060708090a0b0c0d0e0f",
+			vectors: []vector{
+				{
+					path:        "m",
+					fingerprint: "00000000",
+					chainCode:   "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+					private:     "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2",
+					public:      "0266874dc6ade47b3ecd096745ca09bcd29638dd52c2c12117b11ed3e458cfa9e8",
+				},
+				{
+					path:        "m/0'",
+					fingerprint: "be6105b5",
+					chainCode:   "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+					private:     "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c",
+					public:      "0384610f5ecffe8fda089363a41f56a5c7ffc1d81b59a612d0d649b2d22355590c",
+				},
+				{
+					path:        "m/0'/1",
+					fingerprint: "9b02312f",
+					chainCode:   "4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+					private:     "284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129",
+					public:      "03526c63f8d0b4bbbf9c80df553fe66742df4676b241dabefdef67733e070f6844",
+				},
+				{
+					path:        "m/0'/1/2'",
+					fingerprint: "b98005c1",
+					chainCode:   "98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318",
+					private:     "694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7",
+					public:      "0359cf160040778a4b14c5f4d7b76e327ccc8c4a6086dd9451b7482b5a4972dda0",
+				},
+				{
+					path:        "m/0'/1/2'/2",
+					fingerprint: "0e9f3274",
+					chainCode:   "ba96f776a5c3907d7fd48bde5620ee374d4acfd540378476019eab70790c63a0",
+					private:     "5996c37fd3dd2679039b23ed6f70b506c6b56b3cb5e424681fb0fa64caf82aaa",
+					public:      "029f871f4cb9e1c97f9f4de9ccd0d4a2f2a171110c61178f84430062230833ff20",
+				},
+			},
+		},
+		{
+			name: "derivation retry",
+			seed: "000102030405060708090a0b0c0d0e0f",
+			vectors: []vector{
+				{
+					path:        "m/28578'",
+					fingerprint: "be6105b5",
+					chainCode:   "e94c8ebe30c2250a14713212f6449b20f3329105ea15b652ca5bdfc68f6c65c2",
+					private:     "06f0db126f023755d0b8d86d4591718a5210dd8d024e3e14b6159d63f53aa669",
+					public:      "02519b5554a4872e8c9c1c847115363051ec43e93400e030ba3c36b52a3e70a5b7",
+				},
+				{
+					path:        "m/28578'/33941",
+					fingerprint: "3e2b7bc6",
+					chainCode:   "9e87fe95031f14736774cd82f25fd885065cb7c358c1edf813c72af535e83071",
+					private:     "092154eed4af83e078ff9b84322015aefe5769e31270f62c3f66c33888335f3a",
+					public:      "0235bfee614c0d5b2cae260000bb1d0d84b270099ad790022c1ae0b2e782efe120",
+				},
+			},
+		},
+		{
+			name: "seed retry",
+			seed: "a7305bc8df8d0951f0cb224c0e95d7707cbdf2c6ce7e8d481fec69c7ff5e9446",
+			vectors: []vector{
+				{
+					path:        "m",
+					fingerprint: "00000000",
+					chainCode:   "7762f9729fed06121fd13f326884c82f59aa95c57ac492ce8c9654e60efd130c",
+					private:     "3b8c18469a4634517d6d0b65448f8e6c62091b45540a1743c5846be55d47d88f",
+					public:      "0383619fadcde31063d8c5cb00dbfe1713f3e6fa169d8541a798752a1c1ca0cb20",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed, err := hex.DecodeString(tt.seed)
+			require.NoError(t, err)
+			master, err := NewMaster(seed)
+			require.NoError(t, err)
+
+			for _, v := range tt.vectors {
+				path, err := ParsePath(v.path)
+				require.NoError(t, err)
+				key, err := master.Derive(path)
+				require.NoError(t, err)
+
+				assert.Equal(t, v.fingerprint, hex.EncodeToString(key.ParentFingerprint), v.path)
+				assert.Equal(t, v.chainCode, hex.EncodeToString(key.ChainCode), v.path)
+				assert.Equal(t, v.private, hex.EncodeToString(key.Key), v.path)
+				assert.Equal(t, v.public, hex.EncodeToString(key.Neuter().Key), v.path)
+			}
+		})
+	}
+}
+
+func TestNewMasterRejectsSeedLength(t *testing.T) {
+	_, err := NewMaster(make([]byte, 15))
+	assert.EqualError(t, err, "seed is 15 bytes, expected between 16 and 64")
+
+	_, err = NewMaster(make([]byte, 65))
+	assert.EqualError(t, err, "seed is 65 bytes, expected between 16 and 64")
+}
+
+func TestNeuteredKeyDerivesSamePublicKeys(t *testing.T) {
+	master, err := NewMaster([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	account, err := master.Derive(AccountPath(0))
+	require.NoError(t, err)
+
+	privChild, err := account.Derive([]uint32{ExternalChain, 7})
+	require.NoError(t, err)
+	pubChild, err := account.Neuter().Derive([]uint32{ExternalChain, 7})
+	require.NoError(t, err)
+
+	assert.False(t, pubChild.Private)
+	assert.Equal(t, privChild.PublicKey(), pubChild.PublicKey())
+	assert.Equal(t, privChild.Neuter(), pubChild)
+
+	privKey, err := privChild.ECDSAPrivateKey()
+	require.NoError(t, err)
+	assert.Equal(t, privChild.PublicKey(), append(privKey.X.FillBytes(make([]byte, 32)), privKey.Y.FillBytes(make([]byte, 32))...))
+
+	_, err = pubChild.ECDSAPrivateKey()
+	assert.ErrorIs(t, err, ErrNotPrivate)
+}
+
+func TestPublicKeyCannotDeriveHardenedChild(t *testing.T) {
+	master, err := NewMaster([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+
+	_, err = master.Neuter().Child(HardenedOffset)
+	assert.ErrorIs(t, err, ErrHardenedFromPublic)
+}
+
+func TestExtendedKeyStringRoundTrip(t *testing.T) {
+	master, err := NewMaster([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+	key, err := master.Derive(AddressPath(0, InternalChain, 3))
+	require.NoError(t, err)
+
+	for _, k := range []*ExtendedKey{key, key.Neuter()} {
+		encoded := k.String()
+		parsed, err := ParseExtendedKey(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, k, parsed)
+	}
+
+	assert.Equal(t, "xprv", key.String()[:4])
+	assert.Equal(t, "xpub", key.Neuter().String()[:4])
+}
+
+func TestParseExtendedKeyRejectsBadChecksum(t *testing.T) {
+	master, err := NewMaster([]byte("0123456789abcdef"))
+	require.NoError(t, err)
+
+	decoded, err := base58.Decode(master.String())
+	require.NoError(t, err)
+	decoded[len(decoded)-1] ^= 1
+
+	_, err = ParseExtendedKey(base58.Encode(decoded))
+	assert.EqualError(t, err, "extended key checksum does not match")
+}
@@ -0,0 +1,68 @@
+package hd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BIP44 levels: m / purpose' / coin type' / account' / change / address index
+// Purpose -> Always 44, saying the rest of the path follows BIP44
+// CoinType -> 0, there is only the one coin
+// ExternalChain -> Receive addresses, given out to be paid to
+// InternalChain -> Change addresses, only used by the wallet itself
+const (
+	Purpose       uint32 = 44
+	CoinType      uint32 = 0
+	ExternalChain uint32 = 0
+	InternalChain uint32 = 1
+)
+
+// Path of an account, m/44'/0'/account'
+func AccountPath(account uint32) []uint32 {
+	return []uint32{Purpose + HardenedOffset, CoinType + HardenedOffset, account + HardenedOffset}
+}
+
+// Path of an address, m/44'/0'/account'/chain/index
+func AddressPath(account uint32, chain uint32, index uint32) []uint32 {
+	return append(AccountPath(account), chain, index)
+}
+
+// Parse a path like m/44'/0'/0'/0/5. Hardened levels end with ' or h
+func ParsePath(path string) ([]uint32, error) {
+	levels := strings.Split(path, "/")
+	if levels[0] != "m" {
+		return nil, fmt.Errorf("path %s does not start at m", path)
+	}
+
+	parsed := make([]uint32, 0, len(levels)-1)
+	for _, level := range levels[1:] {
+		offset := uint32(0)
+		if strings.HasSuffix(level, "'") || strings.HasSuffix(level, "h") {
+			offset = HardenedOffset
+			level = level[:len(level)-1]
+		}
+
+		i, err := strconv.ParseUint(level, 10, 32)
+		if err != nil || uint32(i) >= HardenedOffset {
+			return nil, fmt.Errorf("path %s has an invalid level %s", path, level)
+		}
+		parsed = append(parsed, uint32(i)+offset)
+	}
+
+	return parsed, nil
+}
+
+// Format a path the way ParsePath reads it
+func FormatPath(path []uint32) string {
+	var builder strings.Builder
+	builder.WriteString("m")
+	for _, i := range path {
+		if i >= HardenedOffset {
+			fmt.Fprintf(&builder, "/%d'", i-HardenedOffset)
+		} else {
+			fmt.Fprintf(&builder, "/%d", i)
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,37 @@
+package hd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePath(t *testing.T) {
+	path, err := ParsePath("m/44'/0h/0'/1/5")
+	require.NoError(t, err)
+	assert.Equal(t, AddressPath(0, InternalChain, 5), path)
+	assert.Equal(t, "m/44'/0'/0'/1/5", FormatPath(path))
+
+	path, err = ParsePath("m")
+	require.NoError(t, err)
+	assert.Empty(t, path)
+	assert.Equal(t, "m", FormatPath(path))
+}
+
+func TestParsePathRejectsInvalidPaths(t *testing.T) {
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"44'/0'", "path 44'/0' does not start at m"},
+		{"m/x", "path m/x has an invalid level x"},
+		{"m/2147483648", "path m/2147483648 has an invalid level 2147483648"},
+		{"m/0//1", "path m/0//1 has an invalid level "},
+	}
+
+	for _, tt := range tests {
+		_, err := ParsePath(tt.path)
+		assert.EqualError(t, err, tt.err, tt.path)
+	}
+}
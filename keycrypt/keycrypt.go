@@ -0,0 +1,108 @@
+package keycrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Cost of the argon2id key derivation for new ciphertexts, the second recommended option of RFC 9106.
+// Each ciphertext carries the cost it was made with, so changing these doesn't break keys encrypted before
+var (
+	Argon2Time    uint32 = 3
+	Argon2Memory  uint32 = 64 * 1024 // KiB
+	Argon2Threads uint8  = 4
+)
+
+// Keys can't be decrypted at a higher cost than this, so a tampered ciphertext can't make the app run out of memory
+// or hang deriving its key
+const (
+	maxArgon2Time   uint32 = 64
+	maxArgon2Memory uint32 = 1024 * 1024
+)
+
+const (
+	version   = byte(1)
+	saltLen   = 16
+	keyLen    = 32
+	headerLen = 1 + 4 + 4 + 1 + saltLen
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// Encrypt a secret under a passphrase. The key comes from argon2id with a random salt and seals the secret with
+// AES-256-GCM.
+// version (1) + time (4) + memory (4) + threads (1) + salt (16) + nonce (12) + sealed secret
+// The header before the nonce is authenticated along with the secret, so its cost can't be lowered unnoticed
+func Encrypt(secret []byte, passphrase string) ([]byte, error) {
+	header := make([]byte, headerLen)
+	header[0] = version
+	binary.BigEndian.PutUint32(header[1:5], Argon2Time)
+	binary.BigEndian.PutUint32(header[5:9], Argon2Memory)
+	header[9] = Argon2Threads
+	if _, err := rand.Read(header[10:]); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(header, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	ciphertext := append(header, nonce...)
+	return aead.Seal(ciphertext, nonce, secret, header), nil
+}
+
+// Decrypt a secret encrypted with Encrypt. Fails with ErrWrongPassphrase if the passphrase isn't the one it was
+// encrypted under, or the ciphertext was changed
+func Decrypt(ciphertext []byte, passphrase string) ([]byte, error) {
+	if len(ciphertext) < headerLen || ciphertext[0] != version {
+		return nil, fmt.Errorf("not an encrypted key")
+	}
+
+	header := ciphertext[:headerLen]
+	aead, err := newAEAD(header, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := ciphertext[headerLen:]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("encrypted key is too short")
+	}
+
+	secret, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return secret, nil
+}
+
+// AES-256-GCM keyed with argon2id of the passphrase, with the cost and salt in header
+func newAEAD(header []byte, passphrase string) (cipher.AEAD, error) {
+	time := binary.BigEndian.Uint32(header[1:5])
+	memory := binary.BigEndian.Uint32(header[5:9])
+	threads := header[9]
+	if time == 0 || threads == 0 || time > maxArgon2Time || memory > maxArgon2Memory {
+		return nil, fmt.Errorf("encrypted key has an invalid argon2id cost")
+	}
+
+	key := argon2.IDKey([]byte(passphrase), header[10:headerLen], time, memory, threads, keyLen)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,111 @@
+package keycrypt
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	Argon2Memory, Argon2Time, Argon2Threads = 64, 1, 1
+
+	os.Exit(m.Run())
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	secret := []byte("private key bytes")
+
+	ciphertext, err := Encrypt(secret, "passphrase")
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), string(secret))
+
+	plaintext, err := Decrypt(ciphertext, "passphrase")
+	require.NoError(t, err)
+	assert.Equal(t, secret, plaintext)
+
+	// A new salt and nonce every time
+	again, err := Encrypt(secret, "passphrase")
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, again)
+}
+
+// Ciphertexts keep the cost they were made with
+func TestDecryptUsesCostInHeader(t *testing.T) {
+	ciphertext, err := Encrypt([]byte("secret"), "passphrase")
+	require.NoError(t, err)
+
+	Argon2Memory, Argon2Time = 128, 2
+	defer func() { Argon2Memory, Argon2Time = 64, 1 }()
+
+	plaintext, err := Decrypt(ciphertext, "passphrase")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), plaintext)
+}
+
+func TestDecryptRejectsWrongPassphrase(t *testing.T) {
+	ciphertext, err := Encrypt([]byte("secret"), "passphrase")
+	require.NoError(t, err)
+
+	_, err = Decrypt(ciphertext, "wrong passphrase")
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+}
+
+func TestDecryptRejectsTamperedCiphertext(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(ciphertext []byte) []byte
+		err    string
+	}{
+		{
+			name:   "lowered cost",
+			tamper: func(c []byte) []byte { c[9]++; return c },
+			err:    ErrWrongPassphrase.Error(),
+		},
+		{
+			name:   "salt",
+			tamper: func(c []byte) []byte { c[10] ^= 1; return c },
+			err:    ErrWrongPassphrase.Error(),
+		},
+		{
+			name:   "sealed secret",
+			tamper: func(c []byte) []byte { c[len(c)-1] ^= 1; return c },
+			err:    ErrWrongPassphrase.Error(),
+		},
+		{
+			name: "excessive memory",
+			tamper: func(c []byte) []byte {
+				binary.BigEndian.PutUint32(c[5:9], maxArgon2Memory+1)
+				return c
+			},
+			err: "encrypted key has an invalid argon2id cost",
+		},
+		{
+			name:   "zero time",
+			tamper: func(c []byte) []byte { binary.BigEndian.PutUint32(c[1:5], 0); return c },
+			err:    "encrypted key has an invalid argon2id cost",
+		},
+		{
+			name:   "version",
+			tamper: func(c []byte) []byte { c[0] = 2; return c },
+			err:    "not an encrypted key",
+		},
+		{
+			name:   "truncated",
+			tamper: func(c []byte) []byte { return c[:headerLen+4] },
+			err:    "encrypted key is too short",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ciphertext, err := Encrypt([]byte("secret"), "passphrase")
+			require.NoError(t, err)
+
+			_, err = Decrypt(tt.tamper(ciphertext), "passphrase")
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -1,10 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
-	"github.com/brucetieu/blockchain/db"
+	"github.com/brucetieu/blockchain/repository"
 	"github.com/brucetieu/blockchain/routes"
+	"github.com/brucetieu/blockchain/services"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
@@ -26,6 +37,9 @@ import (
 // @host      localhost:8080
 // @BasePath  /bitcoin
 func main() {
+	reindex := flag.Bool("reindex", false, "Rebuild the utxo set from the blocks in the blockchain, then exit")
+	flag.Parse()
+
 	log.Info("Bitcoin Blockchain App")
 
 	err := godotenv.Load()
@@ -33,11 +47,60 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
-	db.ConnectDatabase()
+	blockchainRepo, err := repository.OpenBlockchainRepository()
+	if err != nil {
+		log.Fatal("Error opening storage: ", err.Error())
+	}
+	// The bolt backend holds a lock on its file until closed
+	if closer, ok := blockchainRepo.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if *reindex {
+		count, err := services.NewUTXOService(blockchainRepo).Reindex()
+		if err != nil {
+			log.Fatal("Error reindexing utxo set: ", err.Error())
+		}
+		log.Infof("Utxo set rebuilt with %d unspent outputs", count)
+		return
+	}
+
+	if workers, err := strconv.Atoi(os.Getenv("MINER_WORKERS")); err == nil && workers > 0 {
+		services.MinerWorkers = workers
+	}
+	log.Infof("Mining with %d workers", services.MinerWorkers)
+
+	if interval, err := strconv.ParseInt(os.Getenv("HALVING_INTERVAL"), 10, 64); err == nil && interval > 0 {
+		services.HalvingInterval = interval
+	}
+	log.Infof("Block subsidy halves every %d blocks", services.HalvingInterval)
 
 	router := gin.Default()
-	routes.InitRoutes(router)
+	routes.InitRoutes(router, blockchainRepo)
+
+	// Every request context derives from appCtx, so cancelling it on shutdown stops any block being mined
+	appCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// port 5000 by default
-	_ = router.Run(":" + os.Getenv("PORT"))
+	server := &http.Server{
+		Addr:        ":" + os.Getenv("PORT"),
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return appCtx },
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Error running server: ", err.Error())
+		}
+	}()
+
+	<-appCtx.Done()
+	log.Info("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error("Error shutting down server: ", err.Error())
+	}
 }
@@ -1,7 +1,13 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+
 	"github.com/brucetieu/blockchain/db"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
 
 	reps "github.com/brucetieu/blockchain/representations"
 )
@@ -14,11 +20,16 @@ type BlockchainRepository interface {
 	// GetAddresses() (map[string]bool, error)
 	// GetAddresses() ([]reps.WalletGorm, error)
 
-	CreateBlock(block reps.Block) error
+	CreateBlock(block reps.Block, chainUpdate reps.ChainUpdate) error
+	UpdateBlockStatus(blockIds []string, status string) error
 	GetGenesisBlock() (reps.Block, error)
 	GetBlockchain() ([]reps.Block, error)
 	GetLastBlock() (reps.Block, error)
 	GetBlockById(blockId string) (reps.Block, error)
+	GetBlockByHash(hash []byte) (reps.Block, error)
+	GetChainTips() ([]reps.Block, error)
+	GetBlockByHeight(height int64) (reps.Block, error)
+	GetBlocksByHeight(from int64, to int64) ([]reps.Block, error)
 
 	CreateTxnOutput(txnOutput reps.TxnOutput) error
 	CreateTxnInput(txnInput reps.TxnInput) error
@@ -28,8 +39,26 @@ type BlockchainRepository interface {
 	CreateWallet(wallet reps.Wallet) error
 	GetWallet(address string) (reps.Wallet, error)
 	GetWallets() ([]reps.Wallet, error)
+	GetHDWalletAddresses(hdWalletId string) ([]reps.Wallet, error)
+	UpdateWallet(wallet reps.Wallet) error
+
+	CreateHDWallet(hdWallet reps.HDWallet) error
+	GetHDWallet(id string) (reps.HDWallet, error)
+	GetHDWallets() ([]reps.HDWallet, error)
+	UpdateHDWallet(hdWallet reps.HDWallet) error
+
+	GetUTXO(txnId []byte, outIdx int) (reps.UTXO, error)
+	GetUTXOs(pubKeyHash []byte) ([]reps.UTXO, error)
+	GetUTXOBalances() ([]reps.UTXOBalance, error)
+	ReplaceUTXOs(utxos []reps.UTXO) error
 }
 
+// Postgres error codes
+const (
+	uniqueViolation      = "23505"
+	serializationFailure = "40001"
+)
+
 type blockchainRepository struct{}
 
 func NewBlockchainRepository() BlockchainRepository {
@@ -81,13 +110,14 @@ func (repo *blockchainRepository) CreateTransaction(txn []reps.Transaction) erro
 // return wallets, nil
 // }
 
-// Get the last block in the blockchain
+// Get the last block in the blockchain, i.e. the tip of the active chain
 func (repo *blockchainRepository) GetLastBlock() (reps.Block, error) {
 	var lastBlock reps.Block
 
 	err := db.DB.
+		Where("status = ?", reps.BlockStatusActive).
 		Limit(1).
-		Order("timestamp desc").
+		Order("height desc").
 		First(&lastBlock).
 		Error
 	if err != nil {
@@ -125,11 +155,56 @@ func (repo *blockchainRepository) GetBlockById(blockId string) (reps.Block, erro
 	return block, nil
 }
 
-// Get all transactions
+// Get the block at a given height in the active chain
+func (repo *blockchainRepository) GetBlockByHeight(height int64) (reps.Block, error) {
+	var block reps.Block
+
+	res := db.DB.
+		Where("height = ? AND status = ?", height, reps.BlockStatusActive).
+		First(&block)
+	if res.Error != nil {
+		return reps.Block{}, res.Error
+	}
+
+	txns, err := repo.GetTransactionsByBlockId(block.ID)
+	if err != nil {
+		return reps.Block{}, err
+	}
+
+	block.Transactions = txns
+
+	return block, nil
+}
+
+// Get all blocks in the active chain with a height between from and to (inclusive), ordered by height
+func (repo *blockchainRepository) GetBlocksByHeight(from int64, to int64) ([]reps.Block, error) {
+	var blocks []reps.Block
+
+	if err := db.DB.
+		Where("height BETWEEN ? AND ? AND status = ?", from, to, reps.BlockStatusActive).
+		Order("height asc").
+		Find(&blocks).Error; err != nil {
+		return []reps.Block{}, err
+	}
+
+	for i := 0; i < len(blocks); i++ {
+		txns, err := repo.GetTransactionsByBlockId(blocks[i].ID)
+		if err != nil {
+			return []reps.Block{}, err
+		}
+
+		blocks[i].Transactions = txns
+	}
+
+	return blocks, nil
+}
+
+// Get all transactions in the active chain
 func (repo *blockchainRepository) GetTransactions() ([]reps.Transaction, error) {
 	var transactions []reps.Transaction
 
 	err := db.DB.
+		Where("block_id IN (SELECT block_id FROM blocks WHERE status = ?)", reps.BlockStatusActive).
 		Preload("Inputs").
 		Preload("Outputs").
 		Find(&transactions).
@@ -141,12 +216,13 @@ func (repo *blockchainRepository) GetTransactions() ([]reps.Transaction, error)
 	return transactions, nil
 }
 
-// Get a single transaction
+// Get a single transaction. If it is in blocks on several branches, the copy in the active chain is preferred
 func (repo *blockchainRepository) GetTransaction(txnId []byte) (reps.Transaction, error) {
 	var transaction reps.Transaction
 
 	res := db.DB.
 		Where("id = ?", txnId).
+		Order(gorm.Expr("block_id IN (SELECT block_id FROM blocks WHERE status = ?) DESC", reps.BlockStatusActive)).
 		Preload("Inputs").
 		Preload("Outputs").
 		First(&transaction)
@@ -224,21 +300,150 @@ func (repo *blockchainRepository) GetGenesisBlock() (reps.Block, error) {
 	return genesisBlock, nil
 }
 
-// Save block to db
-func (repo *blockchainRepository) CreateBlock(block reps.Block) error {
-	if err := db.DB.Create(&block).Error; err != nil {
+// Save block to db and apply the changes it makes to the active chain and utxo set in one serializable db transaction.
+// Returns ErrChainTipMoved if another block changed the active chain first
+func (repo *blockchainRepository) CreateBlock(block reps.Block, chainUpdate reps.ChainUpdate) error {
+	tx := db.DB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	// Lock the tip so a concurrent CreateBlock connecting blocks waits for this one, then fails its own tip check
+	var tipHashes [][]byte
+	err := tx.Model(&reps.Block{}).
+		Where("status = ?", reps.BlockStatusActive).
+		Order("height desc").
+		Limit(1).
+		Set("gorm:query_option", "FOR UPDATE").
+		Pluck("hash", &tipHashes).
+		Error
+	if err != nil {
+		tx.Rollback()
+		return chainConflict(err)
+	}
+
+	var tipHash []byte
+	if len(tipHashes) > 0 {
+		tipHash = tipHashes[0]
+	}
+	if err := checkTip(tipHash, chainUpdate); err != nil {
+		tx.Rollback()
 		return err
 	}
 
-	return nil
+	if err := tx.Create(&block).Error; err != nil {
+		tx.Rollback()
+		return chainConflict(err)
+	}
+
+	// Blocks that drop out of the active chain during a reorg
+	if len(chainUpdate.Disconnected) > 0 {
+		err := tx.Model(&reps.Block{}).
+			Where("block_id IN (?)", chainUpdate.Disconnected).
+			Update("status", reps.BlockStatusValidFork).
+			Error
+		if err != nil {
+			tx.Rollback()
+			return chainConflict(err)
+		}
+	}
+
+	if len(chainUpdate.Connected) > 0 {
+		err := tx.Model(&reps.Block{}).
+			Where("block_id IN (?)", chainUpdate.Connected).
+			Update("status", reps.BlockStatusActive).
+			Error
+		if err != nil {
+			tx.Rollback()
+			return chainConflict(err)
+		}
+	}
+
+	for _, utxo := range chainUpdate.Spent {
+		if err := tx.Where("id = ?", utxo.ID).Delete(&reps.UTXO{}).Error; err != nil {
+			tx.Rollback()
+			return chainConflict(err)
+		}
+	}
+
+	for _, utxo := range chainUpdate.Created {
+		if err := tx.Create(&utxo).Error; err != nil {
+			tx.Rollback()
+			return chainConflict(err)
+		}
+	}
+
+	return chainConflict(tx.Commit().Error)
+}
+
+// Postgres aborts a serializable transaction that raced with another one, and rejects a second active block on
+// the same parent. Either way the tip moved, so callers get ErrChainTipMoved instead of the driver error
+func chainConflict(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	if pqErr.Code == serializationFailure || (pqErr.Code == uniqueViolation && pqErr.Constraint == db.ActivePrevHashIndex) {
+		return ErrChainTipMoved
+	}
+	return err
+}
+
+// Set the status of blocks, e.g. to mark them invalid
+func (repo *blockchainRepository) UpdateBlockStatus(blockIds []string, status string) error {
+	return db.DB.
+		Model(&reps.Block{}).
+		Where("block_id IN (?)", blockIds).
+		Update("status", status).
+		Error
+}
+
+// Get a block on any branch by its hash
+func (repo *blockchainRepository) GetBlockByHash(hash []byte) (reps.Block, error) {
+	var block reps.Block
+
+	res := db.DB.
+		Where("hash = ?", hash).
+		First(&block)
+	if res.Error != nil {
+		return reps.Block{}, res.Error
+	}
+
+	txns, err := repo.GetTransactionsByBlockId(block.ID)
+	if err != nil {
+		return reps.Block{}, err
+	}
+
+	block.Transactions = txns
+
+	return block, nil
 }
 
-// Get all blocks in blockchain
+// Get every block that no other block builds on, i.e. the head of each branch. Transactions are not loaded
+func (repo *blockchainRepository) GetChainTips() ([]reps.Block, error) {
+	var blocks []reps.Block
+
+	err := db.DB.
+		Where("NOT EXISTS (SELECT 1 FROM blocks children WHERE children.prev_hash = blocks.hash)").
+		Order("chain_work desc").
+		Find(&blocks).
+		Error
+	if err != nil {
+		return []reps.Block{}, err
+	}
+
+	return blocks, nil
+}
+
+// Get all blocks in the active chain, ordered by height
 func (repo *blockchainRepository) GetBlockchain() ([]reps.Block, error) {
 	var blocks []reps.Block
 
 	if err := db.DB.
+		Where("status = ?", reps.BlockStatusActive).
 		Preload("Transactions").
+		Order("height asc").
 		Find(&blocks).Error; err != nil {
 		return []reps.Block{}, err
 	}
@@ -295,3 +500,165 @@ func (repo *blockchainRepository) GetWallets() ([]reps.Wallet, error) {
 
 	return wallets, nil
 }
+
+// Get the wallets holding the addresses of an HD wallet
+func (repo *blockchainRepository) GetHDWalletAddresses(hdWalletId string) ([]reps.Wallet, error) {
+	var wallets []reps.Wallet
+
+	err := db.DB.
+		Where("hd_wallet_id = ?", hdWalletId).
+		Find(&wallets).
+		Error
+	if err != nil {
+		return []reps.Wallet{}, err
+	}
+
+	return wallets, nil
+}
+
+// Save the changes to a wallet, found by its address
+func (repo *blockchainRepository) UpdateWallet(wallet reps.Wallet) error {
+	result := db.DB.
+		Model(&reps.Wallet{}).
+		Where("address = ?", wallet.Address).
+		Updates(map[string]interface{}{
+			"private_key":   wallet.PrivateKey,
+			"key_encrypted": wallet.KeyEncrypted,
+			"retired":       wallet.Retired,
+			"swept_to":      wallet.SweptTo,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Save an HD wallet to the db
+func (repo *blockchainRepository) CreateHDWallet(hdWallet reps.HDWallet) error {
+	if err := db.DB.Create(&hdWallet).Error; err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get HD wallet by id
+func (repo *blockchainRepository) GetHDWallet(id string) (reps.HDWallet, error) {
+	var hdWallet reps.HDWallet
+
+	err := db.DB.
+		Where("id = ?", id).
+		First(&hdWallet).
+		Error
+	if err != nil {
+		return reps.HDWallet{}, err
+	}
+
+	return hdWallet, nil
+}
+
+// Get all HD wallets
+func (repo *blockchainRepository) GetHDWallets() ([]reps.HDWallet, error) {
+	var hdWallets []reps.HDWallet
+
+	err := db.DB.
+		Find(&hdWallets).
+		Error
+	if err != nil {
+		return []reps.HDWallet{}, err
+	}
+
+	return hdWallets, nil
+}
+
+// Save the changes to an HD wallet
+func (repo *blockchainRepository) UpdateHDWallet(hdWallet reps.HDWallet) error {
+	result := db.DB.
+		Model(&reps.HDWallet{}).
+		Where("id = ?", hdWallet.ID).
+		Updates(map[string]interface{}{
+			"seed":           hdWallet.Seed,
+			"seed_encrypted": hdWallet.SeedEncrypted,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Get a single unspent output by the transaction that created it and its index in that transaction
+func (repo *blockchainRepository) GetUTXO(txnId []byte, outIdx int) (reps.UTXO, error) {
+	var utxo reps.UTXO
+
+	err := db.DB.
+		Where("txn_id = ? AND out_idx = ?", txnId, outIdx).
+		First(&utxo).
+		Error
+	if err != nil {
+		return reps.UTXO{}, err
+	}
+
+	return utxo, nil
+}
+
+// Get all unspent outputs locked with a public key hash
+func (repo *blockchainRepository) GetUTXOs(pubKeyHash []byte) ([]reps.UTXO, error) {
+	var utxos []reps.UTXO
+
+	err := db.DB.
+		Where("pub_key_hash = ?", pubKeyHash).
+		Find(&utxos).
+		Error
+	if err != nil {
+		return []reps.UTXO{}, err
+	}
+
+	return utxos, nil
+}
+
+// Get the total value of unspent outputs for each public key hash
+func (repo *blockchainRepository) GetUTXOBalances() ([]reps.UTXOBalance, error) {
+	var balances []reps.UTXOBalance
+
+	err := db.DB.
+		Model(&reps.UTXO{}).
+		Select("pub_key_hash, sum(value) as balance").
+		Group("pub_key_hash").
+		Scan(&balances).
+		Error
+	if err != nil {
+		return []reps.UTXOBalance{}, err
+	}
+
+	return balances, nil
+}
+
+// Throw away the utxo set and replace it, e.g. after rebuilding it from the blocks
+func (repo *blockchainRepository) ReplaceUTXOs(utxos []reps.UTXO) error {
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if err := tx.Delete(&reps.UTXO{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, utxo := range utxos {
+		if err := tx.Create(&utxo).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
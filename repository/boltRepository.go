@@ -0,0 +1,688 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets in the bolt file
+// blocks -> Block id to the block as json, with its transactions
+// blockHashes -> Block hash to block id
+// activeChain -> Height (8 byte big endian) to the id of the active block at that height
+// txnBlocks -> "<hex txnId>:<blockId>" for every block a transaction is in, so transactions can be found by id
+// looseTxns -> Transaction id to transactions saved on their own with CreateTransaction
+// wallets -> Sequence number to wallet as json, so wallets come back in the order they were created
+// walletAddresses -> Wallet address to its key in wallets
+// hdWallets -> HD wallet id to HD wallet as json
+// utxos -> Utxo id to utxo as json
+// utxoPubKeyHashes -> "<hex pubKeyHash>/<utxoId>" for every utxo, so utxos can be found by the key they are locked with
+var (
+	blocksBucket           = []byte("blocks")
+	blockHashesBucket      = []byte("blockHashes")
+	activeChainBucket      = []byte("activeChain")
+	txnBlocksBucket        = []byte("txnBlocks")
+	looseTxnsBucket        = []byte("looseTxns")
+	walletsBucket          = []byte("wallets")
+	walletAddressesBucket  = []byte("walletAddresses")
+	hdWalletsBucket        = []byte("hdWallets")
+	utxosBucket            = []byte("utxos")
+	utxoPubKeyHashesBucket = []byte("utxoPubKeyHashes")
+)
+
+// Stores everything in an embedded bbolt database file. Each method runs in a single bolt transaction
+type boltRepository struct {
+	boltDB *bolt.DB
+}
+
+// Open, or create, the bolt file at path
+func NewBoltRepository(path string) (BlockchainRepository, error) {
+	boltDB, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("%s, cannot open bolt file %s", err.Error(), path)
+	}
+
+	err = boltDB.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{
+			blocksBucket, blockHashesBucket, activeChainBucket, txnBlocksBucket, looseTxnsBucket,
+			walletsBucket, walletAddressesBucket, hdWalletsBucket, utxosBucket, utxoPubKeyHashesBucket,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		boltDB.Close()
+		return nil, err
+	}
+
+	return &boltRepository{boltDB: boltDB}, nil
+}
+
+// Close the bolt file
+func (repo *boltRepository) Close() error {
+	return repo.boltDB.Close()
+}
+
+func (repo *boltRepository) CreateTransaction(txns []reps.Transaction) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		for _, txn := range txns {
+			if err := putJSON(tx.Bucket(looseTxnsBucket), txn.ID, txn); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Add an input to a transaction saved with CreateTransaction
+func (repo *boltRepository) CreateTxnInput(txnInput reps.TxnInput) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		var txn reps.Transaction
+		if err := getJSON(tx.Bucket(looseTxnsBucket), txnInput.CurrTxnID, &txn); err != nil {
+			return fmt.Errorf("%w, transaction %x of input", err, txnInput.CurrTxnID)
+		}
+		txn.Inputs = append(txn.Inputs, txnInput)
+		return putJSON(tx.Bucket(looseTxnsBucket), txn.ID, txn)
+	})
+}
+
+// Add an output to a transaction saved with CreateTransaction
+func (repo *boltRepository) CreateTxnOutput(txnOutput reps.TxnOutput) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		var txn reps.Transaction
+		if err := getJSON(tx.Bucket(looseTxnsBucket), txnOutput.CurrTxnID, &txn); err != nil {
+			return fmt.Errorf("%w, transaction %x of output", err, txnOutput.CurrTxnID)
+		}
+		txn.Outputs = append(txn.Outputs, txnOutput)
+		return putJSON(tx.Bucket(looseTxnsBucket), txn.ID, txn)
+	})
+}
+
+func (repo *boltRepository) GetTransactionsByBlockId(blockId string) ([]reps.Transaction, error) {
+	var txns []reps.Transaction
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		block, err := getBlock(tx, blockId)
+		if err == ErrNotFound {
+			return nil
+		}
+		txns = block.Transactions
+		return err
+	})
+
+	return txns, err
+}
+
+// Get all transactions in the active chain
+func (repo *boltRepository) GetTransactions() ([]reps.Transaction, error) {
+	txns := make([]reps.Transaction, 0)
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(activeChainBucket).ForEach(func(_, blockId []byte) error {
+			block, err := getBlock(tx, string(blockId))
+			if err != nil {
+				return err
+			}
+			txns = append(txns, block.Transactions...)
+			return nil
+		})
+	})
+
+	return txns, err
+}
+
+// Get a single transaction. If it is in blocks on several branches, the copy in the active chain is preferred
+func (repo *boltRepository) GetTransaction(txnId []byte) (reps.Transaction, error) {
+	var found *reps.Transaction
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		prefix := []byte(hex.EncodeToString(txnId) + ":")
+		cursor := tx.Bucket(txnBlocksBucket).Cursor()
+
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			block, err := getBlock(tx, string(key[len(prefix):]))
+			if err != nil {
+				return err
+			}
+
+			for i := range block.Transactions {
+				if !bytes.Equal(block.Transactions[i].ID, txnId) {
+					continue
+				}
+				if found == nil || block.Status == reps.BlockStatusActive {
+					found = &block.Transactions[i]
+				}
+			}
+		}
+
+		if found != nil {
+			return nil
+		}
+
+		var txn reps.Transaction
+		if err := getJSON(tx.Bucket(looseTxnsBucket), txnId, &txn); err != nil {
+			return err
+		}
+		found = &txn
+		return nil
+	})
+	if err != nil {
+		return reps.Transaction{}, err
+	}
+
+	return *found, nil
+}
+
+// Save block and apply the changes it makes to the active chain and utxo set in the same bolt transaction
+func (repo *boltRepository) CreateBlock(block reps.Block, chainUpdate reps.ChainUpdate) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(blocksBucket).Get([]byte(block.ID)) != nil {
+			return fmt.Errorf("block %s already exists", block.ID)
+		}
+
+		// Bolt only runs one write transaction at a time, so the tip can't move between this check and the commit
+		var tipHash []byte
+		if _, tipId := tx.Bucket(activeChainBucket).Cursor().Last(); tipId != nil {
+			tip, err := getBlock(tx, string(tipId))
+			if err != nil {
+				return err
+			}
+			tipHash = tip.Hash
+		}
+		if err := checkTip(tipHash, chainUpdate); err != nil {
+			return err
+		}
+
+		if err := putJSON(tx.Bucket(blocksBucket), []byte(block.ID), block); err != nil {
+			return err
+		}
+		if err := tx.Bucket(blockHashesBucket).Put(block.Hash, []byte(block.ID)); err != nil {
+			return err
+		}
+		for _, txn := range block.Transactions {
+			if err := tx.Bucket(txnBlocksBucket).Put([]byte(hex.EncodeToString(txn.ID)+":"+block.ID), []byte{}); err != nil {
+				return err
+			}
+		}
+
+		if err := setStatus(tx, chainUpdate.Disconnected, reps.BlockStatusValidFork); err != nil {
+			return err
+		}
+		if err := setStatus(tx, chainUpdate.Connected, reps.BlockStatusActive); err != nil {
+			return err
+		}
+
+		for _, utxo := range chainUpdate.Spent {
+			if err := deleteUTXO(tx, utxo.ID); err != nil {
+				return err
+			}
+		}
+		for _, utxo := range chainUpdate.Created {
+			if err := putUTXO(tx, utxo); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Set the status of blocks, e.g. to mark them invalid
+func (repo *boltRepository) UpdateBlockStatus(blockIds []string, status string) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		return setStatus(tx, blockIds, status)
+	})
+}
+
+func (repo *boltRepository) GetGenesisBlock() (reps.Block, error) {
+	return repo.findBlock(func(tx *bolt.Tx) (reps.Block, error) {
+		var genesis reps.Block
+		err := tx.Bucket(blocksBucket).ForEach(func(_, value []byte) error {
+			var block reps.Block
+			if err := json.Unmarshal(value, &block); err != nil {
+				return err
+			}
+			if len(block.PrevHash) == 0 {
+				genesis = block
+			}
+			return nil
+		})
+		if err != nil {
+			return reps.Block{}, err
+		}
+		if genesis.ID == "" {
+			return reps.Block{}, ErrNotFound
+		}
+
+		setBlockIds(&genesis)
+		return genesis, nil
+	})
+}
+
+// Get all blocks in the active chain, ordered by height
+func (repo *boltRepository) GetBlockchain() ([]reps.Block, error) {
+	return repo.GetBlocksByHeight(0, -1)
+}
+
+// Get the last block in the blockchain, i.e. the tip of the active chain
+func (repo *boltRepository) GetLastBlock() (reps.Block, error) {
+	return repo.findBlock(func(tx *bolt.Tx) (reps.Block, error) {
+		_, blockId := tx.Bucket(activeChainBucket).Cursor().Last()
+		if blockId == nil {
+			return reps.Block{}, ErrNotFound
+		}
+		return getBlock(tx, string(blockId))
+	})
+}
+
+func (repo *boltRepository) GetBlockById(blockId string) (reps.Block, error) {
+	return repo.findBlock(func(tx *bolt.Tx) (reps.Block, error) {
+		return getBlock(tx, blockId)
+	})
+}
+
+// Get a block on any branch by its hash
+func (repo *boltRepository) GetBlockByHash(hash []byte) (reps.Block, error) {
+	return repo.findBlock(func(tx *bolt.Tx) (reps.Block, error) {
+		blockId := tx.Bucket(blockHashesBucket).Get(hash)
+		if blockId == nil {
+			return reps.Block{}, ErrNotFound
+		}
+		return getBlock(tx, string(blockId))
+	})
+}
+
+// Get every block that no other block builds on, i.e. the head of each branch. Transactions are not loaded
+func (repo *boltRepository) GetChainTips() ([]reps.Block, error) {
+	blocks := make([]reps.Block, 0)
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(blocksBucket).ForEach(func(_, value []byte) error {
+			var block reps.Block
+			if err := json.Unmarshal(value, &block); err != nil {
+				return err
+			}
+			blocks = append(blocks, block)
+			return nil
+		})
+	})
+	if err != nil {
+		return []reps.Block{}, err
+	}
+
+	return chainTips(blocks), nil
+}
+
+// Get the block at a given height in the active chain
+func (repo *boltRepository) GetBlockByHeight(height int64) (reps.Block, error) {
+	return repo.findBlock(func(tx *bolt.Tx) (reps.Block, error) {
+		if height < 0 {
+			return reps.Block{}, ErrNotFound
+		}
+		blockId := tx.Bucket(activeChainBucket).Get(heightKey(height))
+		if blockId == nil {
+			return reps.Block{}, ErrNotFound
+		}
+		return getBlock(tx, string(blockId))
+	})
+}
+
+// Get all blocks in the active chain with a height between from and to (inclusive), ordered by height.
+// A negative to means up to the tip
+func (repo *boltRepository) GetBlocksByHeight(from int64, to int64) ([]reps.Block, error) {
+	blocks := make([]reps.Block, 0)
+	if from < 0 {
+		from = 0
+	}
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(activeChainBucket).Cursor()
+		for key, blockId := cursor.Seek(heightKey(from)); key != nil; key, blockId = cursor.Next() {
+			if to >= 0 && int64(binary.BigEndian.Uint64(key)) > to {
+				break
+			}
+
+			block, err := getBlock(tx, string(blockId))
+			if err != nil {
+				return err
+			}
+			blocks = append(blocks, block)
+		}
+		return nil
+	})
+	if err != nil {
+		return []reps.Block{}, err
+	}
+
+	return blocks, nil
+}
+
+func (repo *boltRepository) CreateWallet(wallet reps.Wallet) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		addresses := tx.Bucket(walletAddressesBucket)
+		if addresses.Get([]byte(wallet.Address)) != nil {
+			return fmt.Errorf("wallet %s already exists", wallet.Address)
+		}
+
+		wallets := tx.Bucket(walletsBucket)
+		seq, err := wallets.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := putJSON(wallets, key, wallet); err != nil {
+			return err
+		}
+		return addresses.Put([]byte(wallet.Address), key)
+	})
+}
+
+func (repo *boltRepository) GetWallet(address string) (reps.Wallet, error) {
+	var wallet reps.Wallet
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		key := tx.Bucket(walletAddressesBucket).Get([]byte(address))
+		if key == nil {
+			return ErrNotFound
+		}
+		return getJSON(tx.Bucket(walletsBucket), key, &wallet)
+	})
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+func (repo *boltRepository) GetWallets() ([]reps.Wallet, error) {
+	wallets := make([]reps.Wallet, 0)
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(walletsBucket).ForEach(func(_, value []byte) error {
+			var wallet reps.Wallet
+			if err := json.Unmarshal(value, &wallet); err != nil {
+				return err
+			}
+			wallets = append(wallets, wallet)
+			return nil
+		})
+	})
+	if err != nil {
+		return []reps.Wallet{}, err
+	}
+
+	return wallets, nil
+}
+
+func (repo *boltRepository) GetHDWalletAddresses(hdWalletId string) ([]reps.Wallet, error) {
+	wallets, err := repo.GetWallets()
+	if err != nil {
+		return []reps.Wallet{}, err
+	}
+
+	hdWalletAddresses := make([]reps.Wallet, 0)
+	for _, wallet := range wallets {
+		if wallet.HDWalletID == hdWalletId {
+			hdWalletAddresses = append(hdWalletAddresses, wallet)
+		}
+	}
+
+	return hdWalletAddresses, nil
+}
+
+func (repo *boltRepository) UpdateWallet(wallet reps.Wallet) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		key := tx.Bucket(walletAddressesBucket).Get([]byte(wallet.Address))
+		if key == nil {
+			return ErrNotFound
+		}
+		return putJSON(tx.Bucket(walletsBucket), key, wallet)
+	})
+}
+
+func (repo *boltRepository) CreateHDWallet(hdWallet reps.HDWallet) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		hdWallets := tx.Bucket(hdWalletsBucket)
+		if hdWallets.Get([]byte(hdWallet.ID)) != nil {
+			return fmt.Errorf("HD wallet %s already exists", hdWallet.ID)
+		}
+		return putJSON(hdWallets, []byte(hdWallet.ID), hdWallet)
+	})
+}
+
+func (repo *boltRepository) GetHDWallet(id string) (reps.HDWallet, error) {
+	var hdWallet reps.HDWallet
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(hdWalletsBucket), []byte(id), &hdWallet)
+	})
+	if err != nil {
+		return reps.HDWallet{}, err
+	}
+
+	return hdWallet, nil
+}
+
+func (repo *boltRepository) GetHDWallets() ([]reps.HDWallet, error) {
+	hdWallets := make([]reps.HDWallet, 0)
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(hdWalletsBucket).ForEach(func(_, value []byte) error {
+			var hdWallet reps.HDWallet
+			if err := json.Unmarshal(value, &hdWallet); err != nil {
+				return err
+			}
+			hdWallets = append(hdWallets, hdWallet)
+			return nil
+		})
+	})
+	if err != nil {
+		return []reps.HDWallet{}, err
+	}
+
+	return hdWallets, nil
+}
+
+func (repo *boltRepository) UpdateHDWallet(hdWallet reps.HDWallet) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		hdWallets := tx.Bucket(hdWalletsBucket)
+		if hdWallets.Get([]byte(hdWallet.ID)) == nil {
+			return ErrNotFound
+		}
+		return putJSON(hdWallets, []byte(hdWallet.ID), hdWallet)
+	})
+}
+
+func (repo *boltRepository) GetUTXO(txnId []byte, outIdx int) (reps.UTXO, error) {
+	var utxo reps.UTXO
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		return getJSON(tx.Bucket(utxosBucket), []byte(utxoId(txnId, outIdx)), &utxo)
+	})
+	if err != nil {
+		return reps.UTXO{}, err
+	}
+
+	return utxo, nil
+}
+
+// Get all unspent outputs locked with a public key hash
+func (repo *boltRepository) GetUTXOs(pubKeyHash []byte) ([]reps.UTXO, error) {
+	utxos := make([]reps.UTXO, 0)
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		prefix := []byte(hex.EncodeToString(pubKeyHash) + "/")
+		cursor := tx.Bucket(utxoPubKeyHashesBucket).Cursor()
+
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			var utxo reps.UTXO
+			if err := getJSON(tx.Bucket(utxosBucket), key[len(prefix):], &utxo); err != nil {
+				return err
+			}
+			utxos = append(utxos, utxo)
+		}
+		return nil
+	})
+	if err != nil {
+		return []reps.UTXO{}, err
+	}
+
+	return utxos, nil
+}
+
+func (repo *boltRepository) GetUTXOBalances() ([]reps.UTXOBalance, error) {
+	utxos := make([]reps.UTXO, 0)
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(utxosBucket).ForEach(func(_, value []byte) error {
+			var utxo reps.UTXO
+			if err := json.Unmarshal(value, &utxo); err != nil {
+				return err
+			}
+			utxos = append(utxos, utxo)
+			return nil
+		})
+	})
+	if err != nil {
+		return []reps.UTXOBalance{}, err
+	}
+
+	return utxoBalances(utxos), nil
+}
+
+// Throw away the utxo set and replace it, e.g. after rebuilding it from the blocks
+func (repo *boltRepository) ReplaceUTXOs(utxos []reps.UTXO) error {
+	return repo.boltDB.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{utxosBucket, utxoPubKeyHashesBucket} {
+			if err := tx.DeleteBucket(bucket); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(bucket); err != nil {
+				return err
+			}
+		}
+
+		for _, utxo := range utxos {
+			if err := putUTXO(tx, utxo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Run a lookup for a single block in a read only bolt transaction
+func (repo *boltRepository) findBlock(find func(tx *bolt.Tx) (reps.Block, error)) (reps.Block, error) {
+	var block reps.Block
+
+	err := repo.boltDB.View(func(tx *bolt.Tx) error {
+		found, err := find(tx)
+		block = found
+		return err
+	})
+	if err != nil {
+		return reps.Block{}, err
+	}
+
+	return block, nil
+}
+
+func getBlock(tx *bolt.Tx, blockId string) (reps.Block, error) {
+	var block reps.Block
+	if err := getJSON(tx.Bucket(blocksBucket), []byte(blockId), &block); err != nil {
+		return reps.Block{}, err
+	}
+
+	// Input and output block ids aren't part of their json
+	setBlockIds(&block)
+	return block, nil
+}
+
+// Update block statuses and keep the active chain index in step
+func setStatus(tx *bolt.Tx, blockIds []string, status string) error {
+	activeChain := tx.Bucket(activeChainBucket)
+
+	for _, blockId := range blockIds {
+		block, err := getBlock(tx, blockId)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		block.Status = status
+		if err := putJSON(tx.Bucket(blocksBucket), []byte(blockId), block); err != nil {
+			return err
+		}
+
+		key := heightKey(block.Height)
+		if status == reps.BlockStatusActive {
+			err = activeChain.Put(key, []byte(blockId))
+		} else if string(activeChain.Get(key)) == blockId {
+			err = activeChain.Delete(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func putUTXO(tx *bolt.Tx, utxo reps.UTXO) error {
+	if err := putJSON(tx.Bucket(utxosBucket), []byte(utxo.ID), utxo); err != nil {
+		return err
+	}
+	return tx.Bucket(utxoPubKeyHashesBucket).Put([]byte(hex.EncodeToString(utxo.PubKeyHash)+"/"+utxo.ID), []byte{})
+}
+
+func deleteUTXO(tx *bolt.Tx, id string) error {
+	var utxo reps.UTXO
+	err := getJSON(tx.Bucket(utxosBucket), []byte(id), &utxo)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(utxoPubKeyHashesBucket).Delete([]byte(hex.EncodeToString(utxo.PubKeyHash) + "/" + id)); err != nil {
+		return err
+	}
+	return tx.Bucket(utxosBucket).Delete([]byte(id))
+}
+
+func getJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	data := bucket.Get(key)
+	if data == nil {
+		return ErrNotFound
+	}
+	return json.Unmarshal(data, value)
+}
+
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// Height as a bolt key. Big endian so keys sort by height
+func heightKey(height int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(height))
+	return key
+}
@@ -0,0 +1,487 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	reps "github.com/brucetieu/blockchain/representations"
+)
+
+// Keeps everything in memory. Nothing survives a restart, which makes it handy for tests and local experiments
+// blocks -> Every block on every branch, with its transactions, keyed by block id
+// blockOrder -> Block ids in the order they were saved
+// activeChain -> Id of the active block at each height
+// txnBlocks -> Ids of the blocks each transaction is in, keyed by transaction id
+// looseTxns -> Transactions saved on their own with CreateTransaction, keyed by transaction id
+type memoryRepository struct {
+	mu sync.RWMutex
+
+	blocks      map[string]reps.Block
+	blockOrder  []string
+	blockHashes map[string]string
+	activeChain []string
+	txnBlocks   map[string][]string
+	looseTxns   map[string]reps.Transaction
+
+	wallets     map[string]reps.Wallet
+	walletOrder []string
+	hdWallets   map[string]reps.HDWallet
+
+	utxos map[string]reps.UTXO
+}
+
+func NewMemoryRepository() BlockchainRepository {
+	return &memoryRepository{
+		blocks:      make(map[string]reps.Block),
+		blockOrder:  make([]string, 0),
+		blockHashes: make(map[string]string),
+		activeChain: make([]string, 0),
+		txnBlocks:   make(map[string][]string),
+		looseTxns:   make(map[string]reps.Transaction),
+		wallets:     make(map[string]reps.Wallet),
+		walletOrder: make([]string, 0),
+		hdWallets:   make(map[string]reps.HDWallet),
+		utxos:       make(map[string]reps.UTXO),
+	}
+}
+
+func (repo *memoryRepository) CreateTransaction(txns []reps.Transaction) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, txn := range txns {
+		repo.looseTxns[string(txn.ID)] = copyTransaction(txn)
+	}
+
+	return nil
+}
+
+// Add an input to a transaction saved with CreateTransaction
+func (repo *memoryRepository) CreateTxnInput(txnInput reps.TxnInput) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	txn, ok := repo.looseTxns[string(txnInput.CurrTxnID)]
+	if !ok {
+		return fmt.Errorf("%w, transaction %x of input", ErrNotFound, txnInput.CurrTxnID)
+	}
+	txn.Inputs = append(txn.Inputs, txnInput)
+	repo.looseTxns[string(txnInput.CurrTxnID)] = txn
+
+	return nil
+}
+
+// Add an output to a transaction saved with CreateTransaction
+func (repo *memoryRepository) CreateTxnOutput(txnOutput reps.TxnOutput) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	txn, ok := repo.looseTxns[string(txnOutput.CurrTxnID)]
+	if !ok {
+		return fmt.Errorf("%w, transaction %x of output", ErrNotFound, txnOutput.CurrTxnID)
+	}
+	txn.Outputs = append(txn.Outputs, txnOutput)
+	repo.looseTxns[string(txnOutput.CurrTxnID)] = txn
+
+	return nil
+}
+
+func (repo *memoryRepository) GetTransactionsByBlockId(blockId string) ([]reps.Transaction, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	return copyBlock(repo.blocks[blockId]).Transactions, nil
+}
+
+// Get all transactions in the active chain
+func (repo *memoryRepository) GetTransactions() ([]reps.Transaction, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	txns := make([]reps.Transaction, 0)
+	for _, blockId := range repo.activeChain {
+		txns = append(txns, copyBlock(repo.blocks[blockId]).Transactions...)
+	}
+
+	return txns, nil
+}
+
+// Get a single transaction. If it is in blocks on several branches, the copy in the active chain is preferred
+func (repo *memoryRepository) GetTransaction(txnId []byte) (reps.Transaction, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var found *reps.Transaction
+	for _, blockId := range repo.txnBlocks[string(txnId)] {
+		block := repo.blocks[blockId]
+		for i := range block.Transactions {
+			if !bytes.Equal(block.Transactions[i].ID, txnId) {
+				continue
+			}
+			if found == nil || block.Status == reps.BlockStatusActive {
+				found = &block.Transactions[i]
+			}
+		}
+	}
+
+	if found != nil {
+		return copyTransaction(*found), nil
+	}
+	if txn, ok := repo.looseTxns[string(txnId)]; ok {
+		return copyTransaction(txn), nil
+	}
+
+	return reps.Transaction{}, ErrNotFound
+}
+
+func (repo *memoryRepository) CreateBlock(block reps.Block, chainUpdate reps.ChainUpdate) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.blocks[block.ID]; ok {
+		return fmt.Errorf("block %s already exists", block.ID)
+	}
+
+	var tipHash []byte
+	if len(repo.activeChain) > 0 {
+		tipHash = repo.blocks[repo.activeChain[len(repo.activeChain)-1]].Hash
+	}
+	if err := checkTip(tipHash, chainUpdate); err != nil {
+		return err
+	}
+
+	block = copyBlock(block)
+	setBlockIds(&block)
+
+	repo.blocks[block.ID] = block
+	repo.blockOrder = append(repo.blockOrder, block.ID)
+	repo.blockHashes[string(block.Hash)] = block.ID
+	for _, txn := range block.Transactions {
+		repo.txnBlocks[string(txn.ID)] = append(repo.txnBlocks[string(txn.ID)], block.ID)
+	}
+
+	repo.setStatus(chainUpdate.Disconnected, reps.BlockStatusValidFork)
+	repo.setStatus(chainUpdate.Connected, reps.BlockStatusActive)
+
+	for _, utxo := range chainUpdate.Spent {
+		delete(repo.utxos, utxo.ID)
+	}
+	for _, utxo := range chainUpdate.Created {
+		repo.utxos[utxo.ID] = utxo
+	}
+
+	return nil
+}
+
+// Set the status of blocks, e.g. to mark them invalid
+func (repo *memoryRepository) UpdateBlockStatus(blockIds []string, status string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.setStatus(blockIds, status)
+	return nil
+}
+
+// Update block statuses and keep the active chain index in step. Must hold repo.mu
+func (repo *memoryRepository) setStatus(blockIds []string, status string) {
+	for _, blockId := range blockIds {
+		block, ok := repo.blocks[blockId]
+		if !ok {
+			continue
+		}
+		block.Status = status
+		repo.blocks[blockId] = block
+
+		if status == reps.BlockStatusActive {
+			for int64(len(repo.activeChain)) <= block.Height {
+				repo.activeChain = append(repo.activeChain, "")
+			}
+			repo.activeChain[block.Height] = blockId
+		} else if block.Height < int64(len(repo.activeChain)) && repo.activeChain[block.Height] == blockId {
+			repo.activeChain[block.Height] = ""
+		}
+	}
+
+	// A reorg onto a shorter branch leaves the top of the old chain empty
+	for len(repo.activeChain) > 0 && repo.activeChain[len(repo.activeChain)-1] == "" {
+		repo.activeChain = repo.activeChain[:len(repo.activeChain)-1]
+	}
+}
+
+func (repo *memoryRepository) GetGenesisBlock() (reps.Block, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	for _, blockId := range repo.blockOrder {
+		if len(repo.blocks[blockId].PrevHash) == 0 {
+			return copyBlock(repo.blocks[blockId]), nil
+		}
+	}
+
+	return reps.Block{}, ErrNotFound
+}
+
+// Get all blocks in the active chain, ordered by height
+func (repo *memoryRepository) GetBlockchain() ([]reps.Block, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	blocks := make([]reps.Block, 0, len(repo.activeChain))
+	for _, blockId := range repo.activeChain {
+		blocks = append(blocks, copyBlock(repo.blocks[blockId]))
+	}
+
+	return blocks, nil
+}
+
+// Get the last block in the blockchain, i.e. the tip of the active chain
+func (repo *memoryRepository) GetLastBlock() (reps.Block, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	if len(repo.activeChain) == 0 {
+		return reps.Block{}, ErrNotFound
+	}
+
+	return copyBlock(repo.blocks[repo.activeChain[len(repo.activeChain)-1]]), nil
+}
+
+func (repo *memoryRepository) GetBlockById(blockId string) (reps.Block, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	block, ok := repo.blocks[blockId]
+	if !ok {
+		return reps.Block{}, ErrNotFound
+	}
+
+	return copyBlock(block), nil
+}
+
+// Get a block on any branch by its hash
+func (repo *memoryRepository) GetBlockByHash(hash []byte) (reps.Block, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	blockId, ok := repo.blockHashes[string(hash)]
+	if !ok {
+		return reps.Block{}, ErrNotFound
+	}
+
+	return copyBlock(repo.blocks[blockId]), nil
+}
+
+// Get every block that no other block builds on, i.e. the head of each branch. Transactions are not loaded
+func (repo *memoryRepository) GetChainTips() ([]reps.Block, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	blocks := make([]reps.Block, 0, len(repo.blockOrder))
+	for _, blockId := range repo.blockOrder {
+		blocks = append(blocks, repo.blocks[blockId])
+	}
+
+	return chainTips(blocks), nil
+}
+
+// Get the block at a given height in the active chain
+func (repo *memoryRepository) GetBlockByHeight(height int64) (reps.Block, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	if height < 0 || height >= int64(len(repo.activeChain)) {
+		return reps.Block{}, ErrNotFound
+	}
+
+	return copyBlock(repo.blocks[repo.activeChain[height]]), nil
+}
+
+// Get all blocks in the active chain with a height between from and to (inclusive), ordered by height
+func (repo *memoryRepository) GetBlocksByHeight(from int64, to int64) ([]reps.Block, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	blocks := make([]reps.Block, 0)
+	for height := from; height <= to && height < int64(len(repo.activeChain)); height++ {
+		if height < 0 {
+			continue
+		}
+		blocks = append(blocks, copyBlock(repo.blocks[repo.activeChain[height]]))
+	}
+
+	return blocks, nil
+}
+
+func (repo *memoryRepository) CreateWallet(wallet reps.Wallet) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.wallets[wallet.Address]; ok {
+		return fmt.Errorf("wallet %s already exists", wallet.Address)
+	}
+	repo.wallets[wallet.Address] = wallet
+	repo.walletOrder = append(repo.walletOrder, wallet.Address)
+
+	return nil
+}
+
+func (repo *memoryRepository) GetWallet(address string) (reps.Wallet, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	wallet, ok := repo.wallets[address]
+	if !ok {
+		return reps.Wallet{}, ErrNotFound
+	}
+
+	return wallet, nil
+}
+
+func (repo *memoryRepository) GetWallets() ([]reps.Wallet, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	wallets := make([]reps.Wallet, 0, len(repo.walletOrder))
+	for _, address := range repo.walletOrder {
+		wallets = append(wallets, repo.wallets[address])
+	}
+
+	return wallets, nil
+}
+
+func (repo *memoryRepository) GetHDWalletAddresses(hdWalletId string) ([]reps.Wallet, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	wallets := make([]reps.Wallet, 0)
+	for _, address := range repo.walletOrder {
+		if wallet := repo.wallets[address]; wallet.HDWalletID == hdWalletId {
+			wallets = append(wallets, wallet)
+		}
+	}
+
+	return wallets, nil
+}
+
+func (repo *memoryRepository) UpdateWallet(wallet reps.Wallet) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.wallets[wallet.Address]; !ok {
+		return ErrNotFound
+	}
+	repo.wallets[wallet.Address] = wallet
+
+	return nil
+}
+
+func (repo *memoryRepository) CreateHDWallet(hdWallet reps.HDWallet) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.hdWallets[hdWallet.ID]; ok {
+		return fmt.Errorf("HD wallet %s already exists", hdWallet.ID)
+	}
+	repo.hdWallets[hdWallet.ID] = hdWallet
+
+	return nil
+}
+
+func (repo *memoryRepository) GetHDWallet(id string) (reps.HDWallet, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	hdWallet, ok := repo.hdWallets[id]
+	if !ok {
+		return reps.HDWallet{}, ErrNotFound
+	}
+
+	return hdWallet, nil
+}
+
+func (repo *memoryRepository) GetHDWallets() ([]reps.HDWallet, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	hdWallets := make([]reps.HDWallet, 0, len(repo.hdWallets))
+	for _, hdWallet := range repo.hdWallets {
+		hdWallets = append(hdWallets, hdWallet)
+	}
+
+	return hdWallets, nil
+}
+
+func (repo *memoryRepository) UpdateHDWallet(hdWallet reps.HDWallet) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.hdWallets[hdWallet.ID]; !ok {
+		return ErrNotFound
+	}
+	repo.hdWallets[hdWallet.ID] = hdWallet
+
+	return nil
+}
+
+func (repo *memoryRepository) GetUTXO(txnId []byte, outIdx int) (reps.UTXO, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	utxo, ok := repo.utxos[utxoId(txnId, outIdx)]
+	if !ok {
+		return reps.UTXO{}, ErrNotFound
+	}
+
+	return utxo, nil
+}
+
+// Get all unspent outputs locked with a public key hash
+func (repo *memoryRepository) GetUTXOs(pubKeyHash []byte) ([]reps.UTXO, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	utxos := make([]reps.UTXO, 0)
+	for _, utxo := range repo.sortedUTXOs() {
+		if bytes.Equal(utxo.PubKeyHash, pubKeyHash) {
+			utxos = append(utxos, utxo)
+		}
+	}
+
+	return utxos, nil
+}
+
+func (repo *memoryRepository) GetUTXOBalances() ([]reps.UTXOBalance, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	return utxoBalances(repo.sortedUTXOs()), nil
+}
+
+// Throw away the utxo set and replace it, e.g. after rebuilding it from the blocks
+func (repo *memoryRepository) ReplaceUTXOs(utxos []reps.UTXO) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.utxos = make(map[string]reps.UTXO, len(utxos))
+	for _, utxo := range utxos {
+		repo.utxos[utxo.ID] = utxo
+	}
+
+	return nil
+}
+
+// Utxos ordered by id, so results don't depend on map order. Must hold repo.mu
+func (repo *memoryRepository) sortedUTXOs() []reps.UTXO {
+	utxos := make([]reps.UTXO, 0, len(repo.utxos))
+	for _, utxo := range repo.utxos {
+		utxos = append(utxos, utxo)
+	}
+
+	sort.Slice(utxos, func(i, j int) bool {
+		return utxos[i].ID < utxos[j].ID
+	})
+
+	return utxos
+}
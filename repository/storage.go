@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/brucetieu/blockchain/db"
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/jinzhu/gorm"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Storage backends, chosen with the STORAGE_BACKEND env var
+// postgres -> Postgres through gorm, the default
+// memory -> Kept in memory, gone once the app stops
+// bolt -> Embedded bbolt database in the file at BOLT_PATH
+const (
+	PostgresBackend = "postgres"
+	MemoryBackend   = "memory"
+	BoltBackend     = "bolt"
+
+	defaultBoltPath = "blockchain.db"
+)
+
+var (
+	// Returned by the memory and bolt backends when a record doesn't exist. Same message as gorm's
+	ErrNotFound = errors.New("record not found")
+	// Returned by CreateBlock when another block changed the active chain after the chain update was worked out
+	ErrChainTipMoved = errors.New("the tip of the chain moved while the block was being added, try again")
+)
+
+// Whether err says a record doesn't exist, whichever backend returned it
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || gorm.IsRecordNotFoundError(err)
+}
+
+// Open the storage backend set in STORAGE_BACKEND
+func OpenBlockchainRepository() (BlockchainRepository, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+	log.Info("Storage backend: ", backend)
+
+	switch backend {
+	case "", PostgresBackend:
+		db.ConnectDatabase()
+		return NewBlockchainRepository(), nil
+	case MemoryBackend:
+		return NewMemoryRepository(), nil
+	case BoltBackend:
+		path := os.Getenv("BOLT_PATH")
+		if path == "" {
+			path = defaultBoltPath
+		}
+		return NewBoltRepository(path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %s, expected %s, %s or %s", backend, PostgresBackend, MemoryBackend, BoltBackend)
+	}
+}
+
+// Check the active tip is still the one a chain update was worked out against. Updates that don't connect blocks
+// leave the active chain alone, so they are fine whatever the tip is
+func checkTip(tipHash []byte, chainUpdate reps.ChainUpdate) error {
+	if len(chainUpdate.Connected) > 0 && !bytes.Equal(tipHash, chainUpdate.PrevTip) {
+		return ErrChainTipMoved
+	}
+	return nil
+}
+
+// Copy a block so callers can't change what is stored through shared slices
+func copyBlock(block reps.Block) reps.Block {
+	blockCopy := block
+	if block.Transactions != nil {
+		blockCopy.Transactions = make([]reps.Transaction, len(block.Transactions))
+		for i, txn := range block.Transactions {
+			blockCopy.Transactions[i] = copyTransaction(txn)
+		}
+	}
+	return blockCopy
+}
+
+func copyTransaction(txn reps.Transaction) reps.Transaction {
+	txnCopy := txn
+	txnCopy.Inputs = append([]reps.TxnInput{}, txn.Inputs...)
+	txnCopy.Outputs = append([]reps.TxnOutput{}, txn.Outputs...)
+	return txnCopy
+}
+
+// Stamp the block id on transactions and their inputs and outputs, like gorm does when saving associations
+func setBlockIds(block *reps.Block) {
+	for i := range block.Transactions {
+		txn := &block.Transactions[i]
+		txn.BlockID = block.ID
+		for j := range txn.Inputs {
+			txn.Inputs[j].BlockID = block.ID
+		}
+		for j := range txn.Outputs {
+			txn.Outputs[j].BlockID = block.ID
+		}
+	}
+}
+
+// Blocks that no other block builds on, most cumulative work first. Transactions are left out
+func chainTips(blocks []reps.Block) []reps.Block {
+	hasChild := make(map[string]bool)
+	for _, block := range blocks {
+		hasChild[string(block.PrevHash)] = true
+	}
+
+	tips := make([]reps.Block, 0)
+	for _, block := range blocks {
+		if !hasChild[string(block.Hash)] {
+			block.Transactions = nil
+			tips = append(tips, block)
+		}
+	}
+
+	sort.SliceStable(tips, func(i, j int) bool {
+		return tips[i].ChainWork > tips[j].ChainWork
+	})
+
+	return tips
+}
+
+// Total value of unspent outputs for each public key hash
+func utxoBalances(utxos []reps.UTXO) []reps.UTXOBalance {
+	balances := make([]reps.UTXOBalance, 0)
+	balanceIdx := make(map[string]int)
+
+	for _, utxo := range utxos {
+		idx, ok := balanceIdx[string(utxo.PubKeyHash)]
+		if !ok {
+			idx = len(balances)
+			balanceIdx[string(utxo.PubKeyHash)] = idx
+			balances = append(balances, reps.UTXOBalance{PubKeyHash: utxo.PubKeyHash})
+		}
+		balances[idx].Balance += utxo.Value
+	}
+
+	return balances
+}
+
+// Id of the utxo created by output outIdx of a transaction
+func utxoId(txnId []byte, outIdx int) string {
+	return fmt.Sprintf("%x:%d", txnId, outIdx)
+}
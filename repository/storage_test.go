@@ -0,0 +1,223 @@
+package repository
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Run a test against every backend that doesn't need an external database
+func forEachBackend(t *testing.T, test func(t *testing.T, repo BlockchainRepository)) {
+	t.Run(MemoryBackend, func(t *testing.T) {
+		test(t, NewMemoryRepository())
+	})
+
+	t.Run(BoltBackend, func(t *testing.T) {
+		repo, err := NewBoltRepository(filepath.Join(t.TempDir(), "blockchain.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { repo.(*boltRepository).Close() })
+		test(t, repo)
+	})
+}
+
+func TestBlockStorage(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo BlockchainRepository) {
+		genesis := testBlock("genesis", nil, 0, 1)
+		require.NoError(t, repo.CreateBlock(genesis, reps.ChainUpdate{Connected: []string{genesis.ID}}))
+		a1 := testBlock("a1", &genesis, 1, 2)
+		require.NoError(t, repo.CreateBlock(a1, reps.ChainUpdate{Connected: []string{a1.ID}, PrevTip: genesis.Hash}))
+
+		// A block worked out against an old tip is turned away, unless it only goes on a fork
+		b1 := testBlock("b1", &genesis, 1, 2)
+		assert.ErrorIs(t, repo.CreateBlock(b1, reps.ChainUpdate{Connected: []string{b1.ID}, PrevTip: genesis.Hash}), ErrChainTipMoved)
+		b1.Status = reps.BlockStatusValidFork
+		require.NoError(t, repo.CreateBlock(b1, reps.ChainUpdate{}))
+		assert.Error(t, repo.CreateBlock(b1, reps.ChainUpdate{}), "block already exists")
+
+		tip, err := repo.GetLastBlock()
+		require.NoError(t, err)
+		assert.Equal(t, a1.ID, tip.ID)
+
+		// Reorganize onto the b branch
+		b2 := testBlock("b2", &b1, 2, 3)
+		require.NoError(t, repo.CreateBlock(b2, reps.ChainUpdate{
+			Connected:    []string{b1.ID, b2.ID},
+			Disconnected: []string{a1.ID},
+			PrevTip:      a1.Hash,
+		}))
+
+		tip, err = repo.GetLastBlock()
+		require.NoError(t, err)
+		assert.Equal(t, b2.ID, tip.ID)
+		block, err := repo.GetBlockByHeight(1)
+		require.NoError(t, err)
+		assert.Equal(t, b1.ID, block.ID)
+		assert.Equal(t, reps.BlockStatusActive, block.Status)
+		block, err = repo.GetBlockById(a1.ID)
+		require.NoError(t, err)
+		assert.Equal(t, reps.BlockStatusValidFork, block.Status)
+
+		blocks, err := repo.GetBlocksByHeight(0, 5)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{genesis.ID, b1.ID, b2.ID}, blockIds(blocks))
+		blocks, err = repo.GetBlockchain()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{genesis.ID, b1.ID, b2.ID}, blockIds(blocks), "only the active chain")
+
+		tips, err := repo.GetChainTips()
+		require.NoError(t, err)
+		assert.Equal(t, []string{b2.ID, a1.ID}, blockIds(tips), "most work first")
+
+		block, err = repo.GetGenesisBlock()
+		require.NoError(t, err)
+		assert.Equal(t, genesis.ID, block.ID)
+		block, err = repo.GetBlockByHash(b1.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, b1.ID, block.ID)
+		require.Len(t, block.Transactions, 1)
+		assert.Equal(t, b1.ID, block.Transactions[0].BlockID)
+		_, err = repo.GetBlockByHash([]byte("missing"))
+		assert.Error(t, err)
+
+		require.NoError(t, repo.UpdateBlockStatus([]string{a1.ID}, reps.BlockStatusInvalid))
+		block, err = repo.GetBlockById(a1.ID)
+		require.NoError(t, err)
+		assert.Equal(t, reps.BlockStatusInvalid, block.Status)
+
+		txn, err := repo.GetTransaction(b2.Transactions[0].ID)
+		require.NoError(t, err)
+		assert.Equal(t, b2.ID, txn.BlockID)
+	})
+}
+
+func TestStoredBlocksCannotBeChangedThroughReturnedCopies(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo BlockchainRepository) {
+		genesis := testBlock("genesis", nil, 0, 1)
+		require.NoError(t, repo.CreateBlock(genesis, reps.ChainUpdate{Connected: []string{genesis.ID}}))
+		genesis.Transactions[0].Outputs[0].Value = 100
+
+		block, err := repo.GetBlockById(genesis.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 10, block.Transactions[0].Outputs[0].Value)
+		block.Transactions[0].Outputs[0].Value = 100
+
+		block, err = repo.GetBlockById(genesis.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 10, block.Transactions[0].Outputs[0].Value)
+	})
+}
+
+func TestUTXOStorage(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo BlockchainRepository) {
+		alice, bob := []byte("alice"), []byte("bob")
+		first := testUTXO([]byte{1}, 0, 10, alice)
+		second := testUTXO([]byte{1}, 1, 5, bob)
+		third := testUTXO([]byte{2}, 0, 3, alice)
+
+		genesis := testBlock("genesis", nil, 0, 1)
+		require.NoError(t, repo.CreateBlock(genesis, reps.ChainUpdate{
+			UTXOUpdate: reps.UTXOUpdate{Created: []reps.UTXO{first, second}},
+			Connected:  []string{genesis.ID},
+		}))
+		block := testBlock("block", &genesis, 1, 2)
+		require.NoError(t, repo.CreateBlock(block, reps.ChainUpdate{
+			UTXOUpdate: reps.UTXOUpdate{Spent: []reps.UTXO{second}, Created: []reps.UTXO{third}},
+			Connected:  []string{block.ID},
+			PrevTip:    genesis.Hash,
+		}))
+
+		utxo, err := repo.GetUTXO([]byte{1}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 10, utxo.Value)
+		_, err = repo.GetUTXO([]byte{1}, 1)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		utxos, err := repo.GetUTXOs(alice)
+		require.NoError(t, err)
+		assert.Len(t, utxos, 2)
+		utxos, err = repo.GetUTXOs(bob)
+		require.NoError(t, err)
+		assert.Empty(t, utxos)
+
+		balances, err := repo.GetUTXOBalances()
+		require.NoError(t, err)
+		assert.Equal(t, []reps.UTXOBalance{{PubKeyHash: alice, Balance: 13}}, balances)
+
+		require.NoError(t, repo.ReplaceUTXOs([]reps.UTXO{second}))
+		balances, err = repo.GetUTXOBalances()
+		require.NoError(t, err)
+		assert.Equal(t, []reps.UTXOBalance{{PubKeyHash: bob, Balance: 5}}, balances)
+	})
+}
+
+func TestWalletStorage(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo BlockchainRepository) {
+		hdWallet := reps.HDWallet{ID: "hd", Seed: []byte("seed")}
+		require.NoError(t, repo.CreateHDWallet(hdWallet))
+		first := reps.Wallet{ID: "1", Address: "first", HDWalletID: hdWallet.ID, DerivationPath: "m/0'/0'/0'"}
+		second := reps.Wallet{ID: "2", Address: "second"}
+		require.NoError(t, repo.CreateWallet(first))
+		require.NoError(t, repo.CreateWallet(second))
+		assert.Error(t, repo.CreateWallet(first), "wallet already exists")
+
+		wallets, err := repo.GetWallets()
+		require.NoError(t, err)
+		require.Len(t, wallets, 2)
+		assert.Equal(t, first.Address, wallets[0].Address, "in the order they were created")
+		wallets, err = repo.GetHDWalletAddresses(hdWallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []reps.Wallet{first}, wallets)
+
+		second.Retired, second.SweptTo = true, first.Address
+		require.NoError(t, repo.UpdateWallet(second))
+		wallet, err := repo.GetWallet(second.Address)
+		require.NoError(t, err)
+		assert.Equal(t, second, wallet)
+		_, err = repo.GetWallet("missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		hdWallet.SeedEncrypted = true
+		require.NoError(t, repo.UpdateHDWallet(hdWallet))
+		storedHDWallet, err := repo.GetHDWallet(hdWallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, hdWallet, storedHDWallet)
+		hdWallets, err := repo.GetHDWallets()
+		require.NoError(t, err)
+		assert.Len(t, hdWallets, 1)
+	})
+}
+
+// A block with a single transaction paying 10, whose hash is made up from its id
+func testBlock(id string, parent *reps.Block, height int64, work int) reps.Block {
+	block := reps.Block{
+		ID:        id,
+		Height:    height,
+		Hash:      []byte("hash-" + id),
+		ChainWork: fmt.Sprintf("%064x", work),
+		Status:    reps.BlockStatusActive,
+		Transactions: []reps.Transaction{{
+			ID:      []byte("txn-" + id),
+			Outputs: []reps.TxnOutput{{Value: 10}},
+		}},
+	}
+	if parent != nil {
+		block.PrevHash = parent.Hash
+	}
+	return block
+}
+
+func testUTXO(txnId []byte, outIdx int, value int, pubKeyHash []byte) reps.UTXO {
+	return reps.UTXO{ID: utxoId(txnId, outIdx), TxnID: txnId, OutIdx: outIdx, Value: value, PubKeyHash: pubKeyHash}
+}
+
+func blockIds(blocks []reps.Block) []string {
+	ids := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		ids = append(ids, block.ID)
+	}
+	return ids
+}
@@ -1,28 +1,70 @@
 package representations
 
-// Format of payload when mining a block
+// Format of payload when mining a block.
+// Either send From, To and Amount to mine a single transfer, or only Miner to mine all pending transactions.
+// Send From and Outputs instead of To and Amount to pay several addresses in one transaction.
+// Send Parent (hex block hash) with Miner to mine an empty block on top of any known block, e.g. to start a fork
+// TransferOptions optionally set the fee the transfer pays and how its inputs are picked
 type CreateBlockInput struct {
-	From   string `json:"from" binding:"required"`
-	To     string `json:"to" binding:"required"`
-	Amount int    `json:"amount" binding:"required"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Amount  int       `json:"amount"`
+	Outputs []Payment `json:"outputs"`
+	Miner   string    `json:"miner"`
+	Parent  string    `json:"parent"`
+	TransferOptions
 }
 
+// Status of a block
+// active -> On the branch with the most cumulative work
+// valid-fork -> Passed proof of work checks, but sits on a branch with less work
+// invalid -> Failed validation when its branch was connected
+const (
+	BlockStatusActive    = "active"
+	BlockStatusValidFork = "valid-fork"
+	BlockStatusInvalid   = "invalid"
+)
+
 // Block representation in bitcoin blockchain
+// ChainWork -> Total work of this block and all its ancestors, as a zero padded hex string so it sorts correctly
+// Status -> One of BlockStatusActive, BlockStatusValidFork or BlockStatusInvalid
+// Bits -> Proof of work target in compact form. 0 for blocks mined before difficulty was stored, which used the initial target
 type Block struct {
 	ID           string        `gorm:"primary_key;type:char(36);column:block_id"`
+	Height       int64         `json:"height" gorm:"index"`
 	Timestamp    int64         `json:"timestamp"`
 	Transactions []Transaction `json:"transactions" gorm:"foreignKey:BlockID"`
 	PrevHash     []byte        `json:"prevHash"`
 	Hash         []byte        `json:"hash"`
+	MerkleRoot   []byte        `json:"merkleRoot"`
 	Nounce       int64         `json:"nounce"`
+	Bits         uint32        `json:"bits" gorm:"type:bigint"`
+	ChainWork    string        `json:"chainWork"`
+	Status       string        `json:"status" gorm:"index"`
 }
 
-
 type ReadableBlock struct {
 	ID           string                `gorm:"primary_key;type:char(36);column:block_id"`
+	Height       int64                 `json:"height"`
 	Timestamp    int64                 `json:"timestamp"`
 	Transactions []ReadableTransaction `json:"transactions" gorm:"foreignKey:BlockID"`
 	PrevHash     string                `json:"prevHash"`
 	Hash         string                `json:"hash"`
+	MerkleRoot   string                `json:"merkleRoot"`
 	Nounce       int64                 `json:"nounce"`
+	Bits         string                `json:"bits"`
+	Difficulty   float64               `json:"difficulty"`
+	ChainWork    string                `json:"chainWork"`
+	Status       string                `json:"status"`
+}
+
+// A block without any children, i.e. the head of a branch
+// BranchLength -> Number of blocks between the tip and the active chain. 0 for the active tip
+type ChainTip struct {
+	BlockID      string `json:"blockId"`
+	Hash         string `json:"hash"`
+	Height       int64  `json:"height"`
+	ChainWork    string `json:"chainWork"`
+	BranchLength int64  `json:"branchLength"`
+	Status       string `json:"status"`
 }
@@ -3,3 +3,105 @@ package representations
 type CreateBlockchainInput struct {
 	To string `json:"to" binding:"required"`
 }
+
+// Result of validating a single block
+// Reason -> Why the block is invalid. Empty for valid blocks
+type BlockValidation struct {
+	BlockID string `json:"blockId"`
+	Hash    string `json:"hash"`
+	Valid   bool   `json:"valid"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Result of walking the blockchain from genesis to the last block
+// FirstInvalidBlock -> ID of the first block that failed validation, if any
+type ChainValidationReport struct {
+	Valid             bool              `json:"valid"`
+	BlocksChecked     int               `json:"blocksChecked"`
+	FirstInvalidBlock string            `json:"firstInvalidBlock,omitempty"`
+	Reason            string            `json:"reason,omitempty"`
+	Blocks            []BlockValidation `json:"blocks"`
+}
+
+// Coins in existence and when the block subsidy next halves
+// Circulating -> Total value of the utxo set
+// Issued -> Total subsidy blocks up to Height were allowed to claim. More than Circulating if miners claimed less
+// MaxSupply -> Coins there will be once the subsidy has halved down to 0
+// Subsidy -> What the coinbase of the next block can claim, on top of fees
+type SupplyInfo struct {
+	Height             int64 `json:"height"`
+	Circulating        int   `json:"circulating"`
+	Issued             int   `json:"issued"`
+	MaxSupply          int   `json:"maxSupply"`
+	Subsidy            int   `json:"subsidy"`
+	HalvingInterval    int64 `json:"halvingInterval"`
+	NextHalvingHeight  int64 `json:"nextHalvingHeight"`
+	BlocksUntilHalving int64 `json:"blocksUntilHalving"`
+	NextHalvingSubsidy int   `json:"nextHalvingSubsidy"`
+}
+
+// Current proof of work difficulty and when it changes next
+// Difficulty -> How many times harder the current target is than the easiest allowed target
+// AverageBlockTime -> Milliseconds per block since the last retarget
+// EstimatedNextBits -> Bits the next retarget would set if blocks keep coming at the average block time
+type DifficultyInfo struct {
+	Height                  int64   `json:"height"`
+	Bits                    string  `json:"bits"`
+	Target                  string  `json:"target"`
+	Difficulty              float64 `json:"difficulty"`
+	RetargetInterval        int64   `json:"retargetInterval"`
+	TargetBlockTime         int64   `json:"targetBlockTime"`
+	AverageBlockTime        int64   `json:"averageBlockTime"`
+	NextRetargetHeight      int64   `json:"nextRetargetHeight"`
+	BlocksUntilRetarget     int64   `json:"blocksUntilRetarget"`
+	EstimatedNextBits       string  `json:"estimatedNextBits"`
+	EstimatedNextDifficulty float64 `json:"estimatedNextDifficulty"`
+}
+
+// Hash rate of the miner
+// Hashes, DurationMs, HashesPerSecond and TimestampRolls -> For the last block mined
+// TimestampRolls -> How many times every nounce failed and the timestamp was moved forward
+// TotalHashes, TotalDurationMs and AverageHashesPerSecond -> Over every block mined since the app started
+type MiningStats struct {
+	Workers                int     `json:"workers"`
+	Hashes                 int64   `json:"hashes"`
+	DurationMs             int64   `json:"durationMs"`
+	HashesPerSecond        float64 `json:"hashesPerSecond"`
+	TimestampRolls         int     `json:"timestampRolls"`
+	BlocksMined            int64   `json:"blocksMined"`
+	TotalHashes            int64   `json:"totalHashes"`
+	TotalDurationMs        int64   `json:"totalDurationMs"`
+	AverageHashesPerSecond float64 `json:"averageHashesPerSecond"`
+}
+
+// Status of a mining job
+// queued -> Waiting for the jobs ahead of it to finish
+// mining -> Searching for a nounce
+// mined -> Block was added to the blockchain
+// failed -> Mining stopped with an error, or the job was cancelled
+// tip-moved -> Another block extended the tip first, so the block was dropped. Its transactions stay pending
+const (
+	MiningJobQueued   = "queued"
+	MiningJobMining   = "mining"
+	MiningJobMined    = "mined"
+	MiningJobFailed   = "failed"
+	MiningJobTipMoved = "tip-moved"
+)
+
+// A block being mined in the background
+// NouncesTried -> Hashes tried so far, updated while mining
+// ElapsedMs -> Time spent mining, not counting time in the queue
+// BlockID -> Id of the mined block, once the job has status mined
+type MiningJob struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	Miner        string `json:"miner"`
+	Parent       string `json:"parent,omitempty"`
+	NouncesTried int64  `json:"nouncesTried"`
+	ElapsedMs    int64  `json:"elapsedMs"`
+	BlockID      string `json:"blockId,omitempty"`
+	Error        string `json:"error,omitempty"`
+	CreatedAt    int64  `json:"createdAt"`
+	StartedAt    int64  `json:"startedAt,omitempty"`
+	FinishedAt   int64  `json:"finishedAt,omitempty"`
+}
@@ -0,0 +1,47 @@
+package representations
+
+// Wallet whose keys all come from the seed of a BIP39 mnemonic. Its addresses are saved as wallets with HDWalletID
+// set, each derived along the BIP44 path m/44'/0'/0'/chain/index
+// ID -> Hash160 of the master public key, so restoring the same mnemonic finds the same wallet
+// Seed -> BIP39 seed of the mnemonic, encrypted under the passphrase of the wallet once SeedEncrypted is set.
+// The mnemonic itself is only shown when the wallet is created
+// AccountXPub -> Extended public key of account 0, which derives the public keys of every address of the wallet
+type HDWallet struct {
+	ID            string `json:"id,omitempty" gorm:"primary_key"`
+	Seed          []byte `json:"seed,omitempty"`
+	SeedEncrypted bool   `json:"seedEncrypted" gorm:"not null;default:false"`
+	AccountXPub   string `json:"accountXPub,omitempty"`
+}
+
+// Format of payload when creating an HD wallet. Its seed is encrypted under Passphrase
+type CreateHDWalletInput struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// Format of payload when restoring an HD wallet. Its seed is encrypted under Passphrase, which replaces the
+// passphrase it had if the wallet already exists
+type RestoreHDWalletInput struct {
+	Mnemonic   string `json:"mnemonic" binding:"required"`
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// An address of an HD wallet.
+// Change -> Derived on the internal chain, for change back to the wallet rather than for receiving
+type HDAddress struct {
+	Address string `json:"address"`
+	Path    string `json:"path"`
+	Change  bool   `json:"change"`
+	Index   uint32 `json:"index"`
+	Balance int    `json:"balance"`
+}
+
+// An HD wallet with the addresses derived so far and what they hold.
+// Mnemonic -> Only set when the wallet is created. Write it down, it is the only way to restore the wallet
+// Balance -> Sum of the balances of all addresses
+type ReadableHDWallet struct {
+	ID          string      `json:"id"`
+	Mnemonic    string      `json:"mnemonic,omitempty"`
+	AccountXPub string      `json:"accountXPub"`
+	Balance     int         `json:"balance"`
+	Addresses   []HDAddress `json:"addresses"`
+}
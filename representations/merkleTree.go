@@ -49,9 +49,14 @@ func NewMerkleTree(txns [][]byte) *MerkleTree {
 		merkleNodes = append(merkleNodes, merkleNode)
 	}
 
-	// Build merkle tree from bottom up
+	// Build merkle tree from bottom up, until only the root is left
 	// e.g. 4 leafs = 7 nodes = 3 levels
-	for i := 0; i < len(txns)/2; i++ {
+	for len(merkleNodes) > 1 {
+		// Odd number of nodes on this level, so pair the last node with a copy of itself
+		if len(merkleNodes)%2 != 0 {
+			merkleNodes = append(merkleNodes, merkleNodes[len(merkleNodes)-1])
+		}
+
 		treeLevel := make([]*MerkleNode, 0)
 
 		for j := 0; j < len(merkleNodes); j += 2 {
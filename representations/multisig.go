@@ -0,0 +1,36 @@
+package representations
+
+// Format of payload when creating a multisig wallet.
+// Cosigners -> Addresses of the wallets whose public keys go into the redeem script, in that order
+// Threshold -> How many of the cosigners have to sign a spend
+type CreateMultisigWalletInput struct {
+	Cosigners []string `json:"cosigners" binding:"required"`
+	Threshold int      `json:"threshold" binding:"required"`
+}
+
+// Format of payload when a cosigner signs a multisig spend
+type SignMultisigSpendInput struct {
+	Signer string `json:"signer" binding:"required"`
+}
+
+// A wallet spent with signatures from Threshold of its Cosigners. Its address pays to the hash of RedeemScript
+// RedeemScript -> Disassembled redeem script
+type MultisigWallet struct {
+	Address      string   `json:"address"`
+	Threshold    int      `json:"threshold"`
+	Cosigners    []string `json:"cosigners"`
+	PublicKeys   []string `json:"publicKeys"`
+	RedeemScript string   `json:"redeemScript"`
+}
+
+// A transaction from a multisig wallet collecting signatures from its cosigners.
+// Signers -> Cosigners that have signed so far
+// Complete -> Threshold cosigners have signed and the transaction is in the mempool
+type MultisigSpend struct {
+	ID          string              `json:"id"`
+	From        string              `json:"from"`
+	Threshold   int                 `json:"threshold"`
+	Signers     []string            `json:"signers"`
+	Complete    bool                `json:"complete"`
+	Transaction ReadableTransaction `json:"transaction"`
+}
@@ -0,0 +1,46 @@
+package representations
+
+// A partially signed transaction, passed around as base64 between whoever creates, signs, combines and finalizes it.
+// Transaction -> The unsigned transaction. Its id stays the same as inputs get signed
+// Inputs -> What signing each input of the transaction needs, in the same order
+type PSBT struct {
+	Transaction Transaction            `json:"transaction"`
+	Inputs      []PartiallySignedInput `json:"inputs"`
+}
+
+// PrevOutput -> Output the input spends, so a signer doesn't need to look it up on the chain
+// RedeemScript -> Script a P2SH output pays to the hash of
+// Signatures -> Signatures so far, keyed by the hex public key each one verifies with
+// FinalScriptSig -> Unlocking script, set once the input is finalized
+type PartiallySignedInput struct {
+	PrevOutput     TxnOutput         `json:"prevOutput"`
+	RedeemScript   []byte            `json:"redeemScript,omitempty"`
+	Signatures     map[string][]byte `json:"signatures,omitempty"`
+	FinalScriptSig []byte            `json:"finalScriptSig,omitempty"`
+}
+
+// PSBT -> The base64 encoded document
+// Signatures -> Number of signatures each input has so far
+// Finalized -> Every input has its unlocking script, so the transaction can be broadcast
+type ReadablePSBT struct {
+	PSBT        string              `json:"psbt"`
+	Transaction ReadableTransaction `json:"transaction"`
+	Signatures  []int               `json:"signatures"`
+	Finalized   bool                `json:"finalized"`
+}
+
+// Format of payload for the PSBT steps that take a single document
+type PSBTDocumentInput struct {
+	PSBT string `json:"psbt" binding:"required"`
+}
+
+// Format of payload when signing a PSBT with the key of the wallet at Signer
+type SignPSBTInput struct {
+	PSBT   string `json:"psbt" binding:"required"`
+	Signer string `json:"signer" binding:"required"`
+}
+
+// Format of payload when combining copies of the same PSBT signed by different signers
+type CombinePSBTsInput struct {
+	PSBTs []string `json:"psbts" binding:"required"`
+}
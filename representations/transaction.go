@@ -2,62 +2,116 @@ package representations
 
 // import "github.com/google/uuid"
 
+// Format of payload when submitting a transaction to the mempool.
+// Either send To and Amount to pay a single address, or Outputs to pay several addresses in one transaction
+type CreateTransactionInput struct {
+	From    string    `json:"from" binding:"required"`
+	To      string    `json:"to"`
+	Amount  int       `json:"amount"`
+	Outputs []Payment `json:"outputs"`
+	TransferOptions
+}
+
+// Format of payload when submitting a transaction signed outside the app. Send either Hex, the hex encoded
+// serialized transaction, or the Transaction itself
+type RawTransactionInput struct {
+	Hex         string       `json:"hex"`
+	Transaction *Transaction `json:"transaction"`
+}
+
+// One recipient of a transfer
+type Payment struct {
+	To     string `json:"to"`
+	Amount int    `json:"amount"`
+}
+
+// Optional settings for how a transfer is built
+// Fee -> Fixed fee in coins paid to the miner
+// FeeRate -> Fee in coins per byte of the transaction, rounded up to a whole coin. Set at most one of Fee and FeeRate
+// CoinSelection -> How to pick the unspent outputs to spend: largest-first (the default), smallest-first, branch-and-bound or random-improve
+type TransferOptions struct {
+	Fee           int     `json:"fee"`
+	FeeRate       float64 `json:"feeRate"`
+	CoinSelection string  `json:"coinSelection"`
+}
+
 // ID -> Unique id of this transaction
-// BlockID -> Which block is this transaction in?
+// BlockID -> Which block is this transaction in? A transaction can be in one block on each competing branch, so ID and BlockID together form the key
 // Inputs and Outputs -> In both these tables, curr_txn_id is equal to id of transaction. This helps us to track which transaction did these inputs and outputs come from
+// Fee -> What the inputs are worth minus what the outputs are worth, collected by the miner. Left out of the hash when 0,
+// so transactions from before fees hash the same
 type Transaction struct {
 	ID      []byte      `json:"txnId" gorm:"primary_key"`
-	BlockID string      `json:"blockId"`
-	Inputs  []TxnInput  `json:"txnInputs" gorm:"foreignKey:CurrTxnID;association_foreignkey:ID"`
-	Outputs []TxnOutput `json:"txnOutputs" gorm:"foreignKey:CurrTxnID;association_foreignkey:ID"`
+	BlockID string      `json:"blockId" gorm:"primary_key"`
+	Inputs  []TxnInput  `json:"txnInputs" gorm:"foreignKey:CurrTxnID,BlockID;association_foreignkey:ID,BlockID"`
+	Outputs []TxnOutput `json:"txnOutputs" gorm:"foreignKey:CurrTxnID,BlockID;association_foreignkey:ID,BlockID"`
+	Fee     int         `json:"fee,omitempty" gorm:"not null;default:0"`
 }
 
+// Size -> Bytes the transaction takes up in a block
+// FeeRate -> Fee per byte
 type ReadableTransaction struct {
 	ID      string              `json:"id"`
 	BlockID string              `json:"blockId"`
 	Inputs  []ReadableTxnInput  `json:"txnInputs"`
 	Outputs []ReadableTxnOutput `json:"txnOutputs"`
+	Fee     int                 `json:"fee"`
+	Size    int                 `json:"size"`
+	FeeRate float64             `json:"feeRate"`
 }
 
+// ScriptSig -> Disassembled unlocking script
 type ReadableTxnInput struct {
 	CurrTxnID string `json:"currTxnId"`
 	PrevTxnID string `json:"prevTxnId"`
 	OutIdx    int    `json:"outIdx"`
+	ScriptSig string `json:"scriptSig,omitempty"`
 	PubKey    string `json:"pubKey"`
 	Signature string `json:"signature"`
 }
 
+// ScriptPubKey -> Disassembled locking script
 type ReadableTxnOutput struct {
-	CurrTxnID  string `json:"currTxnId"`
-	Value      int    `json:"value"`
-	PubKeyHash string `json:"pubKeyHash"`
+	CurrTxnID    string `json:"currTxnId"`
+	Value        int    `json:"value"`
+	PubKeyHash   string `json:"pubKeyHash"`
+	ScriptPubKey string `json:"scriptPubKey,omitempty"`
 }
 
 // InputID -> unique id of the TxnInput
 // CurrTxnId -> What transaction is this input currently in?
+// BlockID -> Which block is the transaction in? Not part of the transaction's hash
 // OutIdx -> From which output index was used to create this input?
 // PrevTxnID -> From which previous transaction was and ouptut used to create this input?
 // ScriptSig ->  Script which provides data to be used in an outputs ScriptPubKey
+// Signature and PubKey -> How inputs from before scripts unlocked outputs. An input without a ScriptSig is unlocked
+// as if its ScriptSig were <Signature> <PubKey>
 type TxnInput struct {
 	InputID string `json:"inputId" gorm:"primary_key"`
+	BlockID string `json:"-" gorm:"primary_key"`
 
 	CurrTxnID []byte `json:"currTxnId" gorm:"column:curr_txn_id"`
 	PrevTxnID []byte `json:"prevTxnId" gorm:"column:prev_txn_id"`
 	OutIdx    int    `json:"outIdx"`
-	// ScriptSig string `json:"scriptSig"`
+	ScriptSig []byte `json:"scriptSig,omitempty"`
 	Signature []byte `json:"signature"` // signature of the entire transaction
 	PubKey    []byte `json:"pubKey"`    // not hashed
 }
 
 // OutputID -> Unique id representing the output
 // CurrTxnID -> What transaction is this output currently in?
+// BlockID -> Which block is the transaction in? Not part of the transaction's hash
 // Value -> Stores coins
-// ScriptPubKey -> Value needed to unlock a transaction
+// ScriptPubKey -> Script an input has to satisfy to spend the output. Outputs from before scripts don't have one and
+// are spent as if it were a P2PKH script paying to PubKeyHash
+// PubKeyHash -> The public key hash (or for P2SH, script hash) the script pays to, so outputs can be looked up by address. Empty if the script
+// doesn't pay to one
 type TxnOutput struct {
 	OutputID string `json:"outputId" gorm:"primary_key"`
+	BlockID  string `json:"-" gorm:"primary_key"`
 
-	CurrTxnID  []byte `json:"currTxnId" gorm:"column:curr_txn_id"`
-	Value      int    `json:"value"`
-	PubKeyHash []byte `json:"pubKeyHash"` // locks the output
-	// ScriptPubKey string `json:"scriptPubKey"`
+	CurrTxnID    []byte `json:"currTxnId" gorm:"column:curr_txn_id"`
+	Value        int    `json:"value"`
+	PubKeyHash   []byte `json:"pubKeyHash"` // locks the output
+	ScriptPubKey []byte `json:"scriptPubKey,omitempty"`
 }
@@ -0,0 +1,41 @@
+package representations
+
+// An unspent transaction output. The utxos table holds every output on the blockchain that no input references yet
+// ID -> "<txnId>:<outIdx>", unique id of the output
+// TxnID -> Which transaction created this output?
+// OutIdx -> Index of this output in the transaction that created it
+// BlockID -> Which block is the creating transaction in?
+type UTXO struct {
+	ID         string `json:"id" gorm:"primary_key"`
+	TxnID      []byte `json:"txnId"`
+	OutIdx     int    `json:"outIdx"`
+	Value      int    `json:"value"`
+	PubKeyHash []byte `json:"pubKeyHash" gorm:"index"`
+	BlockID    string `json:"blockId"`
+}
+
+// Changes a block makes to the utxo set
+// Spent -> Outputs referenced by inputs in the block, these get removed
+// Created -> Outputs created by transactions in the block, these get added
+type UTXOUpdate struct {
+	Spent   []UTXO
+	Created []UTXO
+}
+
+// Changes a new block makes to the active chain
+// Connected -> Ids of blocks that become part of the active chain
+// Disconnected -> Ids of blocks that drop out of the active chain during a reorg
+// PrevTip -> Hash of the active tip the update was worked out against, empty if there was none yet. If any blocks are
+// connected, the update is only saved if this is still the tip
+type ChainUpdate struct {
+	UTXOUpdate
+	Connected    []string
+	Disconnected []string
+	PrevTip      []byte
+}
+
+// Total value of unspent outputs locked with a public key hash
+type UTXOBalance struct {
+	PubKeyHash []byte
+	Balance    int
+}
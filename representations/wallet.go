@@ -1,15 +1,98 @@
 package representations
 
+// PrivateKey -> Encrypted under the passphrase of the wallet once KeyEncrypted is set. Keys of HD wallet addresses
+// aren't saved, they are derived from the seed of the HD wallet when needed
+// RedeemScript -> Only set for multisig wallets. Their address pays to the hash of this script, and they have no keys of their own
+// WatchOnly -> Imported from an address or public key. The app has no private key for it, so it can only receive and be looked at
+// HDWalletID -> Set for addresses of an HD wallet, along with the DerivationPath of the key from the wallet's seed
+// Retired -> Set once the wallet is swept because its key may have leaked, along with SweptTo, the address its coins went to.
+// Nothing can be sent from it, other than another sweep
 type Wallet struct {
-	ID         string `json:"id,omitempty" gorm:"primary_key"`
-	Address    string `json:"address,omitempty"`
-	PrivateKey []byte `json:"privateKey,omitempty"`
-	PublicKey  string `json:"publicKey,omitempty"`
+	ID             string `json:"id,omitempty" gorm:"primary_key"`
+	Address        string `json:"address,omitempty"`
+	PrivateKey     []byte `json:"privateKey,omitempty"`
+	KeyEncrypted   bool   `json:"keyEncrypted" gorm:"not null;default:false"`
+	PublicKey      string `json:"publicKey,omitempty"`
+	RedeemScript   []byte `json:"redeemScript,omitempty"`
+	WatchOnly      bool   `json:"watchOnly" gorm:"not null;default:false"`
+	HDWalletID     string `json:"hdWalletId,omitempty" gorm:"index"`
+	DerivationPath string `json:"derivationPath,omitempty"`
+	Retired        bool   `json:"retired" gorm:"not null;default:false"`
+	SweptTo        string `json:"sweptTo,omitempty"`
+}
+
+// Format of payload when creating a wallet. Its key is encrypted under Passphrase
+type CreateWalletInput struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// Format of payload when unlocking a wallet.
+// Timeout -> Seconds the wallet stays unlocked for, 5 minutes if left out
+type UnlockWalletInput struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+	Timeout    int    `json:"timeout"`
+}
+
+// Format of payload when changing the passphrase of a wallet. Leave Passphrase empty for a wallet whose key isn't
+// encrypted yet
+type ChangePassphraseInput struct {
+	Passphrase    string `json:"passphrase"`
+	NewPassphrase string `json:"newPassphrase" binding:"required"`
+}
+
+// Format of payload when exporting the private key of a wallet.
+// Format -> wif or pem
+type ExportKeyInput struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+	Format     string `json:"format" binding:"required"`
+}
+
+// Private key of a wallet, encoded in Format
+type ExportedKey struct {
+	Address string `json:"address"`
+	Format  string `json:"format"`
+	Key     string `json:"key"`
+}
+
+// Format of payload when importing a wallet from its private key. The key is encrypted under Passphrase.
+// Format -> wif or pem, worked out from Key if left out
+type ImportKeyInput struct {
+	Key        string `json:"key" binding:"required"`
+	Format     string `json:"format"`
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// Format of payload when sweeping a wallet. Its coins go to To, or to a new wallet whose key is encrypted under
+// Passphrase if To is left out. TransferOptions set the fee, coin selection doesn't apply as every output is spent
+type SweepWalletInput struct {
+	To         string `json:"to"`
+	Passphrase string `json:"passphrase"`
+	TransferOptions
+}
+
+// Format of payload when importing a watch-only wallet. Send Address, PublicKey, or both
+type ImportWalletInput struct {
+	Address   string `json:"address"`
+	PublicKey string `json:"publicKey"`
 }
 
 // This represents balance information for a wallet (address)
+// HDWalletID -> Set for addresses of an HD wallet
+// GroupBalance -> What all addresses of the HD wallet hold together, or Balance for any other address. Change from an
+// HD wallet address goes to a new address, so its own Balance is only part of the picture
 type AddressBalance struct {
-	Address   string `json:"address,omitempty"`
-	PublicKey string `json:"publicKey,omitempty"`
-	Balance   int    `json:"balance"`
+	Address      string `json:"address,omitempty"`
+	PublicKey    string `json:"publicKey,omitempty"`
+	Balance      int    `json:"balance"`
+	HDWalletID   string `json:"hdWalletId,omitempty"`
+	GroupBalance int    `json:"groupBalance"`
+}
+
+// Result of checking an address before paying to it
+// Valid -> The address is well formed
+// Warning -> Set when the address is valid but coins sent to it may be lost: it belongs to a retired wallet whose key
+// may have leaked, or it isn't a wallet in the app, so only whoever holds its key elsewhere can spend them
+type AddressValidation struct {
+	Valid   bool   `json:"valid"`
+	Warning string `json:"warning,omitempty"`
 }
@@ -1,29 +1,63 @@
 package routes
 
 import (
+	"os"
+
 	"github.com/brucetieu/blockchain/handlers"
 	"github.com/brucetieu/blockchain/repository"
 	"github.com/brucetieu/blockchain/services"
 	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
 )
 
-func InitRoutes(route *gin.Engine) {
+// Wire up the services on top of blockchainRepo and register every route
+func InitRoutes(route *gin.Engine, blockchainRepo repository.BlockchainRepository) {
 	services.BlockAssembler = services.NewBlockAssemblerFac()
 	services.TxnAssembler = services.NewTxnAssemblerFac()
 	services.WalletAssembler = services.NewWalletAssemblerFac()
 
-	blockchainRepo := repository.NewBlockchainRepository()
-	blockService := services.NewBlockService(blockchainRepo)
-
 	walletService := services.NewWalletService(blockchainRepo)
-	transactionService := services.NewTransactionService(blockchainRepo, walletService)
-	blockchainService := services.NewBlockchainService(blockchainRepo, blockService, transactionService, walletService)
+	signer, err := services.OpenSigner(walletService)
+	if err != nil {
+		log.Fatal("Error opening signer: ", err.Error())
+	}
+	mempoolIndex := services.NewMempoolIndex()
+	hdWalletService := services.NewHDWalletService(blockchainRepo, walletService, mempoolIndex)
+	transactionService := services.NewTransactionService(blockchainRepo, walletService, mempoolIndex, signer, hdWalletService)
+	mempoolService := services.NewMempoolService(transactionService, walletService, mempoolIndex)
+	difficultyService := services.NewDifficultyService(blockchainRepo)
+	supplyService := services.NewSupplyService(blockchainRepo)
+	validationService := services.NewValidationService(blockchainRepo, transactionService, difficultyService)
+	blockService := services.NewBlockService(blockchainRepo, validationService, mempoolService, difficultyService)
+	blockchainService := services.NewBlockchainService(blockchainRepo, blockService, transactionService, walletService, mempoolService)
+
+	miningJobService := services.NewMiningJobService(blockchainService, mempoolService, walletService)
+	multisigService := services.NewMultisigService(walletService, transactionService, mempoolService, signer)
+	psbtService := services.NewPSBTService(transactionService, walletService, mempoolService, signer)
 
 	blockchainHandler := handlers.NewBlockchainHandler(blockchainService)
+	miningJobHandler := handlers.NewMiningJobHandler(miningJobService, walletService)
 	transactionHandler := handlers.NewTransactionHandler(transactionService)
 	walletHandler := handlers.NewWalletHandler(walletService)
+	mempoolHandler := handlers.NewMempoolHandler(mempoolService, walletService)
+	validationHandler := handlers.NewValidationHandler(validationService)
+	difficultyHandler := handlers.NewDifficultyHandler(difficultyService)
+	supplyHandler := handlers.NewSupplyHandler(supplyService)
+	multisigHandler := handlers.NewMultisigHandler(multisigService, walletService)
+	psbtHandler := handlers.NewPSBTHandler(psbtService, walletService)
+	hdWalletHandler := handlers.NewHDWalletHandler(hdWalletService, walletService)
+
+	// Encrypt keys saved before keys were encrypted at rest
+	if _, err := walletService.EncryptStoredKeys(os.Getenv("WALLET_MIGRATION_PASSPHRASE")); err != nil {
+		log.WithField("error", err.Error()).Warn("Wallet keys are not encrypted, set WALLET_MIGRATION_PASSPHRASE to encrypt them")
+	}
+
+	// Check the stored blockchain hasn't been tampered with before serving requests
+	if _, err := validationService.ValidateBlockchain(); err != nil {
+		log.WithField("error", err.Error()).Error("Error running startup integrity check")
+	}
 
 	groupRoute := route.Group("/")
 
@@ -33,23 +67,66 @@ func InitRoutes(route *gin.Engine) {
 	// Blockchain handlers
 	groupRoute.POST("/bitcoin/blockchain", blockchainHandler.CreateBlockchain)
 	groupRoute.GET("/bitcoin/blockchain", blockchainHandler.GetBlockchain)
+	groupRoute.GET("/bitcoin/blockchain/validate", validationHandler.ValidateBlockchain)
+	groupRoute.GET("/bitcoin/blockchain/tips", blockchainHandler.GetChainTips)
+	groupRoute.GET("/bitcoin/blockchain/difficulty", difficultyHandler.GetDifficulty)
+	groupRoute.GET("/bitcoin/blockchain/supply", supplyHandler.GetSupply)
+	groupRoute.GET("/bitcoin/blockchain/mining/stats", blockchainHandler.GetMiningStats)
+	groupRoute.GET("/bitcoin/blockchain/mining/jobs/:jobId", miningJobHandler.GetMiningJob)
+	groupRoute.DELETE("/bitcoin/blockchain/mining/jobs/:jobId", miningJobHandler.CancelMiningJob)
 
 	// Block handlers
-	groupRoute.POST("/bitcoin/blockchain/block", blockchainHandler.AddToBlockchain)
+	groupRoute.POST("/bitcoin/blockchain/block", miningJobHandler.AddToBlockchain)
 	groupRoute.GET("/bitcoin/blockchain/block/genesis", blockchainHandler.GetGenesisBlock)
 	groupRoute.GET("/bitcoin/blockchain/block/last", blockchainHandler.GetLastBlock)
+	groupRoute.GET("/bitcoin/blockchain/block/height/:height", blockchainHandler.GetBlockByHeight)
 	groupRoute.GET("/bitcoin/blockchain/block/:blockId", blockchainHandler.GetBlock)
 
 	// Transaction handlers
 	groupRoute.GET("/bitcoin/blockchain/transactions", transactionHandler.GetTransactions)
+	groupRoute.POST("/bitcoin/blockchain/transactions", mempoolHandler.CreateTransaction)
+	groupRoute.POST("/bitcoin/blockchain/transactions/raw", mempoolHandler.SubmitRawTransaction)
+	groupRoute.GET("/bitcoin/blockchain/transactions/pending", mempoolHandler.GetPendingTransactions)
 	groupRoute.GET("/bitcoin/blockchain/transactions/:transactionId", transactionHandler.GetTransaction)
 
 	// Wallet handlers
 	groupRoute.POST("/bitcoin/blockchain/wallets", walletHandler.CreateWallet)
+	groupRoute.POST("/bitcoin/blockchain/wallets/import", walletHandler.ImportWallet)
+	groupRoute.POST("/bitcoin/blockchain/wallets/import/key", walletHandler.ImportKey)
 	groupRoute.GET("/bitcoin/blockchain/wallets", walletHandler.GetWallets)
 	groupRoute.GET("/bitcoin/blockchain/wallets/balances", transactionHandler.GetBalances)
 	groupRoute.GET("/bitcoin/blockchain/wallets/:address", walletHandler.GetWallet)
 	groupRoute.GET("/bitcoin/blockchain/wallets/:address/balance", transactionHandler.GetBalance)
+	groupRoute.GET("/bitcoin/blockchain/wallets/:address/transactions", transactionHandler.GetAddressTransactions)
+	groupRoute.POST("/bitcoin/blockchain/wallets/:address/unlock", walletHandler.UnlockWallet)
+	groupRoute.POST("/bitcoin/blockchain/wallets/:address/lock", walletHandler.LockWallet)
+	groupRoute.PUT("/bitcoin/blockchain/wallets/:address/passphrase", walletHandler.ChangePassphrase)
+	groupRoute.POST("/bitcoin/blockchain/wallets/:address/export", walletHandler.ExportKey)
+	groupRoute.POST("/bitcoin/blockchain/wallets/:address/sweep", mempoolHandler.SweepWallet)
+
+	// HD wallet handlers
+	groupRoute.POST("/bitcoin/blockchain/hdwallets", hdWalletHandler.CreateHDWallet)
+	groupRoute.POST("/bitcoin/blockchain/hdwallets/restore", hdWalletHandler.RestoreHDWallet)
+	groupRoute.GET("/bitcoin/blockchain/hdwallets/:hdWalletId", hdWalletHandler.GetHDWallet)
+	groupRoute.POST("/bitcoin/blockchain/hdwallets/:hdWalletId/addresses/:chain", hdWalletHandler.DeriveAddress)
+	groupRoute.POST("/bitcoin/blockchain/hdwallets/:hdWalletId/unlock", hdWalletHandler.UnlockHDWallet)
+	groupRoute.POST("/bitcoin/blockchain/hdwallets/:hdWalletId/lock", hdWalletHandler.LockHDWallet)
+	groupRoute.PUT("/bitcoin/blockchain/hdwallets/:hdWalletId/passphrase", hdWalletHandler.ChangeHDWalletPassphrase)
+
+	// Multisig handlers
+	groupRoute.POST("/bitcoin/blockchain/multisig/wallets", multisigHandler.CreateMultisigWallet)
+	groupRoute.GET("/bitcoin/blockchain/multisig/wallets/:address", multisigHandler.GetMultisigWallet)
+	groupRoute.POST("/bitcoin/blockchain/multisig/spends", multisigHandler.CreateMultisigSpend)
+	groupRoute.GET("/bitcoin/blockchain/multisig/spends/:spendId", multisigHandler.GetMultisigSpend)
+	groupRoute.POST("/bitcoin/blockchain/multisig/spends/:spendId/signatures", multisigHandler.SignMultisigSpend)
+
+	// PSBT handlers
+	groupRoute.POST("/bitcoin/blockchain/psbt", psbtHandler.CreatePSBT)
+	groupRoute.POST("/bitcoin/blockchain/psbt/decode", psbtHandler.DecodePSBT)
+	groupRoute.POST("/bitcoin/blockchain/psbt/sign", psbtHandler.SignPSBT)
+	groupRoute.POST("/bitcoin/blockchain/psbt/combine", psbtHandler.CombinePSBTs)
+	groupRoute.POST("/bitcoin/blockchain/psbt/finalize", psbtHandler.FinalizePSBT)
+	groupRoute.POST("/bitcoin/blockchain/psbt/broadcast", psbtHandler.BroadcastPSBT)
 
 	// swagger
 	groupRoute.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -0,0 +1,570 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Limits that keep scripts cheap to run, the same as Bitcoin's
+const (
+	MaxScriptSize         = 10000
+	MaxElementSize        = 520
+	MaxStackSize          = 1000
+	MaxOpsPerScript       = 201
+	MaxPubKeysPerMultiSig = 20
+)
+
+// The scripts ran, but left false on top of the stack
+var ErrScriptFalse = errors.New("script evaluated to false")
+
+// Checks a signature found by OP_CHECKSIG or OP_CHECKMULTISIG. subscript is the script being run, which is what
+// the signature commits to along with the transaction
+type SignatureChecker interface {
+	CheckSignature(signature []byte, pubKey []byte, subscript []byte) bool
+}
+
+// Run the unlocking script of an input followed by the locking script of the output it spends. The spend is
+// valid if neither fails and they leave true on top of the stack.
+// If the locking script is P2SH, the last item the unlocking script pushed is the redeem script. It is run as well,
+// on the rest of what the unlocking script pushed, and also has to leave true on top of the stack
+func Execute(scriptSig []byte, scriptPubKey []byte, checker SignatureChecker) error {
+	if !IsPushOnly(scriptSig) {
+		return fmt.Errorf("unlocking script can only push data")
+	}
+
+	vm := &engine{checker: checker}
+	if err := vm.run(scriptSig); err != nil {
+		return fmt.Errorf("unlocking script: %w", err)
+	}
+	pushed := append([][]byte{}, vm.stack...)
+
+	if err := vm.run(scriptPubKey); err != nil {
+		return fmt.Errorf("locking script: %w", err)
+	}
+	if !vm.succeeded() {
+		return ErrScriptFalse
+	}
+
+	if ExtractScriptHash(scriptPubKey) == nil {
+		return nil
+	}
+
+	// The locking script checked the redeem script hashes to the right value
+	redeemScript := pushed[len(pushed)-1]
+	vm.stack = pushed[:len(pushed)-1]
+	if err := vm.run(redeemScript); err != nil {
+		return fmt.Errorf("redeem script: %w", err)
+	}
+	if !vm.succeeded() {
+		return ErrScriptFalse
+	}
+	return nil
+}
+
+// Stack machine. The main stack carries over from one script to the next, the alt stack doesn't
+type engine struct {
+	checker  SignatureChecker
+	stack    [][]byte
+	altStack [][]byte
+}
+
+func (vm *engine) run(script []byte) error {
+	if len(script) > MaxScriptSize {
+		return fmt.Errorf("script is %d bytes, more than the maximum of %d", len(script), MaxScriptSize)
+	}
+
+	instructions, err := parse(script)
+	if err != nil {
+		return err
+	}
+
+	vm.altStack = nil
+	// Whether each enclosing OP_IF branch is being executed
+	conditions := make([]bool, 0)
+	ops := 0
+
+	for _, instr := range instructions {
+		if len(instr.data) > MaxElementSize {
+			return fmt.Errorf("push of %d bytes is more than the maximum of %d", len(instr.data), MaxElementSize)
+		}
+		if instr.opcode > Op16 {
+			ops++
+			if ops > MaxOpsPerScript {
+				return fmt.Errorf("script runs more than %d opcodes", MaxOpsPerScript)
+			}
+		}
+
+		executing := true
+		for _, condition := range conditions {
+			executing = executing && condition
+		}
+
+		switch instr.opcode {
+		case OpIf, OpNotIf:
+			branch := false
+			if executing {
+				top, err := vm.pop()
+				if err != nil {
+					return err
+				}
+				branch = asBool(top) == (instr.opcode == OpIf)
+			}
+			conditions = append(conditions, branch)
+			continue
+		case OpElse:
+			if len(conditions) == 0 {
+				return fmt.Errorf("OP_ELSE without OP_IF")
+			}
+			conditions[len(conditions)-1] = !conditions[len(conditions)-1]
+			continue
+		case OpEndIf:
+			if len(conditions) == 0 {
+				return fmt.Errorf("OP_ENDIF without OP_IF")
+			}
+			conditions = conditions[:len(conditions)-1]
+			continue
+		}
+
+		if !executing {
+			continue
+		}
+
+		if err := vm.step(instr, script, &ops); err != nil {
+			return fmt.Errorf("%s: %w", OpcodeName(instr.opcode), err)
+		}
+
+		if len(vm.stack)+len(vm.altStack) > MaxStackSize {
+			return fmt.Errorf("stack holds more than %d items", MaxStackSize)
+		}
+	}
+
+	if len(conditions) != 0 {
+		return fmt.Errorf("OP_IF without OP_ENDIF")
+	}
+	return nil
+}
+
+// Run a single opcode that isn't flow control
+func (vm *engine) step(instr instruction, script []byte, ops *int) error {
+	opcode := instr.opcode
+
+	switch {
+	case opcode <= OpPushData4:
+		vm.push(instr.data)
+		return nil
+	case opcode == Op1Negate:
+		vm.push(encodeNumber(-1))
+		return nil
+	case opcode >= Op1 && opcode <= Op16:
+		vm.push(encodeNumber(int64(opcode - Op1 + 1)))
+		return nil
+	}
+
+	switch opcode {
+	case OpNop:
+	case OpVerify:
+		return vm.verify()
+	case OpReturn:
+		return fmt.Errorf("output is unspendable")
+
+	case OpToAltStack:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.altStack = append(vm.altStack, top)
+	case OpFromAltStack:
+		if len(vm.altStack) == 0 {
+			return fmt.Errorf("alt stack is empty")
+		}
+		vm.push(vm.altStack[len(vm.altStack)-1])
+		vm.altStack = vm.altStack[:len(vm.altStack)-1]
+	case Op2Drop:
+		if _, err := vm.popN(2); err != nil {
+			return err
+		}
+	case Op2Dup:
+		return vm.dupN(2)
+	case Op3Dup:
+		return vm.dupN(3)
+	case Op2Over:
+		if len(vm.stack) < 4 {
+			return errStackTooSmall(4)
+		}
+		vm.push(vm.stack[len(vm.stack)-4])
+		vm.push(vm.stack[len(vm.stack)-4])
+	case Op2Swap:
+		items, err := vm.popN(4)
+		if err != nil {
+			return err
+		}
+		vm.push(items[2])
+		vm.push(items[3])
+		vm.push(items[0])
+		vm.push(items[1])
+	case OpIfDup:
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		if asBool(top) {
+			vm.push(top)
+		}
+	case OpDepth:
+		vm.push(encodeNumber(int64(len(vm.stack))))
+	case OpDrop:
+		if _, err := vm.pop(); err != nil {
+			return err
+		}
+	case OpDup:
+		return vm.dupN(1)
+	case OpNip:
+		items, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.push(items[1])
+	case OpOver:
+		second, err := vm.peek(1)
+		if err != nil {
+			return err
+		}
+		vm.push(second)
+	case OpPick, OpRoll:
+		n, err := vm.popNumber()
+		if err != nil {
+			return err
+		}
+		if n < 0 || n >= int64(len(vm.stack)) {
+			return fmt.Errorf("cannot reach item %d of a stack of %d", n, len(vm.stack))
+		}
+		idx := len(vm.stack) - 1 - int(n)
+		item := vm.stack[idx]
+		if opcode == OpRoll {
+			vm.stack = append(vm.stack[:idx], vm.stack[idx+1:]...)
+		}
+		vm.push(item)
+	case OpRot:
+		items, err := vm.popN(3)
+		if err != nil {
+			return err
+		}
+		vm.push(items[1])
+		vm.push(items[2])
+		vm.push(items[0])
+	case OpSwap:
+		items, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.push(items[1])
+		vm.push(items[0])
+	case OpTuck:
+		items, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.push(items[1])
+		vm.push(items[0])
+		vm.push(items[1])
+	case OpSize:
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		vm.push(encodeNumber(int64(len(top))))
+
+	case OpEqual, OpEqualVerify:
+		items, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		vm.push(fromBool(bytes.Equal(items[0], items[1])))
+		if opcode == OpEqualVerify {
+			return vm.verify()
+		}
+
+	case Op1Add, Op1Sub, OpNegate, OpAbs, OpNot, Op0NotEqual:
+		n, err := vm.popNumber()
+		if err != nil {
+			return err
+		}
+		vm.push(unaryOp(opcode, n))
+	case OpAdd, OpSub, OpBoolAnd, OpBoolOr, OpNumEqual, OpNumEqualVerify, OpNumNotEqual,
+		OpLessThan, OpGreaterThan, OpLessThanOrEqual, OpGreaterThanOrEqual, OpMin, OpMax:
+		b, err := vm.popNumber()
+		if err != nil {
+			return err
+		}
+		a, err := vm.popNumber()
+		if err != nil {
+			return err
+		}
+		vm.push(binaryOp(opcode, a, b))
+		if opcode == OpNumEqualVerify {
+			return vm.verify()
+		}
+	case OpWithin:
+		max, err := vm.popNumber()
+		if err != nil {
+			return err
+		}
+		min, err := vm.popNumber()
+		if err != nil {
+			return err
+		}
+		x, err := vm.popNumber()
+		if err != nil {
+			return err
+		}
+		vm.push(fromBool(min <= x && x < max))
+
+	case OpRipemd160, OpSha256, OpHash160, OpHash256:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.push(hashOp(opcode, top))
+	case OpCheckSig, OpCheckSigVerify:
+		items, err := vm.popN(2)
+		if err != nil {
+			return err
+		}
+		signature, pubKey := items[0], items[1]
+		vm.push(fromBool(len(signature) > 0 && vm.checker.CheckSignature(signature, pubKey, script)))
+		if opcode == OpCheckSigVerify {
+			return vm.verify()
+		}
+	case OpCheckMultiSig, OpCheckMultiSigVerify:
+		valid, err := vm.checkMultiSig(script, ops)
+		if err != nil {
+			return err
+		}
+		vm.push(fromBool(valid))
+		if opcode == OpCheckMultiSigVerify {
+			return vm.verify()
+		}
+
+	default:
+		return fmt.Errorf("opcode is not supported")
+	}
+
+	return nil
+}
+
+// Stack, from the top: n, n public keys, m, m signatures, and an empty dummy item. Bitcoin's OP_CHECKMULTISIG pops
+// one item more than it uses, and the extra item has to be empty. Signatures have to be in the same order as their keys
+func (vm *engine) checkMultiSig(script []byte, ops *int) (bool, error) {
+	nKeys, err := vm.popNumber()
+	if err != nil {
+		return false, err
+	}
+	if nKeys < 0 || nKeys > MaxPubKeysPerMultiSig {
+		return false, fmt.Errorf("%d public keys, expected 0 to %d", nKeys, MaxPubKeysPerMultiSig)
+	}
+	*ops += int(nKeys)
+	if *ops > MaxOpsPerScript {
+		return false, fmt.Errorf("script runs more than %d opcodes", MaxOpsPerScript)
+	}
+	pubKeys, err := vm.popN(int(nKeys))
+	if err != nil {
+		return false, err
+	}
+
+	nSigs, err := vm.popNumber()
+	if err != nil {
+		return false, err
+	}
+	if nSigs < 0 || nSigs > nKeys {
+		return false, fmt.Errorf("%d signatures for %d public keys", nSigs, nKeys)
+	}
+	signatures, err := vm.popN(int(nSigs))
+	if err != nil {
+		return false, err
+	}
+
+	dummy, err := vm.pop()
+	if err != nil {
+		return false, err
+	}
+	if len(dummy) != 0 {
+		return false, fmt.Errorf("dummy item has to be empty")
+	}
+
+	keyIdx := 0
+	for _, signature := range signatures {
+		matched := false
+		for keyIdx < len(pubKeys) && !matched {
+			matched = len(signature) > 0 && vm.checker.CheckSignature(signature, pubKeys[keyIdx], script)
+			keyIdx++
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Whether the scripts run so far left true on top of the stack
+func (vm *engine) succeeded() bool {
+	return len(vm.stack) > 0 && asBool(vm.stack[len(vm.stack)-1])
+}
+
+func (vm *engine) push(item []byte) {
+	vm.stack = append(vm.stack, item)
+}
+
+func (vm *engine) pop() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, errStackTooSmall(1)
+	}
+	top := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return top, nil
+}
+
+// Pop the top n items, keeping their order: the last item returned was the top of the stack
+func (vm *engine) popN(n int) ([][]byte, error) {
+	if len(vm.stack) < n {
+		return nil, errStackTooSmall(n)
+	}
+	items := append([][]byte{}, vm.stack[len(vm.stack)-n:]...)
+	vm.stack = vm.stack[:len(vm.stack)-n]
+	return items, nil
+}
+
+// Item depth places below the top of the stack
+func (vm *engine) peek(depth int) ([]byte, error) {
+	if len(vm.stack) <= depth {
+		return nil, errStackTooSmall(depth + 1)
+	}
+	return vm.stack[len(vm.stack)-1-depth], nil
+}
+
+func (vm *engine) popNumber() (int64, error) {
+	top, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeNumber(top)
+}
+
+// Copy the top n items
+func (vm *engine) dupN(n int) error {
+	if len(vm.stack) < n {
+		return errStackTooSmall(n)
+	}
+	vm.stack = append(vm.stack, vm.stack[len(vm.stack)-n:]...)
+	return nil
+}
+
+// Pop the top item and fail unless it is true
+func (vm *engine) verify() error {
+	top, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(top) {
+		return fmt.Errorf("verify failed")
+	}
+	return nil
+}
+
+func errStackTooSmall(needed int) error {
+	return fmt.Errorf("needs %d items on the stack", needed)
+}
+
+func unaryOp(opcode byte, n int64) []byte {
+	switch opcode {
+	case Op1Add:
+		n++
+	case Op1Sub:
+		n--
+	case OpNegate:
+		n = -n
+	case OpAbs:
+		if n < 0 {
+			n = -n
+		}
+	case OpNot:
+		return encodeNumber(boolNumber(n == 0))
+	case Op0NotEqual:
+		return encodeNumber(boolNumber(n != 0))
+	}
+	return encodeNumber(n)
+}
+
+func binaryOp(opcode byte, a int64, b int64) []byte {
+	switch opcode {
+	case OpAdd:
+		return encodeNumber(a + b)
+	case OpSub:
+		return encodeNumber(a - b)
+	case OpBoolAnd:
+		return encodeNumber(boolNumber(a != 0 && b != 0))
+	case OpBoolOr:
+		return encodeNumber(boolNumber(a != 0 || b != 0))
+	case OpNumEqual, OpNumEqualVerify:
+		return encodeNumber(boolNumber(a == b))
+	case OpNumNotEqual:
+		return encodeNumber(boolNumber(a != b))
+	case OpLessThan:
+		return encodeNumber(boolNumber(a < b))
+	case OpGreaterThan:
+		return encodeNumber(boolNumber(a > b))
+	case OpLessThanOrEqual:
+		return encodeNumber(boolNumber(a <= b))
+	case OpGreaterThanOrEqual:
+		return encodeNumber(boolNumber(a >= b))
+	case OpMin:
+		if b < a {
+			return encodeNumber(b)
+		}
+		return encodeNumber(a)
+	default: // OpMax
+		if b > a {
+			return encodeNumber(b)
+		}
+		return encodeNumber(a)
+	}
+}
+
+func boolNumber(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func hashOp(opcode byte, data []byte) []byte {
+	switch opcode {
+	case OpRipemd160:
+		return ripemd(data)
+	case OpSha256:
+		hash := sha256.Sum256(data)
+		return hash[:]
+	case OpHash160:
+		return Hash160(data)
+	default: // OpHash256
+		first := sha256.Sum256(data)
+		second := sha256.Sum256(first[:])
+		return second[:]
+	}
+}
+
+// ripemd160(sha256(data)), which is how public keys are hashed into addresses
+func Hash160(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	return ripemd(hash[:])
+}
+
+func ripemd(data []byte) []byte {
+	hasher := ripemd160.New()
+	hasher.Write(data)
+	return hasher.Sum(nil)
+}
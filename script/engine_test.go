@@ -0,0 +1,153 @@
+package script
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Accepts a signature if it is "sig:" followed by the public key
+type fakeChecker struct{}
+
+func (fakeChecker) CheckSignature(signature []byte, pubKey []byte, subscript []byte) bool {
+	return bytes.Equal(signature, fakeSignature(pubKey))
+}
+
+func fakeSignature(pubKey []byte) []byte {
+	return append([]byte("sig:"), pubKey...)
+}
+
+func TestPayToPubKeyHash(t *testing.T) {
+	alice, bob := []byte("alice's public key"), []byte("bob's public key")
+	scriptPubKey := PayToPubKeyHash(Hash160(alice))
+	assert.Equal(t, Hash160(alice), ExtractPubKeyHash(scriptPubKey))
+
+	assert.NoError(t, Execute(SignatureScript(fakeSignature(alice), alice), scriptPubKey, fakeChecker{}))
+	assert.ErrorContains(t, Execute(SignatureScript(fakeSignature(bob), bob), scriptPubKey, fakeChecker{}), "OP_EQUALVERIFY")
+	assert.ErrorIs(t, Execute(SignatureScript(fakeSignature(bob), alice), scriptPubKey, fakeChecker{}), ErrScriptFalse)
+
+	notPushOnly := append(SignatureScript(fakeSignature(alice), alice), OpDrop)
+	assert.ErrorContains(t, Execute(notPushOnly, scriptPubKey, fakeChecker{}), "can only push data")
+}
+
+func TestCheckMultiSigNeedsSignaturesInKeyOrder(t *testing.T) {
+	keys := [][]byte{[]byte("key 1"), []byte("key 2"), []byte("key 3")}
+	redeemScript, err := MultiSig(2, keys)
+	require.NoError(t, err)
+	scriptPubKey := PayToScriptHash(Hash160(redeemScript))
+
+	threshold, pubKeys, err := ParseMultiSig(redeemScript)
+	require.NoError(t, err)
+	assert.Equal(t, 2, threshold)
+	assert.Equal(t, keys, pubKeys)
+
+	tests := []struct {
+		name       string
+		signatures [][]byte
+		valid      bool
+	}{
+		{name: "first and last", signatures: [][]byte{fakeSignature(keys[0]), fakeSignature(keys[2])}, valid: true},
+		{name: "last two", signatures: [][]byte{fakeSignature(keys[1]), fakeSignature(keys[2])}, valid: true},
+		{name: "out of order", signatures: [][]byte{fakeSignature(keys[2]), fakeSignature(keys[0])}},
+		{name: "same key twice", signatures: [][]byte{fakeSignature(keys[1]), fakeSignature(keys[1])}},
+		{name: "one bad signature", signatures: [][]byte{fakeSignature(keys[0]), []byte("forged")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Execute(MultiSigScriptSig(tt.signatures, redeemScript), scriptPubKey, fakeChecker{})
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrScriptFalse)
+			}
+		})
+	}
+
+	// OP_CHECKMULTISIG pops one item more than it uses, which has to be empty
+	scriptSig := PushNumber(1)
+	scriptSig = append(scriptSig, PushData(fakeSignature(keys[0]))...)
+	scriptSig = append(scriptSig, PushData(fakeSignature(keys[1]))...)
+	scriptSig = append(scriptSig, PushData(redeemScript)...)
+	assert.ErrorContains(t, Execute(scriptSig, scriptPubKey, fakeChecker{}), "dummy item has to be empty")
+
+	_, err = MultiSig(3, keys[:2])
+	assert.Error(t, err)
+	_, err = MultiSig(0, keys)
+	assert.Error(t, err)
+}
+
+func TestScripts(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []byte
+		reason string
+	}{
+		{name: "add", script: []byte{Op1 + 1, Op1 + 2, OpAdd, Op1 + 4, OpNumEqual}},
+		{name: "sub and negate", script: []byte{Op1 + 1, Op1 + 4, OpSub, OpNegate, Op1 + 2, OpEqual}},
+		{name: "within", script: []byte{Op1 + 2, Op1, Op1 + 4, OpWithin}},
+		{name: "min max", script: []byte{Op1 + 2, Op1 + 6, OpMin, Op1 + 6, Op1 + 8, OpMax, OpAdd, Op1 + 11, OpNumEqual}},
+		{name: "if", script: []byte{Op1, OpIf, Op1, OpElse, Op0, OpEndIf}},
+		{name: "else", script: []byte{Op0, OpIf, Op0, OpElse, Op1, OpEndIf}},
+		{name: "notif", script: []byte{Op0, OpNotIf, Op1, OpEndIf}},
+		{name: "nested if", script: []byte{Op1, OpIf, Op0, OpIf, OpReturn, OpEndIf, Op1, OpEndIf}},
+		{name: "alt stack", script: []byte{Op1 + 2, OpToAltStack, Op0, OpFromAltStack}},
+		{name: "dup swap", script: []byte{Op1, Op1 + 1, OpSwap, OpDup, OpAdd, Op1 + 1, OpNumEqualVerify, Op1 + 1, OpEqual}},
+		{name: "hash", script: append(append(PushData([]byte("data")), OpHash160), append(PushData(Hash160([]byte("data"))), OpEqual)...)},
+		{name: "false", script: []byte{Op1, Op1 + 1, OpEqual}, reason: ErrScriptFalse.Error()},
+		{name: "return", script: []byte{Op1, OpReturn}, reason: "unspendable"},
+		{name: "verify", script: []byte{Op0, OpVerify, Op1}, reason: "OP_VERIFY"},
+		{name: "empty stack", script: []byte{OpAdd}, reason: "OP_ADD"},
+		{name: "unclosed if", script: []byte{Op1, OpIf, Op1}, reason: "without OP_ENDIF"},
+		{name: "stray else", script: []byte{Op1, OpElse}, reason: "without OP_IF"},
+		{name: "number too long", script: append(PushData([]byte{1, 2, 3, 4, 5}), Op1Add), reason: "longer than 4 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Execute(nil, tt.script, fakeChecker{})
+			if tt.reason == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestScriptLimits(t *testing.T) {
+	tooManyOps := bytes.Repeat([]byte{OpNop}, MaxOpsPerScript+1)
+	assert.ErrorContains(t, Execute(nil, append(tooManyOps, Op1), fakeChecker{}), "more than 201 opcodes")
+
+	tooBig := bytes.Repeat([]byte{Op1}, MaxScriptSize+1)
+	assert.ErrorContains(t, Execute(nil, tooBig, fakeChecker{}), "more than the maximum")
+
+	tooLong := PushData(make([]byte, MaxElementSize+1))
+	assert.ErrorContains(t, Execute(nil, append(tooLong, Op1), fakeChecker{}), "push of 521 bytes")
+}
+
+func TestNumbers(t *testing.T) {
+	for _, n := range []int64{0, 1, -1, 16, 127, 128, -128, 255, 256, -32768, 1<<31 - 1, -(1<<31 - 1)} {
+		decoded, err := decodeNumber(encodeNumber(n))
+		require.NoError(t, err)
+		assert.Equal(t, n, decoded)
+	}
+
+	assert.Equal(t, []byte{0x80, 0x00}, encodeNumber(128), "sign bit kept free")
+	assert.Equal(t, []byte{0x81}, encodeNumber(-1))
+	assert.False(t, asBool([]byte{0x00, 0x80}), "negative zero is false")
+	assert.True(t, asBool([]byte{0x00, 0x01}))
+}
+
+func TestDisassemble(t *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{0xab}, 20)
+	text, err := Disassemble(PayToPubKeyHash(pubKeyHash))
+	require.NoError(t, err)
+	assert.Equal(t, "OP_DUP OP_HASH160 "+strings.Repeat("ab", 20)+" OP_EQUALVERIFY OP_CHECKSIG", text)
+
+	_, err = Disassemble([]byte{5, 1, 2})
+	assert.Error(t, err, "push runs past the end of the script")
+}
@@ -0,0 +1,77 @@
+package script
+
+import "fmt"
+
+// Numbers on the stack are little endian, with the top bit of the last byte as the sign. Arithmetic only accepts
+// numbers of up to maxNumberLen bytes, though results can be longer
+const maxNumberLen = 4
+
+func encodeNumber(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+
+	negative := n < 0
+	magnitude := uint64(n)
+	if negative {
+		magnitude = uint64(-n)
+	}
+
+	encoded := make([]byte, 0, 9)
+	for magnitude > 0 {
+		encoded = append(encoded, byte(magnitude&0xff))
+		magnitude >>= 8
+	}
+
+	// Keep the sign bit free, adding a byte if the magnitude uses it
+	if encoded[len(encoded)-1]&0x80 != 0 {
+		if negative {
+			encoded = append(encoded, 0x80)
+		} else {
+			encoded = append(encoded, 0x00)
+		}
+	} else if negative {
+		encoded[len(encoded)-1] |= 0x80
+	}
+
+	return encoded
+}
+
+func decodeNumber(data []byte) (int64, error) {
+	if len(data) > maxNumberLen {
+		return 0, fmt.Errorf("number %x is longer than %d bytes", data, maxNumberLen)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * i)
+	}
+
+	last := len(data) - 1
+	if data[last]&0x80 != 0 {
+		n &^= int64(0x80) << (8 * last)
+		n = -n
+	}
+
+	return n, nil
+}
+
+// Any non zero value is true, except negative zero
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return i != len(data)-1 || b != 0x80
+		}
+	}
+	return false
+}
+
+func fromBool(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{}
+}
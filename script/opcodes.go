@@ -0,0 +1,156 @@
+package script
+
+import "fmt"
+
+// Opcodes understood by the script engine, with the same values as in Bitcoin.
+// 0x01 to 0x4b push that many of the following bytes onto the stack
+const (
+	Op0         byte = 0x00 // Push an empty array, which counts as false
+	OpPushData1 byte = 0x4c // Next byte is the number of bytes to push
+	OpPushData2 byte = 0x4d // Next 2 bytes (little endian) are the number of bytes to push
+	OpPushData4 byte = 0x4e // Next 4 bytes (little endian) are the number of bytes to push
+	Op1Negate   byte = 0x4f
+	Op1         byte = 0x51 // Op1 to Op16 push the number 1 to 16
+	Op16        byte = 0x60
+
+	// Flow control
+	OpNop    byte = 0x61
+	OpIf     byte = 0x63
+	OpNotIf  byte = 0x64
+	OpElse   byte = 0x67
+	OpEndIf  byte = 0x68
+	OpVerify byte = 0x69
+	OpReturn byte = 0x6a
+
+	// Stack
+	OpToAltStack   byte = 0x6b
+	OpFromAltStack byte = 0x6c
+	Op2Drop        byte = 0x6d
+	Op2Dup         byte = 0x6e
+	Op3Dup         byte = 0x6f
+	Op2Over        byte = 0x70
+	Op2Swap        byte = 0x72
+	OpIfDup        byte = 0x73
+	OpDepth        byte = 0x74
+	OpDrop         byte = 0x75
+	OpDup          byte = 0x76
+	OpNip          byte = 0x77
+	OpOver         byte = 0x78
+	OpPick         byte = 0x79
+	OpRoll         byte = 0x7a
+	OpRot          byte = 0x7b
+	OpSwap         byte = 0x7c
+	OpTuck         byte = 0x7d
+	OpSize         byte = 0x82
+
+	// Comparison
+	OpEqual       byte = 0x87
+	OpEqualVerify byte = 0x88
+
+	// Arithmetic, on numbers of at most 4 bytes
+	Op1Add               byte = 0x8b
+	Op1Sub               byte = 0x8c
+	OpNegate             byte = 0x8f
+	OpAbs                byte = 0x90
+	OpNot                byte = 0x91
+	Op0NotEqual          byte = 0x92
+	OpAdd                byte = 0x93
+	OpSub                byte = 0x94
+	OpBoolAnd            byte = 0x9a
+	OpBoolOr             byte = 0x9b
+	OpNumEqual           byte = 0x9c
+	OpNumEqualVerify     byte = 0x9d
+	OpNumNotEqual        byte = 0x9e
+	OpLessThan           byte = 0x9f
+	OpGreaterThan        byte = 0xa0
+	OpLessThanOrEqual    byte = 0xa1
+	OpGreaterThanOrEqual byte = 0xa2
+	OpMin                byte = 0xa3
+	OpMax                byte = 0xa4
+	OpWithin             byte = 0xa5
+
+	// Crypto
+	OpRipemd160           byte = 0xa6
+	OpSha256              byte = 0xa8
+	OpHash160             byte = 0xa9
+	OpHash256             byte = 0xaa
+	OpCheckSig            byte = 0xac
+	OpCheckSigVerify      byte = 0xad
+	OpCheckMultiSig       byte = 0xae
+	OpCheckMultiSigVerify byte = 0xaf
+)
+
+var opcodeNames = map[byte]string{
+	Op0:                   "OP_0",
+	OpPushData1:           "OP_PUSHDATA1",
+	OpPushData2:           "OP_PUSHDATA2",
+	OpPushData4:           "OP_PUSHDATA4",
+	Op1Negate:             "OP_1NEGATE",
+	OpNop:                 "OP_NOP",
+	OpIf:                  "OP_IF",
+	OpNotIf:               "OP_NOTIF",
+	OpElse:                "OP_ELSE",
+	OpEndIf:               "OP_ENDIF",
+	OpVerify:              "OP_VERIFY",
+	OpReturn:              "OP_RETURN",
+	OpToAltStack:          "OP_TOALTSTACK",
+	OpFromAltStack:        "OP_FROMALTSTACK",
+	Op2Drop:               "OP_2DROP",
+	Op2Dup:                "OP_2DUP",
+	Op3Dup:                "OP_3DUP",
+	Op2Over:               "OP_2OVER",
+	Op2Swap:               "OP_2SWAP",
+	OpIfDup:               "OP_IFDUP",
+	OpDepth:               "OP_DEPTH",
+	OpDrop:                "OP_DROP",
+	OpDup:                 "OP_DUP",
+	OpNip:                 "OP_NIP",
+	OpOver:                "OP_OVER",
+	OpPick:                "OP_PICK",
+	OpRoll:                "OP_ROLL",
+	OpRot:                 "OP_ROT",
+	OpSwap:                "OP_SWAP",
+	OpTuck:                "OP_TUCK",
+	OpSize:                "OP_SIZE",
+	OpEqual:               "OP_EQUAL",
+	OpEqualVerify:         "OP_EQUALVERIFY",
+	Op1Add:                "OP_1ADD",
+	Op1Sub:                "OP_1SUB",
+	OpNegate:              "OP_NEGATE",
+	OpAbs:                 "OP_ABS",
+	OpNot:                 "OP_NOT",
+	Op0NotEqual:           "OP_0NOTEQUAL",
+	OpAdd:                 "OP_ADD",
+	OpSub:                 "OP_SUB",
+	OpBoolAnd:             "OP_BOOLAND",
+	OpBoolOr:              "OP_BOOLOR",
+	OpNumEqual:            "OP_NUMEQUAL",
+	OpNumEqualVerify:      "OP_NUMEQUALVERIFY",
+	OpNumNotEqual:         "OP_NUMNOTEQUAL",
+	OpLessThan:            "OP_LESSTHAN",
+	OpGreaterThan:         "OP_GREATERTHAN",
+	OpLessThanOrEqual:     "OP_LESSTHANOREQUAL",
+	OpGreaterThanOrEqual:  "OP_GREATERTHANOREQUAL",
+	OpMin:                 "OP_MIN",
+	OpMax:                 "OP_MAX",
+	OpWithin:              "OP_WITHIN",
+	OpRipemd160:           "OP_RIPEMD160",
+	OpSha256:              "OP_SHA256",
+	OpHash160:             "OP_HASH160",
+	OpHash256:             "OP_HASH256",
+	OpCheckSig:            "OP_CHECKSIG",
+	OpCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	OpCheckMultiSig:       "OP_CHECKMULTISIG",
+	OpCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+}
+
+// Name of an opcode as it appears in disassembled scripts
+func OpcodeName(opcode byte) string {
+	if opcode >= Op1 && opcode <= Op16 {
+		return fmt.Sprintf("OP_%d", opcode-Op1+1)
+	}
+	if name, ok := opcodeNames[opcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP_UNKNOWN_%#02x", opcode)
+}
@@ -0,0 +1,127 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// One step of a script: an opcode, and for pushes the bytes it pushes
+type instruction struct {
+	opcode byte
+	data   []byte
+}
+
+// Split a script into its instructions. Fails if a push runs past the end of the script
+func parse(script []byte) ([]instruction, error) {
+	instructions := make([]instruction, 0)
+
+	for pos := 0; pos < len(script); {
+		opcode := script[pos]
+		pos++
+
+		size := 0
+		switch {
+		case opcode > Op0 && opcode < OpPushData1:
+			size = int(opcode)
+		case opcode == OpPushData1:
+			if pos+1 > len(script) {
+				return nil, fmt.Errorf("OP_PUSHDATA1 at byte %d is missing its length", pos-1)
+			}
+			size = int(script[pos])
+			pos++
+		case opcode == OpPushData2:
+			if pos+2 > len(script) {
+				return nil, fmt.Errorf("OP_PUSHDATA2 at byte %d is missing its length", pos-1)
+			}
+			size = int(binary.LittleEndian.Uint16(script[pos:]))
+			pos += 2
+		case opcode == OpPushData4:
+			if pos+4 > len(script) {
+				return nil, fmt.Errorf("OP_PUSHDATA4 at byte %d is missing its length", pos-1)
+			}
+			size = int(binary.LittleEndian.Uint32(script[pos:]))
+			pos += 4
+		}
+
+		if size < 0 || pos+size > len(script) {
+			return nil, fmt.Errorf("push of %d bytes at byte %d runs past the end of the script", size, pos)
+		}
+
+		instructions = append(instructions, instruction{opcode: opcode, data: script[pos : pos+size]})
+		pos += size
+	}
+
+	return instructions, nil
+}
+
+// Encode pushing data onto the stack
+func PushData(data []byte) []byte {
+	size := len(data)
+	switch {
+	case size == 0:
+		return []byte{Op0}
+	case size < int(OpPushData1):
+		return append([]byte{byte(size)}, data...)
+	case size <= 0xff:
+		return append([]byte{OpPushData1, byte(size)}, data...)
+	case size <= 0xffff:
+		prefix := []byte{OpPushData2, 0, 0}
+		binary.LittleEndian.PutUint16(prefix[1:], uint16(size))
+		return append(prefix, data...)
+	default:
+		prefix := []byte{OpPushData4, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(prefix[1:], uint32(size))
+		return append(prefix, data...)
+	}
+}
+
+// Encode pushing a number onto the stack, using Op0 to Op16 where possible
+func PushNumber(n int64) []byte {
+	switch {
+	case n == 0:
+		return []byte{Op0}
+	case n == -1:
+		return []byte{Op1Negate}
+	case n >= 1 && n <= 16:
+		return []byte{Op1 + byte(n-1)}
+	default:
+		return PushData(encodeNumber(n))
+	}
+}
+
+// Check that a script only pushes data. Unlocking scripts have to be push only, so they can't change what the
+// locking script does
+func IsPushOnly(script []byte) bool {
+	instructions, err := parse(script)
+	if err != nil {
+		return false
+	}
+
+	for _, instr := range instructions {
+		if instr.opcode > Op16 {
+			return false
+		}
+	}
+	return true
+}
+
+// Turn a script into readable text, e.g. "OP_DUP OP_HASH160 <hex> OP_EQUALVERIFY OP_CHECKSIG"
+func Disassemble(script []byte) (string, error) {
+	instructions, err := parse(script)
+	if err != nil {
+		return "", err
+	}
+
+	parts := make([]string, 0, len(instructions))
+	for _, instr := range instructions {
+		if instr.opcode > Op0 && instr.opcode <= OpPushData4 {
+			parts = append(parts, hex.EncodeToString(instr.data))
+		} else {
+			parts = append(parts, OpcodeName(instr.opcode))
+		}
+	}
+
+	return strings.Join(parts, " "), nil
+}
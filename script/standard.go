@@ -0,0 +1,124 @@
+package script
+
+import "fmt"
+
+// Locking script paying to the hash of a public key (P2PKH):
+// OP_DUP OP_HASH160 <pubKeyHash> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHash(pubKeyHash []byte) []byte {
+	script := []byte{OpDup, OpHash160}
+	script = append(script, PushData(pubKeyHash)...)
+	return append(script, OpEqualVerify, OpCheckSig)
+}
+
+// Unlocking script for a P2PKH output: <signature> <pubKey>
+func SignatureScript(signature []byte, pubKey []byte) []byte {
+	return append(PushData(signature), PushData(pubKey)...)
+}
+
+// Get the public key hash a P2PKH locking script pays to, or nil if it isn't one
+func ExtractPubKeyHash(scriptPubKey []byte) []byte {
+	instructions, err := parse(scriptPubKey)
+	if err != nil || len(instructions) != 5 {
+		return nil
+	}
+
+	if instructions[0].opcode != OpDup || instructions[1].opcode != OpHash160 || len(instructions[2].data) != 20 ||
+		instructions[3].opcode != OpEqualVerify || instructions[4].opcode != OpCheckSig {
+		return nil
+	}
+
+	return instructions[2].data
+}
+
+// Locking script paying to the hash of a redeem script (P2SH): OP_HASH160 <scriptHash> OP_EQUAL.
+// The output is spent by pushing the redeem script, along with whatever the redeem script needs, e.g. signatures
+func PayToScriptHash(scriptHash []byte) []byte {
+	script := []byte{OpHash160}
+	script = append(script, PushData(scriptHash)...)
+	return append(script, OpEqual)
+}
+
+// Get the redeem script hash a P2SH locking script pays to, or nil if it isn't one
+func ExtractScriptHash(scriptPubKey []byte) []byte {
+	instructions, err := parse(scriptPubKey)
+	if err != nil || len(instructions) != 3 {
+		return nil
+	}
+
+	if instructions[0].opcode != OpHash160 || len(instructions[1].data) != 20 || instructions[2].opcode != OpEqual {
+		return nil
+	}
+
+	return instructions[1].data
+}
+
+// Redeem script needing signatures from threshold of pubKeys:
+// <threshold> <pubKey 1> ... <pubKey n> <n> OP_CHECKMULTISIG
+// It has to fit in a single push, which limits how many keys it can have
+func MultiSig(threshold int, pubKeys [][]byte) ([]byte, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxPubKeysPerMultiSig {
+		return nil, fmt.Errorf("multisig needs 1 to %d public keys, not %d", MaxPubKeysPerMultiSig, len(pubKeys))
+	}
+	if threshold < 1 || threshold > len(pubKeys) {
+		return nil, fmt.Errorf("threshold has to be between 1 and %d, not %d", len(pubKeys), threshold)
+	}
+
+	script := PushNumber(int64(threshold))
+	for _, pubKey := range pubKeys {
+		script = append(script, PushData(pubKey)...)
+	}
+	script = append(script, PushNumber(int64(len(pubKeys)))...)
+	script = append(script, OpCheckMultiSig)
+
+	if len(script) > MaxElementSize {
+		return nil, fmt.Errorf("redeem script for %d public keys is %d bytes, more than the maximum of %d", len(pubKeys), len(script), MaxElementSize)
+	}
+	return script, nil
+}
+
+// Get the threshold and public keys of a multisig redeem script made by MultiSig
+func ParseMultiSig(redeemScript []byte) (int, [][]byte, error) {
+	instructions, err := parse(redeemScript)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(instructions) < 4 || instructions[len(instructions)-1].opcode != OpCheckMultiSig {
+		return 0, nil, fmt.Errorf("script is not a multisig redeem script")
+	}
+
+	threshold, ok := smallNumber(instructions[0])
+	nKeys, nOk := smallNumber(instructions[len(instructions)-2])
+	keys := instructions[1 : len(instructions)-2]
+	if !ok || !nOk || nKeys != len(keys) || threshold < 1 || threshold > nKeys {
+		return 0, nil, fmt.Errorf("script is not a multisig redeem script")
+	}
+
+	pubKeys := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if key.opcode == Op0 || key.opcode > OpPushData4 {
+			return 0, nil, fmt.Errorf("script is not a multisig redeem script")
+		}
+		pubKeys = append(pubKeys, key.data)
+	}
+
+	return threshold, pubKeys, nil
+}
+
+// Unlocking script for a P2SH multisig output: OP_0 <signature 1> ... <signature m> <redeemScript>.
+// OP_0 is the extra item OP_CHECKMULTISIG pops. Signatures have to be in the same order as their keys
+func MultiSigScriptSig(signatures [][]byte, redeemScript []byte) []byte {
+	script := []byte{Op0}
+	for _, signature := range signatures {
+		script = append(script, PushData(signature)...)
+	}
+	return append(script, PushData(redeemScript)...)
+}
+
+// Value of Op1 to Op16
+func smallNumber(instr instruction) (int, bool) {
+	if instr.opcode < Op1 || instr.opcode > Op16 {
+		return 0, false
+	}
+	return int(instr.opcode-Op1) + 1, true
+}
@@ -3,15 +3,16 @@ package services
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
-
-	// "fmt"
+	"fmt"
+	"math/big"
 
 	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/script"
 
 	// "github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
@@ -48,7 +49,9 @@ type TxnAssemblerFac interface {
 	HashTransaction(txn reps.Transaction) []byte
 	ToReadableTransactions(txns []reps.Transaction) []reps.ReadableTransaction
 	ToReadableTransaction(txn reps.Transaction) reps.ReadableTransaction
+	ToReadablePSBT(psbt reps.PSBT) reps.ReadablePSBT
 	ToTxnBytes(txn reps.Transaction) []byte
+	ToTxnStructure(data []byte) (reps.Transaction, error)
 	// ToCoinbaseTxn(to string, data string) reps.Transaction
 	SetID(txnRep reps.Transaction) []byte
 }
@@ -89,6 +92,16 @@ func (t *txnAssembler) ToTxnBytes(txn reps.Transaction) []byte {
 	return txnBytes
 }
 
+// Parse a transaction serialized by ToTxnBytes
+func (t *txnAssembler) ToTxnStructure(data []byte) (reps.Transaction, error) {
+	var txn reps.Transaction
+	if err := json.Unmarshal(data, &txn); err != nil {
+		return reps.Transaction{}, err
+	}
+
+	return txn, nil
+}
+
 func (t *txnAssembler) HashTransaction(txn reps.Transaction) []byte {
 	var hash [32]byte
 
@@ -162,10 +175,16 @@ func (b *blockAssembler) ToReadableBlock(block reps.Block) reps.ReadableBlock {
 	var readableBlock reps.ReadableBlock
 
 	readableBlock.ID = block.ID
+	readableBlock.Height = block.Height
+	readableBlock.ChainWork = block.ChainWork
+	readableBlock.Status = block.Status
 	readableBlock.Timestamp = block.Timestamp
 	readableBlock.PrevHash = hex.EncodeToString(block.PrevHash)
 	readableBlock.Hash = hex.EncodeToString(block.Hash)
+	readableBlock.MerkleRoot = hex.EncodeToString(block.MerkleRoot)
 	readableBlock.Nounce = block.Nounce
+	readableBlock.Bits = fmt.Sprintf("%08x", blockBits(block))
+	readableBlock.Difficulty = difficulty(blockBits(block))
 
 	var transactions []reps.ReadableTransaction
 	for _, txn := range block.Transactions {
@@ -176,6 +195,7 @@ func (b *blockAssembler) ToReadableBlock(block reps.Block) reps.ReadableBlock {
 				CurrTxnID: hex.EncodeToString(txn.ID),
 				PrevTxnID: hex.EncodeToString(in.PrevTxnID),
 				OutIdx:    in.OutIdx,
+				ScriptSig: disassemble(in.ScriptSig),
 				PubKey:    hex.EncodeToString(in.PubKey),
 				Signature: hex.EncodeToString(in.Signature),
 			}
@@ -185,9 +205,10 @@ func (b *blockAssembler) ToReadableBlock(block reps.Block) reps.ReadableBlock {
 		var outputs []reps.ReadableTxnOutput
 		for _, out := range txn.Outputs {
 			output := reps.ReadableTxnOutput{
-				CurrTxnID:  hex.EncodeToString(txn.ID),
-				Value:      out.Value,
-				PubKeyHash: hex.EncodeToString(out.PubKeyHash),
+				CurrTxnID:    hex.EncodeToString(txn.ID),
+				Value:        out.Value,
+				PubKeyHash:   hex.EncodeToString(out.PubKeyHash),
+				ScriptPubKey: disassemble(out.ScriptPubKey),
 			}
 			outputs = append(outputs, output)
 		}
@@ -197,6 +218,9 @@ func (b *blockAssembler) ToReadableBlock(block reps.Block) reps.ReadableBlock {
 			ID:      hex.EncodeToString(txn.ID),
 			Inputs:  inputs,
 			Outputs: outputs,
+			Fee:     txn.Fee,
+			Size:    txnSize(txn),
+			FeeRate: feeRate(txn),
 		}
 
 		transactions = append(transactions, transaction)
@@ -217,6 +241,7 @@ func (t *txnAssembler) ToReadableTransactions(txns []reps.Transaction) []reps.Re
 			input := reps.ReadableTxnInput{
 				CurrTxnID: hex.EncodeToString(txn.ID),
 				PrevTxnID: hex.EncodeToString(in.PrevTxnID),
+				ScriptSig: disassemble(in.ScriptSig),
 				PubKey:    hex.EncodeToString(in.PubKey),
 				Signature: hex.EncodeToString(in.Signature),
 			}
@@ -226,9 +251,10 @@ func (t *txnAssembler) ToReadableTransactions(txns []reps.Transaction) []reps.Re
 		var outputs []reps.ReadableTxnOutput
 		for _, out := range txn.Outputs {
 			output := reps.ReadableTxnOutput{
-				CurrTxnID:  hex.EncodeToString(txn.ID),
-				Value:      out.Value,
-				PubKeyHash: hex.EncodeToString(out.PubKeyHash),
+				CurrTxnID:    hex.EncodeToString(txn.ID),
+				Value:        out.Value,
+				PubKeyHash:   hex.EncodeToString(out.PubKeyHash),
+				ScriptPubKey: disassemble(out.ScriptPubKey),
 			}
 			outputs = append(outputs, output)
 		}
@@ -238,6 +264,9 @@ func (t *txnAssembler) ToReadableTransactions(txns []reps.Transaction) []reps.Re
 			ID:      hex.EncodeToString(txn.ID),
 			Inputs:  inputs,
 			Outputs: outputs,
+			Fee:     txn.Fee,
+			Size:    txnSize(txn),
+			FeeRate: feeRate(txn),
 		}
 
 		transactions = append(transactions, transaction)
@@ -250,6 +279,9 @@ func (t *txnAssembler) ToReadableTransaction(txn reps.Transaction) reps.Readable
 	readableTxn := reps.ReadableTransaction{
 		ID:      hex.EncodeToString(txn.ID),
 		BlockID: txn.BlockID,
+		Fee:     txn.Fee,
+		Size:    txnSize(txn),
+		FeeRate: feeRate(txn),
 	}
 
 	var inputs []reps.ReadableTxnInput
@@ -258,6 +290,7 @@ func (t *txnAssembler) ToReadableTransaction(txn reps.Transaction) reps.Readable
 			CurrTxnID: hex.EncodeToString(txn.ID),
 			PrevTxnID: hex.EncodeToString(in.PrevTxnID),
 			OutIdx:    in.OutIdx,
+			ScriptSig: disassemble(in.ScriptSig),
 			PubKey:    hex.EncodeToString(in.PubKey),
 			Signature: hex.EncodeToString(in.Signature),
 		}
@@ -267,9 +300,10 @@ func (t *txnAssembler) ToReadableTransaction(txn reps.Transaction) reps.Readable
 	var outputs []reps.ReadableTxnOutput
 	for _, out := range txn.Outputs {
 		output := reps.ReadableTxnOutput{
-			CurrTxnID:  hex.EncodeToString(txn.ID),
-			Value:      out.Value,
-			PubKeyHash: hex.EncodeToString(out.PubKeyHash),
+			CurrTxnID:    hex.EncodeToString(txn.ID),
+			Value:        out.Value,
+			PubKeyHash:   hex.EncodeToString(out.PubKeyHash),
+			ScriptPubKey: disassemble(out.ScriptPubKey),
 		}
 		outputs = append(outputs, output)
 	}
@@ -280,31 +314,93 @@ func (t *txnAssembler) ToReadableTransaction(txn reps.Transaction) reps.Readable
 	return readableTxn
 }
 
-// Convert ecdsa.PrivateKey to slice of bytes
-func (w *walletAssembler) ToPrivateKeyBytes(privateKey ecdsa.PrivateKey) []byte {
-	gob.Register(elliptic.P256())
-	var content bytes.Buffer
+func (t *txnAssembler) ToReadablePSBT(psbt reps.PSBT) reps.ReadablePSBT {
+	readablePSBT := reps.ReadablePSBT{
+		PSBT:        EncodePSBT(psbt),
+		Transaction: t.ToReadableTransaction(psbt.Transaction),
+		Signatures:  make([]int, 0, len(psbt.Inputs)),
+		Finalized:   true,
+	}
+
+	for _, input := range psbt.Inputs {
+		readablePSBT.Signatures = append(readablePSBT.Signatures, len(input.Signatures))
+		if len(input.FinalScriptSig) == 0 {
+			readablePSBT.Finalized = false
+		}
+	}
+
+	return readablePSBT
+}
+
+// Readable form of a script. Scripts that don't parse are shown as hex
+func disassemble(scriptBytes []byte) string {
+	asm, err := script.Disassemble(scriptBytes)
+	if err != nil {
+		return hex.EncodeToString(scriptBytes)
+	}
+	return asm
+}
+
+// Bytes a transaction takes up in a block, i.e. the length of its serialized form. Left without the id of its block,
+// so a transaction is the same size in the mempool as in a block
+func txnSize(txn reps.Transaction) int {
+	txn.BlockID = ""
+	txnBytes, err := json.Marshal(txn)
+	if err != nil {
+		log.Error("Unable to marshal", err.Error())
+	}
+
+	return len(txnBytes)
+}
+
+// Fee paid per byte of a transaction
+func feeRate(txn reps.Transaction) float64 {
+	size := txnSize(txn)
+	if size == 0 {
+		return 0
+	}
+
+	return float64(txn.Fee) / float64(size)
+}
 
-	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(privateKey)
+// Convert ecdsa.PrivateKey to slice of bytes, SEC 1 DER as in an "EC PRIVATE KEY" PEM block
+func (w *walletAssembler) ToPrivateKeyBytes(privateKey ecdsa.PrivateKey) []byte {
+	privKeyBytes, err := x509.MarshalECPrivateKey(&privateKey)
 	if err != nil {
 		log.Error("unable to encode", err.Error())
 	}
 
-	return content.Bytes()
+	return privKeyBytes
 }
 
-// Convert byte representation of the private key to a ecdsa.PrivateKey
+// Convert byte representation of the private key to a ecdsa.PrivateKey. Keys saved before they were encoded as
+// SEC 1 DER are gob encoded, which is still read
 func (w *walletAssembler) ToECDSAPrivateKey(privKeyBytes []byte) ecdsa.PrivateKey {
-	var privKey ecdsa.PrivateKey
-	gob.Register(elliptic.P256())
+	privKey, err := x509.ParseECPrivateKey(privKeyBytes)
+	if err == nil {
+		return *privKey
+	}
 
-	buf := bytes.NewBuffer(privKeyBytes)
-	decoder := gob.NewDecoder(buf)
-	err := decoder.Decode(&privKey)
-	if err != nil {
+	legacyKey, legacyErr := fromGobPrivateKey(privKeyBytes)
+	if legacyErr != nil {
 		log.Error("Unable to decode: ", err.Error())
+		return ecdsa.PrivateKey{}
+	}
+
+	return legacyKey
+}
+
+// Only the scalar of a gob encoded key is read. The curve was gob encoded along with it, but always P-256
+func fromGobPrivateKey(privKeyBytes []byte) (ecdsa.PrivateKey, error) {
+	var gobKey struct {
+		D *big.Int
+	}
+	if err := gob.NewDecoder(bytes.NewReader(privKeyBytes)).Decode(&gobKey); err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+	if gobKey.D == nil {
+		return ecdsa.PrivateKey{}, fmt.Errorf("gob encoded key has no scalar")
 	}
 
-	return privKey
+	return privateKeyFromScalar(gobKey.D)
 }
@@ -1,6 +1,12 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
 	"time"
 
 	"github.com/brucetieu/blockchain/repository"
@@ -9,25 +15,76 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Most bytes of transactions a block can hold, coinbase included
+var MaxBlockSize = 100000
+
 type BlockService interface {
-	CreateBlock(txns []reps.Transaction, prevHash []byte) (reps.Block, error)
+	CreateBlock(ctx context.Context, txns []reps.Transaction, prevBlock *reps.Block) (reps.Block, error)
+	CreateBlockOnTip(ctx context.Context, txns []reps.Transaction, tip reps.Block) (reps.Block, error)
+	AcceptBlock(block reps.Block) (reps.Block, error)
 }
 
 type blockService struct {
-	blockchainRepo repository.BlockchainRepository
+	blockchainRepo    repository.BlockchainRepository
+	validationService ValidationService
+	mempoolService    MempoolService
+	difficultyService DifficultyService
+	txnAssembler      TxnAssemblerFac
 }
 
-func NewBlockService(blockchainRepo repository.BlockchainRepository) BlockService {
+func NewBlockService(blockchainRepo repository.BlockchainRepository, validationService ValidationService,
+	mempoolService MempoolService, difficultyService DifficultyService,
+) BlockService {
 	return &blockService{
-		blockchainRepo: blockchainRepo,
+		blockchainRepo:    blockchainRepo,
+		validationService: validationService,
+		mempoolService:    mempoolService,
+		difficultyService: difficultyService,
+		txnAssembler:      TxnAssembler,
+	}
+}
+
+// Create a single block in the block chain on top of prevBlock. prevBlock is nil for the genesis block.
+// Mining stops if ctx is cancelled
+func (bs *blockService) CreateBlock(ctx context.Context, txns []reps.Transaction, prevBlock *reps.Block) (reps.Block, error) {
+	newBlock, err := bs.mineBlock(ctx, txns, prevBlock)
+	if err != nil {
+		return reps.Block{}, err
+	}
+
+	return bs.AcceptBlock(newBlock)
+}
+
+// Like CreateBlock, but the block has to extend tip. If another block has been added on top of tip by the time
+// this one is mined, it is dropped and repository.ErrChainTipMoved is returned rather than keeping it as a fork
+func (bs *blockService) CreateBlockOnTip(ctx context.Context, txns []reps.Transaction, tip reps.Block) (reps.Block, error) {
+	newBlock, err := bs.mineBlock(ctx, txns, &tip)
+	if err != nil {
+		return reps.Block{}, err
 	}
+
+	return bs.acceptBlock(newBlock, true)
 }
 
-// Create a single block in the block chain.
-func (bs *blockService) CreateBlock(txns []reps.Transaction, prevHash []byte) (reps.Block, error) {
+// Build a block on top of prevBlock and solve its proof of work
+func (bs *blockService) mineBlock(ctx context.Context, txns []reps.Transaction, prevBlock *reps.Block) (reps.Block, error) {
 	log.Info("Mining block...")
 	id := uuid.Must(uuid.NewRandom()).String()
 
+	// Genesis is at height 0, every other block is one higher than the block it builds on
+	prevHash := []byte{}
+	height := int64(0)
+	if prevBlock != nil {
+		prevHash = prevBlock.Hash
+		height = prevBlock.Height + 1
+	}
+
+	// Mine at the difficulty the branch requires
+	bits, err := bs.difficultyService.NextBits(prevBlock)
+	if err != nil {
+		return reps.Block{}, err
+	}
+
 	// Set BlockID in transactions to be Id of block
 	for i := 0; i < len(txns); i++ {
 		txns[i].BlockID = id
@@ -35,21 +92,252 @@ func (bs *blockService) CreateBlock(txns []reps.Transaction, prevHash []byte) (r
 
 	newBlock := reps.Block{
 		ID:           id,
+		Height:       height,
 		Timestamp:    time.Now().UnixMilli(),
 		Transactions: txns,
 		PrevHash:     prevHash,
+		MerkleRoot:   bs.txnAssembler.HashTransactions(txns),
+		Bits:         bits,
 	}
 	// proof := bs.powService.Solve()
 	proof := NewProofOfWorkService(&newBlock)
-	nounce, hash := proof.Solve()
+	nounce, hash, err := proof.Solve(ctx)
+	if err != nil {
+		return reps.Block{}, err
+	}
 	newBlock.Nounce = nounce
 	newBlock.Hash = hash
 
-	// Persist
-	err := bs.blockchainRepo.CreateBlock(newBlock)
+	return newBlock, nil
+}
+
+// Validate a block and store it. The block becomes part of the active chain if its branch has the most
+// cumulative work, which may mean reorganizing away from the current tip. Otherwise it is kept as a fork
+func (bs *blockService) AcceptBlock(block reps.Block) (reps.Block, error) {
+	return bs.acceptBlock(block, false)
+}
+
+// See AcceptBlock. If onTip is set, the block is only accepted if it extends the current tip
+func (bs *blockService) acceptBlock(block reps.Block, onTip bool) (reps.Block, error) {
+	log.Info("Accepting block: ", block.ID)
+
+	if _, err := bs.blockchainRepo.GetBlockByHash(block.Hash); err == nil {
+		return reps.Block{}, fmt.Errorf("block with hash %x already exists", block.Hash)
+	}
+
+	var parent *reps.Block
+	if len(block.PrevHash) != 0 {
+		prevBlock, err := bs.blockchainRepo.GetBlockByHash(block.PrevHash)
+		if err != nil {
+			return reps.Block{}, fmt.Errorf("%s, parent %x of block %s is unknown", err.Error(), block.PrevHash, block.ID)
+		}
+		parent = &prevBlock
+	} else if _, err := bs.blockchainRepo.GetGenesisBlock(); err == nil {
+		return reps.Block{}, fmt.Errorf("block %s is a second genesis block", block.ID)
+	}
+
+	if err := bs.validationService.ValidateBlock(block, parent); err != nil {
+		return reps.Block{}, fmt.Errorf("block %s rejected: %s", block.ID, err.Error())
+	}
+
+	// Cumulative work of the branch ending in this block
+	work := NewProofOfWorkService(&block).Work()
+	if parent != nil {
+		work.Add(work, chainWork(*parent))
+	}
+	block.ChainWork = fmt.Sprintf("%064x", work)
+
+	if parent == nil {
+		return bs.connectToTip(block, nil)
+	}
+
+	// Anything built on an invalid block is invalid too
+	if parent.Status == reps.BlockStatusInvalid {
+		block.Status = reps.BlockStatusInvalid
+		if err := bs.blockchainRepo.CreateBlock(block, reps.ChainUpdate{}); err != nil {
+			return reps.Block{}, err
+		}
+		return reps.Block{}, fmt.Errorf("block %s builds on invalid block %s", block.ID, parent.ID)
+	}
+
+	tip, err := bs.blockchainRepo.GetLastBlock()
 	if err != nil {
 		return reps.Block{}, err
 	}
 
-	return newBlock, nil
+	if bytes.Equal(block.PrevHash, tip.Hash) {
+		return bs.connectToTip(block, &tip)
+	}
+
+	if onTip {
+		log.Infof("Tip moved to %s while block %s was being mined, dropping it", tip.ID, block.ID)
+		return reps.Block{}, repository.ErrChainTipMoved
+	}
+
+	if chainWork(block).Cmp(chainWork(tip)) <= 0 {
+		log.Infof("Block %s has less work than tip %s, keeping it on a fork", block.ID, tip.ID)
+		block.Status = reps.BlockStatusValidFork
+		if err := bs.blockchainRepo.CreateBlock(block, reps.ChainUpdate{}); err != nil {
+			return reps.Block{}, err
+		}
+		return block, nil
+	}
+
+	return bs.reorganize(block, *parent, tip)
+}
+
+// Extend the active chain with a block whose parent is the current tip
+func (bs *blockService) connectToTip(block reps.Block, tip *reps.Block) (reps.Block, error) {
+	view := newUTXOView(bs.blockchainRepo)
+	if err := view.connectBlock(block); err != nil {
+		bs.dropInvalidTxn(err)
+		if tip != nil {
+			block.Status = reps.BlockStatusInvalid
+			if createErr := bs.blockchainRepo.CreateBlock(block, reps.ChainUpdate{}); createErr != nil {
+				log.Error("Error storing invalid block: ", createErr.Error())
+			}
+		}
+		return reps.Block{}, fmt.Errorf("block %s rejected: %s", block.ID, err.Error())
+	}
+
+	block.Status = reps.BlockStatusActive
+	chainUpdate := reps.ChainUpdate{UTXOUpdate: view.update(), Connected: []string{block.ID}}
+	if tip != nil {
+		chainUpdate.PrevTip = tip.Hash
+	}
+	if err := bs.blockchainRepo.CreateBlock(block, chainUpdate); err != nil {
+		return reps.Block{}, err
+	}
+
+	bs.syncMempool([]reps.Block{block}, nil)
+	return block, nil
+}
+
+// Switch the active chain to the branch ending in block, which has more work than the current tip
+func (bs *blockService) reorganize(block reps.Block, parent reps.Block, tip reps.Block) (reps.Block, error) {
+	// Walk back from the new block to where its branch leaves the active chain
+	connect := []reps.Block{block}
+	forkPoint := parent
+	for forkPoint.Status != reps.BlockStatusActive {
+		if forkPoint.Status == reps.BlockStatusInvalid {
+			return reps.Block{}, bs.invalidate(block, nil, fmt.Errorf("block %s builds on invalid block %s", block.ID, forkPoint.ID))
+		}
+
+		connect = append([]reps.Block{forkPoint}, connect...)
+		prevBlock, err := bs.blockchainRepo.GetBlockByHash(forkPoint.PrevHash)
+		if err != nil {
+			return reps.Block{}, fmt.Errorf("%s, cannot find parent of block %s", err.Error(), forkPoint.ID)
+		}
+		forkPoint = prevBlock
+	}
+
+	disconnect, err := bs.blockchainRepo.GetBlocksByHeight(forkPoint.Height+1, tip.Height)
+	if err != nil {
+		return reps.Block{}, err
+	}
+	sort.Slice(disconnect, func(i, j int) bool {
+		return disconnect[i].Height < disconnect[j].Height
+	})
+
+	log.Infof("Reorganizing: disconnecting %d blocks and connecting %d blocks on top of block %s", len(disconnect), len(connect), forkPoint.ID)
+
+	view := newUTXOView(bs.blockchainRepo)
+	for i := len(disconnect) - 1; i >= 0; i-- {
+		if err := view.disconnectBlock(disconnect[i]); err != nil {
+			return reps.Block{}, err
+		}
+	}
+
+	for i, connectBlock := range connect {
+		if err := view.connectBlock(connectBlock); err != nil {
+			// This block and everything built on it in the branch can never be connected
+			bs.dropInvalidTxn(err)
+			return reps.Block{}, bs.invalidate(block, connect[i:len(connect)-1], err)
+		}
+	}
+
+	block.Status = reps.BlockStatusActive
+	chainUpdate := reps.ChainUpdate{
+		UTXOUpdate:   view.update(),
+		Connected:    blockIds(connect),
+		Disconnected: blockIds(disconnect),
+		PrevTip:      tip.Hash,
+	}
+	if err := bs.blockchainRepo.CreateBlock(block, chainUpdate); err != nil {
+		return reps.Block{}, err
+	}
+
+	bs.syncMempool(connect, disconnect)
+	log.Infof("Reorganized to block %s at height %d", block.ID, block.Height)
+
+	return block, nil
+}
+
+// Store block as invalid along with already stored blocks that are invalid because of the same failure
+func (bs *blockService) invalidate(block reps.Block, stored []reps.Block, reason error) error {
+	block.Status = reps.BlockStatusInvalid
+	if err := bs.blockchainRepo.CreateBlock(block, reps.ChainUpdate{}); err != nil {
+		return err
+	}
+
+	if len(stored) > 0 {
+		if err := bs.blockchainRepo.UpdateBlockStatus(blockIds(stored), reps.BlockStatusInvalid); err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("block %s rejected: %s", block.ID, reason.Error())
+}
+
+// Drop the transaction that made a block invalid from the mempool, so it isn't mined into the next block again
+func (bs *blockService) dropInvalidTxn(err error) {
+	var txnErr *invalidTxnError
+	if errors.As(err, &txnErr) {
+		log.WithField("error", err.Error()).Warn("Dropping transaction that made a block invalid from mempool")
+		bs.mempoolService.RemoveTransactions([]reps.Transaction{{ID: txnErr.txnId}})
+	}
+}
+
+// Keep pending transactions in line with the active chain. Transactions in connected blocks are no longer pending,
+// transactions from disconnected blocks go back to the pool, and anything now spending a spent output is dropped
+func (bs *blockService) syncMempool(connected []reps.Block, disconnected []reps.Block) {
+	connectedTxns := make(map[string]bool)
+	for _, block := range connected {
+		bs.mempoolService.RemoveTransactions(block.Transactions)
+		for _, txn := range block.Transactions {
+			connectedTxns[fmt.Sprintf("%x", txn.ID)] = true
+		}
+	}
+
+	for _, block := range disconnected {
+		for txnIdx, txn := range block.Transactions {
+			// Coinbase transactions can't exist outside of their block
+			if txnIdx == 0 || connectedTxns[fmt.Sprintf("%x", txn.ID)] {
+				continue
+			}
+
+			if err := bs.mempoolService.AddToPool(txn); err != nil {
+				log.WithField("error", err.Error()).Warn("Dropping transaction from disconnected block")
+			}
+		}
+	}
+
+	bs.mempoolService.Revalidate()
+}
+
+// Parse the hex encoded cumulative work of a block
+func chainWork(block reps.Block) *big.Int {
+	work, ok := new(big.Int).SetString(block.ChainWork, 16)
+	if !ok {
+		return new(big.Int)
+	}
+	return work
+}
+
+func blockIds(blocks []reps.Block) []string {
+	ids := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		ids = append(ids, block.ID)
+	}
+	return ids
 }
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReorganizeToHeavierBranchAndBack(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice, bob := n.newWallet(t), n.newWallet(t)
+	genesis, err := n.blockchainService.GetGenesisBlock()
+	require.NoError(t, err)
+
+	a1 := n.send(t, miner, alice, 20)
+	payment := a1.Transactions[1]
+
+	// A branch with as much work as the tip stays a fork
+	b1 := n.mineOn(t, bob, genesis)
+	assert.Equal(t, reps.BlockStatusValidFork, b1.Status)
+	n.assertTip(t, a1)
+	assert.Equal(t, 20, n.balance(t, alice))
+
+	// Once it has more work it takes over, and the payment goes back to the mempool
+	b2 := n.mineOn(t, bob, b1)
+	assert.Equal(t, reps.BlockStatusActive, b2.Status)
+	n.assertTip(t, b2)
+	assert.Equal(t, 0, n.balance(t, alice))
+	assert.Equal(t, 2*InitialSubsidy, n.balance(t, bob))
+	assert.Equal(t, InitialSubsidy, n.balance(t, miner), "only the genesis coinbase")
+	pending := n.mempoolService.GetPendingTransactions()
+	require.Len(t, pending, 1)
+	assert.Equal(t, payment.ID, pending[0].ID)
+
+	// The first branch overtakes it again
+	a2 := n.mineOn(t, miner, a1)
+	assert.Equal(t, reps.BlockStatusValidFork, a2.Status)
+	a3 := n.mineOn(t, miner, a2)
+	n.assertTip(t, a3)
+	assert.Equal(t, 20, n.balance(t, alice))
+	assert.Equal(t, 0, n.balance(t, bob))
+	assert.Empty(t, n.mempoolService.GetPendingTransactions(), "the payment is mined again")
+
+	tips, err := n.blockchainService.GetChainTips()
+	require.NoError(t, err)
+	require.Len(t, tips, 2)
+	assert.Equal(t, a3.ID, tips[0].BlockID)
+	assert.Equal(t, reps.BlockStatusActive, tips[0].Status)
+	assert.Equal(t, b2.ID, tips[1].BlockID)
+	assert.Equal(t, reps.BlockStatusValidFork, tips[1].Status)
+	assert.Equal(t, int64(2), tips[1].BranchLength)
+
+	report, err := n.validationService.ValidateBlockchain()
+	require.NoError(t, err)
+	assert.True(t, report.Valid, report.Reason)
+}
+
+func TestBlockBuildingOnInvalidBlockIsInvalid(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice := n.newWallet(t)
+
+	tip, err := n.blockchainService.GetLastBlock()
+	require.NoError(t, err)
+	coinbase := n.transactionService.CreateCoinbaseTxn(miner, "", tip.Height+1, 0)
+	_, err = n.blockService.CreateBlock(context.Background(), []reps.Transaction{coinbase, duplicateInputTxn(t, n, miner, alice)}, &tip)
+	require.Error(t, err)
+
+	tips, err := n.blockchainService.GetChainTips()
+	require.NoError(t, err)
+	require.Len(t, tips, 2)
+	invalid, err := n.repo.GetBlockById(tips[1].BlockID)
+	require.NoError(t, err)
+	assert.Equal(t, reps.BlockStatusInvalid, invalid.Status)
+
+	_, err = n.blockchainService.MineBlock(context.Background(), miner, hex.EncodeToString(invalid.Hash))
+	assert.ErrorContains(t, err, "builds on invalid block")
+	n.assertTip(t, tip)
+}
+
+func TestBlockMinedOnStaleTipIsDropped(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice := n.newWallet(t)
+
+	staleTip, err := n.blockchainService.GetLastBlock()
+	require.NoError(t, err)
+	_, err = n.mempoolService.AddTransaction(miner, payTo(alice, 10), reps.TransferOptions{})
+	require.NoError(t, err)
+	n.mineOn(t, miner, staleTip)
+
+	coinbase := n.transactionService.CreateCoinbaseTxn(miner, "", staleTip.Height+1, 0)
+	pending := n.mempoolService.GetPendingTransactions()
+	_, err = n.blockService.CreateBlockOnTip(context.Background(), append([]reps.Transaction{coinbase}, pending...), staleTip)
+	assert.ErrorIs(t, err, repository.ErrChainTipMoved)
+
+	tips, err := n.blockchainService.GetChainTips()
+	require.NoError(t, err)
+	assert.Len(t, tips, 1, "the block isn't kept as a fork")
+	assert.Len(t, n.mempoolService.GetPendingTransactions(), 1, "its transactions stay pending")
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	// "fmt"
+	"context"
+	"encoding/hex"
 	"fmt"
 	"sort"
 
@@ -13,12 +15,17 @@ import (
 )
 
 type BlockchainService interface {
-	AddToBlockChain(from string, to string, amount int) (reps.Block, error)
-	CreateBlockchain(address string) (reps.Block, bool, error)
+	AddToBlockChain(ctx context.Context, from string, payments []reps.Payment, options reps.TransferOptions) (reps.Block, error)
+	MineBlock(ctx context.Context, miner string, parentHash string) (reps.Block, error)
+	CreateBlockchain(ctx context.Context, address string) (reps.Block, bool, error)
 	GetBlockchain() ([]reps.Block, error)
 	GetGenesisBlock() (reps.Block, error)
 	GetBlock(blockId string) (reps.Block, error)
+	GetBlockByHeight(height int64) (reps.Block, error)
+	GetBlocksByHeight(from int64, to int64) ([]reps.Block, error)
 	GetLastBlock() (reps.Block, error)
+	GetChainTips() ([]reps.ChainTip, error)
+	GetMiningStats() reps.MiningStats
 }
 
 type blockchainService struct {
@@ -26,32 +33,35 @@ type blockchainService struct {
 	blockService       BlockService
 	transactionService TransactionService
 	walletService      WalletService
+	mempoolService     MempoolService
 	blockAssembler     BlockAssemblerFac
 }
 
 func NewBlockchainService(blockchainRepo repository.BlockchainRepository,
 	blockService BlockService, transactionService TransactionService, walletService WalletService,
+	mempoolService MempoolService,
 ) BlockchainService {
 	return &blockchainService{
 		blockchainRepo:     blockchainRepo,
 		blockService:       blockService,
 		transactionService: transactionService,
 		walletService:      walletService,
+		mempoolService:     mempoolService,
 		blockAssembler:     BlockAssembler,
 	}
 }
 
 // Address is wallet address
-func (bc *blockchainService) CreateBlockchain(address string) (reps.Block, bool, error) {
+func (bc *blockchainService) CreateBlockchain(ctx context.Context, address string) (reps.Block, bool, error) {
 	// Check address is in db to begin with
-	addressValid, err := bc.walletService.ValidateAddress(address)
+	validation, err := bc.walletService.ValidateAddress(address)
 	if err != nil {
 		log.Error(err.Error())
 		return reps.Block{}, false, err
 	}
 
 	// Then validate it
-	if !addressValid {
+	if !validation.Valid {
 		log.Errorf("error: address of %s is not valid", address)
 		return reps.Block{}, false, fmt.Errorf("error: address of %s is not valid", address)
 	}
@@ -60,8 +70,8 @@ func (bc *blockchainService) CreateBlockchain(address string) (reps.Block, bool,
 	genesis, err := bc.GetGenesisBlock()
 	if err != nil {
 		log.Info("Genesis doesn't exist, so creating it now...")
-		coinbaseTxn := bc.transactionService.CreateCoinbaseTxn(address, "First transaction in Blockchain")
-		newBlock, err := bc.blockService.CreateBlock([]reps.Transaction{coinbaseTxn}, []byte{})
+		coinbaseTxn := bc.transactionService.CreateCoinbaseTxn(address, "First transaction in Blockchain", 0, 0)
+		newBlock, err := bc.blockService.CreateBlock(ctx, []reps.Transaction{coinbaseTxn}, nil)
 		// Persist
 		if err != nil {
 			log.Error("Error creating blockchain: ", err.Error())
@@ -75,23 +85,34 @@ func (bc *blockchainService) CreateBlockchain(address string) (reps.Block, bool,
 	return genesis, true, nil
 }
 
-// Mine a block
-func (bc *blockchainService) AddToBlockChain(from string, to string, amount int) (reps.Block, error) {
-	// Validate from and to exist in the db and are valid addresses
-	addressValid, err := bc.walletService.ValidateAddress(from)
+// Submit a transfer to the mempool and mine it, along with every other pending transaction, in a new block
+func (bc *blockchainService) AddToBlockChain(ctx context.Context, from string, payments []reps.Payment, options reps.TransferOptions) (reps.Block, error) {
+	// Check if there is at least a genesis block in the blockchain
+	_, err := bc.blockchainRepo.GetLastBlock()
 	if err != nil {
-		return reps.Block{}, err
+		errMsg := fmt.Errorf("%s, cannot create a block without genesis", err.Error())
+		return reps.Block{}, errMsg
 	}
-	if !addressValid {
-		return reps.Block{}, fmt.Errorf("error: address of %s is not valid", from)
+
+	// Create a new transaction and park it in the mempool
+	_, err = bc.mempoolService.AddTransaction(from, payments, options)
+	if err != nil {
+		return reps.Block{}, err
 	}
 
-	addressValid, err = bc.walletService.ValidateAddress(to)
+	return bc.MineBlock(ctx, from, "")
+}
+
+// Mine a block of pending transactions on top of the tip, picking the highest fee rates first if they don't all fit in
+// MaxBlockSize. The miner gets the block subsidy plus the fees. If parentHash is given, mine a block with only the
+// coinbase on top of that block instead
+func (bc *blockchainService) MineBlock(ctx context.Context, miner string, parentHash string) (reps.Block, error) {
+	validation, err := bc.walletService.ValidateAddress(miner)
 	if err != nil {
 		return reps.Block{}, err
 	}
-	if !addressValid {
-		return reps.Block{}, fmt.Errorf("error: address of %s is not valid", to)
+	if !validation.Valid {
+		return reps.Block{}, fmt.Errorf("error: address of %s is not valid", miner)
 	}
 
 	// Check if there is at least a genesis block in the blockchain
@@ -101,32 +122,89 @@ func (bc *blockchainService) AddToBlockChain(from string, to string, amount int)
 		return reps.Block{}, errMsg
 	}
 
-	// Create a new transaction.
-	newTxn, err := bc.transactionService.CreateTransaction(from, to, amount)
+	if parentHash != "" {
+		parent, err := bc.getBlockByHash(parentHash)
+		if err != nil {
+			return reps.Block{}, err
+		}
+
+		// Pending transactions are checked against the active chain, so they can't go on a fork
+		coinbaseTxn := bc.transactionService.CreateCoinbaseTxn(miner, "", parent.Height+1, 0)
+		return bc.blockService.CreateBlock(ctx, []reps.Transaction{coinbaseTxn}, &parent)
+	}
+
+	// Re-verify pending transactions against the current chain. Drop any that are no longer valid
+	pendingTxns := bc.mempoolService.GetPendingTransactions()
+	invalidTxns := make([]reps.Transaction, 0)
+	pendingFees := 0
+	for _, txn := range pendingTxns {
+		if err := bc.verifyPendingTransaction(txn); err != nil {
+			log.WithField("error", err.Error()).Warn("Dropping invalid transaction from mempool")
+			invalidTxns = append(invalidTxns, txn)
+			continue
+		}
+		pendingFees += txn.Fee
+	}
+	bc.mempoolService.RemoveTransactions(invalidTxns)
+
+	// Leave room for the coinbase. It can't be bigger than one collecting every pending fee
+	coinbaseSize := txnSize(bc.transactionService.CreateCoinbaseTxn(miner, "", lastBlock.Height+1, pendingFees))
+	selectedTxns := bc.mempoolService.SelectTransactions(MaxBlockSize - coinbaseSize)
+
+	fees := 0
+	for _, txn := range selectedTxns {
+		fees += txn.Fee
+	}
+
+	coinbaseTxn := bc.transactionService.CreateCoinbaseTxn(miner, "", lastBlock.Height+1, fees)
+	txns := append([]reps.Transaction{coinbaseTxn}, selectedTxns...)
+
+	// Create a new block with pending transactions and persist. Mined transactions leave the mempool once the block is accepted.
+	// If another block extends the tip first, the caller gets repository.ErrChainTipMoved and the transactions stay pending
+	return bc.blockService.CreateBlockOnTip(ctx, txns, lastBlock)
+}
+
+func (bc *blockchainService) getBlockByHash(hash string) (reps.Block, error) {
+	decodedHash, err := hex.DecodeString(hash)
 	if err != nil {
-		return reps.Block{}, err
+		return reps.Block{}, fmt.Errorf("%s, hash: %s", err.Error(), hash)
+	}
+
+	block, err := bc.blockchainRepo.GetBlockByHash(decodedHash)
+	if err != nil {
+		return reps.Block{}, fmt.Errorf("%s, hash: %s", err.Error(), hash)
 	}
 
-	// Also create a new coinbase transaction
-	coinbaseTxn := bc.transactionService.CreateCoinbaseTxn(from, "")
+	return block, nil
+}
 
-	// Verify the signatures on transaction inputs
-	txns := []reps.Transaction{coinbaseTxn, newTxn}
-	for _, txn := range txns {
-		verifiedTxn, err := bc.transactionService.VerifyTransaction(txn)
-		if !verifiedTxn {
-			log.WithField("error", err.Error()).Error("error: invalid transaction")
-			return reps.Block{}, err
+// Verify the signatures of a pending transaction, and that it still passes the checks connecting its block will make:
+// its inputs spend distinct outputs that are still unspent, and it pays the fee it declares
+func (bc *blockchainService) verifyPendingTransaction(txn reps.Transaction) error {
+	verifiedTxn, err := bc.transactionService.VerifyTransaction(txn)
+	if !verifiedTxn {
+		return fmt.Errorf("transaction %x is invalid: %v", txn.ID, err)
+	}
+
+	if err := checkDistinctInputs(txn); err != nil {
+		return err
+	}
+
+	for _, input := range txn.Inputs {
+		if !bc.transactionService.IsSpendable(input) {
+			return fmt.Errorf("transaction %x spends output %d of %x which is already spent", txn.ID, input.OutIdx, input.PrevTxnID)
 		}
 	}
 
-	// Create a new block with new transaction and persist
-	newBlock, err := bc.blockService.CreateBlock(txns, lastBlock.Hash)
+	fee, err := bc.transactionService.CalculateFee(txn)
 	if err != nil {
-		return reps.Block{}, err
+		return err
+	}
+	if fee != txn.Fee {
+		return fmt.Errorf("transaction %x says it pays a fee of %d but pays %d", txn.ID, txn.Fee, fee)
 	}
 
-	return newBlock, nil
+	return nil
 }
 
 // Get all blocks in the blockchain
@@ -139,7 +217,7 @@ func (bc *blockchainService) GetBlockchain() ([]reps.Block, error) {
 
 	// Ensure that genesis block is last
 	sort.Slice(blocks, func(i, j int) bool {
-		return blocks[i].Timestamp > blocks[j].Timestamp
+		return blocks[i].Height > blocks[j].Height
 	})
 
 	return blocks, nil
@@ -171,6 +249,36 @@ func (bc *blockchainService) GetBlock(blockId string) (reps.Block, error) {
 	return block, nil
 }
 
+// Get block on blockchain by its height
+func (bc *blockchainService) GetBlockByHeight(height int64) (reps.Block, error) {
+	block, err := bc.blockchainRepo.GetBlockByHeight(height)
+	if err != nil {
+		errMsg := fmt.Errorf("%s, height: %d", err.Error(), height)
+		return reps.Block{}, errMsg
+	}
+
+	return block, nil
+}
+
+// Get blocks with a height in the range from to to (inclusive). Like GetBlockchain, the highest block comes first
+func (bc *blockchainService) GetBlocksByHeight(from int64, to int64) ([]reps.Block, error) {
+	if from < 0 || to < from {
+		return []reps.Block{}, fmt.Errorf("invalid height range from %d to %d", from, to)
+	}
+
+	blocks, err := bc.blockchainRepo.GetBlocksByHeight(from, to)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error getting blocks by height")
+		return []reps.Block{}, err
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Height > blocks[j].Height
+	})
+
+	return blocks, nil
+}
+
 // Get the last block in the blockchain
 func (bc *blockchainService) GetLastBlock() (reps.Block, error) {
 	lastBlock, err := bc.blockchainRepo.GetLastBlock()
@@ -181,3 +289,51 @@ func (bc *blockchainService) GetLastBlock() (reps.Block, error) {
 
 	return lastBlock, nil
 }
+
+// Get the head of every known branch, with the most work first. BranchLength is how many blocks
+// the branch has since it left the active chain, 0 for the active tip
+func (bc *blockchainService) GetChainTips() ([]reps.ChainTip, error) {
+	tipBlocks, err := bc.blockchainRepo.GetChainTips()
+	if err != nil {
+		return []reps.ChainTip{}, err
+	}
+
+	// The active tip always counts, even if an invalid block was built on it
+	lastBlock, err := bc.blockchainRepo.GetLastBlock()
+	if err == nil {
+		hasActiveTip := false
+		for _, block := range tipBlocks {
+			hasActiveTip = hasActiveTip || block.ID == lastBlock.ID
+		}
+		if !hasActiveTip {
+			tipBlocks = append([]reps.Block{lastBlock}, tipBlocks...)
+		}
+	}
+
+	tips := make([]reps.ChainTip, 0, len(tipBlocks))
+	for _, block := range tipBlocks {
+		branchLength := int64(0)
+		for branchBlock := block; branchBlock.Status != reps.BlockStatusActive; branchLength++ {
+			branchBlock, err = bc.blockchainRepo.GetBlockByHash(branchBlock.PrevHash)
+			if err != nil {
+				return []reps.ChainTip{}, fmt.Errorf("%s, cannot find parent of block %s", err.Error(), block.ID)
+			}
+		}
+
+		tips = append(tips, reps.ChainTip{
+			BlockID:      block.ID,
+			Hash:         hex.EncodeToString(block.Hash),
+			Height:       block.Height,
+			ChainWork:    block.ChainWork,
+			BranchLength: branchLength,
+			Status:       block.Status,
+		})
+	}
+
+	return tips, nil
+}
+
+// Get the hash rate of the miner
+func (bc *blockchainService) GetMiningStats() reps.MiningStats {
+	return GetMiningStats()
+}
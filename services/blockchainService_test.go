@@ -0,0 +1,43 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlocksAreQueriedByHeight(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	for i := 0; i < 3; i++ {
+		n.mine(t, miner)
+	}
+
+	tip, err := n.blockchainService.GetLastBlock()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), tip.Height)
+
+	genesis, err := n.blockchainService.GetBlockByHeight(0)
+	require.NoError(t, err)
+	assert.Empty(t, genesis.PrevHash)
+	block, err := n.blockchainService.GetBlockByHeight(2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), block.Height)
+	_, err = n.blockchainService.GetBlockByHeight(4)
+	assert.ErrorContains(t, err, "height: 4")
+
+	blocks, err := n.blockchainService.GetBlocksByHeight(1, 10)
+	require.NoError(t, err)
+	require.Len(t, blocks, 3)
+	for i, block := range blocks {
+		assert.Equal(t, int64(3-i), block.Height, "highest block first")
+	}
+	assert.Equal(t, tip.Hash, blocks[0].Hash)
+	assert.Equal(t, blocks[1].Hash, blocks[0].PrevHash)
+
+	_, err = n.blockchainService.GetBlocksByHeight(2, 1)
+	assert.ErrorContains(t, err, "invalid height range")
+	_, err = n.blockchainService.GetBlocksByHeight(-1, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	reps "github.com/brucetieu/blockchain/representations"
+)
+
+// Coin selection strategies, picked per transfer with TransferOptions.CoinSelection
+// largest-first -> Spend the biggest outputs first, so transfers need as few inputs as possible. The default
+// smallest-first -> Spend the smallest outputs first, consolidating dust
+// branch-and-bound -> Search for outputs adding up to exactly the target, so there is no change.
+// Falls back to largest-first if there is no exact match
+// random-improve -> Pick outputs at random until the target is covered, then add more to get the change close to the target
+const (
+	LargestFirst    = "largest-first"
+	SmallestFirst   = "smallest-first"
+	BranchAndBound  = "branch-and-bound"
+	RandomImprove   = "random-improve"
+	DefaultSelector = LargestFirst
+)
+
+// Most combinations branch-and-bound tries before giving up on an exact match
+var MaxBranchAndBoundTries = 100000
+
+// Picks which unspent outputs pay for a transfer. Returns outputs worth at least target, or an error if utxos
+// aren't worth enough
+type CoinSelector interface {
+	Select(utxos []reps.UTXO, target int) ([]reps.UTXO, error)
+}
+
+type (
+	largestFirstSelector   struct{}
+	smallestFirstSelector  struct{}
+	branchAndBoundSelector struct{}
+	randomImproveSelector  struct{}
+)
+
+// Get the coin selector for a strategy. An empty strategy gives the default
+func NewCoinSelector(strategy string) (CoinSelector, error) {
+	switch strategy {
+	case "", LargestFirst:
+		return &largestFirstSelector{}, nil
+	case SmallestFirst:
+		return &smallestFirstSelector{}, nil
+	case BranchAndBound:
+		return &branchAndBoundSelector{}, nil
+	case RandomImprove:
+		return &randomImproveSelector{}, nil
+	default:
+		return nil, fmt.Errorf("unknown coin selection %s, expected %s, %s, %s or %s", strategy, LargestFirst, SmallestFirst, BranchAndBound, RandomImprove)
+	}
+}
+
+func (s *largestFirstSelector) Select(utxos []reps.UTXO, target int) ([]reps.UTXO, error) {
+	sorted := sortUTXOs(utxos, func(a, b reps.UTXO) bool { return a.Value > b.Value })
+	return selectInOrder(sorted, target)
+}
+
+func (s *smallestFirstSelector) Select(utxos []reps.UTXO, target int) ([]reps.UTXO, error) {
+	sorted := sortUTXOs(utxos, func(a, b reps.UTXO) bool { return a.Value < b.Value })
+	return selectInOrder(sorted, target)
+}
+
+// Depth first search over including or leaving out each output, biggest first. A branch is dropped as soon as it
+// overshoots the target, or what is left can't reach it
+func (s *branchAndBoundSelector) Select(utxos []reps.UTXO, target int) ([]reps.UTXO, error) {
+	sorted := sortUTXOs(utxos, func(a, b reps.UTXO) bool { return a.Value > b.Value })
+
+	// remaining[i] -> what sorted[i:] is worth together
+	remaining := make([]int, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Value
+	}
+	if remaining[0] < target {
+		return nil, insufficientFunds(remaining[0], target)
+	}
+
+	included := make([]bool, len(sorted))
+	tries := 0
+
+	var search func(idx int, sum int) bool
+	search = func(idx int, sum int) bool {
+		tries++
+		if sum == target {
+			return true
+		}
+		if sum > target || sum+remaining[idx] < target || idx == len(sorted) || tries > MaxBranchAndBoundTries {
+			return false
+		}
+
+		included[idx] = true
+		if search(idx+1, sum+sorted[idx].Value) {
+			return true
+		}
+		included[idx] = false
+		return search(idx+1, sum)
+	}
+
+	if !search(0, 0) {
+		return (&largestFirstSelector{}).Select(utxos, target)
+	}
+
+	selected := make([]reps.UTXO, 0)
+	for i, utxo := range sorted {
+		if included[i] {
+			selected = append(selected, utxo)
+		}
+	}
+
+	return selected, nil
+}
+
+// Random selection followed by an improvement pass, which adds outputs while that moves the total closer to twice
+// the target without going over three times it. Change about the size of the payment keeps outputs useful for later transfers
+func (s *randomImproveSelector) Select(utxos []reps.UTXO, target int) ([]reps.UTXO, error) {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	shuffled := append([]reps.UTXO{}, utxos...)
+	random.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	selected, err := selectInOrder(shuffled, target)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := 0
+	for _, utxo := range selected {
+		sum += utxo.Value
+	}
+
+	ideal := 2 * target
+	for _, utxo := range shuffled[len(selected):] {
+		improved := sum + utxo.Value
+		if improved <= 3*target && abs(ideal-improved) < abs(ideal-sum) {
+			selected = append(selected, utxo)
+			sum = improved
+		}
+	}
+
+	return selected, nil
+}
+
+// Take outputs in order until they cover target
+func selectInOrder(utxos []reps.UTXO, target int) ([]reps.UTXO, error) {
+	selected := make([]reps.UTXO, 0)
+	sum := 0
+	for _, utxo := range utxos {
+		if sum >= target && len(selected) > 0 {
+			break
+		}
+		selected = append(selected, utxo)
+		sum += utxo.Value
+	}
+
+	if sum < target {
+		return nil, insufficientFunds(sum, target)
+	}
+
+	return selected, nil
+}
+
+// Sort a copy of utxos. Ties keep the order they came in
+func sortUTXOs(utxos []reps.UTXO, less func(a, b reps.UTXO) bool) []reps.UTXO {
+	sorted := append([]reps.UTXO{}, utxos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+func insufficientFunds(available int, target int) error {
+	return fmt.Errorf("unspent outputs are only worth %d, not %d", available, target)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
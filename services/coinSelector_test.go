@@ -0,0 +1,132 @@
+package services
+
+import (
+	"testing"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoinSelectors(t *testing.T) {
+	utxos := testUTXOs(1, 5, 10, 20, 3)
+
+	tests := []struct {
+		strategy string
+		target   int
+		values   []int
+	}{
+		{strategy: "", target: 12, values: []int{20}},
+		{strategy: LargestFirst, target: 25, values: []int{20, 10}},
+		{strategy: SmallestFirst, target: 12, values: []int{1, 3, 5, 10}},
+		{strategy: BranchAndBound, target: 18, values: []int{10, 5, 3}},
+		{strategy: BranchAndBound, target: 39, values: []int{20, 10, 5, 3, 1}},
+		// Nothing adds up to exactly 37, so it falls back to largest-first
+		{strategy: BranchAndBound, target: 37, values: []int{20, 10, 5, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			selector, err := NewCoinSelector(tt.strategy)
+			require.NoError(t, err)
+
+			selected, err := selector.Select(utxos, tt.target)
+			require.NoError(t, err)
+			assert.Equal(t, tt.values, utxoValues(selected))
+		})
+	}
+}
+
+func TestRandomImproveCoversTarget(t *testing.T) {
+	utxos := testUTXOs(1, 5, 10, 20, 3, 8, 2)
+	selector, err := NewCoinSelector(RandomImprove)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		selected, err := selector.Select(utxos, 12)
+		require.NoError(t, err)
+
+		sum := 0
+		seen := make(map[string]bool)
+		for _, utxo := range selected {
+			assert.False(t, seen[utxo.ID], "output picked twice")
+			seen[utxo.ID] = true
+			sum += utxo.Value
+		}
+		assert.GreaterOrEqual(t, sum, 12)
+	}
+}
+
+func TestCoinSelectorsNeedEnoughFunds(t *testing.T) {
+	for _, strategy := range []string{LargestFirst, SmallestFirst, BranchAndBound, RandomImprove} {
+		selector, err := NewCoinSelector(strategy)
+		require.NoError(t, err)
+		_, err = selector.Select(testUTXOs(1, 2), 4)
+		assert.ErrorContains(t, err, "only worth 3, not 4", strategy)
+	}
+
+	_, err := NewCoinSelector("biggest")
+	assert.ErrorContains(t, err, "unknown coin selection")
+}
+
+func TestTransferOnlySpendsWhatItNeeds(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	alice := n.newWallet(t)
+	n.mine(t, sender)
+	n.mine(t, sender)
+
+	txn, err := n.transactionService.CreateTransaction(sender, payTo(alice, 10), reps.TransferOptions{Fee: 1})
+	require.NoError(t, err)
+	assert.Len(t, txn.Inputs, 1)
+	assert.Equal(t, InitialSubsidy-11, txn.Outputs[1].Value)
+
+	txn, err = n.transactionService.CreateTransaction(sender, payTo(alice, 60), reps.TransferOptions{CoinSelection: SmallestFirst})
+	require.NoError(t, err)
+	assert.Len(t, txn.Inputs, 2)
+}
+
+func testUTXOs(values ...int) []reps.UTXO {
+	utxos := make([]reps.UTXO, 0, len(values))
+	for i, value := range values {
+		utxos = append(utxos, reps.UTXO{ID: outpointKey([]byte{byte(i)}, 0), TxnID: []byte{byte(i)}, Value: value})
+	}
+	return utxos
+}
+
+func utxoValues(utxos []reps.UTXO) []int {
+	values := make([]int, 0, len(utxos))
+	for _, utxo := range utxos {
+		values = append(values, utxo.Value)
+	}
+	return values
+}
+
+func TestPendingTransfersSpendDifferentOutputs(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice := n.newWallet(t)
+	bob := n.newWallet(t)
+	n.send(t, miner, alice, 10)
+	n.send(t, miner, alice, 10)
+
+	options := reps.TransferOptions{CoinSelection: SmallestFirst}
+	first, err := n.mempoolService.AddTransaction(alice, payTo(bob, 5), options)
+	require.NoError(t, err)
+	// The first transfer's output is still unspent on chain, but it is left to the pending transaction
+	second, err := n.mempoolService.AddTransaction(alice, payTo(bob, 5), options)
+	require.NoError(t, err)
+
+	require.Len(t, first.Inputs, 1)
+	require.Len(t, second.Inputs, 1)
+	assert.NotEqual(t, outpointKey(first.Inputs[0].PrevTxnID, first.Inputs[0].OutIdx),
+		outpointKey(second.Inputs[0].PrevTxnID, second.Inputs[0].OutIdx))
+
+	// Both outputs are now pending, so a third transfer has nothing to spend
+	_, err = n.mempoolService.AddTransaction(alice, payTo(bob, 5), options)
+	assert.ErrorContains(t, err, "only worth 0")
+
+	n.mine(t, miner)
+	assert.Equal(t, 10, n.balance(t, bob))
+	assert.Equal(t, 10, n.balance(t, alice))
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/utils"
+)
+
+var (
+	// Difficulty is recalculated every RetargetInterval blocks
+	RetargetInterval int64 = 10
+	// Milliseconds the blockchain aims to take per block
+	TargetBlockTime int64 = 10000
+	// A single retarget can't make difficulty more than this many times easier or harder
+	MaxRetargetFactor int64 = 4
+)
+
+type DifficultyService interface {
+	NextBits(prevBlock *reps.Block) (uint32, error)
+	GetDifficulty() (reps.DifficultyInfo, error)
+}
+
+type difficultyService struct {
+	blockchainRepo repository.BlockchainRepository
+}
+
+func NewDifficultyService(blockchainRepo repository.BlockchainRepository) DifficultyService {
+	return &difficultyService{
+		blockchainRepo: blockchainRepo,
+	}
+}
+
+// Compact target the block after prevBlock has to meet. prevBlock is nil for the genesis block.
+// The target only changes every RetargetInterval blocks, based on how long the last interval took
+func (ds *difficultyService) NextBits(prevBlock *reps.Block) (uint32, error) {
+	if prevBlock == nil {
+		return utils.BigToCompact(initialTarget()), nil
+	}
+
+	height := prevBlock.Height + 1
+	if height%RetargetInterval != 0 {
+		return blockBits(*prevBlock), nil
+	}
+
+	firstBlock, err := ds.ancestor(*prevBlock, height-RetargetInterval)
+	if err != nil {
+		return 0, fmt.Errorf("%s, cannot find first block of retarget interval ending at height %d", err.Error(), prevBlock.Height)
+	}
+
+	return retarget(blockBits(*prevBlock), firstBlock, *prevBlock), nil
+}
+
+// Get the difficulty of the last block and an estimate of the next retarget
+func (ds *difficultyService) GetDifficulty() (reps.DifficultyInfo, error) {
+	lastBlock, err := ds.blockchainRepo.GetLastBlock()
+	if err != nil {
+		return reps.DifficultyInfo{}, fmt.Errorf("%s, genesis does not exist", err.Error())
+	}
+
+	bits := blockBits(lastBlock)
+	nextRetargetHeight := (lastBlock.Height/RetargetInterval + 1) * RetargetInterval
+
+	// Project the blocks mined since the last retarget onto the rest of the interval
+	firstBlock, err := ds.ancestor(lastBlock, nextRetargetHeight-RetargetInterval)
+	if err != nil {
+		return reps.DifficultyInfo{}, err
+	}
+
+	averageBlockTime := int64(0)
+	if lastBlock.Height > firstBlock.Height {
+		averageBlockTime = (lastBlock.Timestamp - firstBlock.Timestamp) / (lastBlock.Height - firstBlock.Height)
+	}
+	estimatedNextBits := retarget(bits, firstBlock, lastBlock)
+
+	return reps.DifficultyInfo{
+		Height:                  lastBlock.Height,
+		Bits:                    fmt.Sprintf("%08x", bits),
+		Target:                  fmt.Sprintf("%064x", utils.CompactToBig(bits)),
+		Difficulty:              difficulty(bits),
+		RetargetInterval:        RetargetInterval,
+		TargetBlockTime:         TargetBlockTime,
+		AverageBlockTime:        averageBlockTime,
+		NextRetargetHeight:      nextRetargetHeight,
+		BlocksUntilRetarget:     nextRetargetHeight - lastBlock.Height,
+		EstimatedNextBits:       fmt.Sprintf("%08x", estimatedNextBits),
+		EstimatedNextDifficulty: difficulty(estimatedNextBits),
+	}, nil
+}
+
+// Find the block at height on the same branch as block
+func (ds *difficultyService) ancestor(block reps.Block, height int64) (reps.Block, error) {
+	for block.Height > height {
+		// Below an active block, the branch is the active chain
+		if block.Status == reps.BlockStatusActive {
+			return ds.blockchainRepo.GetBlockByHeight(height)
+		}
+
+		prevBlock, err := ds.blockchainRepo.GetBlockByHash(block.PrevHash)
+		if err != nil {
+			return reps.Block{}, err
+		}
+		block = prevBlock
+	}
+
+	return block, nil
+}
+
+// Scale the target by how long the blocks from firstBlock to lastBlock actually took versus how long they should have taken
+func retarget(bits uint32, firstBlock reps.Block, lastBlock reps.Block) uint32 {
+	intervals := lastBlock.Height - firstBlock.Height
+	if intervals <= 0 {
+		return bits
+	}
+
+	expectedTimespan := intervals * TargetBlockTime
+	actualTimespan := lastBlock.Timestamp - firstBlock.Timestamp
+	if actualTimespan < expectedTimespan/MaxRetargetFactor {
+		actualTimespan = expectedTimespan / MaxRetargetFactor
+	}
+	if actualTimespan > expectedTimespan*MaxRetargetFactor {
+		actualTimespan = expectedTimespan * MaxRetargetFactor
+	}
+
+	target := utils.CompactToBig(bits)
+	target.Mul(target, big.NewInt(actualTimespan))
+	target.Div(target, big.NewInt(expectedTimespan))
+
+	if target.Cmp(powLimit()) > 0 {
+		target = powLimit()
+	}
+
+	return utils.BigToCompact(target)
+}
+
+// How many times harder a target is than the easiest allowed target
+func difficulty(bits uint32) float64 {
+	ratio := new(big.Float).Quo(new(big.Float).SetInt(powLimit()), new(big.Float).SetInt(utils.CompactToBig(bits)))
+	value, _ := ratio.Float64()
+	return value
+}
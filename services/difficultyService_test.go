@@ -0,0 +1,76 @@
+package services
+
+import (
+	"math/big"
+	"testing"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetargetIsClampedAt4x(t *testing.T) {
+	bits := utils.BigToCompact(new(big.Int).Lsh(big.NewInt(1), 200))
+	expectedTimespan := 10 * TargetBlockTime
+
+	tests := []struct {
+		name     string
+		timespan int64
+		shift    uint
+	}{
+		{name: "much too fast", timespan: 1, shift: 198},
+		{name: "twice as fast", timespan: expectedTimespan / 2, shift: 199},
+		{name: "on time", timespan: expectedTimespan, shift: 200},
+		{name: "twice as slow", timespan: expectedTimespan * 2, shift: 201},
+		{name: "much too slow", timespan: expectedTimespan * 100, shift: 202},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			firstBlock := reps.Block{Height: 10, Timestamp: 1000}
+			lastBlock := reps.Block{Height: 20, Timestamp: 1000 + tt.timespan}
+
+			newBits := retarget(bits, firstBlock, lastBlock)
+			assert.Equal(t, new(big.Int).Lsh(big.NewInt(1), tt.shift), utils.CompactToBig(newBits))
+		})
+	}
+}
+
+func TestRetargetNeverGoesPastPowLimit(t *testing.T) {
+	bits := utils.BigToCompact(powLimit())
+	newBits := retarget(bits, reps.Block{Height: 0, Timestamp: 0}, reps.Block{Height: 10, Timestamp: 100 * TargetBlockTime})
+	assert.Equal(t, powLimit(), utils.CompactToBig(newBits))
+}
+
+func TestNextBitsRetargetsEveryInterval(t *testing.T) {
+	defer func(interval int64) { RetargetInterval = interval }(RetargetInterval)
+	RetargetInterval = 4
+
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	for i := 0; i < 3; i++ {
+		block := n.mine(t, miner)
+		assert.Equal(t, utils.BigToCompact(initialTarget()), block.Bits, "no retarget inside the interval")
+	}
+
+	info, err := n.difficultyService.GetDifficulty()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), info.NextRetargetHeight)
+	assert.Equal(t, int64(1), info.BlocksUntilRetarget)
+	assert.Equal(t, float64(16), info.Difficulty)
+
+	// Blocks are mined far faster than TargetBlockTime, so difficulty goes up as much as it can
+	block := n.mine(t, miner)
+	assert.Equal(t, new(big.Int).Rsh(initialTarget(), 2), utils.CompactToBig(block.Bits))
+	info, err = n.difficultyService.GetDifficulty()
+	require.NoError(t, err)
+	assert.Equal(t, float64(64), info.Difficulty)
+
+	bits, err := n.difficultyService.NextBits(&block)
+	require.NoError(t, err)
+	assert.Equal(t, block.Bits, bits)
+	bits, err = n.difficultyService.NextBits(nil)
+	require.NoError(t, err)
+	assert.Equal(t, utils.BigToCompact(initialTarget()), bits)
+}
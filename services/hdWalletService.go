@@ -0,0 +1,420 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/brucetieu/blockchain/hd"
+	"github.com/brucetieu/blockchain/keycrypt"
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/script"
+	"github.com/tyler-smith/go-bip39"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MnemonicEntropyBits -> Entropy behind new mnemonics, 256 bits makes 24 words
+// GapLimit -> Unused addresses in a row after which a restore stops looking further along a chain, as in BIP44
+// hdAccount -> HD wallets only use the first account
+const (
+	MnemonicEntropyBits = 256
+	GapLimit            = 20
+
+	hdAccount uint32 = 0
+)
+
+type HDWalletService interface {
+	CreateHDWallet(passphrase string) (reps.ReadableHDWallet, error)
+	RestoreHDWallet(mnemonic string, passphrase string) (reps.ReadableHDWallet, error)
+	GetHDWallet(id string) (reps.ReadableHDWallet, error)
+	DeriveAddress(id string, change bool) (reps.HDAddress, error)
+	ChangeAddress(id string) (reps.HDAddress, error)
+}
+
+// Only the seed of an HD wallet is kept, encrypted. Addresses are derived from the account's extended public key
+// and saved as wallets, so they can be paid to without unlocking anything. Their private keys are derived from the
+// seed while the HD wallet is unlocked, see walletService.GetPrivateKey
+type hdWalletService struct {
+	// Stops two addresses being derived at the same index
+	mu sync.Mutex
+
+	blockchainRepo repository.BlockchainRepository
+	walletService  WalletService
+	// What pending transactions pay to, so change addresses they pay aren't given out again
+	mempoolIndex *MempoolIndex
+}
+
+func NewHDWalletService(blockchainRepo repository.BlockchainRepository, walletService WalletService,
+	mempoolIndex *MempoolIndex,
+) HDWalletService {
+	return &hdWalletService{
+		blockchainRepo: blockchainRepo,
+		walletService:  walletService,
+		mempoolIndex:   mempoolIndex,
+	}
+}
+
+// Create an HD wallet from a new random mnemonic, with its seed encrypted under passphrase. The mnemonic is in
+// what's returned and isn't saved anywhere
+func (hs *hdWalletService) CreateHDWallet(passphrase string) (reps.ReadableHDWallet, error) {
+	if err := checkPassphrase(passphrase); err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+
+	entropy, err := bip39.NewEntropy(MnemonicEntropyBits)
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+
+	hdWallet, err := hs.createHDWallet(bip39.NewSeed(mnemonic, ""), passphrase)
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+
+	readable, err := hs.toReadableHDWallet(hdWallet)
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+	readable.Mnemonic = mnemonic
+
+	log.Info("created HD wallet: ", hdWallet.ID)
+	return readable, nil
+}
+
+// Restore an HD wallet from its mnemonic. Both chains are scanned for addresses that appear in a transaction,
+// stopping after GapLimit unused addresses in a row, and every address up to the last used one is saved.
+// Restoring a wallet that already exists saves whatever addresses it is missing, and encrypts its seed under
+// passphrase. Knowing the mnemonic is enough to spend from the wallet anyway
+func (hs *hdWalletService) RestoreHDWallet(mnemonic string, passphrase string) (reps.ReadableHDWallet, error) {
+	if err := checkPassphrase(passphrase); err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "")
+	if err != nil {
+		return reps.ReadableHDWallet{}, fmt.Errorf("%s, mnemonic is not valid", err.Error())
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hdWallet, err := hs.createHDWallet(seed, passphrase)
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+
+	master, err := hd.NewMaster(seed)
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+	accountKey, err := master.Derive(hd.AccountPath(hdAccount))
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+	derived, err := hs.derivedIndexes(hdWallet.ID)
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+	used, err := hs.usedPubKeyHashes()
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+
+	for _, chain := range []uint32{hd.ExternalChain, hd.InternalChain} {
+		chainKey, err := accountKey.Child(chain)
+		if err != nil {
+			return reps.ReadableHDWallet{}, err
+		}
+
+		keys := make([]*hd.ExtendedKey, 0)
+		lastUsed := -1
+		for index, unused := uint32(0), 0; unused < GapLimit; index++ {
+			key, err := chainKey.Child(index)
+			if err != nil {
+				return reps.ReadableHDWallet{}, err
+			}
+			keys = append(keys, key)
+
+			pubKeyHash, err := hs.walletService.CreatePubKeyHash(key.PublicKey())
+			if err != nil {
+				return reps.ReadableHDWallet{}, err
+			}
+			if used[string(pubKeyHash)] {
+				lastUsed = int(index)
+				unused = 0
+			} else {
+				unused++
+			}
+		}
+
+		for index := 0; index <= lastUsed; index++ {
+			if derived[chain][uint32(index)] {
+				continue
+			}
+			if _, err := hs.saveAddress(hdWallet.ID, chain, uint32(index), keys[index]); err != nil {
+				return reps.ReadableHDWallet{}, err
+			}
+		}
+		log.Infof("restored HD wallet %s chain %d up to index %d", hdWallet.ID, chain, lastUsed)
+	}
+
+	return hs.toReadableHDWallet(hdWallet)
+}
+
+func (hs *hdWalletService) GetHDWallet(id string) (reps.ReadableHDWallet, error) {
+	hdWallet, err := hs.getHDWallet(id)
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+
+	return hs.toReadableHDWallet(hdWallet)
+}
+
+// Derive the address after the last one derived on the receive chain, or on the change chain if change is set
+func (hs *hdWalletService) DeriveAddress(id string, change bool) (reps.HDAddress, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hdWallet, err := hs.getHDWallet(id)
+	if err != nil {
+		return reps.HDAddress{}, err
+	}
+
+	chain := hd.ExternalChain
+	if change {
+		chain = hd.InternalChain
+	}
+
+	return hs.deriveAddress(hdWallet, chain)
+}
+
+// Address for the change of a transfer from the HD wallet. The last address derived on the change chain is given
+// again as long as nothing has paid to it, in the chain or in a pending transaction, so a transfer that fails doesn't
+// use one up. Otherwise the next address of the change chain is derived
+func (hs *hdWalletService) ChangeAddress(id string) (reps.HDAddress, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hdWallet, err := hs.getHDWallet(id)
+	if err != nil {
+		return reps.HDAddress{}, err
+	}
+
+	wallets, err := hs.blockchainRepo.GetHDWalletAddresses(hdWallet.ID)
+	if err != nil {
+		return reps.HDAddress{}, err
+	}
+
+	var last *reps.HDAddress
+	for _, wallet := range wallets {
+		chain, index, err := addressPosition(wallet)
+		if err != nil {
+			return reps.HDAddress{}, err
+		}
+		if chain == hd.InternalChain && (last == nil || index > last.Index) {
+			last = &reps.HDAddress{Address: wallet.Address, Path: wallet.DerivationPath, Change: true, Index: index}
+		}
+	}
+
+	if last != nil {
+		used, err := hs.usedPubKeyHashes()
+		if err != nil {
+			return reps.HDAddress{}, err
+		}
+		if !used[string(addressHash(last.Address))] {
+			return *last, nil
+		}
+	}
+
+	return hs.deriveAddress(hdWallet, hd.InternalChain)
+}
+
+// Derive and save the address after the last one derived on chain. hs.mu has to be held
+func (hs *hdWalletService) deriveAddress(hdWallet reps.HDWallet, chain uint32) (reps.HDAddress, error) {
+	derived, err := hs.derivedIndexes(hdWallet.ID)
+	if err != nil {
+		return reps.HDAddress{}, err
+	}
+	index := uint32(len(derived[chain]))
+	for derived[chain][index] {
+		index++
+	}
+
+	accountXPub, err := hd.ParseExtendedKey(hdWallet.AccountXPub)
+	if err != nil {
+		return reps.HDAddress{}, err
+	}
+	key, err := accountXPub.Derive([]uint32{chain, index})
+	if err != nil {
+		return reps.HDAddress{}, err
+	}
+
+	wallet, err := hs.saveAddress(hdWallet.ID, chain, index, key)
+	if err != nil {
+		return reps.HDAddress{}, err
+	}
+
+	return reps.HDAddress{Address: wallet.Address, Path: wallet.DerivationPath, Change: chain == hd.InternalChain, Index: index}, nil
+}
+
+func (hs *hdWalletService) getHDWallet(id string) (reps.HDWallet, error) {
+	hdWallet, err := hs.blockchainRepo.GetHDWallet(id)
+	if err != nil {
+		return reps.HDWallet{}, fmt.Errorf("%s, HD wallet %s does not exist", err.Error(), id)
+	}
+
+	return hdWallet, nil
+}
+
+// Save the HD wallet of a seed with the seed encrypted under passphrase. If it was saved before, its seed is
+// encrypted under passphrase again
+func (hs *hdWalletService) createHDWallet(seed []byte, passphrase string) (reps.HDWallet, error) {
+	master, err := hd.NewMaster(seed)
+	if err != nil {
+		return reps.HDWallet{}, err
+	}
+
+	encryptedSeed, err := keycrypt.Encrypt(seed, passphrase)
+	if err != nil {
+		return reps.HDWallet{}, err
+	}
+
+	id := hex.EncodeToString(script.Hash160(master.PublicKey()))
+	if hdWallet, err := hs.blockchainRepo.GetHDWallet(id); err == nil {
+		hdWallet.Seed = encryptedSeed
+		hdWallet.SeedEncrypted = true
+		if err := hs.blockchainRepo.UpdateHDWallet(hdWallet); err != nil {
+			return reps.HDWallet{}, err
+		}
+		return hdWallet, nil
+	}
+
+	accountKey, err := master.Derive(hd.AccountPath(hdAccount))
+	if err != nil {
+		return reps.HDWallet{}, err
+	}
+
+	hdWallet := reps.HDWallet{
+		ID:            id,
+		Seed:          encryptedSeed,
+		SeedEncrypted: true,
+		AccountXPub:   accountKey.Neuter().String(),
+	}
+
+	// Persist
+	if err := hs.blockchainRepo.CreateHDWallet(hdWallet); err != nil {
+		return reps.HDWallet{}, err
+	}
+
+	return hdWallet, nil
+}
+
+// Save the key at index of chain as a wallet of the HD wallet
+func (hs *hdWalletService) saveAddress(hdWalletId string, chain uint32, index uint32, key *hd.ExtendedKey) (reps.Wallet, error) {
+	path := hd.FormatPath(hd.AddressPath(hdAccount, chain, index))
+	return hs.walletService.CreateDerivedWallet(key.PublicKey(), hdWalletId, path)
+}
+
+// Chain and index of each address of an HD wallet saved so far
+func (hs *hdWalletService) derivedIndexes(hdWalletId string) (map[uint32]map[uint32]bool, error) {
+	wallets, err := hs.blockchainRepo.GetHDWalletAddresses(hdWalletId)
+	if err != nil {
+		return nil, err
+	}
+
+	derived := map[uint32]map[uint32]bool{hd.ExternalChain: {}, hd.InternalChain: {}}
+	for _, wallet := range wallets {
+		chain, index, err := addressPosition(wallet)
+		if err != nil {
+			return nil, err
+		}
+		derived[chain][index] = true
+	}
+
+	return derived, nil
+}
+
+// Public key hashes that any output has ever paid to, including outputs of pending transactions
+func (hs *hdWalletService) usedPubKeyHashes() (map[string]bool, error) {
+	txns, err := hs.blockchainRepo.GetTransactions()
+	if err != nil {
+		return nil, err
+	}
+
+	used := make(map[string]bool)
+	for _, txn := range txns {
+		for _, output := range txn.Outputs {
+			used[string(output.PubKeyHash)] = true
+		}
+	}
+	for _, pubKeyHash := range hs.mempoolIndex.PaidTo() {
+		used[string(pubKeyHash)] = true
+	}
+
+	return used, nil
+}
+
+// The HD wallet with its addresses sorted by chain then index, and their balances
+func (hs *hdWalletService) toReadableHDWallet(hdWallet reps.HDWallet) (reps.ReadableHDWallet, error) {
+	wallets, err := hs.blockchainRepo.GetHDWalletAddresses(hdWallet.ID)
+	if err != nil {
+		return reps.ReadableHDWallet{}, err
+	}
+
+	readable := reps.ReadableHDWallet{
+		ID:          hdWallet.ID,
+		AccountXPub: hdWallet.AccountXPub,
+		Addresses:   make([]reps.HDAddress, 0, len(wallets)),
+	}
+	for _, wallet := range wallets {
+		chain, index, err := addressPosition(wallet)
+		if err != nil {
+			return reps.ReadableHDWallet{}, err
+		}
+		balance, err := addressBalance(hs.blockchainRepo, wallet.Address)
+		if err != nil {
+			return reps.ReadableHDWallet{}, err
+		}
+
+		readable.Balance += balance
+		readable.Addresses = append(readable.Addresses, reps.HDAddress{
+			Address: wallet.Address,
+			Path:    wallet.DerivationPath,
+			Change:  chain == hd.InternalChain,
+			Index:   index,
+			Balance: balance,
+		})
+	}
+
+	sort.SliceStable(readable.Addresses, func(i, j int) bool {
+		a, b := readable.Addresses[i], readable.Addresses[j]
+		if a.Change != b.Change {
+			return !a.Change
+		}
+		return a.Index < b.Index
+	})
+
+	return readable, nil
+}
+
+// Chain and index of an HD wallet address, the last two levels of its derivation path
+func addressPosition(wallet reps.Wallet) (uint32, uint32, error) {
+	path, err := hd.ParsePath(wallet.DerivationPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(path) != len(hd.AddressPath(hdAccount, 0, 0)) || (path[3] != hd.ExternalChain && path[3] != hd.InternalChain) {
+		return 0, 0, fmt.Errorf("wallet %s has derivation path %s, which is not an address path", wallet.Address, wallet.DerivationPath)
+	}
+
+	return path[3], path[4], nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brucetieu/blockchain/hd"
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tyler-smith/go-bip39"
+)
+
+func TestCreateHDWallet(t *testing.T) {
+	n := newTestNode(t)
+
+	hdWallet, err := n.hdWalletService.CreateHDWallet(testPassphrase)
+	require.NoError(t, err)
+
+	assert.Len(t, strings.Fields(hdWallet.Mnemonic), 24)
+	assert.Empty(t, hdWallet.Addresses)
+	accountXPub, err := hd.ParseExtendedKey(hdWallet.AccountXPub)
+	require.NoError(t, err)
+	assert.False(t, accountXPub.Private)
+
+	// The mnemonic is only ever shown once
+	got, err := n.hdWalletService.GetHDWallet(hdWallet.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.Mnemonic)
+	assert.Equal(t, hdWallet.AccountXPub, got.AccountXPub)
+}
+
+func TestDeriveAddress(t *testing.T) {
+	n := newTestNode(t)
+	hdWallet, err := n.hdWalletService.CreateHDWallet(testPassphrase)
+	require.NoError(t, err)
+
+	for i := uint32(0); i < 3; i++ {
+		address, err := n.hdWalletService.DeriveAddress(hdWallet.ID, false)
+		require.NoError(t, err)
+		assert.Equal(t, i, address.Index)
+		assert.Equal(t, hd.FormatPath(hd.AddressPath(0, hd.ExternalChain, i)), address.Path)
+	}
+	change, err := n.hdWalletService.DeriveAddress(hdWallet.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, "m/44'/0'/0'/1/0", change.Path)
+	assert.True(t, change.Change)
+
+	got, err := n.hdWalletService.GetHDWallet(hdWallet.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Addresses, 4)
+	assert.Equal(t, change, got.Addresses[3])
+
+	_, err = n.hdWalletService.DeriveAddress("missing", false)
+	assert.Error(t, err)
+}
+
+// Addresses are derived from the account xpub, the private key derived from the seed once unlocked must match
+func TestHDAddressSignsOnceUnlocked(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	hdWallet, err := n.hdWalletService.CreateHDWallet(testPassphrase)
+	require.NoError(t, err)
+	address, err := n.hdWalletService.DeriveAddress(hdWallet.ID, false)
+	require.NoError(t, err)
+
+	_, err = n.walletService.GetPrivateKey(address.Address)
+	assert.ErrorIs(t, err, ErrWalletLocked)
+
+	_, err = n.walletService.UnlockWallet(hdWallet.ID, testPassphrase, time.Hour)
+	require.NoError(t, err)
+	privKey, err := n.walletService.GetPrivateKey(address.Address)
+	require.NoError(t, err)
+	wallet, err := n.walletService.GetWallet(address.Address)
+	require.NoError(t, err)
+	assert.Equal(t, wallet.PublicKey, hex.EncodeToString(append(privKey.X.FillBytes(make([]byte, 32)), privKey.Y.FillBytes(make([]byte, 32))...)))
+
+	n.send(t, miner, address.Address, 10)
+	n.send(t, address.Address, miner, 10)
+	// Only the coinbase of the block it mined is left
+	assert.Equal(t, 50, n.balance(t, address.Address))
+}
+
+func TestRestoreHDWallet(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+
+	mnemonic, err := bip39.NewMnemonic(make([]byte, 16))
+	require.NoError(t, err)
+	master, err := hd.NewMaster(bip39.NewSeed(mnemonic, ""))
+	require.NoError(t, err)
+	addressAt := func(chain uint32, index uint32) string {
+		key, err := master.Derive(hd.AddressPath(0, chain, index))
+		require.NoError(t, err)
+		address, err := n.walletService.CreateAddress(key.PublicKey())
+		require.NoError(t, err)
+		return string(address)
+	}
+
+	// Index 37 is past the gap limit from 15, so the restore doesn't find it
+	_, err = n.blockchainService.AddToBlockChain(context.Background(), miner, []reps.Payment{
+		{To: addressAt(hd.ExternalChain, 0), Amount: 1},
+		{To: addressAt(hd.ExternalChain, 15), Amount: 2},
+		{To: addressAt(hd.ExternalChain, 37), Amount: 4},
+		{To: addressAt(hd.InternalChain, 3), Amount: 8},
+	}, reps.TransferOptions{})
+	require.NoError(t, err)
+
+	restored, err := n.hdWalletService.RestoreHDWallet("  "+mnemonic+"\n", testPassphrase)
+	require.NoError(t, err)
+	require.Len(t, restored.Addresses, 16+4)
+	assert.Equal(t, 11, restored.Balance)
+	assert.Equal(t, 2, restored.Addresses[15].Balance)
+	assert.True(t, restored.Addresses[19].Change)
+	assert.Equal(t, uint32(3), restored.Addresses[19].Index)
+
+	next, err := n.hdWalletService.DeriveAddress(restored.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(16), next.Index)
+
+	// Restoring again finds the same wallet and has nothing to add
+	again, err := n.hdWalletService.RestoreHDWallet(mnemonic, testPassphrase)
+	require.NoError(t, err)
+	assert.Equal(t, restored.ID, again.ID)
+	assert.Len(t, again.Addresses, 16+4+1)
+
+	_, err = n.hdWalletService.RestoreHDWallet("abandon abandon abandon", testPassphrase)
+	assert.Error(t, err)
+}
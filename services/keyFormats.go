@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/akamensky/base58"
+)
+
+// Formats private keys are exported and imported in
+// wif -> Wallet Import Format: base58check of the version byte 0x80 followed by the 32 byte private key. Keys are on
+// P-256, so there is no compressed flag, and a WIF from a Bitcoin wallet imports as a different address
+// pem -> PEM encoded SEC 1 DER, an "EC PRIVATE KEY" block. PKCS #8 "PRIVATE KEY" blocks are imported too
+const (
+	WIFFormat = "wif"
+	PEMFormat = "pem"
+
+	wifVersion = byte(0x80)
+
+	pemECPrivateKey = "EC PRIVATE KEY"
+	pemPrivateKey   = "PRIVATE KEY"
+)
+
+// Encode a private key in format
+func (ws *walletService) encodePrivateKey(privKey ecdsa.PrivateKey, format string) (string, error) {
+	switch format {
+	case WIFFormat:
+		size := (privKey.Curve.Params().BitSize + 7) / 8
+		payload := make([]byte, 1+size)
+		payload[0] = wifVersion
+		privKey.D.FillBytes(payload[1:])
+		checksum := ws.CreateChecksum(payload)
+		return base58.Encode(append(payload, checksum...)), nil
+	case PEMFormat:
+		der, err := x509.MarshalECPrivateKey(&privKey)
+		if err != nil {
+			return "", err
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: pemECPrivateKey, Bytes: der})), nil
+	default:
+		return "", fmt.Errorf("unknown key format %s, expected %s or %s", format, WIFFormat, PEMFormat)
+	}
+}
+
+// Decode a private key in format. An empty format is worked out from the key, PEM if it has a PEM header
+func (ws *walletService) decodePrivateKey(key string, format string) (ecdsa.PrivateKey, error) {
+	key = strings.TrimSpace(key)
+	if format == "" {
+		format = WIFFormat
+		if strings.HasPrefix(key, "-----BEGIN") {
+			format = PEMFormat
+		}
+	}
+
+	switch format {
+	case WIFFormat:
+		return ws.decodeWIF(key)
+	case PEMFormat:
+		return decodePEM(key)
+	default:
+		return ecdsa.PrivateKey{}, fmt.Errorf("unknown key format %s, expected %s or %s", format, WIFFormat, PEMFormat)
+	}
+}
+
+func (ws *walletService) decodeWIF(key string) (ecdsa.PrivateKey, error) {
+	decoded, err := base58.Decode(key)
+	if err != nil {
+		return ecdsa.PrivateKey{}, fmt.Errorf("%s, key is not valid base58", err.Error())
+	}
+
+	curve := elliptic.P256()
+	size := (curve.Params().BitSize + 7) / 8
+	if len(decoded) != 1+size+ChecksumLen {
+		return ecdsa.PrivateKey{}, fmt.Errorf("key is not a WIF of a %d byte private key", size)
+	}
+
+	payload, checksum := decoded[:1+size], decoded[1+size:]
+	if !bytes.Equal(checksum, ws.CreateChecksum(payload)) {
+		return ecdsa.PrivateKey{}, fmt.Errorf("checksum of the key does not match")
+	}
+	if payload[0] != wifVersion {
+		return ecdsa.PrivateKey{}, fmt.Errorf("key has version %#x, expected %#x", payload[0], wifVersion)
+	}
+
+	return privateKeyFromScalar(new(big.Int).SetBytes(payload[1:]))
+}
+
+func decodePEM(key string) (ecdsa.PrivateKey, error) {
+	block, rest := pem.Decode([]byte(key))
+	if block == nil {
+		return ecdsa.PrivateKey{}, fmt.Errorf("key is not PEM encoded")
+	}
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return ecdsa.PrivateKey{}, fmt.Errorf("key has more than one PEM block")
+	}
+
+	var privKey *ecdsa.PrivateKey
+	switch block.Type {
+	case pemECPrivateKey:
+		parsed, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return ecdsa.PrivateKey{}, fmt.Errorf("%s, key is not a valid EC private key", err.Error())
+		}
+		privKey = parsed
+	case pemPrivateKey:
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return ecdsa.PrivateKey{}, fmt.Errorf("%s, key is not a valid PKCS #8 private key", err.Error())
+		}
+		ecKey, ok := parsed.(*ecdsa.PrivateKey)
+		if !ok {
+			return ecdsa.PrivateKey{}, fmt.Errorf("key is a %T, not an EC private key", parsed)
+		}
+		privKey = ecKey
+	default:
+		return ecdsa.PrivateKey{}, fmt.Errorf("PEM block is a %s, expected %s or %s", block.Type, pemECPrivateKey, pemPrivateKey)
+	}
+
+	if privKey.Curve != elliptic.P256() {
+		return ecdsa.PrivateKey{}, fmt.Errorf("key is on %s, expected P-256", privKey.Curve.Params().Name)
+	}
+
+	return *privKey, nil
+}
+
+// P-256 private key with scalar d, which has to be between 1 and the order of the curve
+func privateKeyFromScalar(d *big.Int) (ecdsa.PrivateKey, error) {
+	curve := elliptic.P256()
+	if d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+		return ecdsa.PrivateKey{}, fmt.Errorf("private key is out of range for P-256")
+	}
+
+	privKey := ecdsa.PrivateKey{D: d}
+	privKey.PublicKey.Curve = curve
+	privKey.PublicKey.X, privKey.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+	return privKey, nil
+}
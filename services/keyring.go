@@ -0,0 +1,71 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Secrets decrypted by unlocking a wallet, kept in memory until their unlock session expires or the wallet is
+// locked again. Nothing here is ever saved
+type keyring struct {
+	mu       sync.Mutex
+	sessions map[string]unlockSession
+}
+
+type unlockSession struct {
+	secret  []byte
+	expires time.Time
+}
+
+func newKeyring() *keyring {
+	return &keyring{sessions: make(map[string]unlockSession)}
+}
+
+// Keep the secret of id until timeout has passed, replacing any session id already has
+func (kr *keyring) unlock(id string, secret []byte, timeout time.Duration) time.Time {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if session, ok := kr.sessions[id]; ok {
+		wipe(session.secret)
+	}
+
+	expires := time.Now().Add(timeout)
+	kr.sessions[id] = unlockSession{secret: secret, expires: expires}
+	return expires
+}
+
+// Secret of id if it is unlocked. Expired sessions are dropped when they are next looked at
+func (kr *keyring) get(id string) ([]byte, bool) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	session, ok := kr.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(session.expires) {
+		wipe(session.secret)
+		delete(kr.sessions, id)
+		return nil, false
+	}
+
+	return append([]byte{}, session.secret...), true
+}
+
+func (kr *keyring) lock(id string) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if session, ok := kr.sessions[id]; ok {
+		wipe(session.secret)
+		delete(kr.sessions, id)
+	}
+}
+
+// Overwrite a secret that is no longer needed, so it doesn't linger in memory
+func wipe(secret []byte) {
+	for i := range secret {
+		secret[i] = 0
+	}
+}
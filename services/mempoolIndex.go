@@ -0,0 +1,71 @@
+package services
+
+import (
+	"encoding/hex"
+	"sync"
+
+	reps "github.com/brucetieu/blockchain/representations"
+)
+
+// What transactions waiting in the mempool spend and pay to, kept up to date by the mempool. The mempool is built on the
+// transaction service, so services it is built on get the index instead to see what is pending.
+// spentBy -> "<prevTxnId>:<outIdx>" of every output spent by a pending transaction, mapped to the spending transaction id
+// paidTo -> How many outputs of pending transactions pay to each public key hash
+type MempoolIndex struct {
+	mu      sync.RWMutex
+	spentBy map[string]string
+	paidTo  map[string]int
+}
+
+func NewMempoolIndex() *MempoolIndex {
+	return &MempoolIndex{spentBy: make(map[string]string), paidTo: make(map[string]int)}
+}
+
+// Id of the pending transaction that spends output outIdx of txnId, if there is one
+func (mi *MempoolIndex) SpentBy(txnId []byte, outIdx int) (string, bool) {
+	mi.mu.RLock()
+	defer mi.mu.RUnlock()
+
+	spender, ok := mi.spentBy[outpointKey(txnId, outIdx)]
+	return spender, ok
+}
+
+// Public key hashes that outputs of pending transactions pay to
+func (mi *MempoolIndex) PaidTo() [][]byte {
+	mi.mu.RLock()
+	defer mi.mu.RUnlock()
+
+	pubKeyHashes := make([][]byte, 0, len(mi.paidTo))
+	for pubKeyHash := range mi.paidTo {
+		pubKeyHashes = append(pubKeyHashes, []byte(pubKeyHash))
+	}
+	return pubKeyHashes
+}
+
+func (mi *MempoolIndex) add(txn reps.Transaction) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	txnId := hex.EncodeToString(txn.ID)
+	for _, input := range txn.Inputs {
+		mi.spentBy[outpointKey(input.PrevTxnID, input.OutIdx)] = txnId
+	}
+	for _, output := range txn.Outputs {
+		mi.paidTo[string(output.PubKeyHash)]++
+	}
+}
+
+func (mi *MempoolIndex) remove(txn reps.Transaction) {
+	mi.mu.Lock()
+	defer mi.mu.Unlock()
+
+	for _, input := range txn.Inputs {
+		delete(mi.spentBy, outpointKey(input.PrevTxnID, input.OutIdx))
+	}
+	for _, output := range txn.Outputs {
+		key := string(output.PubKeyHash)
+		if mi.paidTo[key]--; mi.paidTo[key] <= 0 {
+			delete(mi.paidTo, key)
+		}
+	}
+}
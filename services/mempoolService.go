@@ -0,0 +1,322 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+
+	reps "github.com/brucetieu/blockchain/representations"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type MempoolService interface {
+	AddTransaction(from string, payments []reps.Payment, options reps.TransferOptions) (reps.Transaction, error)
+	AddToPool(txn reps.Transaction) error
+	AddRawTransaction(txn reps.Transaction) (reps.Transaction, error)
+	SweepWallet(from string, to string, passphrase string, options reps.TransferOptions) (string, reps.Transaction, error)
+	GetPendingTransactions() []reps.Transaction
+	SelectTransactions(maxSize int) []reps.Transaction
+	RemoveTransactions(txns []reps.Transaction)
+	Revalidate()
+}
+
+// pending -> transactions waiting to be mined, keyed by transaction id
+// order -> transaction ids in the order they arrived, so transactions paying the same fee rate are mined first come first served
+// index -> what the pending transactions spend
+type mempoolService struct {
+	mu      sync.RWMutex
+	pending map[string]reps.Transaction
+	order   []string
+	index   *MempoolIndex
+
+	transactionService TransactionService
+	walletService      WalletService
+}
+
+func NewMempoolService(transactionService TransactionService, walletService WalletService, index *MempoolIndex) MempoolService {
+	return &mempoolService{
+		pending:            make(map[string]reps.Transaction),
+		order:              make([]string, 0),
+		index:              index,
+		transactionService: transactionService,
+		walletService:      walletService,
+	}
+}
+
+// Create a signed transfer to one or more addresses and park it in the pool until it is mined
+func (ms *mempoolService) AddTransaction(from string, payments []reps.Payment, options reps.TransferOptions) (reps.Transaction, error) {
+	addresses := []string{from}
+	for _, payment := range payments {
+		addresses = append(addresses, payment.To)
+	}
+
+	for _, address := range addresses {
+		validation, err := ms.walletService.ValidateAddress(address)
+		if err != nil {
+			return reps.Transaction{}, err
+		}
+		if !validation.Valid {
+			return reps.Transaction{}, fmt.Errorf("error: address of %s is not valid", address)
+		}
+	}
+
+	txn, err := ms.transactionService.CreateTransaction(from, payments, options)
+	if err != nil {
+		return reps.Transaction{}, err
+	}
+
+	if err := ms.AddToPool(txn); err != nil {
+		return reps.Transaction{}, err
+	}
+
+	return txn, nil
+}
+
+// Move every unspent output of a wallet whose key may have leaked to to, or to a new wallet whose key is encrypted under
+// passphrase if to is empty, in a single transaction parked in the pool. The wallet is then retired. Returns the address
+// the coins were swept to along with the transaction
+func (ms *mempoolService) SweepWallet(from string, to string, passphrase string, options reps.TransferOptions) (string, reps.Transaction, error) {
+	if _, err := ms.walletService.GetWallet(from); err != nil {
+		return "", reps.Transaction{}, err
+	}
+
+	if to != "" {
+		validation, err := ms.walletService.ValidateAddress(to)
+		if err != nil {
+			return "", reps.Transaction{}, err
+		}
+		if !validation.Valid {
+			return "", reps.Transaction{}, fmt.Errorf("error: address of %s is not valid", to)
+		}
+		if to == from {
+			return "", reps.Transaction{}, fmt.Errorf("cannot sweep %s to itself", from)
+		}
+		if toWallet, err := ms.walletService.GetWallet(to); err == nil && toWallet.Retired {
+			return "", reps.Transaction{}, fmt.Errorf("%w, cannot sweep to %s", ErrWalletRetired, to)
+		}
+	}
+
+	// Without an address, check the sweep can be signed and covers its fee before making a wallet for it, by building
+	// it back to the same wallet first. Every address is the same size, so is the fee
+	sweepTo := to
+	if sweepTo == "" {
+		sweepTo = from
+	}
+	txn, err := ms.transactionService.CreateSweepTransaction(from, sweepTo, options)
+	if err != nil {
+		return "", reps.Transaction{}, err
+	}
+
+	if to == "" {
+		newWallet, err := ms.walletService.CreateWallet(passphrase)
+		if err != nil {
+			return "", reps.Transaction{}, err
+		}
+		to = newWallet.Address
+
+		txn, err = ms.transactionService.CreateSweepTransaction(from, to, options)
+		if err != nil {
+			return "", reps.Transaction{}, err
+		}
+	}
+
+	if err := ms.AddToPool(txn); err != nil {
+		return "", reps.Transaction{}, err
+	}
+
+	if err := ms.walletService.RetireWallet(from, to); err != nil {
+		return "", reps.Transaction{}, fmt.Errorf("%s, %s was swept in transaction %x but is not retired", err.Error(), from, txn.ID)
+	}
+
+	return to, txn, nil
+}
+
+// Add a transaction signed outside the app, e.g. with a key the app never sees. Neither the sender nor the recipients
+// need a wallet here. Its id has to match its contents, and its inputs and outputs have to point back at it as they
+// did when it was signed. Then it is checked like any other transaction
+func (ms *mempoolService) AddRawTransaction(txn reps.Transaction) (reps.Transaction, error) {
+	if len(txn.Inputs) == 0 || len(txn.Outputs) == 0 {
+		return reps.Transaction{}, fmt.Errorf("transaction needs at least one input and one output")
+	}
+	if txnId := ms.transactionService.TxnID(txn); !bytes.Equal(txn.ID, txnId) {
+		return reps.Transaction{}, fmt.Errorf("transaction id %x does not match its contents, expected %x", txn.ID, txnId)
+	}
+
+	txn.BlockID = ""
+	txn.Inputs = append([]reps.TxnInput{}, txn.Inputs...)
+	txn.Outputs = append([]reps.TxnOutput{}, txn.Outputs...)
+	for i := range txn.Inputs {
+		if txn.Inputs[i].InputID == "" {
+			return reps.Transaction{}, fmt.Errorf("input %d has no inputId", i)
+		}
+		if !bytes.Equal(txn.Inputs[i].CurrTxnID, txn.ID) {
+			return reps.Transaction{}, fmt.Errorf("input %d has currTxnId %x instead of the transaction id", i, txn.Inputs[i].CurrTxnID)
+		}
+		txn.Inputs[i].BlockID = ""
+	}
+	for i := range txn.Outputs {
+		if txn.Outputs[i].OutputID == "" {
+			return reps.Transaction{}, fmt.Errorf("output %d has no outputId", i)
+		}
+		if !bytes.Equal(txn.Outputs[i].CurrTxnID, txn.ID) {
+			return reps.Transaction{}, fmt.Errorf("output %d has currTxnId %x instead of the transaction id", i, txn.Outputs[i].CurrTxnID)
+		}
+		txn.Outputs[i].BlockID = ""
+	}
+
+	if err := ms.AddToPool(txn); err != nil {
+		return reps.Transaction{}, err
+	}
+
+	return txn, nil
+}
+
+// Validate a transaction and add it to the pool of pending transactions
+func (ms *mempoolService) AddToPool(txn reps.Transaction) error {
+	txnId := hex.EncodeToString(txn.ID)
+	log.Info("Adding transaction to mempool: ", txnId)
+
+	if ms.transactionService.IsCoinbaseTransaction(txn) {
+		return fmt.Errorf("coinbase transaction %s cannot be added to the mempool", txnId)
+	}
+
+	verified, err := ms.transactionService.VerifyTransaction(txn)
+	if !verified {
+		return fmt.Errorf("transaction %s is invalid: %v", txnId, err)
+	}
+
+	if err := checkDistinctInputs(txn); err != nil {
+		return err
+	}
+
+	for _, input := range txn.Inputs {
+		if !ms.transactionService.IsSpendable(input) {
+			return fmt.Errorf("transaction %s spends output %d of %x which is already spent", txnId, input.OutIdx, input.PrevTxnID)
+		}
+	}
+
+	fee, err := ms.transactionService.CalculateFee(txn)
+	if err != nil {
+		return err
+	}
+	if fee != txn.Fee {
+		return fmt.Errorf("transaction %s says it pays a fee of %d but pays %d", txnId, txn.Fee, fee)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.pending[txnId]; ok {
+		return fmt.Errorf("transaction %s is already pending", txnId)
+	}
+
+	// Reject transactions spending an output that another pending transaction already spends
+	for _, input := range txn.Inputs {
+		if spender, ok := ms.index.SpentBy(input.PrevTxnID, input.OutIdx); ok {
+			return fmt.Errorf("transaction %s conflicts with pending transaction %s, mine pending transactions first", txnId, spender)
+		}
+	}
+
+	ms.index.add(txn)
+	ms.pending[txnId] = txn
+	ms.order = append(ms.order, txnId)
+
+	return nil
+}
+
+// Get all pending transactions in the order they arrived
+func (ms *mempoolService) GetPendingTransactions() []reps.Transaction {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	txns := make([]reps.Transaction, 0, len(ms.order))
+	for _, txnId := range ms.order {
+		txns = append(txns, ms.pending[txnId])
+	}
+
+	return txns
+}
+
+// Pick pending transactions for a block of at most maxSize bytes. The highest fee rates go first, and transactions
+// paying the same rate go in the order they arrived. A transaction too big for the space left is skipped so smaller ones can still fit
+func (ms *mempoolService) SelectTransactions(maxSize int) []reps.Transaction {
+	pending := ms.GetPendingTransactions()
+	sort.SliceStable(pending, func(i, j int) bool {
+		return feeRate(pending[i]) > feeRate(pending[j])
+	})
+
+	selected := make([]reps.Transaction, 0, len(pending))
+	size := 0
+	for _, txn := range pending {
+		if size+txnSize(txn) > maxSize {
+			continue
+		}
+		selected = append(selected, txn)
+		size += txnSize(txn)
+	}
+
+	return selected
+}
+
+// Drop transactions from the pool, e.g. once they have landed in a block
+func (ms *mempoolService) RemoveTransactions(txns []reps.Transaction) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for _, txn := range txns {
+		txnId := hex.EncodeToString(txn.ID)
+		pendingTxn, ok := ms.pending[txnId]
+		if !ok {
+			continue
+		}
+
+		ms.index.remove(pendingTxn)
+		delete(ms.pending, txnId)
+	}
+
+	order := make([]string, 0, len(ms.pending))
+	for _, txnId := range ms.order {
+		if _, ok := ms.pending[txnId]; ok {
+			order = append(order, txnId)
+		}
+	}
+	ms.order = order
+}
+
+// Drop pending transactions that spend outputs no longer in the utxo set, e.g. after a reorg
+func (ms *mempoolService) Revalidate() {
+	invalidTxns := make([]reps.Transaction, 0)
+	for _, txn := range ms.GetPendingTransactions() {
+		for _, input := range txn.Inputs {
+			if !ms.transactionService.IsSpendable(input) {
+				log.WithField("txnId", hex.EncodeToString(txn.ID)).Warn("Dropping transaction spending an output that is no longer unspent")
+				invalidTxns = append(invalidTxns, txn)
+				break
+			}
+		}
+	}
+
+	ms.RemoveTransactions(invalidTxns)
+}
+
+// Key identifying a single transaction output
+func outpointKey(txnId []byte, outIdx int) string {
+	return fmt.Sprintf("%x:%d", txnId, outIdx)
+}
+
+// An output can only be spent once, so no two inputs of a transaction can spend the same one
+func checkDistinctInputs(txn reps.Transaction) error {
+	spent := make(map[string]bool, len(txn.Inputs))
+	for _, input := range txn.Inputs {
+		key := outpointKey(input.PrevTxnID, input.OutIdx)
+		if spent[key] {
+			return fmt.Errorf("transaction %x spends output %d of %x more than once", txn.ID, input.OutIdx, input.PrevTxnID)
+		}
+		spent[key] = true
+	}
+
+	return nil
+}
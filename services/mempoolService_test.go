@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMempoolMinesPendingTransactions(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice, bob := n.newWallet(t), n.newWallet(t)
+
+	txn, err := n.mempoolService.AddTransaction(miner, payTo(alice, 10), reps.TransferOptions{})
+	require.NoError(t, err)
+	_, err = n.mempoolService.AddTransaction(miner, payTo(bob, 5), reps.TransferOptions{})
+	assert.Error(t, err, "spends the same output as the pending transaction")
+
+	pending := n.mempoolService.GetPendingTransactions()
+	require.Len(t, pending, 1)
+	assert.Equal(t, txn.ID, pending[0].ID)
+	assert.Equal(t, 0, n.balance(t, alice), "nothing moves until the transaction is mined")
+
+	block := n.mine(t, bob)
+	assert.Len(t, block.Transactions, 2)
+	assert.Empty(t, n.mempoolService.GetPendingTransactions())
+	assert.Equal(t, 10, n.balance(t, alice))
+	assert.Equal(t, InitialSubsidy, n.balance(t, bob))
+
+	// Mining with nothing pending still makes a block with just the coinbase
+	block = n.mine(t, bob)
+	assert.Len(t, block.Transactions, 1)
+}
+
+func TestMineBlockDropsInvalidPendingTransactions(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice := n.newWallet(t)
+
+	wrongFee, err := n.transactionService.CreateTransaction(miner, payTo(alice, 1), reps.TransferOptions{Fee: 2})
+	require.NoError(t, err)
+	wrongFee.Fee = 3
+
+	badTxn := duplicateInputTxn(t, n, miner, alice)
+	forcePending(n, badTxn)
+
+	bc := n.blockchainService.(*blockchainService)
+	assert.ErrorContains(t, bc.verifyPendingTransaction(badTxn), "more than once")
+	assert.ErrorContains(t, bc.verifyPendingTransaction(wrongFee), "says it pays a fee of 3 but pays 2")
+
+	// The bad transaction is dropped rather than mined, so mining goes on
+	block := n.mine(t, miner)
+	assert.Len(t, block.Transactions, 1)
+	assert.Empty(t, n.mempoolService.GetPendingTransactions())
+}
+
+func TestRejectedBlockDropsTransactionFromMempool(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice := n.newWallet(t)
+
+	badTxn := duplicateInputTxn(t, n, miner, alice)
+	forcePending(n, badTxn)
+
+	tip, err := n.blockchainService.GetLastBlock()
+	require.NoError(t, err)
+	coinbase := n.transactionService.CreateCoinbaseTxn(miner, "", tip.Height+1, 0)
+	_, err = n.blockService.CreateBlockOnTip(context.Background(), []reps.Transaction{coinbase, badTxn}, tip)
+	assert.ErrorContains(t, err, "missing or already spent")
+
+	assert.Empty(t, n.mempoolService.GetPendingTransactions(), "the transaction that broke the block would be mined again")
+	tips, err := n.blockchainService.GetChainTips()
+	require.NoError(t, err)
+	assert.Len(t, tips, 2, "active tip and the invalid block")
+
+	block := n.mine(t, miner)
+	assert.Equal(t, tip.Height+1, block.Height)
+}
+
+// A signed transaction from a wallet whose first two inputs spend the same output, with the change claiming it twice
+func duplicateInputTxn(t *testing.T, n *testNode, from string, to string) reps.Transaction {
+	t.Helper()
+
+	ts := n.transactionService.(*transactionService)
+	txn, err := ts.CreateUnsignedTransaction(from, payTo(to, 1), reps.TransferOptions{})
+	require.NoError(t, err)
+
+	prevOutput, err := ts.GetPrevOutput(txn.Inputs[0])
+	require.NoError(t, err)
+	duplicate := txn.Inputs[0]
+	duplicate.InputID = uuid.Must(uuid.NewRandom()).String()
+	txn.Inputs = append(txn.Inputs, duplicate)
+	txn.Outputs[len(txn.Outputs)-1].Value += prevOutput.Value
+
+	txn.ID = ts.TxnID(txn)
+	for i := range txn.Inputs {
+		txn.Inputs[i].CurrTxnID = txn.ID
+	}
+	for i := range txn.Outputs {
+		txn.Outputs[i].CurrTxnID = txn.ID
+	}
+
+	wallet, err := n.walletService.GetWallet(from)
+	require.NoError(t, err)
+	pubKey, err := hex.DecodeString(wallet.PublicKey)
+	require.NoError(t, err)
+	signed, err := ts.SignTransaction(txn, from, pubKey)
+	require.NoError(t, err)
+
+	return signed
+}
+
+// Put a transaction in the pool without the checks AddToPool makes, as if an earlier version had let it in
+func forcePending(n *testNode, txn reps.Transaction) {
+	ms := n.mempoolService.(*mempoolService)
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	txnId := hex.EncodeToString(txn.ID)
+	ms.index.add(txn)
+	ms.pending[txnId] = txn
+	ms.order = append(ms.order, txnId)
+}
+
+func TestBlockIsFilledByFeeRate(t *testing.T) {
+	defer func(size int) { MaxBlockSize = size }(MaxBlockSize)
+
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice, bob, carol := n.newWallet(t), n.newWallet(t), n.newWallet(t)
+	_, err := n.blockchainService.AddToBlockChain(context.Background(), miner,
+		[]reps.Payment{{To: alice, Amount: 10}, {To: bob, Amount: 10}, {To: carol, Amount: 10}}, reps.TransferOptions{})
+	require.NoError(t, err)
+
+	low, err := n.mempoolService.AddTransaction(alice, payTo(miner, 5), reps.TransferOptions{Fee: 1})
+	require.NoError(t, err)
+	high, err := n.mempoolService.AddTransaction(bob, payTo(miner, 5), reps.TransferOptions{Fee: 3})
+	require.NoError(t, err)
+	middle, err := n.mempoolService.AddTransaction(carol, payTo(miner, 5), reps.TransferOptions{Fee: 2})
+	require.NoError(t, err)
+
+	selected := n.mempoolService.SelectTransactions(txnSize(high) + txnSize(middle))
+	require.Len(t, selected, 2)
+	assert.Equal(t, high.ID, selected[0].ID)
+	assert.Equal(t, middle.ID, selected[1].ID)
+
+	// Room for the coinbase and two of the transactions
+	coinbase := n.transactionService.CreateCoinbaseTxn(miner, "", 2, low.Fee+high.Fee+middle.Fee)
+	MaxBlockSize = txnSize(coinbase) + txnSize(high) + txnSize(middle)
+	block := n.mine(t, miner)
+	require.Len(t, block.Transactions, 3)
+	assert.Equal(t, InitialSubsidy+5, block.Transactions[0].Outputs[0].Value)
+	pending := n.mempoolService.GetPendingTransactions()
+	require.Len(t, pending, 1, "the lowest fee rate waits for the next block")
+	assert.Equal(t, low.ID, pending[0].ID)
+}
+
+func TestAddRawTransaction(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	alice := n.newWallet(t)
+
+	txn, err := n.transactionService.CreateTransaction(sender, payTo(alice, 10), reps.TransferOptions{})
+	require.NoError(t, err)
+	// Made before txn is pending, so both spend the same coinbase
+	doubleSpend, err := n.transactionService.CreateTransaction(sender, payTo(alice, 20), reps.TransferOptions{})
+	require.NoError(t, err)
+
+	tampered := txn
+	tampered.Outputs = append([]reps.TxnOutput{}, txn.Outputs...)
+	tampered.Outputs[0].Value++
+	_, err = n.mempoolService.AddRawTransaction(tampered)
+	assert.ErrorContains(t, err, "does not match its contents")
+
+	_, err = n.mempoolService.AddRawTransaction(txn)
+	require.NoError(t, err)
+	_, err = n.mempoolService.AddRawTransaction(txn)
+	assert.ErrorContains(t, err, "already pending")
+
+	_, err = n.mempoolService.AddRawTransaction(doubleSpend)
+	assert.ErrorContains(t, err, "conflicts with pending transaction")
+
+	n.mine(t, sender)
+	assert.Equal(t, 10, n.balance(t, alice))
+	_, err = n.mempoolService.AddRawTransaction(doubleSpend)
+	assert.ErrorContains(t, err, "already spent")
+}
+
+func TestRawTransactionSpendingAnOutputTwiceIsRejected(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	alice := n.newWallet(t)
+
+	_, err := n.mempoolService.AddRawTransaction(duplicateInputTxn(t, n, sender, alice))
+	assert.ErrorContains(t, err, "more than once")
+	assert.Empty(t, n.mempoolService.GetPendingTransactions())
+	assert.Equal(t, InitialSubsidy, n.balance(t, sender))
+}
+
+func TestSweepWalletToNewWallet(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	leaked := n.newWallet(t)
+	for i := 1; i <= 3; i++ {
+		n.send(t, miner, leaked, i*2)
+	}
+
+	to, txn, err := n.mempoolService.SweepWallet(leaked, "", testPassphrase, reps.TransferOptions{FeeRate: 0.005})
+	require.NoError(t, err)
+	assert.Len(t, txn.Inputs, 3)
+	require.Len(t, txn.Outputs, 1)
+	assert.Positive(t, txn.Fee)
+	assert.Equal(t, 12-txn.Fee, txn.Outputs[0].Value)
+
+	newWallet, err := n.walletService.GetWallet(to)
+	require.NoError(t, err)
+	assert.False(t, newWallet.Retired)
+	assert.True(t, newWallet.KeyEncrypted)
+	retired, err := n.walletService.GetWallet(leaked)
+	require.NoError(t, err)
+	assert.True(t, retired.Retired)
+	assert.Equal(t, to, retired.SweptTo)
+
+	n.mine(t, miner)
+	assert.Equal(t, 12-txn.Fee, n.balance(t, to))
+	assert.Equal(t, 0, n.balance(t, leaked))
+}
+
+func TestRetiredWalletCannotSend(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	leaked, safe := n.newWallet(t), n.newWallet(t)
+	n.send(t, miner, leaked, 10)
+
+	_, _, err := n.mempoolService.SweepWallet(leaked, safe, "", reps.TransferOptions{})
+	require.NoError(t, err)
+	n.mine(t, miner)
+	assert.Equal(t, 10, n.balance(t, safe))
+
+	_, err = n.transactionService.CreateTransaction(leaked, payTo(miner, 1), reps.TransferOptions{})
+	assert.ErrorIs(t, err, ErrWalletRetired)
+	_, err = n.transactionService.CreateUnsignedTransaction(leaked, payTo(miner, 1), reps.TransferOptions{})
+	assert.ErrorIs(t, err, ErrWalletRetired)
+	_, _, err = n.mempoolService.SweepWallet(miner, leaked, "", reps.TransferOptions{})
+	assert.ErrorIs(t, err, ErrWalletRetired)
+
+	// It can still be paid, and whatever arrives later swept again
+	validation, err := n.walletService.ValidateAddress(leaked)
+	require.NoError(t, err)
+	assert.True(t, validation.Valid)
+	assert.Contains(t, validation.Warning, "retired wallet")
+	assert.Contains(t, validation.Warning, safe)
+	n.send(t, miner, leaked, 5)
+	_, _, err = n.mempoolService.SweepWallet(leaked, safe, "", reps.TransferOptions{Fee: 1})
+	require.NoError(t, err)
+	n.mine(t, miner)
+	assert.Equal(t, 10+4, n.balance(t, safe))
+
+	_, _, err = n.mempoolService.SweepWallet(leaked, safe, "", reps.TransferOptions{})
+	assert.ErrorContains(t, err, "has no unspent outputs to sweep")
+
+	report, err := n.validationService.ValidateBlockchain()
+	require.NoError(t, err)
+	assert.True(t, report.Valid)
+}
+
+func TestSweepWalletChecksInput(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	leaked := n.newWallet(t)
+	n.send(t, miner, leaked, 12)
+
+	_, _, err := n.mempoolService.SweepWallet(leaked, leaked, "", reps.TransferOptions{})
+	assert.EqualError(t, err, "cannot sweep "+leaked+" to itself")
+	_, _, err = n.mempoolService.SweepWallet(leaked, miner, "", reps.TransferOptions{Fee: 12})
+	assert.EqualError(t, err, "balance of "+leaked+" is 12, not enough to pay a fee of 12")
+	_, _, err = n.mempoolService.SweepWallet(leaked, miner, "", reps.TransferOptions{CoinSelection: "smallest-first"})
+	assert.Error(t, err)
+	_, _, err = n.mempoolService.SweepWallet(leaked, "", "", reps.TransferOptions{})
+	assert.Error(t, err)
+
+	// A sweep that can't be signed doesn't leave a new wallet behind
+	wallets, err := n.walletService.GetWallets()
+	require.NoError(t, err)
+	require.NoError(t, n.walletService.LockWallet(leaked))
+	_, _, err = n.mempoolService.SweepWallet(leaked, "", testPassphrase, reps.TransferOptions{})
+	assert.ErrorIs(t, err, ErrWalletLocked)
+	after, err := n.walletService.GetWallets()
+	require.NoError(t, err)
+	assert.Len(t, after, len(wallets))
+
+	retired, err := n.walletService.GetWallet(leaked)
+	require.NoError(t, err)
+	assert.False(t, retired.Retired)
+}
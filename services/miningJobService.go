@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/google/uuid"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// Number of jobs that can wait in the queue before new ones are turned away
+	MaxQueuedMiningJobs = 100
+	// How long finished jobs are kept around so their result can still be looked up
+	MiningJobRetention = time.Hour
+
+	ErrMiningJobNotFound = errors.New("mining job not found")
+	ErrMiningJobFinished = errors.New("mining job already finished")
+	ErrMiningQueueFull   = errors.New("mining queue is full, try again later")
+)
+
+type MiningJobService interface {
+	SubmitMiningJob(miner string, parentHash string) (reps.MiningJob, error)
+	SubmitTransferJob(from string, payments []reps.Payment, options reps.TransferOptions) (reps.MiningJob, error)
+	GetMiningJob(jobId string) (reps.MiningJob, error)
+	CancelMiningJob(jobId string) (reps.MiningJob, error)
+}
+
+// A job along with what's needed to run and cancel it
+// hashes -> Updated by the miner while the job is mining, so read it atomically
+type miningJob struct {
+	job     reps.MiningJob
+	hashes  int64
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started time.Time
+}
+
+// Jobs run one at a time in the order they were submitted, each one building on the block the previous one mined
+type miningJobService struct {
+	mu    sync.Mutex
+	jobs  map[string]*miningJob
+	queue chan *miningJob
+
+	blockchainService BlockchainService
+	mempoolService    MempoolService
+	walletService     WalletService
+}
+
+func NewMiningJobService(blockchainService BlockchainService, mempoolService MempoolService,
+	walletService WalletService,
+) MiningJobService {
+	js := &miningJobService{
+		jobs:              make(map[string]*miningJob),
+		queue:             make(chan *miningJob, MaxQueuedMiningJobs),
+		blockchainService: blockchainService,
+		mempoolService:    mempoolService,
+		walletService:     walletService,
+	}
+
+	go js.run()
+
+	return js
+}
+
+// Queue a block with all pending transactions, or only a coinbase on top of parentHash if given. Returns straight away
+func (js *miningJobService) SubmitMiningJob(miner string, parentHash string) (reps.MiningJob, error) {
+	validation, err := js.walletService.ValidateAddress(miner)
+	if err != nil {
+		return reps.MiningJob{}, err
+	}
+	if !validation.Valid {
+		return reps.MiningJob{}, fmt.Errorf("error: address of %s is not valid", miner)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mj := &miningJob{
+		job: reps.MiningJob{
+			ID:        uuid.Must(uuid.NewRandom()).String(),
+			Status:    reps.MiningJobQueued,
+			Miner:     miner,
+			Parent:    parentHash,
+			CreatedAt: time.Now().UnixMilli(),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	js.pruneFinished()
+
+	select {
+	case js.queue <- mj:
+	default:
+		cancel()
+		return reps.MiningJob{}, ErrMiningQueueFull
+	}
+	js.jobs[mj.job.ID] = mj
+
+	log.Info("Queued mining job: ", mj.job.ID)
+	return mj.job, nil
+}
+
+// Submit a transfer to the mempool, then queue a block to mine it. The sender gets the coinbase reward
+func (js *miningJobService) SubmitTransferJob(from string, payments []reps.Payment, options reps.TransferOptions) (reps.MiningJob, error) {
+	if _, err := js.blockchainService.GetLastBlock(); err != nil {
+		return reps.MiningJob{}, fmt.Errorf("%s, cannot create a block without genesis", err.Error())
+	}
+
+	txn, err := js.mempoolService.AddTransaction(from, payments, options)
+	if err != nil {
+		return reps.MiningJob{}, err
+	}
+
+	job, err := js.SubmitMiningJob(from, "")
+	if err != nil {
+		// No job will mine the transfer, take it out of the pool so it can be sent again
+		js.mempoolService.RemoveTransactions([]reps.Transaction{txn})
+		return reps.MiningJob{}, err
+	}
+
+	return job, nil
+}
+
+// Get a job with its latest progress
+func (js *miningJobService) GetMiningJob(jobId string) (reps.MiningJob, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	mj, ok := js.jobs[jobId]
+	if !ok {
+		return reps.MiningJob{}, fmt.Errorf("%w, id: %s", ErrMiningJobNotFound, jobId)
+	}
+
+	return mj.snapshot(), nil
+}
+
+// Stop a job that is queued or mining. Pending transactions stay in the mempool
+func (js *miningJobService) CancelMiningJob(jobId string) (reps.MiningJob, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	mj, ok := js.jobs[jobId]
+	if !ok {
+		return reps.MiningJob{}, fmt.Errorf("%w, id: %s", ErrMiningJobNotFound, jobId)
+	}
+	if mj.finished() {
+		return mj.snapshot(), fmt.Errorf("%w, id: %s", ErrMiningJobFinished, jobId)
+	}
+
+	log.Info("Cancelling mining job: ", jobId)
+	mj.cancel()
+
+	// A queued job never reaches the miner, so finish it here
+	if mj.job.Status == reps.MiningJobQueued {
+		mj.job.Status = reps.MiningJobFailed
+		mj.job.Error = "job cancelled"
+		mj.job.FinishedAt = time.Now().UnixMilli()
+	}
+
+	return mj.snapshot(), nil
+}
+
+// Mine queued jobs one after another
+func (js *miningJobService) run() {
+	for mj := range js.queue {
+		js.mu.Lock()
+		if mj.ctx.Err() != nil {
+			js.mu.Unlock()
+			continue
+		}
+		mj.job.Status = reps.MiningJobMining
+		mj.started = time.Now()
+		mj.job.StartedAt = mj.started.UnixMilli()
+		js.mu.Unlock()
+
+		log.Info("Mining job: ", mj.job.ID)
+		block, err := js.blockchainService.MineBlock(withHashCounter(mj.ctx, &mj.hashes), mj.job.Miner, mj.job.Parent)
+
+		js.mu.Lock()
+		mj.job.NouncesTried = atomic.LoadInt64(&mj.hashes)
+		mj.job.ElapsedMs = time.Since(mj.started).Milliseconds()
+		mj.job.FinishedAt = time.Now().UnixMilli()
+		if err != nil {
+			log.WithFields(log.Fields{"jobId": mj.job.ID, "error": err.Error()}).Error("Mining job failed")
+			mj.job.Status = reps.MiningJobFailed
+			mj.job.Error = err.Error()
+			if errors.Is(err, context.Canceled) {
+				mj.job.Error = "job cancelled"
+			}
+			if errors.Is(err, repository.ErrChainTipMoved) {
+				mj.job.Status = reps.MiningJobTipMoved
+			}
+		} else {
+			mj.job.Status = reps.MiningJobMined
+			mj.job.BlockID = block.ID
+		}
+		js.mu.Unlock()
+
+		mj.cancel()
+	}
+}
+
+// Drop jobs that finished longer than MiningJobRetention ago. Must hold js.mu
+func (js *miningJobService) pruneFinished() {
+	cutoff := time.Now().Add(-MiningJobRetention).UnixMilli()
+	for jobId, mj := range js.jobs {
+		if mj.job.FinishedAt != 0 && mj.job.FinishedAt < cutoff {
+			delete(js.jobs, jobId)
+		}
+	}
+}
+
+// Copy of the job with live progress filled in. Must hold js.mu
+func (mj *miningJob) snapshot() reps.MiningJob {
+	job := mj.job
+	if job.Status == reps.MiningJobMining {
+		job.NouncesTried = atomic.LoadInt64(&mj.hashes)
+		job.ElapsedMs = time.Since(mj.started).Milliseconds()
+	}
+	return job
+}
+
+// Whether the job has stopped for good. Must hold js.mu
+func (mj *miningJob) finished() bool {
+	switch mj.job.Status {
+	case reps.MiningJobMined, reps.MiningJobFailed, reps.MiningJobTipMoved:
+		return true
+	}
+	return false
+}
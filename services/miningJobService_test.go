@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiningJobMinesBlock(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	js := NewMiningJobService(n.blockchainService, n.mempoolService, n.walletService)
+
+	_, err := js.SubmitMiningJob("not an address", "")
+	assert.Error(t, err)
+
+	job, err := js.SubmitMiningJob(miner, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, reps.MiningJobMined, job.Status)
+
+	job = waitForJob(t, js, job.ID)
+	assert.Equal(t, reps.MiningJobMined, job.Status, job.Error)
+	assert.Positive(t, job.NouncesTried)
+	tip, err := n.blockchainService.GetLastBlock()
+	require.NoError(t, err)
+	assert.Equal(t, tip.ID, job.BlockID)
+
+	_, err = js.CancelMiningJob(job.ID)
+	assert.ErrorIs(t, err, ErrMiningJobFinished)
+	_, err = js.GetMiningJob("missing")
+	assert.ErrorIs(t, err, ErrMiningJobNotFound)
+}
+
+func TestCancelMiningJob(t *testing.T) {
+	defer func(max int) { MaxQueuedMiningJobs = max }(MaxQueuedMiningJobs)
+	MaxQueuedMiningJobs = 1
+
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	chain := newStubChain(n.blockchainService)
+	js := NewMiningJobService(chain, n.mempoolService, n.walletService)
+
+	mining, err := js.SubmitMiningJob(miner, "")
+	require.NoError(t, err)
+	<-chain.started
+	queued, err := js.SubmitMiningJob(miner, "")
+	require.NoError(t, err)
+	_, err = js.SubmitMiningJob(miner, "")
+	assert.ErrorIs(t, err, ErrMiningQueueFull)
+
+	// A queued job finishes straight away
+	job, err := js.CancelMiningJob(queued.ID)
+	require.NoError(t, err)
+	assert.Equal(t, reps.MiningJobFailed, job.Status)
+	assert.Equal(t, "job cancelled", job.Error)
+
+	job, err = js.GetMiningJob(mining.ID)
+	require.NoError(t, err)
+	assert.Equal(t, reps.MiningJobMining, job.Status)
+	_, err = js.CancelMiningJob(mining.ID)
+	require.NoError(t, err)
+	job = waitForJob(t, js, mining.ID)
+	assert.Equal(t, reps.MiningJobFailed, job.Status)
+	assert.Equal(t, "job cancelled", job.Error)
+}
+
+func TestTransferJobWithFullQueue(t *testing.T) {
+	defer func(max int) { MaxQueuedMiningJobs = max }(MaxQueuedMiningJobs)
+	MaxQueuedMiningJobs = 1
+
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice := n.newWallet(t)
+	chain := newStubChain(n.blockchainService)
+	js := NewMiningJobService(chain, n.mempoolService, n.walletService)
+
+	mining, err := js.SubmitMiningJob(miner, "")
+	require.NoError(t, err)
+	<-chain.started
+	_, err = js.SubmitMiningJob(miner, "")
+	require.NoError(t, err)
+
+	_, err = js.SubmitTransferJob(miner, payTo(alice, 10), reps.TransferOptions{})
+	assert.ErrorIs(t, err, ErrMiningQueueFull)
+	assert.Empty(t, n.mempoolService.GetPendingTransactions())
+
+	// Once there is room the same transfer goes through
+	_, err = js.CancelMiningJob(mining.ID)
+	require.NoError(t, err)
+	waitForJob(t, js, mining.ID)
+	require.Eventually(t, func() bool {
+		_, err = js.SubmitTransferJob(miner, payTo(alice, 10), reps.TransferOptions{})
+		return !errors.Is(err, ErrMiningQueueFull)
+	}, 10*time.Second, 5*time.Millisecond)
+	require.NoError(t, err)
+	assert.Len(t, n.mempoolService.GetPendingTransactions(), 1)
+}
+
+func TestMiningJobLosingTheTip(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	chain := newStubChain(n.blockchainService)
+	chain.mineBlock = func() (reps.Block, error) { return reps.Block{}, repository.ErrChainTipMoved }
+	js := NewMiningJobService(chain, n.mempoolService, n.walletService)
+
+	job, err := js.SubmitMiningJob(miner, "")
+	require.NoError(t, err)
+	job = waitForJob(t, js, job.ID)
+	assert.Equal(t, reps.MiningJobTipMoved, job.Status)
+	assert.Equal(t, repository.ErrChainTipMoved.Error(), job.Error)
+
+	_, err = js.CancelMiningJob(job.ID)
+	assert.ErrorIs(t, err, ErrMiningJobFinished)
+}
+
+// A blockchain whose MineBlock runs mineBlock, or until it is cancelled if there is none
+type stubChain struct {
+	BlockchainService
+	started   chan struct{}
+	mineBlock func() (reps.Block, error)
+}
+
+func newStubChain(bc BlockchainService) *stubChain {
+	return &stubChain{BlockchainService: bc, started: make(chan struct{}, 10)}
+}
+
+func (sc *stubChain) MineBlock(ctx context.Context, miner string, parentHash string) (reps.Block, error) {
+	sc.started <- struct{}{}
+	if sc.mineBlock != nil {
+		return sc.mineBlock()
+	}
+	<-ctx.Done()
+	return reps.Block{}, ctx.Err()
+}
+
+// Poll a job until it has finished
+func waitForJob(t *testing.T, js MiningJobService, jobId string) reps.MiningJob {
+	t.Helper()
+
+	var job reps.MiningJob
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = js.GetMiningJob(jobId)
+		require.NoError(t, err)
+		return job.Status != reps.MiningJobQueued && job.Status != reps.MiningJobMining
+	}, 10*time.Second, 5*time.Millisecond)
+
+	return job
+}
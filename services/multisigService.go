@@ -0,0 +1,312 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/script"
+	"github.com/brucetieu/blockchain/signer"
+	"github.com/google/uuid"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrMultisigSpendNotFound = errors.New("multisig spend not found")
+	ErrMultisigSpendComplete = errors.New("multisig spend already complete")
+)
+
+type MultisigService interface {
+	CreateMultisigWallet(cosigners []string, threshold int) (reps.MultisigWallet, error)
+	GetMultisigWallet(address string) (reps.MultisigWallet, error)
+
+	CreateSpend(from string, payments []reps.Payment, options reps.TransferOptions) (reps.MultisigSpend, error)
+	SignSpend(spendId string, signer string) (reps.MultisigSpend, error)
+	GetSpend(spendId string) (reps.MultisigSpend, error)
+}
+
+// An unsigned transaction from a multisig wallet and the signatures collected for it so far
+// signatures -> For each input, the signature of each public key in the redeem script, nil until that key signs
+type multisigSpend struct {
+	id           string
+	from         string
+	redeemScript []byte
+	threshold    int
+	pubKeys      [][]byte
+	txn          reps.Transaction
+	signatures   [][][]byte
+	signers      []string
+	complete     bool
+}
+
+// Spends waiting for signatures are only kept in memory. Once enough cosigners sign, the transaction goes to the
+// mempool like any other
+type multisigService struct {
+	mu     sync.Mutex
+	spends map[string]*multisigSpend
+
+	walletService      WalletService
+	transactionService TransactionService
+	mempoolService     MempoolService
+	signer             signer.Signer
+	txnAssembler       TxnAssemblerFac
+}
+
+func NewMultisigService(walletService WalletService, transactionService TransactionService,
+	mempoolService MempoolService, signer signer.Signer,
+) MultisigService {
+	return &multisigService{
+		spends:             make(map[string]*multisigSpend),
+		walletService:      walletService,
+		transactionService: transactionService,
+		mempoolService:     mempoolService,
+		signer:             signer,
+		txnAssembler:       TxnAssembler,
+	}
+}
+
+// Create a wallet that needs threshold of the wallets at the cosigners addresses to sign its spends. It has no keys
+// of its own, only the redeem script its address pays to
+func (ms *multisigService) CreateMultisigWallet(cosigners []string, threshold int) (reps.MultisigWallet, error) {
+	pubKeys := make([][]byte, 0, len(cosigners))
+	for _, cosigner := range cosigners {
+		wallet, err := ms.walletService.GetWallet(cosigner)
+		if err != nil {
+			return reps.MultisigWallet{}, err
+		}
+		if len(wallet.RedeemScript) > 0 {
+			return reps.MultisigWallet{}, fmt.Errorf("%s is a multisig wallet and cannot be a cosigner", cosigner)
+		}
+		if wallet.PublicKey == "" {
+			return reps.MultisigWallet{}, fmt.Errorf("wallet %s has no public key", cosigner)
+		}
+
+		pubKey, err := hex.DecodeString(wallet.PublicKey)
+		if err != nil {
+			return reps.MultisigWallet{}, fmt.Errorf("%s, wallet %s has an invalid public key", err.Error(), cosigner)
+		}
+		for _, other := range pubKeys {
+			if bytes.Equal(other, pubKey) {
+				return reps.MultisigWallet{}, fmt.Errorf("%s is listed as a cosigner more than once", cosigner)
+			}
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+
+	redeemScript, err := script.MultiSig(threshold, pubKeys)
+	if err != nil {
+		return reps.MultisigWallet{}, err
+	}
+
+	wallet, err := ms.walletService.CreateScriptWallet(redeemScript)
+	if err != nil {
+		return reps.MultisigWallet{}, err
+	}
+
+	log.Infof("Created %d-of-%d multisig wallet: %s", threshold, len(pubKeys), wallet.Address)
+	return ms.toMultisigWallet(wallet)
+}
+
+func (ms *multisigService) GetMultisigWallet(address string) (reps.MultisigWallet, error) {
+	wallet, err := ms.walletService.GetWallet(address)
+	if err != nil {
+		return reps.MultisigWallet{}, err
+	}
+	if len(wallet.RedeemScript) == 0 {
+		return reps.MultisigWallet{}, fmt.Errorf("%s is not a multisig wallet", address)
+	}
+
+	return ms.toMultisigWallet(wallet)
+}
+
+// Start a spend from a multisig wallet. The transaction is built now, so every cosigner signs the same one
+func (ms *multisigService) CreateSpend(from string, payments []reps.Payment, options reps.TransferOptions) (reps.MultisigSpend, error) {
+	for _, payment := range payments {
+		validation, err := ms.walletService.ValidateAddress(payment.To)
+		if err != nil {
+			return reps.MultisigSpend{}, err
+		}
+		if !validation.Valid {
+			return reps.MultisigSpend{}, fmt.Errorf("error: address of %s is not valid", payment.To)
+		}
+	}
+
+	wallet, err := ms.walletService.GetWallet(from)
+	if err != nil {
+		return reps.MultisigSpend{}, err
+	}
+	if len(wallet.RedeemScript) == 0 {
+		return reps.MultisigSpend{}, fmt.Errorf("%s is not a multisig wallet", from)
+	}
+	threshold, pubKeys, err := script.ParseMultiSig(wallet.RedeemScript)
+	if err != nil {
+		return reps.MultisigSpend{}, err
+	}
+
+	txn, err := ms.transactionService.CreateUnsignedTransaction(from, payments, options)
+	if err != nil {
+		return reps.MultisigSpend{}, err
+	}
+
+	spend := &multisigSpend{
+		id:           uuid.Must(uuid.NewRandom()).String(),
+		from:         from,
+		redeemScript: wallet.RedeemScript,
+		threshold:    threshold,
+		pubKeys:      pubKeys,
+		txn:          txn,
+		signatures:   make([][][]byte, len(txn.Inputs)),
+		signers:      make([]string, 0),
+	}
+	for inIdx := range spend.signatures {
+		spend.signatures[inIdx] = make([][]byte, len(pubKeys))
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.spends[spend.id] = spend
+
+	log.Infof("Created multisig spend %s from %s, waiting for %d signatures", spend.id, from, threshold)
+	return ms.toMultisigSpend(spend), nil
+}
+
+// Sign every input of a spend with the key of signer, one of the cosigners, through the signer holding its key.
+// The signature that reaches the threshold completes the transaction and submits it to the mempool
+func (ms *multisigService) SignSpend(spendId string, signer string) (reps.MultisigSpend, error) {
+	pubKey, err := ms.signer.PublicKey(signer)
+	if err != nil {
+		return reps.MultisigSpend{}, err
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	spend, ok := ms.spends[spendId]
+	if !ok {
+		return reps.MultisigSpend{}, fmt.Errorf("%w: %s", ErrMultisigSpendNotFound, spendId)
+	}
+	if spend.complete {
+		return reps.MultisigSpend{}, fmt.Errorf("%w: %s", ErrMultisigSpendComplete, spendId)
+	}
+
+	keyIdx := -1
+	for i, key := range spend.pubKeys {
+		if bytes.Equal(key, pubKey) {
+			keyIdx = i
+		}
+	}
+	if keyIdx == -1 {
+		return reps.MultisigSpend{}, fmt.Errorf("%s is not a cosigner of %s", signer, spend.from)
+	}
+	if len(spend.txn.Inputs) > 0 && spend.signatures[0][keyIdx] != nil {
+		return reps.MultisigSpend{}, fmt.Errorf("%s has already signed spend %s", signer, spendId)
+	}
+
+	// Sign every input before keeping any signature, so a failure doesn't leave the spend half signed
+	signatures := make([][]byte, len(spend.txn.Inputs))
+	for inIdx := range spend.txn.Inputs {
+		prevOutput, err := ms.transactionService.GetPrevOutput(spend.txn.Inputs[inIdx])
+		if err != nil {
+			return reps.MultisigSpend{}, err
+		}
+		hash := ms.transactionService.SignatureHash(spend.txn, inIdx, prevOutput, spend.redeemScript)
+		signatures[inIdx], err = ms.signer.SignHash(signer, hash)
+		if err != nil {
+			log.Error("error signing transaction: ", err.Error())
+			return reps.MultisigSpend{}, err
+		}
+	}
+
+	for inIdx, signature := range signatures {
+		spend.signatures[inIdx][keyIdx] = signature
+	}
+	spend.signers = append(spend.signers, signer)
+	log.Infof("%s signed multisig spend %s, %d of %d signatures", signer, spendId, len(spend.signers), spend.threshold)
+
+	if len(spend.signers) < spend.threshold {
+		return ms.toMultisigSpend(spend), nil
+	}
+
+	txn := ms.unlock(spend)
+	if err := ms.mempoolService.AddToPool(txn); err != nil {
+		return reps.MultisigSpend{}, err
+	}
+	spend.txn = txn
+	spend.complete = true
+
+	return ms.toMultisigSpend(spend), nil
+}
+
+func (ms *multisigService) GetSpend(spendId string) (reps.MultisigSpend, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	spend, ok := ms.spends[spendId]
+	if !ok {
+		return reps.MultisigSpend{}, fmt.Errorf("%w: %s", ErrMultisigSpendNotFound, spendId)
+	}
+
+	return ms.toMultisigSpend(spend), nil
+}
+
+// Copy of the spend's transaction with each input unlocked by the collected signatures, which OP_CHECKMULTISIG
+// needs in the same order as the public keys
+func (ms *multisigService) unlock(spend *multisigSpend) reps.Transaction {
+	txn := spend.txn
+	txn.Inputs = make([]reps.TxnInput, len(spend.txn.Inputs))
+
+	for inIdx, input := range spend.txn.Inputs {
+		signatures := make([][]byte, 0, spend.threshold)
+		for _, signature := range spend.signatures[inIdx] {
+			if signature != nil && len(signatures) < spend.threshold {
+				signatures = append(signatures, signature)
+			}
+		}
+
+		input.ScriptSig = script.MultiSigScriptSig(signatures, spend.redeemScript)
+		txn.Inputs[inIdx] = input
+	}
+
+	return txn
+}
+
+func (ms *multisigService) toMultisigWallet(wallet reps.Wallet) (reps.MultisigWallet, error) {
+	threshold, pubKeys, err := script.ParseMultiSig(wallet.RedeemScript)
+	if err != nil {
+		return reps.MultisigWallet{}, err
+	}
+	redeemScript, _ := script.Disassemble(wallet.RedeemScript)
+
+	multisigWallet := reps.MultisigWallet{
+		Address:      wallet.Address,
+		Threshold:    threshold,
+		Cosigners:    make([]string, 0, len(pubKeys)),
+		PublicKeys:   make([]string, 0, len(pubKeys)),
+		RedeemScript: redeemScript,
+	}
+	for _, pubKey := range pubKeys {
+		address, err := ms.walletService.CreateAddress(pubKey)
+		if err != nil {
+			return reps.MultisigWallet{}, err
+		}
+		multisigWallet.Cosigners = append(multisigWallet.Cosigners, string(address))
+		multisigWallet.PublicKeys = append(multisigWallet.PublicKeys, hex.EncodeToString(pubKey))
+	}
+
+	return multisigWallet, nil
+}
+
+func (ms *multisigService) toMultisigSpend(spend *multisigSpend) reps.MultisigSpend {
+	return reps.MultisigSpend{
+		ID:          spend.id,
+		From:        spend.from,
+		Threshold:   spend.threshold,
+		Signers:     append([]string{}, spend.signers...),
+		Complete:    spend.complete,
+		Transaction: ms.txnAssembler.ToReadableTransaction(spend.txn),
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"testing"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultisigSpendNeedsThresholdSignatures(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	ms := NewMultisigService(n.walletService, n.transactionService, n.mempoolService, n.signer)
+	cosigners := []string{n.newWallet(t), n.newWallet(t), n.newWallet(t)}
+	alice := n.newWallet(t)
+
+	multisigWallet, err := ms.CreateMultisigWallet(cosigners, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, multisigWallet.Threshold)
+	assert.Equal(t, cosigners, multisigWallet.Cosigners)
+	n.send(t, miner, multisigWallet.Address, 20)
+
+	_, err = n.transactionService.CreateTransaction(multisigWallet.Address, payTo(alice, 5), reps.TransferOptions{})
+	assert.Error(t, err, "no single key can spend from a multisig wallet")
+
+	spend, err := ms.CreateSpend(multisigWallet.Address, payTo(alice, 5), reps.TransferOptions{Fee: 1})
+	require.NoError(t, err)
+
+	spend, err = ms.SignSpend(spend.ID, cosigners[2])
+	require.NoError(t, err)
+	assert.False(t, spend.Complete)
+	assert.Empty(t, n.mempoolService.GetPendingTransactions())
+	_, err = ms.SignSpend(spend.ID, cosigners[2])
+	assert.ErrorContains(t, err, "already signed")
+	_, err = ms.SignSpend(spend.ID, alice)
+	assert.ErrorContains(t, err, "is not a cosigner")
+
+	// Signed out of key order, the signatures are still put in the order OP_CHECKMULTISIG needs
+	spend, err = ms.SignSpend(spend.ID, cosigners[0])
+	require.NoError(t, err)
+	assert.True(t, spend.Complete)
+	assert.Equal(t, []string{cosigners[2], cosigners[0]}, spend.Signers)
+	assert.Len(t, n.mempoolService.GetPendingTransactions(), 1)
+	_, err = ms.SignSpend(spend.ID, cosigners[1])
+	assert.ErrorIs(t, err, ErrMultisigSpendComplete)
+	_, err = ms.GetSpend("missing")
+	assert.ErrorIs(t, err, ErrMultisigSpendNotFound)
+
+	n.mine(t, miner)
+	assert.Equal(t, 5, n.balance(t, alice))
+	assert.Equal(t, 14, n.balance(t, multisigWallet.Address))
+	report, err := n.validationService.ValidateBlockchain()
+	require.NoError(t, err)
+	assert.True(t, report.Valid, report.Reason)
+}
+
+func TestCreateMultisigWalletChecksCosigners(t *testing.T) {
+	n := newTestNode(t)
+	ms := NewMultisigService(n.walletService, n.transactionService, n.mempoolService, n.signer)
+	alice, bob := n.newWallet(t), n.newWallet(t)
+
+	_, err := ms.CreateMultisigWallet([]string{alice, alice}, 1)
+	assert.ErrorContains(t, err, "more than once")
+	_, err = ms.CreateMultisigWallet([]string{alice, bob}, 3)
+	assert.ErrorContains(t, err, "threshold")
+
+	multisigWallet, err := ms.CreateMultisigWallet([]string{alice, bob}, 2)
+	require.NoError(t, err)
+	_, err = ms.CreateMultisigWallet([]string{alice, multisigWallet.Address}, 1)
+	assert.ErrorContains(t, err, "cannot be a cosigner")
+
+	stored, err := ms.GetMultisigWallet(multisigWallet.Address)
+	require.NoError(t, err)
+	assert.Equal(t, multisigWallet, stored)
+	_, err = ms.GetMultisigWallet(alice)
+	assert.ErrorContains(t, err, "not a multisig wallet")
+}
@@ -2,21 +2,42 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"math"
 	"math/big"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/brucetieu/blockchain/representations"
 	"github.com/brucetieu/blockchain/utils"
+	log "github.com/sirupsen/logrus"
 )
 
 var (
+	// Difficulty of the genesis block, as the number of leading zero bits its target has
 	TargetBits = 12
+	// Easiest difficulty retargeting can go down to
+	MinTargetBits = 8
+	// Number of goroutines searching for a nounce. Set with the MINER_WORKERS env var
+	MinerWorkers = runtime.NumCPU()
+	// Highest nounce tried before the timestamp is rolled forward
+	MaxNounce int64 = math.MaxUint32
+
+	miningStats = struct {
+		sync.Mutex
+		stats representations.MiningStats
+	}{}
 )
 
 type PowService interface {
-	Solve() (int64, []byte)
+	Solve(ctx context.Context) (int64, []byte, error)
 	HashData() []byte
 	ValidateProof() bool
+	Work() *big.Int
 }
 
 type powService struct {
@@ -27,49 +48,156 @@ type powService struct {
 }
 
 func NewProofOfWorkService(block *representations.Block) PowService {
-	target := big.NewInt(1)
-
-	// means the first TargetBits number of bits will be 0. e.g. 0000000000001...
-	target.Lsh(target, uint(256-TargetBits))
-
 	return &powService{
-		Target:         target,
+		Target:         blockTarget(*block),
 		Block:          block,
 		blockAssembler: BlockAssembler,
 		txnAssembler:   TxnAssembler,
 	}
 }
 
-func (pow *powService) Solve() (int64, []byte) {
-	nounce := 0
-	var solvedHash []byte
-	solvedHashInt := new(big.Int)
+// Search for a nounce that makes the block hash fall below the target, using MinerWorkers goroutines.
+// Each worker takes every MinerWorkers-th nounce. If every nounce up to MaxNounce fails, the timestamp is rolled
+// forward so the search can start over. Stops early with the context's error if ctx is cancelled
+func (pow *powService) Solve(ctx context.Context) (int64, []byte, error) {
+	workers := MinerWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	start := time.Now()
+	hashes := int64(0)
+	timestampRolls := 0
 
 	for {
-		pow.Block.Nounce = int64(nounce)
-		solvedHash = pow.HashData()
-		solvedHashInt.SetBytes(solvedHash)
-
-		// Check if HASH(data + nounce) < target number
-		if solvedHashInt.Cmp(pow.Target) == -1 {
-			break
-		} else {
-			nounce++
+		nounce, hash, searched := pow.search(ctx, workers)
+		hashes += searched
+
+		if hash != nil {
+			pow.Block.Nounce = nounce
+			stats := recordMiningStats(workers, hashes, time.Since(start), timestampRolls)
+			log.Infof("Solved block %s with %d hashes in %dms, %.0f hashes/sec across %d workers",
+				pow.Block.ID, stats.Hashes, stats.DurationMs, stats.HashesPerSecond, stats.Workers)
+
+			// miner is basically trying to solve for nounce.
+			return nounce, hash, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			log.Infof("Stopped mining block %s after %d hashes: %s", pow.Block.ID, hashes, err.Error())
+			return 0, nil, err
+		}
+
+		// Every nounce failed, so change the block data and go again
+		timestampRolls++
+		pow.Block.Timestamp++
+		if now := time.Now().UnixMilli(); now > pow.Block.Timestamp {
+			pow.Block.Timestamp = now
 		}
 	}
+}
+
+// Try every nounce from 0 to MaxNounce in parallel. Returns the first nounce found to meet the target, or a nil hash
+// if there is none or ctx is cancelled, along with how many hashes were tried
+func (pow *powService) search(ctx context.Context, workers int) (int64, []byte, int64) {
+	searchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	prefix, suffix := pow.headerParts()
+	progress := hashCounter(ctx)
+	solutions := make(chan powSolution, workers)
+	hashes := int64(0)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(first int64) {
+			defer wg.Done()
+
+			data := append([]byte{}, prefix...)
+			hashInt := new(big.Int)
+			tried := int64(0)
+			reported := int64(0)
+			defer func() {
+				atomic.AddInt64(&hashes, tried)
+				if progress != nil {
+					atomic.AddInt64(progress, tried-reported)
+				}
+			}()
+
+			for nounce := first; nounce <= MaxNounce; nounce += int64(workers) {
+				// Checking the context is relatively slow, so only do it every so often
+				if tried%1024 == 0 {
+					if searchCtx.Err() != nil {
+						return
+					}
+					if progress != nil {
+						atomic.AddInt64(progress, tried-reported)
+						reported = tried
+					}
+				}
+
+				data = append(strconv.AppendInt(data[:len(prefix)], nounce, 10), suffix...)
+				hash := sha256.Sum256(data)
+				tried++
+
+				// Check if HASH(data + nounce) < target number
+				if hashInt.SetBytes(hash[:]).Cmp(pow.Target) == -1 {
+					solutions <- powSolution{nounce: nounce, hash: hash[:]}
+					cancel()
+					return
+				}
+			}
+		}(int64(worker))
+	}
+
+	wg.Wait()
+	close(solutions)
+
+	solution, ok := <-solutions
+	if !ok {
+		return 0, nil, hashes
+	}
+
+	return solution.nounce, solution.hash, hashes
+}
+
+type powSolution struct {
+	nounce int64
+	hash   []byte
+}
+
+// Block data hashed before and after the nounce. See HashData
+func (pow *powService) headerParts() ([]byte, []byte) {
+	prefix := bytes.Join([][]byte{
+		pow.txnAssembler.HashTransactions(pow.Block.Transactions),
+		pow.Block.PrevHash,
+		utils.Int64ToByte(pow.Block.Timestamp),
+	}, []byte{})
+
+	suffix := []byte{}
+	if pow.Block.Bits != 0 {
+		suffix = utils.Int64ToByte(int64(pow.Block.Bits))
+	}
 
-	// miner is basically trying to solve for nounce.
-	return int64(nounce), solvedHash
+	return prefix, suffix
 }
 
 // sha256 hash the block data and nounce
 func (pow *powService) HashData() []byte {
-	joined := bytes.Join([][]byte{
+	data := [][]byte{
 		pow.txnAssembler.HashTransactions(pow.Block.Transactions),
 		pow.Block.PrevHash,
 		utils.Int64ToByte(pow.Block.Timestamp),
 		utils.Int64ToByte(pow.Block.Nounce),
-	}, []byte{})
+	}
+
+	// Commit to the difficulty. Blocks mined before it was stored leave it out, so their hashes still check out
+	if pow.Block.Bits != 0 {
+		data = append(data, utils.Int64ToByte(int64(pow.Block.Bits)))
+	}
+
+	joined := bytes.Join(data, []byte{})
 	hash := sha256.Sum256(joined)
 	return hash[:]
 }
@@ -81,3 +209,71 @@ func (pow *powService) ValidateProof() bool {
 
 	return proposedHashInt.Cmp(pow.Target) == -1
 }
+
+// Expected number of hashes needed to solve a block at this target, 2^256 / (target + 1)
+func (pow *powService) Work() *big.Int {
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, new(big.Int).Add(pow.Target, big.NewInt(1)))
+}
+
+// Target of the genesis block. Means the first TargetBits number of bits will be 0. e.g. 0000000000001...
+func initialTarget() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(256-TargetBits))
+}
+
+// Easiest target a block can have
+func powLimit() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(256-MinTargetBits))
+}
+
+// Compact target of a block. Blocks mined before difficulty was stored used the initial target
+func blockBits(block representations.Block) uint32 {
+	if block.Bits == 0 {
+		return utils.BigToCompact(initialTarget())
+	}
+	return block.Bits
+}
+
+// Target the hash of a block has to be below
+func blockTarget(block representations.Block) *big.Int {
+	return utils.CompactToBig(blockBits(block))
+}
+
+// Save the hash rate of a finished Solve and add it to the running totals
+func recordMiningStats(workers int, hashes int64, duration time.Duration, timestampRolls int) representations.MiningStats {
+	miningStats.Lock()
+	defer miningStats.Unlock()
+
+	stats := &miningStats.stats
+	stats.Workers = workers
+	stats.Hashes = hashes
+	stats.DurationMs = duration.Milliseconds()
+	stats.HashesPerSecond = float64(hashes) / math.Max(duration.Seconds(), 1e-9)
+	stats.TimestampRolls = timestampRolls
+	stats.BlocksMined++
+	stats.TotalHashes += hashes
+	stats.TotalDurationMs += stats.DurationMs
+	stats.AverageHashesPerSecond = float64(stats.TotalHashes) / math.Max(float64(stats.TotalDurationMs)/1000, 1e-9)
+
+	return *stats
+}
+
+// Get the hash rate of the last block mined by this process, and the average over every block it has mined
+func GetMiningStats() representations.MiningStats {
+	miningStats.Lock()
+	defer miningStats.Unlock()
+
+	return miningStats.stats
+}
+
+type hashCounterKey struct{}
+
+// Attach a counter to ctx that Solve keeps adding the number of hashes tried to, so progress can be watched while mining
+func withHashCounter(ctx context.Context, counter *int64) context.Context {
+	return context.WithValue(ctx, hashCounterKey{}, counter)
+}
+
+func hashCounter(ctx context.Context) *int64 {
+	counter, _ := ctx.Value(hashCounterKey{}).(*int64)
+	return counter
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSolveAcrossWorkers(t *testing.T) {
+	defer func(workers int) { MinerWorkers = workers }(MinerWorkers)
+	MinerWorkers = 4
+
+	block := powTestBlock(12)
+	before := GetMiningStats()
+	pow := NewProofOfWorkService(&block)
+
+	nounce, hash, err := pow.Solve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, nounce, block.Nounce)
+	assert.Equal(t, hash, pow.HashData())
+	assert.True(t, pow.ValidateProof())
+
+	stats := GetMiningStats()
+	assert.Equal(t, 4, stats.Workers)
+	assert.Equal(t, before.BlocksMined+1, stats.BlocksMined)
+	assert.GreaterOrEqual(t, stats.TotalHashes, before.TotalHashes+stats.Hashes)
+}
+
+func TestSolveRollsTimestampWhenNouncesRunOut(t *testing.T) {
+	defer func(workers int, maxNounce int64) { MinerWorkers, MaxNounce = workers, maxNounce }(MinerWorkers, MaxNounce)
+	MinerWorkers, MaxNounce = 1, 0
+
+	block := powTestBlock(10)
+	timestamp := block.Timestamp
+	pow := NewProofOfWorkService(&block)
+
+	_, _, err := pow.Solve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), block.Nounce, "the only nounce there is")
+	assert.True(t, pow.ValidateProof())
+	stats := GetMiningStats()
+	assert.Equal(t, stats.TimestampRolls > 0, block.Timestamp > timestamp, "the timestamp moves with every roll")
+}
+
+func TestSolveStopsWhenCancelled(t *testing.T) {
+	block := powTestBlock(255)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := NewProofOfWorkService(&block).Solve(ctx)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Solve kept mining after its context was cancelled")
+	}
+}
+
+// A block with only a coinbase, whose target has the given number of leading zero bits
+func powTestBlock(zeroBits uint) reps.Block {
+	return reps.Block{
+		ID:           "pow-test",
+		Timestamp:    time.Now().UnixMilli(),
+		Transactions: []reps.Transaction{{ID: []byte{1}, Outputs: []reps.TxnOutput{{Value: 1}}}},
+		Bits:         utils.BigToCompact(new(big.Int).Lsh(big.NewInt(1), 256-zeroBits)),
+	}
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/script"
+	"github.com/brucetieu/blockchain/signer"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Partially signed transactions go through create -> sign -> combine -> finalize -> broadcast. Only creating and
+// broadcasting look at the chain. Each PSBT carries the outputs its inputs spend, so signing, combining and
+// finalizing work offline
+type PSBTService interface {
+	CreatePSBT(from string, payments []reps.Payment, options reps.TransferOptions) (reps.PSBT, error)
+	SignPSBT(psbt reps.PSBT, privKey ecdsa.PrivateKey, pubKey []byte) (reps.PSBT, error)
+	SignPSBTWithWallet(psbt reps.PSBT, address string) (reps.PSBT, error)
+	CombinePSBTs(psbts []reps.PSBT) (reps.PSBT, error)
+	FinalizePSBT(psbt reps.PSBT) (reps.PSBT, error)
+	ExtractTransaction(psbt reps.PSBT) (reps.Transaction, error)
+	BroadcastPSBT(psbt reps.PSBT) (reps.Transaction, error)
+}
+
+type psbtService struct {
+	transactionService TransactionService
+	walletService      WalletService
+	mempoolService     MempoolService
+	signer             signer.Signer
+}
+
+func NewPSBTService(transactionService TransactionService, walletService WalletService,
+	mempoolService MempoolService, signer signer.Signer,
+) PSBTService {
+	return &psbtService{
+		transactionService: transactionService,
+		walletService:      walletService,
+		mempoolService:     mempoolService,
+		signer:             signer,
+	}
+}
+
+// Create an unsigned transfer along with the outputs its inputs spend, and for a multisig wallet its redeem script
+func (ps *psbtService) CreatePSBT(from string, payments []reps.Payment, options reps.TransferOptions) (reps.PSBT, error) {
+	for _, payment := range payments {
+		validation, err := ps.walletService.ValidateAddress(payment.To)
+		if err != nil {
+			return reps.PSBT{}, err
+		}
+		if !validation.Valid {
+			return reps.PSBT{}, fmt.Errorf("error: address of %s is not valid", payment.To)
+		}
+	}
+
+	wallet, err := ps.walletService.GetWallet(from)
+	if err != nil {
+		return reps.PSBT{}, err
+	}
+
+	txn, err := ps.transactionService.CreateUnsignedTransaction(from, payments, options)
+	if err != nil {
+		return reps.PSBT{}, err
+	}
+
+	psbt := reps.PSBT{Transaction: txn, Inputs: make([]reps.PartiallySignedInput, 0, len(txn.Inputs))}
+	for _, input := range txn.Inputs {
+		prevOutput, err := ps.transactionService.GetPrevOutput(input)
+		if err != nil {
+			return reps.PSBT{}, err
+		}
+		psbt.Inputs = append(psbt.Inputs, reps.PartiallySignedInput{PrevOutput: prevOutput, RedeemScript: wallet.RedeemScript})
+	}
+
+	log.Infof("Created PSBT for transaction %x with %d inputs", txn.ID, len(txn.Inputs))
+	return psbt, nil
+}
+
+// Sign every input that pubKey can unlock, either a P2PKH output paying to its hash or a P2SH multisig it is one of
+// the keys of. Fails if it can't sign any
+func (ps *psbtService) SignPSBT(psbt reps.PSBT, privKey ecdsa.PrivateKey, pubKey []byte) (reps.PSBT, error) {
+	return ps.signPSBT(psbt, pubKey, func(hash []byte) ([]byte, error) {
+		return signer.SignWithKey(privKey, hash)
+	})
+}
+
+// Sign a PSBT through the signer holding the key of a wallet
+func (ps *psbtService) SignPSBTWithWallet(psbt reps.PSBT, address string) (reps.PSBT, error) {
+	pubKey, err := ps.signer.PublicKey(address)
+	if err != nil {
+		return reps.PSBT{}, err
+	}
+
+	return ps.signPSBT(psbt, pubKey, func(hash []byte) ([]byte, error) {
+		return ps.signer.SignHash(address, hash)
+	})
+}
+
+// See SignPSBT. sign makes the signature of each sighash with the key of pubKey
+func (ps *psbtService) signPSBT(psbt reps.PSBT, pubKey []byte, sign func(hash []byte) ([]byte, error)) (reps.PSBT, error) {
+	psbt = copyPSBT(psbt)
+	signed := 0
+
+	for inIdx, input := range psbt.Inputs {
+		if len(input.FinalScriptSig) > 0 {
+			continue
+		}
+
+		subscript := signingScript(input, pubKey)
+		if subscript == nil {
+			continue
+		}
+
+		// The sighash is the hash of a trimmed copy of the transaction, the same one VerifyTransaction checks against
+		hash := ps.transactionService.SignatureHash(psbt.Transaction, inIdx, input.PrevOutput, subscript)
+		signature, err := sign(hash)
+		if err != nil {
+			log.Error("error signing transaction: ", err.Error())
+			return reps.PSBT{}, err
+		}
+
+		psbt.Inputs[inIdx].Signatures[hex.EncodeToString(pubKey)] = signature
+		signed++
+	}
+
+	if signed == 0 {
+		return reps.PSBT{}, fmt.Errorf("public key %x cannot sign any input of transaction %x", pubKey, psbt.Transaction.ID)
+	}
+
+	log.Infof("Signed %d inputs of transaction %x", signed, psbt.Transaction.ID)
+	return psbt, nil
+}
+
+// Merge the signatures of copies of the same PSBT, e.g. each signed by a different cosigner
+func (ps *psbtService) CombinePSBTs(psbts []reps.PSBT) (reps.PSBT, error) {
+	if len(psbts) == 0 {
+		return reps.PSBT{}, fmt.Errorf("nothing to combine")
+	}
+
+	combined := copyPSBT(psbts[0])
+	for _, psbt := range psbts[1:] {
+		if !bytes.Equal(psbt.Transaction.ID, combined.Transaction.ID) || len(psbt.Inputs) != len(combined.Inputs) {
+			return reps.PSBT{}, fmt.Errorf("transaction %x is not the same as transaction %x, cannot combine them", psbt.Transaction.ID, combined.Transaction.ID)
+		}
+
+		for inIdx, input := range psbt.Inputs {
+			for pubKey, signature := range input.Signatures {
+				combined.Inputs[inIdx].Signatures[pubKey] = signature
+			}
+			if len(combined.Inputs[inIdx].FinalScriptSig) == 0 {
+				combined.Inputs[inIdx].FinalScriptSig = input.FinalScriptSig
+			}
+		}
+	}
+
+	return combined, nil
+}
+
+// Turn the signatures of each input into its unlocking script, and check it unlocks the output the input spends.
+// Fails if an input doesn't have enough signatures yet
+func (ps *psbtService) FinalizePSBT(psbt reps.PSBT) (reps.PSBT, error) {
+	psbt = copyPSBT(psbt)
+
+	for inIdx, input := range psbt.Inputs {
+		if len(input.FinalScriptSig) > 0 {
+			continue
+		}
+
+		scriptSig, err := finalScriptSig(input)
+		if err != nil {
+			return reps.PSBT{}, fmt.Errorf("input %d: %s", inIdx, err.Error())
+		}
+
+		txn := copyTransaction(psbt.Transaction)
+		txn.Inputs[inIdx].ScriptSig = scriptSig
+		if err := ps.transactionService.VerifyInput(txn, inIdx, input.PrevOutput); err != nil {
+			return reps.PSBT{}, err
+		}
+
+		psbt.Inputs[inIdx].FinalScriptSig = scriptSig
+		psbt.Inputs[inIdx].Signatures = map[string][]byte{}
+	}
+
+	return psbt, nil
+}
+
+// Get the signed transaction out of a finalized PSBT
+func (ps *psbtService) ExtractTransaction(psbt reps.PSBT) (reps.Transaction, error) {
+	txn := copyTransaction(psbt.Transaction)
+	for inIdx, input := range psbt.Inputs {
+		if len(input.FinalScriptSig) == 0 {
+			return reps.Transaction{}, fmt.Errorf("input %d of transaction %x is not finalized", inIdx, txn.ID)
+		}
+		txn.Inputs[inIdx].ScriptSig = input.FinalScriptSig
+	}
+
+	return txn, nil
+}
+
+// Submit the transaction of a finalized PSBT to the mempool. It is checked against the chain like any other
+func (ps *psbtService) BroadcastPSBT(psbt reps.PSBT) (reps.Transaction, error) {
+	txn, err := ps.ExtractTransaction(psbt)
+	if err != nil {
+		return reps.Transaction{}, err
+	}
+
+	if err := ps.mempoolService.AddToPool(txn); err != nil {
+		return reps.Transaction{}, err
+	}
+
+	return txn, nil
+}
+
+// Encode a PSBT as base64 to pass it around
+func EncodePSBT(psbt reps.PSBT) string {
+	data, err := json.Marshal(psbt)
+	if err != nil {
+		log.Error("Unable to marshal", err.Error())
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// Decode a base64 PSBT, checking it has an entry for each input of its transaction
+func DecodePSBT(encoded string) (reps.PSBT, error) {
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return reps.PSBT{}, fmt.Errorf("%s, psbt is not valid base64", err.Error())
+	}
+
+	var psbt reps.PSBT
+	if err := json.Unmarshal(data, &psbt); err != nil {
+		return reps.PSBT{}, fmt.Errorf("%s, psbt is not valid", err.Error())
+	}
+	if len(psbt.Transaction.Inputs) == 0 || len(psbt.Inputs) != len(psbt.Transaction.Inputs) {
+		return reps.PSBT{}, fmt.Errorf("psbt has %d inputs but its transaction has %d", len(psbt.Inputs), len(psbt.Transaction.Inputs))
+	}
+
+	for inIdx, input := range psbt.Inputs {
+		if !bytes.Equal(input.PrevOutput.CurrTxnID, psbt.Transaction.Inputs[inIdx].PrevTxnID) {
+			return reps.PSBT{}, fmt.Errorf("psbt input %d does not carry the output it spends", inIdx)
+		}
+	}
+
+	return copyPSBT(psbt), nil
+}
+
+// Script a signature by pubKey for input commits to, or nil if pubKey can't sign the input
+func signingScript(input reps.PartiallySignedInput, pubKey []byte) []byte {
+	lock := lockingScript(input.PrevOutput)
+
+	if scriptHash := script.ExtractScriptHash(lock); scriptHash != nil {
+		if !bytes.Equal(script.Hash160(input.RedeemScript), scriptHash) {
+			return nil
+		}
+		_, pubKeys, err := script.ParseMultiSig(input.RedeemScript)
+		if err != nil {
+			return nil
+		}
+		for _, key := range pubKeys {
+			if bytes.Equal(key, pubKey) {
+				return input.RedeemScript
+			}
+		}
+		return nil
+	}
+
+	if pubKeyHash := script.ExtractPubKeyHash(lock); pubKeyHash != nil && bytes.Equal(script.Hash160(pubKey), pubKeyHash) {
+		return lock
+	}
+	return nil
+}
+
+// Unlocking script built from the signatures of an input
+func finalScriptSig(input reps.PartiallySignedInput) ([]byte, error) {
+	lock := lockingScript(input.PrevOutput)
+
+	if script.ExtractScriptHash(lock) != nil {
+		threshold, pubKeys, err := script.ParseMultiSig(input.RedeemScript)
+		if err != nil {
+			return nil, err
+		}
+
+		// OP_CHECKMULTISIG needs the signatures in the same order as the public keys
+		signatures := make([][]byte, 0, threshold)
+		for _, pubKey := range pubKeys {
+			if signature, ok := input.Signatures[hex.EncodeToString(pubKey)]; ok && len(signatures) < threshold {
+				signatures = append(signatures, signature)
+			}
+		}
+		if len(signatures) < threshold {
+			return nil, fmt.Errorf("has %d of the %d signatures it needs", len(signatures), threshold)
+		}
+		return script.MultiSigScriptSig(signatures, input.RedeemScript), nil
+	}
+
+	pubKeyHash := script.ExtractPubKeyHash(lock)
+	for pubKeyHex, signature := range input.Signatures {
+		pubKey, _ := hex.DecodeString(pubKeyHex)
+		if pubKeyHash != nil && bytes.Equal(script.Hash160(pubKey), pubKeyHash) {
+			return script.SignatureScript(signature, pubKey), nil
+		}
+	}
+	return nil, fmt.Errorf("is not signed")
+}
+
+// Copy of a PSBT that can be changed without changing the original
+func copyPSBT(psbt reps.PSBT) reps.PSBT {
+	psbtCopy := reps.PSBT{Transaction: copyTransaction(psbt.Transaction), Inputs: make([]reps.PartiallySignedInput, len(psbt.Inputs))}
+	for inIdx, input := range psbt.Inputs {
+		signatures := make(map[string][]byte, len(input.Signatures))
+		for pubKey, signature := range input.Signatures {
+			signatures[pubKey] = signature
+		}
+		input.Signatures = signatures
+		psbtCopy.Inputs[inIdx] = input
+	}
+	return psbtCopy
+}
+
+func copyTransaction(txn reps.Transaction) reps.Transaction {
+	txn.Inputs = append([]reps.TxnInput{}, txn.Inputs...)
+	txn.Outputs = append([]reps.TxnOutput{}, txn.Outputs...)
+	return txn
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"testing"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPSBTSignCombineFinalizeRoundTrip(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	ps := NewPSBTService(n.transactionService, n.walletService, n.mempoolService, n.signer)
+	ms := NewMultisigService(n.walletService, n.transactionService, n.mempoolService, n.signer)
+	cosigners := []string{n.newWallet(t), n.newWallet(t), n.newWallet(t)}
+	alice := n.newWallet(t)
+
+	multisigWallet, err := ms.CreateMultisigWallet(cosigners, 2)
+	require.NoError(t, err)
+	n.send(t, miner, multisigWallet.Address, 20)
+
+	psbt, err := ps.CreatePSBT(multisigWallet.Address, payTo(alice, 5), reps.TransferOptions{Fee: 1})
+	require.NoError(t, err)
+	require.Len(t, psbt.Inputs, 1)
+	assert.Equal(t, 20, psbt.Inputs[0].PrevOutput.Value, "carries the output it spends")
+
+	// Each cosigner signs their own copy, passed around as base64
+	signedCopies := make([]reps.PSBT, 0)
+	for _, cosigner := range []string{cosigners[2], cosigners[0]} {
+		received, err := DecodePSBT(EncodePSBT(psbt))
+		require.NoError(t, err)
+		signed, err := ps.SignPSBTWithWallet(received, cosigner)
+		require.NoError(t, err)
+		signedCopies = append(signedCopies, signed)
+	}
+	assert.Empty(t, psbt.Inputs[0].Signatures, "signing doesn't change the original")
+
+	_, err = ps.FinalizePSBT(signedCopies[0])
+	assert.ErrorContains(t, err, "has 1 of the 2 signatures it needs")
+	_, err = ps.ExtractTransaction(signedCopies[0])
+	assert.ErrorContains(t, err, "not finalized")
+
+	combined, err := ps.CombinePSBTs(signedCopies)
+	require.NoError(t, err)
+	assert.Len(t, combined.Inputs[0].Signatures, 2)
+	finalized, err := ps.FinalizePSBT(combined)
+	require.NoError(t, err)
+	assert.NotEmpty(t, finalized.Inputs[0].FinalScriptSig)
+
+	txn, err := ps.BroadcastPSBT(finalized)
+	require.NoError(t, err)
+	assert.Equal(t, psbt.Transaction.ID, txn.ID)
+	n.mine(t, miner)
+	assert.Equal(t, 5, n.balance(t, alice))
+	assert.Equal(t, 14, n.balance(t, multisigWallet.Address))
+}
+
+func TestPSBTFromSingleKeyWallet(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	ps := NewPSBTService(n.transactionService, n.walletService, n.mempoolService, n.signer)
+	alice := n.newWallet(t)
+
+	psbt, err := ps.CreatePSBT(sender, payTo(alice, 10), reps.TransferOptions{})
+	require.NoError(t, err)
+	_, err = ps.SignPSBTWithWallet(psbt, alice)
+	assert.ErrorContains(t, err, "cannot sign any input")
+
+	signed, err := ps.SignPSBTWithWallet(psbt, sender)
+	require.NoError(t, err)
+	finalized, err := ps.FinalizePSBT(signed)
+	require.NoError(t, err)
+	txn, err := ps.ExtractTransaction(finalized)
+	require.NoError(t, err)
+	verified, err := n.transactionService.VerifyTransaction(txn)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	other, err := ps.CreatePSBT(sender, payTo(alice, 20), reps.TransferOptions{})
+	require.NoError(t, err)
+	_, err = ps.CombinePSBTs([]reps.PSBT{signed, other})
+	assert.ErrorContains(t, err, "cannot combine")
+}
+
+func TestDecodePSBTChecksDocument(t *testing.T) {
+	_, err := DecodePSBT("not base64!")
+	assert.ErrorContains(t, err, "not valid base64")
+	_, err = DecodePSBT(EncodePSBT(reps.PSBT{}))
+	assert.ErrorContains(t, err, "psbt has 0 inputs")
+
+	psbt := reps.PSBT{
+		Transaction: reps.Transaction{Inputs: []reps.TxnInput{{PrevTxnID: []byte{1}}}},
+		Inputs:      []reps.PartiallySignedInput{{PrevOutput: reps.TxnOutput{CurrTxnID: []byte{2}}}},
+	}
+	_, err = DecodePSBT(EncodePSBT(psbt))
+	assert.ErrorContains(t, err, "does not carry the output it spends")
+}
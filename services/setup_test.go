@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/brucetieu/blockchain/keycrypt"
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/signer"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPassphrase = "correct horse battery"
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+
+	BlockAssembler = NewBlockAssemblerFac()
+	TxnAssembler = NewTxnAssemblerFac()
+	WalletAssembler = NewWalletAssemblerFac()
+
+	// Keys are encrypted on every wallet created, keep it cheap
+	keycrypt.Argon2Memory, keycrypt.Argon2Time, keycrypt.Argon2Threads = 64, 1, 1
+
+	os.Exit(m.Run())
+}
+
+// Services wired up as in routes.InitRoutes, on top of an in-memory repository
+type testNode struct {
+	repo               repository.BlockchainRepository
+	walletService      WalletService
+	hdWalletService    HDWalletService
+	signer             signer.Signer
+	transactionService TransactionService
+	mempoolService     MempoolService
+	difficultyService  DifficultyService
+	validationService  ValidationService
+	blockService       BlockService
+	blockchainService  BlockchainService
+}
+
+func newTestNode(t *testing.T) *testNode {
+	t.Helper()
+
+	repo := repository.NewMemoryRepository()
+	walletService := NewWalletService(repo)
+	mempoolIndex := NewMempoolIndex()
+	hdWalletService := NewHDWalletService(repo, walletService, mempoolIndex)
+	signer := NewDBSigner(walletService)
+	transactionService := NewTransactionService(repo, walletService, mempoolIndex, signer, hdWalletService)
+	mempoolService := NewMempoolService(transactionService, walletService, mempoolIndex)
+	difficultyService := NewDifficultyService(repo)
+	validationService := NewValidationService(repo, transactionService, difficultyService)
+	blockService := NewBlockService(repo, validationService, mempoolService, difficultyService)
+
+	return &testNode{
+		repo:               repo,
+		walletService:      walletService,
+		hdWalletService:    hdWalletService,
+		signer:             signer,
+		transactionService: transactionService,
+		mempoolService:     mempoolService,
+		difficultyService:  difficultyService,
+		validationService:  validationService,
+		blockService:       blockService,
+		blockchainService:  NewBlockchainService(repo, blockService, transactionService, walletService, mempoolService),
+	}
+}
+
+// Create a wallet and unlock it, so the app can sign for it
+func (n *testNode) newWallet(t *testing.T) string {
+	t.Helper()
+
+	wallet, err := n.walletService.CreateWallet(testPassphrase)
+	require.NoError(t, err)
+	_, err = n.walletService.UnlockWallet(wallet.Address, testPassphrase, time.Hour)
+	require.NoError(t, err)
+
+	return wallet.Address
+}
+
+// Mine the genesis block paying a new wallet, and return the wallet
+func (n *testNode) newChain(t *testing.T) string {
+	t.Helper()
+
+	miner := n.newWallet(t)
+	_, _, err := n.blockchainService.CreateBlockchain(context.Background(), miner)
+	require.NoError(t, err)
+
+	return miner
+}
+
+// Mine every pending transaction into a block paying miner
+func (n *testNode) mine(t *testing.T, miner string) reps.Block {
+	t.Helper()
+
+	block, err := n.blockchainService.MineBlock(context.Background(), miner, "")
+	require.NoError(t, err)
+
+	return block
+}
+
+// Send amount from one wallet to another and mine it
+func (n *testNode) send(t *testing.T, from string, to string, amount int) reps.Block {
+	t.Helper()
+
+	block, err := n.blockchainService.AddToBlockChain(context.Background(), from, payTo(to, amount), reps.TransferOptions{})
+	require.NoError(t, err)
+
+	return block
+}
+
+// Mine a block with only a coinbase on top of parent, whether or not it is the tip
+func (n *testNode) mineOn(t *testing.T, miner string, parent reps.Block) reps.Block {
+	t.Helper()
+
+	block, err := n.blockchainService.MineBlock(context.Background(), miner, hex.EncodeToString(parent.Hash))
+	require.NoError(t, err)
+
+	return block
+}
+
+func (n *testNode) assertTip(t *testing.T, block reps.Block) {
+	t.Helper()
+
+	tip, err := n.blockchainService.GetLastBlock()
+	require.NoError(t, err)
+	assert.Equal(t, block.ID, tip.ID)
+}
+
+func (n *testNode) balance(t *testing.T, address string) int {
+	t.Helper()
+
+	balance, err := n.transactionService.GetBalance(address)
+	require.NoError(t, err)
+
+	return balance
+}
+
+func payTo(to string, amount int) []reps.Payment {
+	return []reps.Payment{{To: to, Amount: amount}}
+}
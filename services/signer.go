@@ -0,0 +1,87 @@
+package services
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/brucetieu/blockchain/signer"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Signers, chosen with the SIGNER env var
+// db -> Keys of wallets saved in storage, encrypted until the wallet is unlocked. The default
+// keystore -> Encrypted key files in KEYSTORE_DIR, under KEYSTORE_PASSPHRASE
+// external -> Another process holding the keys, listening on the Unix socket SIGNER_SOCKET or started as
+// SIGNER_COMMAND and spoken to over its stdin and stdout
+const (
+	DBSigner       = "db"
+	KeystoreSigner = "keystore"
+	ExternalSigner = "external"
+)
+
+// Signs with the keys of wallets saved in storage. See WalletService.GetPrivateKey
+type dbSigner struct {
+	walletService WalletService
+}
+
+func NewDBSigner(walletService WalletService) signer.Signer {
+	return &dbSigner{walletService: walletService}
+}
+
+func (ds *dbSigner) PublicKey(keyId string) ([]byte, error) {
+	wallet, err := ds.walletService.GetWallet(keyId)
+	if err != nil {
+		return nil, err
+	}
+	if wallet.WatchOnly {
+		return nil, fmt.Errorf("%s is a watch-only wallet, create a PSBT and sign it where its key is kept", keyId)
+	}
+	if wallet.PublicKey == "" {
+		return nil, fmt.Errorf("%w %s", signer.ErrUnknownKey, keyId)
+	}
+
+	return hex.DecodeString(wallet.PublicKey)
+}
+
+func (ds *dbSigner) SignHash(keyId string, hash []byte) ([]byte, error) {
+	privKey, err := ds.walletService.GetPrivateKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.SignWithKey(privKey, hash)
+}
+
+// Open the signer set in SIGNER
+func OpenSigner(walletService WalletService) (signer.Signer, error) {
+	kind := os.Getenv("SIGNER")
+	log.Info("Signer: ", kind)
+
+	switch kind {
+	case "", DBSigner:
+		return NewDBSigner(walletService), nil
+	case KeystoreSigner:
+		keystore, err := signer.OpenKeystore(os.Getenv("KEYSTORE_DIR"), os.Getenv("KEYSTORE_PASSPHRASE"))
+		if err != nil {
+			return nil, err
+		}
+		if keyIds, err := keystore.KeyIds(); err == nil {
+			log.Infof("Keystore has %d keys", len(keyIds))
+		}
+		return keystore, nil
+	case ExternalSigner:
+		if socket := os.Getenv("SIGNER_SOCKET"); socket != "" {
+			return signer.NewSocketSigner(socket), nil
+		}
+		command := strings.Fields(os.Getenv("SIGNER_COMMAND"))
+		if len(command) == 0 {
+			return nil, fmt.Errorf("external signer needs SIGNER_SOCKET or SIGNER_COMMAND")
+		}
+		return signer.NewCommandSigner(command[0], command[1:]...), nil
+	default:
+		return nil, fmt.Errorf("unknown signer %s, expected %s, %s or %s", kind, DBSigner, KeystoreSigner, ExternalSigner)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+)
+
+var (
+	// Coins the coinbase of the genesis block and every block in the first halving interval can claim
+	InitialSubsidy = 50
+	// The subsidy halves every HalvingInterval blocks. Set with the HALVING_INTERVAL env var
+	HalvingInterval int64 = 210000
+)
+
+type SupplyService interface {
+	GetSupply() (reps.SupplyInfo, error)
+}
+
+type supplyService struct {
+	blockchainRepo repository.BlockchainRepository
+}
+
+func NewSupplyService(blockchainRepo repository.BlockchainRepository) SupplyService {
+	return &supplyService{
+		blockchainRepo: blockchainRepo,
+	}
+}
+
+// Get how many coins exist now, how many ever will, and when the subsidy next halves
+func (ss *supplyService) GetSupply() (reps.SupplyInfo, error) {
+	lastBlock, err := ss.blockchainRepo.GetLastBlock()
+	if err != nil {
+		return reps.SupplyInfo{}, fmt.Errorf("%s, genesis does not exist", err.Error())
+	}
+
+	balances, err := ss.blockchainRepo.GetUTXOBalances()
+	if err != nil {
+		return reps.SupplyInfo{}, err
+	}
+
+	circulating := 0
+	for _, balance := range balances {
+		circulating += balance.Balance
+	}
+
+	nextHeight := lastBlock.Height + 1
+	nextHalvingHeight := (nextHeight/HalvingInterval + 1) * HalvingInterval
+
+	return reps.SupplyInfo{
+		Height:             lastBlock.Height,
+		Circulating:        circulating,
+		Issued:             issuedSupply(lastBlock.Height),
+		MaxSupply:          maxSupply(),
+		Subsidy:            BlockSubsidy(nextHeight),
+		HalvingInterval:    HalvingInterval,
+		NextHalvingHeight:  nextHalvingHeight,
+		BlocksUntilHalving: nextHalvingHeight - nextHeight,
+		NextHalvingSubsidy: BlockSubsidy(nextHalvingHeight),
+	}, nil
+}
+
+// Coins the coinbase of a block at height can create on top of the fees in the block.
+// Halves every HalvingInterval blocks, rounding down, until it reaches 0
+func BlockSubsidy(height int64) int {
+	halvings := height / HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+
+	return InitialSubsidy >> uint(halvings)
+}
+
+// Total subsidy of every block from genesis up to and including height
+func issuedSupply(height int64) int {
+	issued := 0
+	for eraStart := int64(0); eraStart <= height; eraStart += HalvingInterval {
+		subsidy := BlockSubsidy(eraStart)
+		if subsidy == 0 {
+			break
+		}
+
+		blocks := HalvingInterval
+		if eraStart+blocks > height+1 {
+			blocks = height + 1 - eraStart
+		}
+		issued += subsidy * int(blocks)
+	}
+
+	return issued
+}
+
+// Every coin that will ever be created, once the subsidy has halved down to 0
+func maxSupply() int {
+	supply := 0
+	for halvings := int64(0); BlockSubsidy(halvings*HalvingInterval) > 0; halvings++ {
+		supply += BlockSubsidy(halvings*HalvingInterval) * int(HalvingInterval)
+	}
+
+	return supply
+}
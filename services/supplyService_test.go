@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockSubsidyHalves(t *testing.T) {
+	tests := []struct {
+		height  int64
+		subsidy int
+	}{
+		{height: 0, subsidy: 50},
+		{height: HalvingInterval - 1, subsidy: 50},
+		{height: HalvingInterval, subsidy: 25},
+		{height: 2 * HalvingInterval, subsidy: 12},
+		{height: 5 * HalvingInterval, subsidy: 1},
+		{height: 6 * HalvingInterval, subsidy: 0},
+		{height: 100 * HalvingInterval, subsidy: 0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.subsidy, BlockSubsidy(tt.height), "height %d", tt.height)
+	}
+
+	assert.Equal(t, (50+25+12+6+3+1)*int(HalvingInterval), maxSupply())
+	assert.Equal(t, 50, issuedSupply(0))
+	assert.Equal(t, 50*int(HalvingInterval)+25, issuedSupply(HalvingInterval))
+	assert.Equal(t, maxSupply(), issuedSupply(100*HalvingInterval))
+}
+
+func TestSupplyFollowsTheChain(t *testing.T) {
+	defer func(interval int64) { HalvingInterval = interval }(HalvingInterval)
+	HalvingInterval = 2
+
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	n.mine(t, miner)
+	block := n.mine(t, miner)
+	assert.Equal(t, 25, block.Transactions[0].Outputs[0].Value, "first block after a halving")
+	n.mine(t, miner)
+
+	supply, err := NewSupplyService(n.repo).GetSupply()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), supply.Height)
+	assert.Equal(t, 150, supply.Circulating)
+	assert.Equal(t, 150, supply.Issued)
+	assert.Equal(t, 12, supply.Subsidy)
+	assert.Equal(t, int64(6), supply.NextHalvingHeight)
+	assert.Equal(t, int64(2), supply.BlocksUntilHalving)
+	assert.Equal(t, 6, supply.NextHalvingSubsidy)
+	assert.Equal(t, maxSupply(), supply.MaxSupply)
+}
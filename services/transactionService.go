@@ -5,37 +5,48 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"math/big"
-	"sort"
 
 	"github.com/akamensky/base58"
 	"github.com/brucetieu/blockchain/repository"
 	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/script"
+	"github.com/brucetieu/blockchain/signer"
 	"github.com/brucetieu/blockchain/utils"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/ripemd160"
 
 	log "github.com/sirupsen/logrus"
 )
 
-var Reward = 50 // Initial reward miner gets for mining the first block
+const (
+	// Times a transaction is rebuilt to settle on a fee that matches its fee rate
+	maxFeeAttempts = 5
+	// Bytes in a signature, r and s padded to the size of the P-256 curve
+	signatureLen = 64
+	// Bytes in a public key, x and y padded to the size of the P-256 curve
+	pubKeyLen = 64
+)
 
 type TransactionService interface {
 	NewTxnOutput(value int, address string) reps.TxnOutput
 
 	// SetID(txnRep reps.Transaction) []byte
-	CreateCoinbaseTxn(to string, data string) reps.Transaction
-	CreateTransaction(from string, to string, amount int) (reps.Transaction, error)
+	CreateCoinbaseTxn(to string, data string, height int64, fees int) reps.Transaction
+	CreateTransaction(from string, payments []reps.Payment, options reps.TransferOptions) (reps.Transaction, error)
+	CreateUnsignedTransaction(from string, payments []reps.Payment, options reps.TransferOptions) (reps.Transaction, error)
+	CreateSweepTransaction(from string, to string, options reps.TransferOptions) (reps.Transaction, error)
 	CreateTrimmedTxnCopy(txn reps.Transaction) reps.Transaction
+	TxnID(txn reps.Transaction) []byte
 
 	GetTransactions() ([]reps.Transaction, error)
 	GetTransaction(txnId string) (reps.Transaction, error)
-	GetUnspentTransactions(address []byte) []reps.Transaction
 	GetUnspentTxnOutputs(address []byte) []reps.TxnOutput
-	GetSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int)
+	GetSpendableOutputs(pubKeyHash []byte, amount int, selector CoinSelector) (int, []reps.UTXO, error)
+	IsSpendable(input reps.TxnInput) bool
+	CalculateFee(txn reps.Transaction) (int, error)
 
 	// CanUnlock(input reps.TxnInput, data string) bool
 	// CanBeUnlockedWith(output reps.TxnOutput, data string) bool
@@ -43,23 +54,39 @@ type TransactionService interface {
 
 	VerifyTransaction(txn reps.Transaction) (bool, error)
 	VerifySignature(currTxn reps.Transaction, prevTxns map[string]reps.Transaction) (bool, error)
+	VerifyInput(txn reps.Transaction, inIdx int, prevOutput reps.TxnOutput) error
+	GetPrevOutput(input reps.TxnInput) (reps.TxnOutput, error)
+	SignatureHash(txn reps.Transaction, inIdx int, prevOutput reps.TxnOutput, subscript []byte) []byte
 
 	GetBalances() ([]reps.AddressBalance, error)
 	GetBalance(address string) (int, error)
+	GetGroupBalance(address string) (int, error)
+	GetAddressTransactions(address string) ([]reps.Transaction, error)
 }
 
+// mempoolIndex -> Outputs pending transactions spend, which transfers leave alone
+// signer -> Holds the keys transfers from wallets are signed with
+// hdWalletService -> Derives the addresses change from HD wallet addresses goes to
 type transactionService struct {
 	blockchainRepo  repository.BlockchainRepository
 	walletService   WalletService
+	mempoolIndex    *MempoolIndex
+	signer          signer.Signer
+	hdWalletService HDWalletService
 	blockAssembler  BlockAssemblerFac
 	txnAssembler    TxnAssemblerFac
 	walletAssembler WalletAssemblerFac
 }
 
-func NewTransactionService(blockchainRepo repository.BlockchainRepository, walletService WalletService) TransactionService {
+func NewTransactionService(blockchainRepo repository.BlockchainRepository, walletService WalletService,
+	mempoolIndex *MempoolIndex, signer signer.Signer, hdWalletService HDWalletService,
+) TransactionService {
 	return &transactionService{
 		blockchainRepo:  blockchainRepo,
 		walletService:   walletService,
+		mempoolIndex:    mempoolIndex,
+		signer:          signer,
+		hdWalletService: hdWalletService,
 		blockAssembler:  BlockAssembler,
 		txnAssembler:    TxnAssembler,
 		walletAssembler: WalletAssembler,
@@ -75,8 +102,9 @@ func NewTransactionService(blockchainRepo repository.BlockchainRepository, walle
 // 	return hashID[:]
 // }
 
-// A coinbase transaction is a special type of transaction which doesn’t require previously existing outputs. It creates the output
-func (ts *transactionService) CreateCoinbaseTxn(to string, data string) reps.Transaction {
+// A coinbase transaction is a special type of transaction which doesn’t require previously existing outputs. It creates the output.
+// The miner gets the subsidy for a block at height plus the fees of every other transaction in the block
+func (ts *transactionService) CreateCoinbaseTxn(to string, data string, height int64, fees int) reps.Transaction {
 	log.WithFields(log.Fields{"to": to, "data": data}).Info("Creating coinbase transaction")
 	if data == "" {
 		randData := make([]byte, 24)
@@ -87,14 +115,14 @@ func (ts *transactionService) CreateCoinbaseTxn(to string, data string) reps.Tra
 		data = fmt.Sprintf("%x", randData)
 	}
 
-	txnRep := ts.ToCoinbaseTxn(to, data)
+	txnRep := ts.ToCoinbaseTxn(to, data, BlockSubsidy(height)+fees)
 	log.Info("txnRep in CreateCoinbaseTxn: ", utils.Pretty(txnRep))
 
 	return txnRep
 }
 
 // Given an address, create a coinbase transaction representation
-func (ts *transactionService) ToCoinbaseTxn(to string, data string) reps.Transaction {
+func (ts *transactionService) ToCoinbaseTxn(to string, data string, value int) reps.Transaction {
 	var txnOut reps.TxnOutput
 	var txnIn reps.TxnInput
 	var txnRep reps.Transaction
@@ -102,7 +130,7 @@ func (ts *transactionService) ToCoinbaseTxn(to string, data string) reps.Transac
 	txnInputId := uuid.Must(uuid.NewRandom()).String()
 	// txnOutputId := uuid.Must(uuid.NewRandom()).String()
 
-	txnOut = ts.NewTxnOutput(Reward, to)
+	txnOut = ts.NewTxnOutput(value, to)
 	// txnOut.OutputID = txnOutputId
 	// txnOut.Value = Reward
 	// txnOut.PubKeyHash = to
@@ -121,74 +149,232 @@ func (ts *transactionService) ToCoinbaseTxn(to string, data string) reps.Transac
 	currTxnID := ts.txnAssembler.HashTransaction(txnRep)
 
 	txnRep.ID = currTxnID
-	txnOut.CurrTxnID = currTxnID
-	txnIn.CurrTxnID = currTxnID
+	txnRep.Outputs[0].CurrTxnID = currTxnID
+	txnRep.Inputs[0].CurrTxnID = currTxnID
 
 	return txnRep
 }
 
-// Create a transaction. This does the following:
-// 1. Create locked outputs (populate PubKeyHash in the output)
-// 2. Create new input referencing locked outputs
-// 3. sign the transaction
-func (ts *transactionService) CreateTransaction(from string, to string, amount int) (reps.Transaction, error) {
-	log.WithFields(log.Fields{"from": from, "to": to, "amount": amount}).Info("Creating transaction...")
+// Create a transaction from a wallet whose key the signer holds and sign it. See CreateUnsignedTransaction
+func (ts *transactionService) CreateTransaction(from string, payments []reps.Payment, options reps.TransferOptions) (reps.Transaction, error) {
+	wallet, pubKeyBytes, err := ts.signingKey(from)
+	if err != nil {
+		return reps.Transaction{}, err
+	}
+	if wallet.Retired {
+		return reps.Transaction{}, fmt.Errorf("%w, %s was swept to %s", ErrWalletRetired, from, wallet.SweptTo)
+	}
 
-	var transaction reps.Transaction
-	txnOutput := ts.NewTxnOutput(amount, to)
-	txnInputs := make([]reps.TxnInput, 0)
-	txnOutputs := make([]reps.TxnOutput, 0)
+	transaction, err := ts.CreateUnsignedTransaction(from, payments, options)
+	if err != nil {
+		return reps.Transaction{}, err
+	}
+
+	// sign transaction
+	return ts.SignTransaction(transaction, from, pubKeyBytes)
+}
+
+// Create a transaction moving every unspent output of a wallet whose key the signer holds to a single address, less
+// the fee, and sign it. Outputs a pending transaction already spends are left to it. Nothing comes back as change.
+// Retired wallets can still be swept, for coins sent to them after they were retired
+func (ts *transactionService) CreateSweepTransaction(from string, to string, options reps.TransferOptions) (reps.Transaction, error) {
+	if options.Fee < 0 || options.FeeRate < 0 {
+		return reps.Transaction{}, fmt.Errorf("fee cannot be negative")
+	}
+	if options.Fee > 0 && options.FeeRate > 0 {
+		return reps.Transaction{}, fmt.Errorf("set either a fee or a fee rate, not both")
+	}
+	if options.CoinSelection != "" {
+		return reps.Transaction{}, fmt.Errorf("a sweep spends every unspent output, coin selection does not apply")
+	}
+
+	wallet, pubKeyBytes, err := ts.signingKey(from)
+	if err != nil {
+		return reps.Transaction{}, err
+	}
+
+	utxos, err := ts.availableUTXOs(addressHash(from))
+	if err != nil {
+		return reps.Transaction{}, err
+	}
+	balance := 0
+	for _, utxo := range utxos {
+		balance += utxo.Value
+	}
+	if balance == 0 {
+		return reps.Transaction{}, fmt.Errorf("%s has no unspent outputs to sweep", from)
+	}
+
+	// Any selector has to pick every output to cover the whole balance
+	selector, err := NewCoinSelector("")
+	if err != nil {
+		return reps.Transaction{}, err
+	}
 
+	sweep := func(fee int) (reps.Transaction, error) {
+		if fee >= balance {
+			return reps.Transaction{}, fmt.Errorf("balance of %s is %d, not enough to pay a fee of %d", from, balance, fee)
+		}
+		payments := []reps.Payment{{To: to, Amount: balance - fee}}
+		return ts.createTransaction(wallet, payments, balance-fee, fee, selector, ts.changeAddress(wallet))
+	}
+
+	if options.FeeRate == 0 {
+		txn, err := sweep(options.Fee)
+		if err != nil {
+			return reps.Transaction{}, err
+		}
+		return ts.SignTransaction(txn, from, pubKeyBytes)
+	}
+
+	// Settle on a fee the same way CreateUnsignedTransaction does
+	txnFee := 0
+	for attempt := 0; attempt < maxFeeAttempts; attempt++ {
+		txn, err := sweep(txnFee)
+		if err != nil {
+			return reps.Transaction{}, err
+		}
+
+		requiredFee := int(math.Ceil(options.FeeRate * float64(signedTxnSize(txn, wallet))))
+		if txnFee >= requiredFee {
+			return ts.SignTransaction(txn, from, pubKeyBytes)
+		}
+		txnFee = requiredFee
+	}
+
+	return reps.Transaction{}, fmt.Errorf("could not work out a fee for a fee rate of %g", options.FeeRate)
+}
+
+// Wallet to send coins from, along with the public key the signer holds for it. The key has to hash to the address
+func (ts *transactionService) signingKey(from string) (reps.Wallet, []byte, error) {
 	// Check that a wallet exists to send coins from
 	wallet, err := ts.walletService.GetWallet(from)
 	if err != nil {
-		return reps.Transaction{}, err
+		return reps.Wallet{}, nil, err
+	}
+	if len(wallet.RedeemScript) > 0 {
+		return reps.Wallet{}, nil, fmt.Errorf("%s is a multisig wallet, its spends have to be signed by its cosigners", from)
 	}
 
-	pubKeyBytes, _ := hex.DecodeString(wallet.PublicKey)
-	pubKeyHash, _ := ts.walletService.CreatePubKeyHash(pubKeyBytes)
-	privKey := ts.walletAssembler.ToECDSAPrivateKey(wallet.PrivateKey)
+	pubKeyBytes, err := ts.signer.PublicKey(from)
+	if err != nil {
+		return reps.Wallet{}, nil, err
+	}
+	pubKeyHash, err := ts.walletService.CreatePubKeyHash(pubKeyBytes)
+	if err != nil {
+		return reps.Wallet{}, nil, err
+	}
+	if !bytes.Equal(pubKeyHash, addressHash(from)) {
+		return reps.Wallet{}, nil, fmt.Errorf("the signer's key for %s does not belong to that address", from)
+	}
 
-	totalUnspentAmount, validOutputs := ts.GetSpendableOutputs(pubKeyHash, amount)
-	log.WithFields(log.Fields{"totalUnspentAmount": totalUnspentAmount, "validOutputs": utils.Pretty(validOutputs)}).Info("Got spendable outputs")
+	return wallet, pubKeyBytes, nil
+}
 
-	// Not enough coins to send
-	if amount > totalUnspentAmount {
-		err := fmt.Errorf("%s only has %d coins to send to %s, not %d, Cancelling transaction", from, totalUnspentAmount, to, amount)
-		log.Error(err)
+// Create a transaction paying one or more addresses and either a fixed fee or a fee rate, spending outputs picked by the
+// requested coin selection, but don't sign it. A fee rate allows for the unlocking scripts the inputs get once signed.
+// See createTransaction
+func (ts *transactionService) CreateUnsignedTransaction(from string, payments []reps.Payment, options reps.TransferOptions) (reps.Transaction, error) {
+	if options.Fee < 0 || options.FeeRate < 0 {
+		return reps.Transaction{}, fmt.Errorf("fee cannot be negative")
+	}
+	if options.Fee > 0 && options.FeeRate > 0 {
+		return reps.Transaction{}, fmt.Errorf("set either a fee or a fee rate, not both")
+	}
+
+	amount, err := totalPayments(payments)
+	if err != nil {
 		return reps.Transaction{}, err
 	}
 
-	// For each found unspent output an input referencing it is created
-	for txnId, outputIndices := range validOutputs {
-		decodedTxnId, err := hex.DecodeString(txnId)
+	selector, err := NewCoinSelector(options.CoinSelection)
+	if err != nil {
+		return reps.Transaction{}, err
+	}
+
+	wallet, err := ts.walletService.GetWallet(from)
+	if err != nil {
+		return reps.Transaction{}, err
+	}
+	if wallet.Retired {
+		return reps.Transaction{}, fmt.Errorf("%w, %s was swept to %s", ErrWalletRetired, from, wallet.SweptTo)
+	}
+
+	changeTo := ts.changeAddress(wallet)
+	if options.FeeRate == 0 {
+		return ts.createTransaction(wallet, payments, amount, options.Fee, selector, changeTo)
+	}
+
+	// The fee depends on the size of the transaction, which depends on the fee. Build it until the fee covers its own size
+	txnFee := 0
+	for attempt := 0; attempt < maxFeeAttempts; attempt++ {
+		txn, err := ts.createTransaction(wallet, payments, amount, txnFee, selector, changeTo)
 		if err != nil {
-			log.WithField("error", err.Error()).Error("Error decoding transactionId to bytes")
+			return reps.Transaction{}, err
 		}
 
-		for _, outputIdx := range outputIndices {
-			input := reps.TxnInput{}
-			inputID := uuid.Must(uuid.NewRandom()).String()
-			input.InputID = inputID
-			input.PrevTxnID = decodedTxnId
-			input.OutIdx = outputIdx
-			input.PubKey = pubKeyBytes
-			txnInputs = append(txnInputs, input)
+		requiredFee := int(math.Ceil(options.FeeRate * float64(signedTxnSize(txn, wallet))))
+		if txnFee >= requiredFee {
+			return txn, nil
 		}
+		txnFee = requiredFee
+	}
+
+	return reps.Transaction{}, fmt.Errorf("could not work out a fee for a fee rate of %g", options.FeeRate)
+}
+
+// Create an unsigned transaction. This does the following:
+// 1. Create locked outputs (populate PubKeyHash in the output), one per payment
+// 2. Create new input referencing locked outputs
+// amount is what the payments add up to. Inputs spend the outputs selector picks to cover amount and fee.
+// Whatever they are worth on top of that is change, paid in a single output to the address changeTo gives
+func (ts *transactionService) createTransaction(wallet reps.Wallet, payments []reps.Payment, amount int, fee int, selector CoinSelector,
+	changeTo func() (string, error),
+) (reps.Transaction, error) {
+	from := wallet.Address
+	log.WithFields(log.Fields{"from": from, "payments": len(payments), "amount": amount, "fee": fee}).Info("Creating transaction...")
+
+	var transaction reps.Transaction
+	txnInputs := make([]reps.TxnInput, 0)
+	txnOutputs := make([]reps.TxnOutput, 0)
+
+	totalUnspentAmount, validOutputs, err := ts.GetSpendableOutputs(addressHash(from), amount+fee, selector)
+	if err != nil {
+		err := fmt.Errorf("%s, %s cannot send %d to %d addresses plus a fee of %d, Cancelling transaction", err.Error(), from, amount, len(payments), fee)
+		log.Error(err)
+		return reps.Transaction{}, err
+	}
+	log.WithFields(log.Fields{"totalUnspentAmount": totalUnspentAmount, "validOutputs": utils.Pretty(validOutputs)}).Info("Got spendable outputs")
+
+	// For each selected unspent output an input referencing it is created
+	for _, utxo := range validOutputs {
+		input := reps.TxnInput{}
+		inputID := uuid.Must(uuid.NewRandom()).String()
+		input.InputID = inputID
+		input.PrevTxnID = utxo.TxnID
+		input.OutIdx = utxo.OutIdx
+		txnInputs = append(txnInputs, input)
 	}
 
 	transaction.Inputs = txnInputs
 
-	// Amount sender gave to receiver
-	txnOutputs = append(txnOutputs, txnOutput)
+	// Amount sender gave to each receiver
+	for _, payment := range payments {
+		txnOutputs = append(txnOutputs, ts.NewTxnOutput(payment.Amount, payment.To))
+	}
 
-	// Any change associated with sender
-	if totalUnspentAmount > amount {
-		txnOutputChange := ts.NewTxnOutput(totalUnspentAmount-amount, from)
+	// Any change goes to the address changeTo gives, back to the sender or to a change address of its HD wallet
+	if totalUnspentAmount > amount+fee {
+		changeAddress, err := changeTo()
+		if err != nil {
+			return reps.Transaction{}, err
+		}
+		txnOutputChange := ts.NewTxnOutput(totalUnspentAmount-amount-fee, changeAddress)
 		txnOutputs = append(txnOutputs, txnOutputChange)
 	}
 
 	transaction.Outputs = txnOutputs
+	transaction.Fee = fee
 
 	// txnId := ts.txnAssembler.SetID(transaction)
 	txnId := ts.txnAssembler.HashTransaction(transaction)
@@ -203,15 +389,32 @@ func (ts *transactionService) CreateTransaction(from string, to string, amount i
 
 	transaction.ID = txnId
 
-	// sign transaction
-	transaction, err = ts.SignTransaction(transaction, privKey)
-	if err != nil {
-		return reps.Transaction{}, err
-	}
-
 	return transaction, nil
 }
 
+// Address change from a wallet goes to. Change from an address of an HD wallet goes to an unused address on the change
+// chain of the HD wallet, so it isn't linked to the address it was sent from. Any other wallet gets its change back. The
+// address is looked up the first time it is needed, and the same address is given every time after that
+func (ts *transactionService) changeAddress(wallet reps.Wallet) func() (string, error) {
+	changeAddress := ""
+	return func() (string, error) {
+		if changeAddress != "" {
+			return changeAddress, nil
+		}
+		if wallet.HDWalletID == "" {
+			changeAddress = wallet.Address
+			return changeAddress, nil
+		}
+
+		hdAddress, err := ts.hdWalletService.ChangeAddress(wallet.HDWalletID)
+		if err != nil {
+			return "", fmt.Errorf("%s, could not get a change address for %s", err.Error(), wallet.Address)
+		}
+		changeAddress = hdAddress.Address
+		return changeAddress, nil
+	}
+}
+
 // Get transaction on a block by transactionId
 func (tx *transactionService) GetTransaction(txnId string) (reps.Transaction, error) {
 	log.Info("Attempting to get transaction with transaction id: ", txnId)
@@ -248,22 +451,37 @@ func (ts *transactionService) GetBalances() ([]reps.AddressBalance, error) {
 		return []reps.AddressBalance{}, err
 	}
 
+	// Sum up the utxo set once for all public key hashes, rather than once per wallet
+	utxoBalances, err := ts.blockchainRepo.GetUTXOBalances()
+	if err != nil {
+		return []reps.AddressBalance{}, err
+	}
+
+	balancesByPubKeyHash := make(map[string]int)
+	for _, utxoBalance := range utxoBalances {
+		balancesByPubKeyHash[hex.EncodeToString(utxoBalance.PubKeyHash)] = utxoBalance.Balance
+	}
+
 	addressBalances := make([]reps.AddressBalance, 0)
+	groupBalances := make(map[string]int)
 
 	for _, wallet := range wallets {
-		balance := 0
-
 		pubKeyHash := base58Decode([]byte(wallet.Address))
 		pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-ChecksumLen]
 
-		unspentTxnOutputs := ts.GetUnspentTxnOutputs(pubKeyHash)
-		log.Info("unspentTxnOutputs in GetBalances for address: "+wallet.Address, utils.Pretty(unspentTxnOutputs))
+		balance := balancesByPubKeyHash[hex.EncodeToString(pubKeyHash)]
+		groupBalances[wallet.HDWalletID] += balance
 
-		for _, unspentOutput := range unspentTxnOutputs {
-			balance += unspentOutput.Value
-		}
+		addressBalances = append(addressBalances, reps.AddressBalance{Address: wallet.Address, Balance: balance, HDWalletID: wallet.HDWalletID})
+	}
 
-		addressBalances = append(addressBalances, reps.AddressBalance{Address: wallet.Address, Balance: balance})
+	// Addresses of an HD wallet also get what the HD wallet holds across all of them. Any other address is a group of
+	// its own, as in GetGroupBalance
+	for i, addressBalance := range addressBalances {
+		addressBalances[i].GroupBalance = addressBalance.Balance
+		if addressBalance.HDWalletID != "" {
+			addressBalances[i].GroupBalance = groupBalances[addressBalance.HDWalletID]
+		}
 	}
 
 	return addressBalances, nil
@@ -292,105 +510,193 @@ func (ts *transactionService) GetBalance(address string) (int, error) {
 	return balance, nil
 }
 
-// Find out how much of the unspendable outputs from the sender can be spent given an amount
-func (ts *transactionService) GetSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	log.WithFields(log.Fields{"from": hex.EncodeToString(pubKeyHash), "amount": amount}).Info("Calling GetSpendableOutputs")
-	totalUnspentAmount := 0
+// Get balance for the group of wallets an address is in: every address of its HD wallet, change addresses included.
+// Any other address is a group of its own
+func (ts *transactionService) GetGroupBalance(address string) (int, error) {
+	wallet, err := ts.walletService.GetWallet(address)
+	if err != nil {
+		return 0, err
+	}
+	if wallet.HDWalletID == "" {
+		return addressBalance(ts.blockchainRepo, wallet.Address)
+	}
 
-	// <key>: transactionIds associated with spender
-	// <value> list of all unspent output indices associated with sender for each transaction
-	unspentOutIdxs := make(map[string][]int)
-	unspentTxns := ts.GetUnspentTransactions(pubKeyHash)
+	wallets, err := ts.blockchainRepo.GetHDWalletAddresses(wallet.HDWalletID)
+	if err != nil {
+		return 0, err
+	}
 
-	// Outer:
-	for _, unspentTxn := range unspentTxns {
-		txnId := hex.EncodeToString(unspentTxn.ID)
+	groupBalance := 0
+	for _, wallet := range wallets {
+		balance, err := addressBalance(ts.blockchainRepo, wallet.Address)
+		if err != nil {
+			return 0, err
+		}
+		groupBalance += balance
+	}
 
-		for outputIdx, output := range unspentTxn.Outputs {
-			if ts.IsLockedWithKey(output, pubKeyHash) /*&& totalUnspentAmount < amount*/ {
-				unspentOutIdxs[txnId] = append(unspentOutIdxs[txnId], outputIdx)
-				totalUnspentAmount += output.Value
+	return groupBalance, nil
+}
+
+// What the unspent outputs paying an address are worth
+func addressBalance(blockchainRepo repository.BlockchainRepository, address string) (int, error) {
+	utxos, err := blockchainRepo.GetUTXOs(addressHash(address))
+	if err != nil {
+		return 0, err
+	}
+
+	balance := 0
+	for _, utxo := range utxos {
+		balance += utxo.Value
+	}
+
+	return balance, nil
+}
+
+// Get the transactions on the blockchain that pay to an address or spend from it
+func (ts *transactionService) GetAddressTransactions(address string) ([]reps.Transaction, error) {
+	log.Info("Attempting to get the transactions of the address: ", address)
+	wallet, err := ts.walletService.GetWallet(address)
+	if err != nil {
+		return []reps.Transaction{}, err
+	}
+	pubKeyHash := addressHash(wallet.Address)
+
+	txns, err := ts.blockchainRepo.GetTransactions()
+	if err != nil {
+		return []reps.Transaction{}, err
+	}
 
-				// if totalUnspentAmount >= amount {
-				// 	break Outer
-				// }
+	// Outputs paying to the address, so inputs spending them can be found
+	ownOutputs := make(map[string]bool)
+	for _, txn := range txns {
+		for outIdx, output := range txn.Outputs {
+			if bytes.Equal(output.PubKeyHash, pubKeyHash) {
+				ownOutputs[outpointKey(txn.ID, outIdx)] = true
 			}
 		}
 	}
-	return totalUnspentAmount, unspentOutIdxs
+
+	addressTxns := make([]reps.Transaction, 0)
+	for _, txn := range txns {
+		involved := false
+		for _, output := range txn.Outputs {
+			involved = involved || bytes.Equal(output.PubKeyHash, pubKeyHash)
+		}
+		for _, input := range txn.Inputs {
+			involved = involved || ownOutputs[outpointKey(input.PrevTxnID, input.OutIdx)]
+		}
+
+		if involved {
+			addressTxns = append(addressTxns, txn)
+		}
+	}
+
+	return addressTxns, nil
 }
 
-// Get all transactions whose outputs aren't referenced in inputs
-func (ts *transactionService) GetUnspentTransactions(pubKeyHash []byte) []reps.Transaction {
-	var unspentTxns []reps.Transaction
+// Check the payments of a transfer and work out what they add up to. There has to be at least one payment,
+// each paying a positive amount to a different address
+func totalPayments(payments []reps.Payment) (int, error) {
+	if len(payments) == 0 {
+		return 0, fmt.Errorf("a transfer needs at least one recipient")
+	}
 
-	// key: transaction id, value: list of output indices
-	spentTxns := make(map[string][]int)
+	total := 0
+	recipients := make(map[string]bool)
+	for _, payment := range payments {
+		if payment.Amount <= 0 {
+			return 0, fmt.Errorf("amount sent to %s must be positive, not %d", payment.To, payment.Amount)
+		}
+		if recipients[payment.To] {
+			return 0, fmt.Errorf("%s is paid more than once, combine its payments into one", payment.To)
+		}
+		if total > math.MaxInt-payment.Amount {
+			return 0, fmt.Errorf("payments add up to more than %d", math.MaxInt)
+		}
+		recipients[payment.To] = true
+		total += payment.Amount
+	}
 
-	// TODO: Need to put the sorting in blockchainrepo perhaps
-	blocks, err := ts.blockchainRepo.GetBlockchain()
+	return total, nil
+}
+
+// Pick which of the sender's unspent outputs to spend to cover amount, and what they are worth together. Outputs that
+// a pending transaction already spends can't be picked. Fails if the sender's other unspent outputs aren't worth enough
+func (ts *transactionService) GetSpendableOutputs(pubKeyHash []byte, amount int, selector CoinSelector) (int, []reps.UTXO, error) {
+	log.WithFields(log.Fields{"from": hex.EncodeToString(pubKeyHash), "amount": amount}).Info("Calling GetSpendableOutputs")
+
+	utxos, err := ts.availableUTXOs(pubKeyHash)
 	if err != nil {
-		log.WithField("error", err.Error()).Error("Error getting blocks in blockchain")
-	}
-
-	// Need to process genesis block last
-	sort.Slice(blocks, func(i, j int) bool {
-		return blocks[i].Timestamp > blocks[j].Timestamp
-	})
-
-	for _, block := range blocks {
-
-		for _, txn := range block.Transactions {
-			txnId := hex.EncodeToString(txn.ID)
-
-		Outputs:
-			for outputIdx, output := range txn.Outputs {
-				// if spentTxns[txnId] != nil {
-				if _, ok := spentTxns[txnId]; ok {
-					for _, inputOutIdx := range spentTxns[txnId] {
-						if outputIdx == inputOutIdx {
-							continue Outputs // Skip this spent transaction
-						}
-					}
-				}
-
-				// If we get to here no OutIdx is referenced in an input; ie unspent
-				if ts.IsLockedWithKey(output, pubKeyHash) {
-					unspentTxns = append(unspentTxns, txn)
-				}
-			}
+		log.WithField("error", err.Error()).Error("Error getting unspent outputs")
+		return 0, nil, err
+	}
 
-			// Non coinbase transaction will have an input with non negative OutIdx. Find all of them for a given transaction, these are the spent txns
-			if !ts.IsCoinbaseTransaction(txn) {
-				for _, input := range txn.Inputs {
-					if ts.UsesKey(input, pubKeyHash) {
-						txnId := hex.EncodeToString(input.PrevTxnID)
-						spentTxns[txnId] = append(spentTxns[txnId], input.OutIdx)
-					}
-				}
-			}
+	selected, err := selector.Select(utxos, amount)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	totalUnspentAmount := 0
+	for _, utxo := range selected {
+		totalUnspentAmount += utxo.Value
+	}
+
+	return totalUnspentAmount, selected, nil
+}
+
+// Unspent outputs paying to pubKeyHash that no pending transaction spends
+func (ts *transactionService) availableUTXOs(pubKeyHash []byte) ([]reps.UTXO, error) {
+	utxos, err := ts.blockchainRepo.GetUTXOs(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	available := make([]reps.UTXO, 0, len(utxos))
+	for _, utxo := range utxos {
+		if _, ok := ts.mempoolIndex.SpentBy(utxo.TxnID, utxo.OutIdx); !ok {
+			available = append(available, utxo)
 		}
+	}
+
+	return available, nil
+}
+
+// Check that the output referenced by an input is in the utxo set. VerifyTransaction checks the input unlocks it
+func (ts *transactionService) IsSpendable(input reps.TxnInput) bool {
+	_, err := ts.blockchainRepo.GetUTXO(input.PrevTxnID, input.OutIdx)
+	return err == nil
+}
 
-		// Don't process the Transactions in the Genesis block.
-		if len(block.PrevHash) == 0 {
-			break
+// Work out the fee of a transaction from the outputs it spends: what its inputs are worth minus what its outputs are worth.
+// Fails if an input isn't in the utxo set or the outputs are worth more than the inputs
+func (ts *transactionService) CalculateFee(txn reps.Transaction) (int, error) {
+	inputValue := 0
+	for _, input := range txn.Inputs {
+		utxo, err := ts.blockchainRepo.GetUTXO(input.PrevTxnID, input.OutIdx)
+		if err != nil {
+			return 0, fmt.Errorf("%s, output %d of %x", err.Error(), input.OutIdx, input.PrevTxnID)
 		}
+		inputValue += utxo.Value
 	}
-	return unspentTxns
+
+	return txnFee(txn, inputValue)
 }
 
-// Get the outputs from unspent transactions
-func (ts *transactionService) GetUnspentTxnOutputs(address []byte) []reps.TxnOutput {
+// Get the unspent outputs locked with a public key hash
+func (ts *transactionService) GetUnspentTxnOutputs(pubKeyHash []byte) []reps.TxnOutput {
 	unspentTxnOutputs := make([]reps.TxnOutput, 0)
-	unspentTxns := ts.GetUnspentTransactions(address)
-	// log.Info("Got unspentTxns in GetUnspentTxnOutputs", utils.Pretty(unspentTxns))
+	utxos, err := ts.blockchainRepo.GetUTXOs(pubKeyHash)
+	if err != nil {
+		log.WithField("error", err.Error()).Error("Error getting unspent outputs")
+	}
 
-	for _, unspentTxn := range unspentTxns {
-		for _, output := range unspentTxn.Outputs {
-			if ts.IsLockedWithKey(output, address) {
-				unspentTxnOutputs = append(unspentTxnOutputs, output)
-			}
-		}
+	for _, utxo := range utxos {
+		unspentTxnOutputs = append(unspentTxnOutputs, reps.TxnOutput{
+			CurrTxnID:  utxo.TxnID,
+			Value:      utxo.Value,
+			PubKeyHash: utxo.PubKeyHash,
+		})
 	}
 
 	return unspentTxnOutputs
@@ -407,7 +713,8 @@ func (ts *transactionService) NewTxnOutput(value int, address string) reps.TxnOu
 	return txnOutput
 }
 
-func (ts *transactionService) SignTransaction(txn reps.Transaction, privKey ecdsa.PrivateKey) (reps.Transaction, error) {
+// Sign every input of a transaction with the key of keyId, unlocking the P2PKH outputs they spend with pubKey
+func (ts *transactionService) SignTransaction(txn reps.Transaction, keyId string, pubKey []byte) (reps.Transaction, error) {
 	log.Info("Attempting to sign transaction: ", hex.EncodeToString(txn.ID))
 	prevTxns := make(map[string]reps.Transaction)
 
@@ -420,11 +727,17 @@ func (ts *transactionService) SignTransaction(txn reps.Transaction, privKey ecds
 		prevTxns[hex.EncodeToString(prevTxn.ID)] = prevTxn
 	}
 
-	return ts.Sign(privKey, txn, prevTxns)
+	return ts.Sign(keyId, pubKey, txn, prevTxns)
 }
 
 func (ts *transactionService) VerifyTransaction(txn reps.Transaction) (bool, error) {
 	log.Info("Attempting to verify transaction: ", hex.EncodeToString(txn.ID))
+	for outIdx, output := range txn.Outputs {
+		if err := checkLock(output); err != nil {
+			return false, fmt.Errorf("output %d: %s", outIdx, err.Error())
+		}
+	}
+
 	if ts.IsCoinbaseTransaction(txn) {
 		return true, nil
 	}
@@ -443,85 +756,45 @@ func (ts *transactionService) VerifyTransaction(txn reps.Transaction) (bool, err
 	return ts.VerifySignature(txn, prevTxns)
 }
 
-func (ts *transactionService) Sign(privKey ecdsa.PrivateKey, txn reps.Transaction, prevTxns map[string]reps.Transaction) (reps.Transaction, error) {
+// Sign each input through the signer and give it the unlocking script <signature> <pubKey>
+func (ts *transactionService) Sign(keyId string, pubKey []byte, txn reps.Transaction, prevTxns map[string]reps.Transaction) (reps.Transaction, error) {
 	log.Info("Attempting to sign: ", hex.EncodeToString(txn.ID))
 	if ts.IsCoinbaseTransaction(txn) {
 		return reps.Transaction{}, nil
 	}
 
-	for _, in := range txn.Inputs {
-		if prevTxns[hex.EncodeToString(in.PrevTxnID)].ID == nil {
-			log.WithField("input currTxnID", in.PrevTxnID).Error("error: previous transaction does not exist")
-			// return reps.Transaction{}, fmt.Errorf("error: previous transaction does not exist with id: %s", in.PrevTxnID)
+	for inIdx, input := range txn.Inputs {
+		prevOutput, err := prevOutput(input, prevTxns)
+		if err != nil {
+			return reps.Transaction{}, err
 		}
-	}
-
-	// trimmed txn copy is signed, not a full one
-	txnCopy := ts.CreateTrimmedTxnCopy(txn)
-
-	for inIdx, input := range txnCopy.Inputs {
-		prevTxn := prevTxns[hex.EncodeToString(input.PrevTxnID)]
-		txnCopy.Inputs[inIdx].Signature = nil
-
-		// This txns input's pubKey is set to the outputs pubKeyHash from previous transaction
-		txnCopy.Inputs[inIdx].PubKey = prevTxn.Outputs[input.OutIdx].PubKeyHash
 
 		// Sign the Public key hashes stored in unlocked outputs. This identifies “sender” of a transaction.
-		txnCopy.ID = ts.txnAssembler.HashTransaction(txnCopy)
-		txnCopy.Inputs[inIdx].PubKey = nil // don't affect further iterations
-
-		// sign txnCopy.Id with privKey
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, txnCopy.ID)
+		hash := ts.SignatureHash(txn, inIdx, prevOutput, lockingScript(prevOutput))
+		signature, err := ts.signer.SignHash(keyId, hash)
 		if err != nil {
 			log.Error("error signing transaction: ", err.Error())
+			return reps.Transaction{}, err
 		}
 
-		signature := append(r.Bytes(), s.Bytes()...)
-		txn.Inputs[inIdx].Signature = signature
+		txn.Inputs[inIdx].ScriptSig = script.SignatureScript(signature, pubKey)
 	}
 
 	return txn, nil
-	// Update db with signature
 }
 
+// Run the unlocking script of each input against the locking script of the output it spends
 func (ts *transactionService) VerifySignature(currTxn reps.Transaction, prevTxns map[string]reps.Transaction) (bool, error) {
 	log.Info("Attempting to verify signature of transaction: "+hex.EncodeToString(currTxn.ID)+" with inputs: ", utils.Pretty(currTxn.Inputs))
-	txnCopy := ts.CreateTrimmedTxnCopy(currTxn)
-	curve := elliptic.P256()
 
 	for inIdx, in := range currTxn.Inputs {
-
-		if in.Signature == nil {
-			log.Error("Signature cannot be null, cannot verify.")
-			return false, fmt.Errorf("cannot verify a null signature. Invalid transaction")
+		prevOutput, err := prevOutput(in, prevTxns)
+		if err != nil {
+			return false, err
 		}
 
-		// need same data that was signed
-		prevTxn := prevTxns[hex.EncodeToString(in.PrevTxnID)]
-		txnCopy.Inputs[inIdx].Signature = nil
-		txnCopy.Inputs[inIdx].PubKey = prevTxn.Outputs[in.OutIdx].PubKeyHash
-		txnCopy.ID = ts.txnAssembler.HashTransaction(txnCopy)
-		txnCopy.Inputs[inIdx].PubKey = nil
-
-		// Unpack signature, signature is a pair of numbers
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(in.Signature)
-		r.SetBytes(in.Signature[:(sigLen / 2)])
-		s.SetBytes(in.Signature[(sigLen / 2):])
-
-		// Unpack pubKey, pubKey is a pair of points
-		x := big.Int{}
-		y := big.Int{}
-		pubKeyLen := len(in.PubKey)
-		x.SetBytes(in.PubKey[:(pubKeyLen / 2)])
-		y.SetBytes(in.PubKey[(pubKeyLen / 2):])
-
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
-
-		// verifies the signature in r, s of hash (txnCopy.ID) using the public key.
-		if !ecdsa.Verify(&rawPubKey, txnCopy.ID, &r, &s) {
-			return false, fmt.Errorf("Signature: %x could not be verified", in.Signature)
+		if err := ts.VerifyInput(currTxn, inIdx, prevOutput); err != nil {
+			return false, err
 		}
 	}
 
@@ -529,17 +802,144 @@ func (ts *transactionService) VerifySignature(currTxn reps.Transaction, prevTxns
 	return true, nil
 }
 
+// Run the unlocking script of input inIdx against the locking script of prevOutput, the output it spends
+func (ts *transactionService) VerifyInput(txn reps.Transaction, inIdx int, prevOutput reps.TxnOutput) error {
+	checker := &txnSignatureChecker{ts: ts, txn: txn, inIdx: inIdx, prevOutput: prevOutput}
+	if err := script.Execute(unlockingScript(txn.Inputs[inIdx]), lockingScript(prevOutput), checker); err != nil {
+		return fmt.Errorf("input %d could not be verified: %s", inIdx, err.Error())
+	}
+	return nil
+}
+
+// Hash of the transaction an input's signature commits to. This is a trimmed copy of the transaction where the
+// input carries the public key hash of the output it spends. If the output has a locking script, the input
+// also carries subscript, the script being run, in place of its unlocking script. Outputs from before scripts leave
+// it out, so their signatures still match
+func (ts *transactionService) SignatureHash(txn reps.Transaction, inIdx int, prevOutput reps.TxnOutput, subscript []byte) []byte {
+	txnCopy := ts.CreateTrimmedTxnCopy(txn)
+	txnCopy.Inputs[inIdx].PubKey = prevOutput.PubKeyHash
+	if len(prevOutput.ScriptPubKey) > 0 {
+		txnCopy.Inputs[inIdx].ScriptSig = subscript
+	}
+
+	return ts.txnAssembler.HashTransaction(txnCopy)
+}
+
+// Get the output an input spends
+func (ts *transactionService) GetPrevOutput(input reps.TxnInput) (reps.TxnOutput, error) {
+	prevTxn, err := ts.blockchainRepo.GetTransaction(input.PrevTxnID)
+	if err != nil {
+		log.Error("error finding previous transaction with id: ", input.PrevTxnID)
+		return reps.TxnOutput{}, err
+	}
+
+	return prevOutput(input, map[string]reps.Transaction{hex.EncodeToString(prevTxn.ID): prevTxn})
+}
+
+// Checks the signatures a script finds against the signature hash of one input
+type txnSignatureChecker struct {
+	ts         *transactionService
+	txn        reps.Transaction
+	inIdx      int
+	prevOutput reps.TxnOutput
+}
+
+func (c *txnSignatureChecker) CheckSignature(signature []byte, pubKey []byte, subscript []byte) bool {
+	hash := c.ts.SignatureHash(c.txn, c.inIdx, c.prevOutput, subscript)
+
+	// Signature is a pair of numbers, pubKey is a pair of points
+	r, s := splitHalves(signature)
+	x, y := splitHalves(pubKey)
+	rawPubKey := ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+
+	// verifies the signature in r, s of hash using the public key.
+	return ecdsa.Verify(&rawPubKey, hash, r, s)
+}
+
+// Output an input spends, out of the transactions it spends from
+func prevOutput(input reps.TxnInput, prevTxns map[string]reps.Transaction) (reps.TxnOutput, error) {
+	prevTxn, ok := prevTxns[hex.EncodeToString(input.PrevTxnID)]
+	if !ok || input.OutIdx < 0 || input.OutIdx >= len(prevTxn.Outputs) {
+		return reps.TxnOutput{}, fmt.Errorf("output %d of %x does not exist", input.OutIdx, input.PrevTxnID)
+	}
+	return prevTxn.Outputs[input.OutIdx], nil
+}
+
+// Locking script of an output. Outputs from before scripts are P2PKH
+func lockingScript(output reps.TxnOutput) []byte {
+	if len(output.ScriptPubKey) > 0 {
+		return output.ScriptPubKey
+	}
+	return script.PayToPubKeyHash(output.PubKeyHash)
+}
+
+// Unlocking script of an input. Inputs from before scripts are <signature> <pubKey>
+func unlockingScript(input reps.TxnInput) []byte {
+	if len(input.ScriptSig) > 0 {
+		return input.ScriptSig
+	}
+	return script.SignatureScript(input.Signature, input.PubKey)
+}
+
+// Check the public key hash of an output is the one its locking script pays to. For P2SH scripts it is the script hash
+func checkLock(output reps.TxnOutput) error {
+	if len(output.ScriptPubKey) == 0 {
+		return nil
+	}
+
+	lockHash := script.ExtractPubKeyHash(output.ScriptPubKey)
+	if lockHash == nil {
+		lockHash = script.ExtractScriptHash(output.ScriptPubKey)
+	}
+	if !bytes.Equal(lockHash, output.PubKeyHash) {
+		return fmt.Errorf("public key hash %x does not match the locking script", output.PubKeyHash)
+	}
+	return nil
+}
+
+// Size a transaction from wallet will be once its inputs are signed
+func signedTxnSize(txn reps.Transaction, wallet reps.Wallet) int {
+	placeholder := make([]byte, signatureLen)
+	var scriptSig []byte
+	if len(wallet.RedeemScript) > 0 {
+		threshold, _, _ := script.ParseMultiSig(wallet.RedeemScript)
+		signatures := make([][]byte, threshold)
+		for i := range signatures {
+			signatures[i] = placeholder
+		}
+		scriptSig = script.MultiSigScriptSig(signatures, wallet.RedeemScript)
+	} else {
+		// Watch-only wallets imported from an address don't have their public key
+		scriptSig = script.SignatureScript(placeholder, make([]byte, pubKeyLen))
+	}
+
+	signed := txn
+	signed.Inputs = make([]reps.TxnInput, len(txn.Inputs))
+	for i, input := range txn.Inputs {
+		input.ScriptSig = scriptSig
+		signed.Inputs[i] = input
+	}
+
+	return txnSize(signed)
+}
+
+// Split a signature or public key into the two numbers it is made of
+func splitHalves(data []byte) (*big.Int, *big.Int) {
+	half := len(data) / 2
+	return new(big.Int).SetBytes(data[:half]), new(big.Int).SetBytes(data[half:])
+}
+
 // Create copy of a transaction, but remove the signature and pub key from the input inside the transaction
 func (ts *transactionService) CreateTrimmedTxnCopy(txn reps.Transaction) reps.Transaction {
 	var inputs []reps.TxnInput
 	var outputs []reps.TxnOutput
 
 	for _, in := range txn.Inputs {
-		inputs = append(inputs, reps.TxnInput{in.InputID, in.CurrTxnID, in.PrevTxnID, in.OutIdx, nil, nil})
+		inputs = append(inputs, reps.TxnInput{InputID: in.InputID, CurrTxnID: in.CurrTxnID, PrevTxnID: in.PrevTxnID, OutIdx: in.OutIdx})
 	}
 
 	for _, out := range txn.Outputs {
-		outputs = append(outputs, reps.TxnOutput{out.OutputID, out.CurrTxnID, out.Value, out.PubKeyHash})
+		outputs = append(outputs, reps.TxnOutput{OutputID: out.OutputID, CurrTxnID: out.CurrTxnID, Value: out.Value, PubKeyHash: out.PubKeyHash, ScriptPubKey: out.ScriptPubKey})
 	}
 
 	txnCopy := reps.Transaction{
@@ -551,18 +951,24 @@ func (ts *transactionService) CreateTrimmedTxnCopy(txn reps.Transaction) reps.Tr
 	return txnCopy
 }
 
-// checks that an input uses a specific key to unlock an output.
-// input.PubKey is not hashed, so hash it to compare it with hashed pub key of output
-func (ts *transactionService) UsesKey(input reps.TxnInput, pubKeyHash []byte) bool {
-	lockingHash, err := createPubKeyHash(input.PubKey)
-	if err != nil {
-		log.Warn("error creating pubKeyHash: ", err.Error())
+// Id a transaction gets when it is created: the hash of the transaction before it is signed, and before its inputs
+// and outputs point back at it
+func (ts *transactionService) TxnID(txn reps.Transaction) []byte {
+	txnCopy := ts.CreateTrimmedTxnCopy(txn)
+	txnCopy.Fee = txn.Fee
+
+	for i := range txnCopy.Inputs {
+		txnCopy.Inputs[i].CurrTxnID = nil
+	}
+	for i := range txnCopy.Outputs {
+		txnCopy.Outputs[i].CurrTxnID = nil
 	}
 
-	return bytes.Compare(lockingHash, pubKeyHash) == 0
+	return ts.txnAssembler.HashTransaction(txnCopy)
 }
 
 // Lock an output. When we send coins to someone, we know only their address
+// Addresses starting with ScriptVersion get a P2SH script, the rest P2PKH
 func (ts *transactionService) Lock(output *reps.TxnOutput, address string) {
 	pubKeyHash, err := base58.Decode(address)
 	if err != nil {
@@ -570,30 +976,32 @@ func (ts *transactionService) Lock(output *reps.TxnOutput, address string) {
 	}
 
 	output.PubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4] // remove version and checksum
+	if pubKeyHash[0] == ScriptVersion {
+		output.ScriptPubKey = script.PayToScriptHash(output.PubKeyHash)
+	} else {
+		output.ScriptPubKey = script.PayToPubKeyHash(output.PubKeyHash)
+	}
 
-	log.Infof("Locking output with address: %s with PubKeyHash of: ", address, hex.EncodeToString(output.PubKeyHash))
-}
-
-// checks if provided public key hash was used to lock the output
-func (ts *transactionService) IsLockedWithKey(output reps.TxnOutput, pubKeyHash []byte) bool {
-	return bytes.Equal(output.PubKeyHash, pubKeyHash)
+	log.Infof("Locking output with address: %s with PubKeyHash of: %s", address, hex.EncodeToString(output.PubKeyHash))
 }
 
 func (ts *transactionService) IsCoinbaseTransaction(txn reps.Transaction) bool {
 	return len(txn.Inputs) == 1 && len(txn.Inputs[0].PrevTxnID) == 0 && txn.Inputs[0].OutIdx == -1
 }
 
-func createPubKeyHash(pubKey []byte) ([]byte, error) {
-	pubHash := sha256.Sum256(pubKey)
-
-	ripemdHasher := ripemd160.New()
-	_, err := ripemdHasher.Write(pubHash[:])
-	if err != nil {
-		log.Error(err.Error())
+// Fee of a transaction given what its inputs are worth
+func txnFee(txn reps.Transaction, inputValue int) (int, error) {
+	outputValue := 0
+	for _, output := range txn.Outputs {
+		if output.Value < 0 {
+			return 0, fmt.Errorf("transaction %x has an output with negative value %d", txn.ID, output.Value)
+		}
+		outputValue += output.Value
 	}
 
-	pubKeyHash := ripemdHasher.Sum(nil)
+	if outputValue > inputValue {
+		return 0, fmt.Errorf("transaction %x spends %d but its inputs are only worth %d", txn.ID, outputValue, inputValue)
+	}
 
-	// log.Info(fmt.Sprintf("pubKeyHash: %x\n", pubKeyHash))
-	return pubKeyHash, err
+	return inputValue - outputValue, nil
 }
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/script"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferPaysFeeToMiner(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	alice, miner := n.newWallet(t), n.newWallet(t)
+
+	txn, err := n.mempoolService.AddTransaction(sender, payTo(alice, 10), reps.TransferOptions{Fee: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 3, txn.Fee)
+	fee, err := n.transactionService.CalculateFee(txn)
+	require.NoError(t, err)
+	assert.Equal(t, 3, fee)
+
+	block := n.mine(t, miner)
+	assert.Equal(t, InitialSubsidy+3, block.Transactions[0].Outputs[0].Value, "the coinbase collects the fee")
+	assert.Equal(t, InitialSubsidy-10-3, n.balance(t, sender))
+	assert.Equal(t, InitialSubsidy+3, n.balance(t, miner))
+}
+
+func TestTransferWithFeeRate(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	alice := n.newWallet(t)
+
+	txn, err := n.transactionService.CreateTransaction(sender, payTo(alice, 10), reps.TransferOptions{FeeRate: 0.01})
+	require.NoError(t, err)
+	assert.Equal(t, int(math.Ceil(0.01*float64(txnSize(txn)))), txn.Fee, "the fee covers the signed transaction")
+	assert.Equal(t, InitialSubsidy-10-txn.Fee, txn.Outputs[1].Value)
+}
+
+func TestTransferOptionsAreChecked(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	alice := n.newWallet(t)
+
+	tests := []struct {
+		name    string
+		options reps.TransferOptions
+		reason  string
+	}{
+		{name: "negative fee", options: reps.TransferOptions{Fee: -1}, reason: "cannot be negative"},
+		{name: "negative fee rate", options: reps.TransferOptions{FeeRate: -1}, reason: "cannot be negative"},
+		{name: "fee and fee rate", options: reps.TransferOptions{Fee: 1, FeeRate: 1}, reason: "not both"},
+		{name: "fee more than balance", options: reps.TransferOptions{Fee: InitialSubsidy}, reason: "plus a fee of 50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := n.transactionService.CreateTransaction(sender, payTo(alice, 10), tt.options)
+			assert.ErrorContains(t, err, tt.reason)
+		})
+	}
+}
+
+func TestBatchedPaymentHasOneChangeOutput(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	alice, bob, carol := n.newWallet(t), n.newWallet(t), n.newWallet(t)
+	payments := []reps.Payment{{To: alice, Amount: 5}, {To: bob, Amount: 7}, {To: carol, Amount: 9}}
+
+	block, err := n.blockchainService.AddToBlockChain(context.Background(), sender, payments, reps.TransferOptions{Fee: 2})
+	require.NoError(t, err)
+	txn := block.Transactions[1]
+	require.Len(t, txn.Outputs, 4, "one output per payment and the change")
+	assert.Equal(t, InitialSubsidy-21-2, txn.Outputs[3].Value)
+
+	assert.Equal(t, 5, n.balance(t, alice))
+	assert.Equal(t, 7, n.balance(t, bob))
+	assert.Equal(t, 9, n.balance(t, carol))
+	assert.Equal(t, InitialSubsidy-23+InitialSubsidy+2, n.balance(t, sender))
+}
+
+func TestBatchedPaymentsAreChecked(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	alice, bob := n.newWallet(t), n.newWallet(t)
+
+	tests := []struct {
+		name     string
+		payments []reps.Payment
+		reason   string
+	}{
+		{name: "no payments", payments: nil, reason: "at least one recipient"},
+		{name: "zero amount", payments: []reps.Payment{{To: alice, Amount: 1}, {To: bob, Amount: 0}}, reason: "must be positive"},
+		{name: "negative amount", payments: []reps.Payment{{To: alice, Amount: -1}}, reason: "must be positive"},
+		{name: "duplicate recipient", payments: []reps.Payment{{To: alice, Amount: 1}, {To: alice, Amount: 2}}, reason: "paid more than once"},
+		{name: "more than balance", payments: []reps.Payment{{To: alice, Amount: 30}, {To: bob, Amount: 30}}, reason: "only worth 50, not 60"},
+		{name: "overflow", payments: []reps.Payment{{To: alice, Amount: math.MaxInt}, {To: bob, Amount: 1}}, reason: "add up to more than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := n.transactionService.CreateTransaction(sender, tt.payments, reps.TransferOptions{})
+			assert.ErrorContains(t, err, tt.reason)
+		})
+	}
+}
+
+func TestVerifyTransactionRunsScripts(t *testing.T) {
+	n := newTestNode(t)
+	sender := n.newChain(t)
+	alice := n.newWallet(t)
+
+	txn, err := n.transactionService.CreateTransaction(sender, payTo(alice, 10), reps.TransferOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, script.PayToPubKeyHash(addressHash(alice)), txn.Outputs[0].ScriptPubKey)
+	verified, err := n.transactionService.VerifyTransaction(txn)
+	require.NoError(t, err)
+	assert.True(t, verified)
+
+	// The signature commits to the outputs
+	tampered := txn
+	tampered.Outputs = append([]reps.TxnOutput{}, txn.Outputs...)
+	tampered.Outputs[0].Value++
+	verified, _ = n.transactionService.VerifyTransaction(tampered)
+	assert.False(t, verified)
+
+	// Someone else's key can't unlock the input
+	wallet, err := n.walletService.GetWallet(alice)
+	require.NoError(t, err)
+	pubKey, err := hex.DecodeString(wallet.PublicKey)
+	require.NoError(t, err)
+	stolen := txn
+	stolen.Inputs = append([]reps.TxnInput{}, txn.Inputs...)
+	stolen.Inputs[0].ScriptSig = script.SignatureScript([]byte("signature"), pubKey)
+	verified, _ = n.transactionService.VerifyTransaction(stolen)
+	assert.False(t, verified)
+}
+
+// An HD wallet, locked, with a funded receive address
+func newFundedHDAddress(t *testing.T, n *testNode, miner string, amount int) (reps.ReadableHDWallet, reps.HDAddress) {
+	t.Helper()
+
+	hdWallet, err := n.hdWalletService.CreateHDWallet(testPassphrase)
+	require.NoError(t, err)
+	address, err := n.hdWalletService.DeriveAddress(hdWallet.ID, false)
+	require.NoError(t, err)
+	n.send(t, miner, address.Address, amount)
+
+	return hdWallet, address
+}
+
+func TestHDChangeGoesToChangeAddress(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	hdWallet, address := newFundedHDAddress(t, n, miner, 10)
+	_, err := n.walletService.UnlockWallet(hdWallet.ID, testPassphrase, time.Hour)
+	require.NoError(t, err)
+
+	txn, err := n.mempoolService.AddTransaction(address.Address, payTo(miner, 4), reps.TransferOptions{})
+	require.NoError(t, err)
+	n.mine(t, miner)
+
+	got, err := n.hdWalletService.GetHDWallet(hdWallet.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Addresses, 2)
+	change := got.Addresses[1]
+	assert.Equal(t, "m/44'/0'/0'/1/0", change.Path)
+	assert.Equal(t, 6, change.Balance)
+	assert.Equal(t, addressHash(change.Address), txn.Outputs[1].PubKeyHash)
+	assert.Equal(t, 0, n.balance(t, address.Address))
+
+	groupBalance, err := n.transactionService.GetGroupBalance(address.Address)
+	require.NoError(t, err)
+	assert.Equal(t, 6, groupBalance)
+
+	// Change 0 has been paid to, the next transfer gets change 1
+	_, err = n.mempoolService.AddTransaction(change.Address, payTo(miner, 1), reps.TransferOptions{})
+	require.NoError(t, err)
+	next, err := n.hdWalletService.GetHDWallet(hdWallet.ID)
+	require.NoError(t, err)
+	require.Len(t, next.Addresses, 3)
+	assert.Equal(t, "m/44'/0'/0'/1/1", next.Addresses[2].Path)
+}
+
+func TestFailedHDTransferKeepsChangeAddress(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	hdWallet, address := newFundedHDAddress(t, n, miner, 10)
+
+	// Locked, so the transfer fails after the change address is picked
+	_, err := n.blockchainService.AddToBlockChain(context.Background(), address.Address, payTo(miner, 4), reps.TransferOptions{})
+	assert.ErrorIs(t, err, ErrWalletLocked)
+	_, err = n.blockchainService.AddToBlockChain(context.Background(), address.Address, payTo(miner, 4), reps.TransferOptions{})
+	assert.ErrorIs(t, err, ErrWalletLocked)
+
+	_, err = n.walletService.UnlockWallet(hdWallet.ID, testPassphrase, time.Hour)
+	require.NoError(t, err)
+	n.send(t, address.Address, miner, 4)
+
+	got, err := n.hdWalletService.GetHDWallet(hdWallet.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Addresses, 2)
+	assert.Equal(t, "m/44'/0'/0'/1/0", got.Addresses[1].Path)
+	assert.Equal(t, 6, got.Addresses[1].Balance)
+}
+
+func TestPendingHDTransfersGetDifferentChangeAddresses(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	hdWallet, first := newFundedHDAddress(t, n, miner, 10)
+	second, err := n.hdWalletService.DeriveAddress(hdWallet.ID, false)
+	require.NoError(t, err)
+	n.send(t, miner, second.Address, 10)
+	_, err = n.walletService.UnlockWallet(hdWallet.ID, testPassphrase, time.Hour)
+	require.NoError(t, err)
+
+	// Neither transfer is mined, the first change address is only paid by a pending transaction
+	firstTxn, err := n.mempoolService.AddTransaction(first.Address, payTo(miner, 4), reps.TransferOptions{})
+	require.NoError(t, err)
+	secondTxn, err := n.mempoolService.AddTransaction(second.Address, payTo(miner, 4), reps.TransferOptions{})
+	require.NoError(t, err)
+	require.Len(t, firstTxn.Outputs, 2)
+	require.Len(t, secondTxn.Outputs, 2)
+	assert.NotEqual(t, firstTxn.Outputs[1].PubKeyHash, secondTxn.Outputs[1].PubKeyHash)
+
+	n.mine(t, miner)
+	got, err := n.hdWalletService.GetHDWallet(hdWallet.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Addresses, 4)
+	assert.Equal(t, "m/44'/0'/0'/1/0", got.Addresses[2].Path)
+	assert.Equal(t, 6, got.Addresses[2].Balance)
+	assert.Equal(t, "m/44'/0'/0'/1/1", got.Addresses[3].Path)
+	assert.Equal(t, 6, got.Addresses[3].Balance)
+}
+
+func TestHDTransferWithoutChangeDerivesNothing(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	hdWallet, address := newFundedHDAddress(t, n, miner, 10)
+	_, err := n.walletService.UnlockWallet(hdWallet.ID, testPassphrase, time.Hour)
+	require.NoError(t, err)
+
+	txn, err := n.transactionService.CreateTransaction(address.Address, payTo(miner, 10), reps.TransferOptions{})
+	require.NoError(t, err)
+	assert.Len(t, txn.Outputs, 1)
+
+	// Rebuilding for a fee rate settles on one change address
+	txn, err = n.transactionService.CreateTransaction(address.Address, payTo(miner, 1), reps.TransferOptions{FeeRate: 0.001})
+	require.NoError(t, err)
+	require.Len(t, txn.Outputs, 2)
+	assert.Positive(t, txn.Fee)
+
+	got, err := n.hdWalletService.GetHDWallet(hdWallet.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Addresses, 2)
+	assert.Equal(t, addressHash(got.Addresses[1].Address), txn.Outputs[1].PubKeyHash)
+}
+
+func TestBalancesHaveGroupBalance(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	empty := n.newWallet(t)
+	hdWallet, address := newFundedHDAddress(t, n, miner, 10)
+	other, err := n.hdWalletService.DeriveAddress(hdWallet.ID, true)
+	require.NoError(t, err)
+
+	balances, err := n.transactionService.GetBalances()
+	require.NoError(t, err)
+	byAddress := make(map[string]reps.AddressBalance)
+	for _, balance := range balances {
+		byAddress[balance.Address] = balance
+	}
+
+	assert.Equal(t, n.balance(t, miner), byAddress[miner].GroupBalance)
+	assert.Equal(t, 10, byAddress[address.Address].GroupBalance)
+	assert.Equal(t, 0, byAddress[other.Address].Balance)
+	assert.Equal(t, 10, byAddress[other.Address].GroupBalance)
+	assert.Equal(t, hdWallet.ID, byAddress[other.Address].HDWalletID)
+
+	// A group balance of 0 is still there
+	encoded, err := json.Marshal(byAddress[empty])
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"groupBalance":0`)
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type UTXOService interface {
+	CreateUTXOUpdate(txns []reps.Transaction) reps.UTXOUpdate
+	Reindex() (int, error)
+}
+
+type utxoService struct {
+	blockchainRepo repository.BlockchainRepository
+}
+
+func NewUTXOService(blockchainRepo repository.BlockchainRepository) UTXOService {
+	return &utxoService{
+		blockchainRepo: blockchainRepo,
+	}
+}
+
+// Work out which outputs the transactions of a block spend and which ones they create
+func (us *utxoService) CreateUTXOUpdate(txns []reps.Transaction) reps.UTXOUpdate {
+	spent := make([]reps.UTXO, 0)
+	created := make(map[string]reps.UTXO)
+	createdOrder := make([]string, 0)
+
+	for _, txn := range txns {
+		for _, input := range txn.Inputs {
+			// Coinbase inputs don't reference an output
+			if input.OutIdx < 0 || len(input.PrevTxnID) == 0 {
+				continue
+			}
+
+			utxoId := outpointKey(input.PrevTxnID, input.OutIdx)
+
+			// Output created earlier in this same block, so it never makes it into the utxo set
+			if _, ok := created[utxoId]; ok {
+				delete(created, utxoId)
+				continue
+			}
+
+			spent = append(spent, reps.UTXO{ID: utxoId, TxnID: input.PrevTxnID, OutIdx: input.OutIdx})
+		}
+
+		for outIdx, output := range txn.Outputs {
+			utxoId := outpointKey(txn.ID, outIdx)
+			created[utxoId] = reps.UTXO{
+				ID:         utxoId,
+				TxnID:      txn.ID,
+				OutIdx:     outIdx,
+				Value:      output.Value,
+				PubKeyHash: output.PubKeyHash,
+				BlockID:    txn.BlockID,
+			}
+			createdOrder = append(createdOrder, utxoId)
+		}
+	}
+
+	utxoUpdate := reps.UTXOUpdate{Spent: spent, Created: make([]reps.UTXO, 0)}
+	for _, utxoId := range createdOrder {
+		if utxo, ok := created[utxoId]; ok {
+			utxoUpdate.Created = append(utxoUpdate.Created, utxo)
+		}
+	}
+
+	return utxoUpdate
+}
+
+// Rebuild the utxo set by replaying every block from genesis onwards. Returns the number of unspent outputs
+func (us *utxoService) Reindex() (int, error) {
+	log.Info("Reindexing utxo set...")
+	blocks, err := us.blockchainRepo.GetBlockchain()
+	if err != nil {
+		return 0, err
+	}
+
+	// Replay genesis first
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Height < blocks[j].Height
+	})
+
+	utxos := make(map[string]reps.UTXO)
+	utxoOrder := make([]string, 0)
+
+	for _, block := range blocks {
+		utxoUpdate := us.CreateUTXOUpdate(block.Transactions)
+
+		for _, utxo := range utxoUpdate.Spent {
+			delete(utxos, utxo.ID)
+		}
+
+		for _, utxo := range utxoUpdate.Created {
+			utxos[utxo.ID] = utxo
+			utxoOrder = append(utxoOrder, utxo.ID)
+		}
+	}
+
+	unspent := make([]reps.UTXO, 0, len(utxos))
+	for _, utxoId := range utxoOrder {
+		if utxo, ok := utxos[utxoId]; ok {
+			unspent = append(unspent, utxo)
+		}
+	}
+
+	if err := us.blockchainRepo.ReplaceUTXOs(unspent); err != nil {
+		return 0, err
+	}
+
+	log.Infof("Reindexed utxo set from %d blocks", len(blocks))
+	return len(unspent), nil
+}
+
+// A transaction that can't be connected, which makes the block it is in invalid
+type invalidTxnError struct {
+	txnId []byte
+	err   error
+}
+
+func (e *invalidTxnError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidTxnError) Unwrap() error {
+	return e.err
+}
+
+// In memory view of the utxo set used while connecting and disconnecting blocks during a reorg.
+// Nothing is written until the whole branch checks out, then update() gives the changes to persist
+// added -> Outputs created on top of the stored utxo set
+// removed -> Stored outputs that have been spent or disconnected
+type utxoView struct {
+	blockchainRepo repository.BlockchainRepository
+	added          map[string]reps.UTXO
+	removed        map[string]bool
+}
+
+func newUTXOView(blockchainRepo repository.BlockchainRepository) *utxoView {
+	return &utxoView{
+		blockchainRepo: blockchainRepo,
+		added:          make(map[string]reps.UTXO),
+		removed:        make(map[string]bool),
+	}
+}
+
+// Look up an unspent output, taking changes made in the view into account
+func (v *utxoView) get(txnId []byte, outIdx int) (reps.UTXO, bool) {
+	utxoId := outpointKey(txnId, outIdx)
+	if utxo, ok := v.added[utxoId]; ok {
+		return utxo, true
+	}
+	if v.removed[utxoId] {
+		return reps.UTXO{}, false
+	}
+
+	utxo, err := v.blockchainRepo.GetUTXO(txnId, outIdx)
+	if err != nil {
+		return reps.UTXO{}, false
+	}
+
+	return utxo, true
+}
+
+func (v *utxoView) add(utxo reps.UTXO) {
+	v.added[utxo.ID] = utxo
+}
+
+func (v *utxoView) spend(utxoId string) {
+	if _, ok := v.added[utxoId]; ok {
+		delete(v.added, utxoId)
+		return
+	}
+	v.removed[utxoId] = true
+}
+
+// Apply a block on top of the view. Fails if a transaction spends an output that doesn't exist or is already spent,
+// or its fee doesn't add up. ValidateBlock has already checked each input's script unlocks the output it spends
+func (v *utxoView) connectBlock(block reps.Block) error {
+	for txnIdx, txn := range block.Transactions {
+		isCoinbase := len(txn.Inputs) == 1 && len(txn.Inputs[0].PrevTxnID) == 0 && txn.Inputs[0].OutIdx == -1
+		if isCoinbase != (txnIdx == 0) {
+			return fmt.Errorf("block %s must have exactly one coinbase transaction, as its first transaction", block.ID)
+		}
+
+		if !isCoinbase {
+			inputValue := 0
+			for _, input := range txn.Inputs {
+				utxo, ok := v.get(input.PrevTxnID, input.OutIdx)
+				if !ok {
+					return &invalidTxnError{txnId: txn.ID, err: fmt.Errorf("transaction %x spends output %d of %x which is missing or already spent", txn.ID, input.OutIdx, input.PrevTxnID)}
+				}
+
+				v.spend(utxo.ID)
+				inputValue += utxo.Value
+			}
+
+			// The fee a transaction declares has to be exactly what it leaves for the miner
+			fee, err := txnFee(txn, inputValue)
+			if err != nil {
+				return &invalidTxnError{txnId: txn.ID, err: err}
+			}
+			if fee != txn.Fee {
+				return &invalidTxnError{txnId: txn.ID, err: fmt.Errorf("transaction %x says it pays a fee of %d but pays %d", txn.ID, txn.Fee, fee)}
+			}
+		}
+
+		for outIdx, output := range txn.Outputs {
+			v.add(reps.UTXO{
+				ID:         outpointKey(txn.ID, outIdx),
+				TxnID:      txn.ID,
+				OutIdx:     outIdx,
+				Value:      output.Value,
+				PubKeyHash: output.PubKeyHash,
+				BlockID:    block.ID,
+			})
+		}
+	}
+
+	return nil
+}
+
+// Undo a block: drop the outputs it created and give back the outputs it spent
+func (v *utxoView) disconnectBlock(block reps.Block) error {
+	for txnIdx := len(block.Transactions) - 1; txnIdx >= 0; txnIdx-- {
+		txn := block.Transactions[txnIdx]
+
+		for outIdx := range txn.Outputs {
+			v.spend(outpointKey(txn.ID, outIdx))
+		}
+
+		for _, input := range txn.Inputs {
+			if input.OutIdx < 0 || len(input.PrevTxnID) == 0 {
+				continue
+			}
+
+			prevTxn, err := v.blockchainRepo.GetTransaction(input.PrevTxnID)
+			if err != nil {
+				return fmt.Errorf("%s, cannot restore output %d of %x", err.Error(), input.OutIdx, input.PrevTxnID)
+			}
+			if input.OutIdx >= len(prevTxn.Outputs) {
+				return fmt.Errorf("cannot restore output %d of %x, it only has %d outputs", input.OutIdx, input.PrevTxnID, len(prevTxn.Outputs))
+			}
+
+			output := prevTxn.Outputs[input.OutIdx]
+			v.add(reps.UTXO{
+				ID:         outpointKey(prevTxn.ID, input.OutIdx),
+				TxnID:      prevTxn.ID,
+				OutIdx:     input.OutIdx,
+				Value:      output.Value,
+				PubKeyHash: output.PubKeyHash,
+				BlockID:    prevTxn.BlockID,
+			})
+		}
+	}
+
+	return nil
+}
+
+// Changes to write to the stored utxo set. Removals are applied before additions
+func (v *utxoView) update() reps.UTXOUpdate {
+	utxoUpdate := reps.UTXOUpdate{Spent: make([]reps.UTXO, 0), Created: make([]reps.UTXO, 0)}
+
+	for utxoId := range v.removed {
+		utxoUpdate.Spent = append(utxoUpdate.Spent, reps.UTXO{ID: utxoId})
+	}
+	for _, utxo := range v.added {
+		utxoUpdate.Created = append(utxoUpdate.Created, utxo)
+	}
+
+	sort.Slice(utxoUpdate.Spent, func(i, j int) bool {
+		return utxoUpdate.Spent[i].ID < utxoUpdate.Spent[j].ID
+	})
+	sort.Slice(utxoUpdate.Created, func(i, j int) bool {
+		return utxoUpdate.Created[i].ID < utxoUpdate.Created[j].ID
+	})
+
+	return utxoUpdate
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"testing"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUTXOSetFollowsBlocks(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice := n.newWallet(t)
+
+	genesis, err := n.blockchainService.GetGenesisBlock()
+	require.NoError(t, err)
+	coinbase := genesis.Transactions[0]
+	_, err = n.repo.GetUTXO(coinbase.ID, 0)
+	require.NoError(t, err)
+
+	n.send(t, miner, alice, 20)
+
+	_, err = n.repo.GetUTXO(coinbase.ID, 0)
+	assert.Error(t, err, "genesis coinbase is spent")
+	utxos, err := n.repo.GetUTXOs(addressHash(alice))
+	require.NoError(t, err)
+	require.Len(t, utxos, 1)
+	assert.Equal(t, 20, utxos[0].Value)
+	assert.Equal(t, 2*InitialSubsidy-20, n.balance(t, miner), "change and the second coinbase")
+
+	before, err := n.repo.GetUTXOBalances()
+	require.NoError(t, err)
+	count, err := NewUTXOService(n.repo).Reindex()
+	require.NoError(t, err)
+	assert.Equal(t, 3, count, "alice's output, the change and the coinbase of the second block")
+	after, err := n.repo.GetUTXOBalances()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, before, after)
+}
+
+func TestCreateUTXOUpdateSkipsOutputsSpentInTheSameBlock(t *testing.T) {
+	first := reps.Transaction{
+		ID:      []byte{1},
+		Inputs:  []reps.TxnInput{{PrevTxnID: []byte{9}, OutIdx: 0}},
+		Outputs: []reps.TxnOutput{{Value: 5}, {Value: 3}},
+	}
+	second := reps.Transaction{
+		ID:      []byte{2},
+		Inputs:  []reps.TxnInput{{PrevTxnID: []byte{1}, OutIdx: 1}},
+		Outputs: []reps.TxnOutput{{Value: 3}},
+	}
+
+	update := NewUTXOService(nil).CreateUTXOUpdate([]reps.Transaction{first, second})
+
+	require.Len(t, update.Spent, 1)
+	assert.Equal(t, outpointKey([]byte{9}, 0), update.Spent[0].ID)
+	created := make([]string, 0)
+	for _, utxo := range update.Created {
+		created = append(created, utxo.ID)
+	}
+	assert.Equal(t, []string{outpointKey([]byte{1}, 0), outpointKey([]byte{2}, 0)}, created)
+}
+
+func TestUTXOViewDisconnectsAndReconnectsBlock(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice := n.newWallet(t)
+	block := n.send(t, miner, alice, 20)
+	spending := block.Transactions[1]
+
+	view := newUTXOView(n.repo)
+	require.NoError(t, view.disconnectBlock(block))
+
+	_, ok := view.get(spending.ID, 0)
+	assert.False(t, ok, "outputs of a disconnected block are gone")
+	restored, ok := view.get(spending.Inputs[0].PrevTxnID, spending.Inputs[0].OutIdx)
+	require.True(t, ok, "outputs it spent are back")
+	assert.Equal(t, InitialSubsidy, restored.Value)
+
+	// Nothing is written until the update is applied
+	_, err := n.repo.GetUTXO(spending.ID, 0)
+	assert.NoError(t, err)
+
+	require.NoError(t, view.connectBlock(block))
+	_, ok = view.get(spending.ID, 0)
+	assert.True(t, ok)
+	assert.Error(t, view.connectBlock(block), "its inputs are spent now")
+}
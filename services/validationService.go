@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"github.com/brucetieu/blockchain/repository"
+	reps "github.com/brucetieu/blockchain/representations"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ValidationService interface {
+	ValidateBlockchain() (reps.ChainValidationReport, error)
+	ValidateBlock(block reps.Block, prevBlock *reps.Block) error
+}
+
+type validationService struct {
+	blockchainRepo     repository.BlockchainRepository
+	transactionService TransactionService
+	difficultyService  DifficultyService
+	txnAssembler       TxnAssemblerFac
+}
+
+func NewValidationService(blockchainRepo repository.BlockchainRepository, transactionService TransactionService,
+	difficultyService DifficultyService,
+) ValidationService {
+	return &validationService{
+		blockchainRepo:     blockchainRepo,
+		transactionService: transactionService,
+		difficultyService:  difficultyService,
+		txnAssembler:       TxnAssembler,
+	}
+}
+
+// Walk the blockchain from genesis to the last block and validate every block along the way
+func (vs *validationService) ValidateBlockchain() (reps.ChainValidationReport, error) {
+	log.Info("Validating blockchain...")
+	blocks, err := vs.blockchainRepo.GetBlockchain()
+	if err != nil {
+		return reps.ChainValidationReport{}, err
+	}
+
+	// Walk from genesis to the last block
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Height < blocks[j].Height
+	})
+
+	report := reps.ChainValidationReport{
+		Valid:  true,
+		Blocks: make([]reps.BlockValidation, 0, len(blocks)),
+	}
+
+	var prevBlock *reps.Block
+	for i := range blocks {
+		blockValidation := reps.BlockValidation{
+			BlockID: blocks[i].ID,
+			Hash:    hex.EncodeToString(blocks[i].Hash),
+			Valid:   true,
+		}
+
+		if err := vs.ValidateBlock(blocks[i], prevBlock); err != nil {
+			blockValidation.Valid = false
+			blockValidation.Reason = err.Error()
+
+			// Only the first broken block is reported at the top level
+			if report.Valid {
+				report.Valid = false
+				report.FirstInvalidBlock = blocks[i].ID
+				report.Reason = err.Error()
+			}
+		}
+
+		report.Blocks = append(report.Blocks, blockValidation)
+		prevBlock = &blocks[i]
+	}
+
+	report.BlocksChecked = len(report.Blocks)
+
+	if report.Valid {
+		log.Infof("Blockchain is valid, checked %d blocks", report.BlocksChecked)
+	} else {
+		log.WithFields(log.Fields{"blockId": report.FirstInvalidBlock, "reason": report.Reason}).Error("Blockchain is invalid")
+	}
+
+	return report, nil
+}
+
+// Validate a single block. prevBlock is the block it should build on, nil for the genesis block
+func (vs *validationService) ValidateBlock(block reps.Block, prevBlock *reps.Block) error {
+	// Check the block links to the one before it
+	if prevBlock == nil {
+		if len(block.PrevHash) != 0 {
+			return fmt.Errorf("first block has prevHash %x, expected a genesis block", block.PrevHash)
+		}
+		if block.Height != 0 {
+			return fmt.Errorf("genesis block has height %d, expected 0", block.Height)
+		}
+	} else {
+		if !bytes.Equal(block.PrevHash, prevBlock.Hash) {
+			return fmt.Errorf("prevHash %x does not match hash %x of previous block %s", block.PrevHash, prevBlock.Hash, prevBlock.ID)
+		}
+		if block.Height != prevBlock.Height+1 {
+			return fmt.Errorf("height %d does not follow height %d of previous block %s", block.Height, prevBlock.Height, prevBlock.ID)
+		}
+	}
+
+	// Check the block was mined at the difficulty its branch requires
+	expectedBits, err := vs.difficultyService.NextBits(prevBlock)
+	if err != nil {
+		return err
+	}
+	if block.Bits == 0 {
+		// Blocks mined before difficulty was stored can only follow other such blocks
+		if prevBlock != nil && prevBlock.Bits != 0 {
+			return fmt.Errorf("block has no difficulty bits but previous block %s does", prevBlock.ID)
+		}
+	} else if block.Bits != expectedBits {
+		return fmt.Errorf("bits %08x do not match expected difficulty bits %08x", block.Bits, expectedBits)
+	}
+
+	// Check the block isn't bigger than a miner is allowed to make it
+	blockSize := 0
+	for _, txn := range block.Transactions {
+		blockSize += txnSize(txn)
+	}
+	if blockSize > MaxBlockSize {
+		return fmt.Errorf("block holds %d bytes of transactions, more than the maximum of %d", blockSize, MaxBlockSize)
+	}
+
+	// Check the merkle root commits to the transactions in the block
+	merkleRoot := vs.txnAssembler.HashTransactions(block.Transactions)
+	if len(block.MerkleRoot) != 0 && !bytes.Equal(block.MerkleRoot, merkleRoot) {
+		return fmt.Errorf("merkle root %x does not match transactions, expected %x", block.MerkleRoot, merkleRoot)
+	}
+
+	// Re-run proof of work
+	proof := NewProofOfWorkService(&block)
+	if !bytes.Equal(proof.HashData(), block.Hash) {
+		if !vs.matchesLegacyHash(block) {
+			return fmt.Errorf("hash %x does not match block contents", block.Hash)
+		}
+	} else if !proof.ValidateProof() {
+		return fmt.Errorf("hash %x does not meet the proof of work target", block.Hash)
+	}
+
+	// Check the coinbase doesn't create more coins than the subsidy plus the fees of the block. connectBlock checks
+	// each fee matches what the transaction really leaves over
+	if err := vs.validateCoinbase(block); err != nil {
+		return err
+	}
+
+	// Re-verify the signature of every non coinbase transaction
+	for _, txn := range block.Transactions {
+		if vs.transactionService.IsCoinbaseTransaction(txn) {
+			continue
+		}
+
+		verified, err := vs.transactionService.VerifyTransaction(txn)
+		if !verified {
+			return fmt.Errorf("transaction %x has an invalid signature: %v", txn.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (vs *validationService) validateCoinbase(block reps.Block) error {
+	if len(block.Transactions) == 0 || !vs.transactionService.IsCoinbaseTransaction(block.Transactions[0]) {
+		return fmt.Errorf("block has no coinbase transaction")
+	}
+
+	fees := 0
+	for _, txn := range block.Transactions[1:] {
+		if txn.Fee < 0 {
+			return fmt.Errorf("transaction %x has a negative fee %d", txn.ID, txn.Fee)
+		}
+		fees += txn.Fee
+	}
+
+	claimed := 0
+	for _, output := range block.Transactions[0].Outputs {
+		if output.Value < 0 {
+			return fmt.Errorf("coinbase has an output with negative value %d", output.Value)
+		}
+		claimed += output.Value
+	}
+
+	subsidy := BlockSubsidy(block.Height)
+	if claimed > subsidy+fees {
+		return fmt.Errorf("coinbase claims %d, more than the subsidy of %d plus %d in fees", claimed, subsidy, fees)
+	}
+
+	return nil
+}
+
+// Blocks mined before coinbase inputs and outputs carried their transaction id were hashed without it
+func (vs *validationService) matchesLegacyHash(block reps.Block) bool {
+	legacyTxns := make([]reps.Transaction, len(block.Transactions))
+	for i, txn := range block.Transactions {
+		legacyTxns[i] = txn
+		if !vs.transactionService.IsCoinbaseTransaction(txn) {
+			continue
+		}
+
+		legacyTxns[i].Inputs = make([]reps.TxnInput, len(txn.Inputs))
+		for j, input := range txn.Inputs {
+			input.CurrTxnID = nil
+			legacyTxns[i].Inputs[j] = input
+		}
+
+		legacyTxns[i].Outputs = make([]reps.TxnOutput, len(txn.Outputs))
+		for j, output := range txn.Outputs {
+			output.CurrTxnID = nil
+			legacyTxns[i].Outputs[j] = output
+		}
+	}
+
+	legacyBlock := block
+	legacyBlock.Transactions = legacyTxns
+	proof := NewProofOfWorkService(&legacyBlock)
+
+	return bytes.Equal(proof.HashData(), block.Hash) && proof.ValidateProof()
+}
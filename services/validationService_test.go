@@ -0,0 +1,87 @@
+package services
+
+import (
+	"testing"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBlockchainAcceptsMinedChain(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	n.send(t, miner, n.newWallet(t), 20)
+
+	report, err := n.validationService.ValidateBlockchain()
+	require.NoError(t, err)
+	assert.True(t, report.Valid, report.Reason)
+	assert.Equal(t, 2, report.BlocksChecked)
+	assert.Empty(t, report.FirstInvalidBlock)
+}
+
+func TestValidateBlockRejectsTamperedBlocks(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	n.send(t, miner, n.newWallet(t), 20)
+
+	blocks, err := n.blockchainService.GetBlockchain()
+	require.NoError(t, err)
+	require.Len(t, blocks, 2)
+	block, genesis := blocks[0], blocks[1]
+	require.NoError(t, n.validationService.ValidateBlock(block, &genesis))
+
+	tests := []struct {
+		name   string
+		tamper func(block *reps.Block)
+		reason string
+	}{
+		{
+			name: "output value",
+			tamper: func(block *reps.Block) {
+				txn := block.Transactions[1]
+				txn.Outputs = append([]reps.TxnOutput(nil), txn.Outputs...)
+				txn.Outputs[0].Value++
+				block.Transactions = []reps.Transaction{block.Transactions[0], txn}
+			},
+			reason: "merkle root",
+		},
+		{
+			name:   "prevHash",
+			tamper: func(block *reps.Block) { block.PrevHash = block.Hash },
+			reason: "does not match hash",
+		},
+		{
+			name:   "height",
+			tamper: func(block *reps.Block) { block.Height++ },
+			reason: "does not follow height",
+		},
+		{
+			name:   "nonce",
+			tamper: func(block *reps.Block) { block.Nounce++ },
+			reason: "does not match block contents",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := block
+			tt.tamper(&tampered)
+			assert.ErrorContains(t, n.validationService.ValidateBlock(tampered, &genesis), tt.reason)
+		})
+	}
+}
+
+func TestValidateBlockRejectsCoinbaseClaimingTooMuch(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+
+	tip, err := n.blockchainService.GetLastBlock()
+	require.NoError(t, err)
+	coinbase := n.transactionService.CreateCoinbaseTxn(miner, "", tip.Height+1, 1)
+
+	vs := n.validationService.(*validationService)
+	block := reps.Block{Height: tip.Height + 1, Transactions: []reps.Transaction{coinbase}}
+	assert.ErrorContains(t, vs.validateCoinbase(block), "more than the subsidy")
+	assert.ErrorContains(t, vs.validateCoinbase(reps.Block{}), "no coinbase")
+}
@@ -7,10 +7,15 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/brucetieu/blockchain/hd"
+	"github.com/brucetieu/blockchain/keycrypt"
 	"github.com/brucetieu/blockchain/repository"
 	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/brucetieu/blockchain/script"
 	// "github.com/brucetieu/blockchain/utils"
 	"golang.org/x/crypto/ripemd160"
 
@@ -20,34 +25,72 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// Version -> First byte of addresses paying to a public key hash
+// ScriptVersion -> First byte of addresses paying to a script hash, e.g. multisig wallets
 var (
-	ChecksumLen = 4
-	Version     = byte(0)
+	ChecksumLen   = 4
+	Version       = byte(0)
+	ScriptVersion = byte(5)
+)
+
+// Bytes in the public key hash or script hash an address pays to
+const hashLen = 20
+
+// DefaultUnlockTimeout -> How long a wallet stays unlocked if no timeout is given
+// MaxUnlockTimeout -> Longest a wallet can be unlocked for in one go
+// MinPassphraseLen -> Shortest passphrase a key can be encrypted under
+const (
+	DefaultUnlockTimeout = 5 * time.Minute
+	MaxUnlockTimeout     = time.Hour
+	MinPassphraseLen     = 8
+)
+
+var (
+	ErrWalletLocked    = errors.New("wallet is locked, unlock it with its passphrase first")
+	ErrWrongPassphrase = keycrypt.ErrWrongPassphrase
+	ErrWalletRetired   = errors.New("wallet is retired, its key may have leaked")
 )
 
 type WalletService interface {
-	CreateWallet() (reps.Wallet, error)
+	CreateWallet(passphrase string) (reps.Wallet, error)
+	CreateScriptWallet(redeemScript []byte) (reps.Wallet, error)
+	CreateDerivedWallet(pubKey []byte, hdWalletId string, derivationPath string) (reps.Wallet, error)
+	ImportWatchOnlyWallet(address string, publicKey string) (reps.Wallet, error)
 	GetWallet(address string) (reps.Wallet, error)
 	// GetWalletGorm(address string) (reps.WalletGorm, error)
 	GetWallets() ([]reps.Wallet, error)
 
+	UnlockWallet(id string, passphrase string, timeout time.Duration) (time.Time, error)
+	LockWallet(id string) error
+	GetPrivateKey(address string) (ecdsa.PrivateKey, error)
+	ChangePassphrase(id string, passphrase string, newPassphrase string) error
+	EncryptStoredKeys(passphrase string) (int, error)
+
+	ExportPrivateKey(address string, passphrase string, format string) (string, error)
+	ImportPrivateKey(key string, format string, passphrase string) (reps.Wallet, error)
+	RetireWallet(address string, sweptTo string) error
+
 	CreateKeyPair() (ecdsa.PrivateKey, []byte)
 	CreatePubKeyHash(pubKey []byte) ([]byte, error)
 	CreateChecksum(pubKeyHash []byte) []byte
 	CreateAddress(pubKey []byte) ([]byte, error)
+	CreateScriptAddress(redeemScript []byte) []byte
 
-	ValidateAddress(address string) (bool, error)
+	ValidateAddress(address string) (reps.AddressValidation, error)
 }
 
+// keyring -> Keys and seeds of the wallets that are unlocked
 type walletService struct {
 	blockchainRepo repository.BlockchainRepository
 	walletAssember WalletAssemblerFac
+	keyring        *keyring
 }
 
 func NewWalletService(blockchainRepo repository.BlockchainRepository) WalletService {
 	return &walletService{
 		blockchainRepo: blockchainRepo,
 		walletAssember: WalletAssembler,
+		keyring:        newKeyring(),
 	}
 }
 
@@ -55,8 +98,12 @@ func (ws *walletService) CreateKeyPair() (ecdsa.PrivateKey, []byte) {
 	curve := elliptic.P256()
 	privKey, _ := ecdsa.GenerateKey(curve, rand.Reader)
 
-	// Public key is a combination of x and y coordinates on elliptic curve
-	pubKey := append(privKey.X.Bytes(), privKey.Y.Bytes()...)
+	// Public key is a combination of x and y coordinates on elliptic curve, each padded to the size of the curve
+	// so the key can be split in half again
+	size := (curve.Params().BitSize + 7) / 8
+	pubKey := make([]byte, 2*size)
+	privKey.X.FillBytes(pubKey[:size])
+	privKey.Y.FillBytes(pubKey[size:])
 
 	// log.Info(fmt.Sprintf("pubKey: %x\n", pubKey))
 	return *privKey, pubKey
@@ -73,7 +120,12 @@ func (ws *walletService) GetWallet(address string) (reps.Wallet, error) {
 	return wallet, nil
 }
 
-func (ws *walletService) CreateWallet() (reps.Wallet, error) {
+// Create a wallet with a new key pair. The private key is only saved encrypted under passphrase
+func (ws *walletService) CreateWallet(passphrase string) (reps.Wallet, error) {
+	if err := checkPassphrase(passphrase); err != nil {
+		return reps.Wallet{}, err
+	}
+
 	privKey, pubKey := ws.CreateKeyPair()
 
 	walletAddress, err := ws.CreateAddress(pubKey)
@@ -84,7 +136,19 @@ func (ws *walletService) CreateWallet() (reps.Wallet, error) {
 	log.Info("wallet address: ", string(walletAddress))
 
 	privKeyBytes := ws.walletAssember.ToPrivateKeyBytes(privKey)
-	wallet := reps.Wallet{uuid.Must(uuid.NewRandom()).String(), string(walletAddress), privKeyBytes, hex.EncodeToString(pubKey)}
+	encryptedKey, err := keycrypt.Encrypt(privKeyBytes, passphrase)
+	wipe(privKeyBytes)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+
+	wallet := reps.Wallet{
+		ID:           uuid.Must(uuid.NewRandom()).String(),
+		Address:      string(walletAddress),
+		PrivateKey:   encryptedKey,
+		KeyEncrypted: true,
+		PublicKey:    hex.EncodeToString(pubKey),
+	}
 
 	// utils.PrettyPrintln("wallet: ", wallet)
 	// Persist
@@ -96,6 +160,111 @@ func (ws *walletService) CreateWallet() (reps.Wallet, error) {
 	return wallet, nil
 }
 
+// Create a wallet for a key derived from the seed of an HD wallet. Its private key isn't saved, it is derived again
+// from the seed when the HD wallet is unlocked
+func (ws *walletService) CreateDerivedWallet(pubKey []byte, hdWalletId string, derivationPath string) (reps.Wallet, error) {
+	walletAddress, err := ws.CreateAddress(pubKey)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+
+	wallet := reps.Wallet{
+		ID:             uuid.Must(uuid.NewRandom()).String(),
+		Address:        string(walletAddress),
+		PublicKey:      hex.EncodeToString(pubKey),
+		HDWalletID:     hdWalletId,
+		DerivationPath: derivationPath,
+	}
+
+	// Persist
+	err = ws.blockchainRepo.CreateWallet(wallet)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+
+	log.Infof("derived wallet %s at %s", wallet.Address, derivationPath)
+	return wallet, nil
+}
+
+// Create a wallet paying to the hash of a redeem script. It has no keys of its own, whoever can satisfy the redeem
+// script can spend from it
+func (ws *walletService) CreateScriptWallet(redeemScript []byte) (reps.Wallet, error) {
+	address := string(ws.CreateScriptAddress(redeemScript))
+	if _, err := ws.blockchainRepo.GetWallet(address); err == nil {
+		return reps.Wallet{}, fmt.Errorf("wallet %s already exists", address)
+	}
+
+	log.Info("wallet address: ", address)
+
+	wallet := reps.Wallet{
+		ID:           uuid.Must(uuid.NewRandom()).String(),
+		Address:      address,
+		RedeemScript: redeemScript,
+	}
+
+	// Persist
+	err := ws.blockchainRepo.CreateWallet(wallet)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// Import a wallet the app only watches, from its address or its public key. It can receive coins and report its
+// balance, but holds no private key, so the app can never sign for it. Send both to check they match
+func (ws *walletService) ImportWatchOnlyWallet(address string, publicKey string) (reps.Wallet, error) {
+	if address == "" && publicKey == "" {
+		return reps.Wallet{}, fmt.Errorf("address or public key is required")
+	}
+
+	if publicKey != "" {
+		pubKey, err := hex.DecodeString(publicKey)
+		if err != nil {
+			return reps.Wallet{}, fmt.Errorf("%s, public key is not valid hex", err.Error())
+		}
+		if !isPublicKey(pubKey) {
+			return reps.Wallet{}, fmt.Errorf("public key %s is not a point on the P-256 curve", publicKey)
+		}
+
+		pubKeyAddress, err := ws.CreateAddress(pubKey)
+		if err != nil {
+			return reps.Wallet{}, err
+		}
+		if address != "" && address != string(pubKeyAddress) {
+			return reps.Wallet{}, fmt.Errorf("address %s does not belong to public key %s", address, publicKey)
+		}
+		address = string(pubKeyAddress)
+	}
+
+	validation, err := ws.ValidateAddress(address)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+	if !validation.Valid {
+		return reps.Wallet{}, fmt.Errorf("error: address of %s is not valid", address)
+	}
+	if _, err := ws.blockchainRepo.GetWallet(address); err == nil {
+		return reps.Wallet{}, fmt.Errorf("wallet %s already exists", address)
+	}
+
+	wallet := reps.Wallet{
+		ID:        uuid.Must(uuid.NewRandom()).String(),
+		Address:   address,
+		PublicKey: publicKey,
+		WatchOnly: true,
+	}
+
+	// Persist
+	err = ws.blockchainRepo.CreateWallet(wallet)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+
+	log.Info("imported watch-only wallet: ", address)
+	return wallet, nil
+}
+
 func (ws *walletService) GetWallets() ([]reps.Wallet, error) {
 	wallets, err := ws.blockchainRepo.GetWallets()
 	if err != nil {
@@ -105,6 +274,335 @@ func (ws *walletService) GetWallets() ([]reps.Wallet, error) {
 	return wallets, nil
 }
 
+// Decrypt the key of a wallet and keep it in memory until timeout has passed, so it can sign. id is the address of
+// a wallet or the id of an HD wallet. Unlocking an address of an HD wallet unlocks the whole HD wallet
+func (ws *walletService) UnlockWallet(id string, passphrase string, timeout time.Duration) (time.Time, error) {
+	if timeout == 0 {
+		timeout = DefaultUnlockTimeout
+	}
+	if timeout < 0 || timeout > MaxUnlockTimeout {
+		return time.Time{}, fmt.Errorf("timeout has to be between 0 and %s", MaxUnlockTimeout)
+	}
+
+	secret, err := ws.getWalletSecret(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !secret.encrypted {
+		return time.Time{}, fmt.Errorf("key of wallet %s is not encrypted, set a passphrase for it first", id)
+	}
+
+	plaintext, err := keycrypt.Decrypt(secret.stored, passphrase)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w, cannot unlock wallet %s", err, id)
+	}
+
+	expires := ws.keyring.unlock(secret.sessionId, plaintext, timeout)
+	log.Infof("unlocked wallet %s until %s", secret.sessionId, expires.Format(time.RFC3339))
+	return expires, nil
+}
+
+// End the unlock session of a wallet before it times out
+func (ws *walletService) LockWallet(id string) error {
+	secret, err := ws.getWalletSecret(id)
+	if err != nil {
+		return err
+	}
+
+	ws.keyring.lock(secret.sessionId)
+	log.Info("locked wallet: ", secret.sessionId)
+	return nil
+}
+
+// Private key of a wallet to sign with. Fails with ErrWalletLocked unless the wallet, or the HD wallet it belongs
+// to, is unlocked
+func (ws *walletService) GetPrivateKey(address string) (ecdsa.PrivateKey, error) {
+	wallet, err := ws.GetWallet(address)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+
+	if wallet.HDWalletID != "" {
+		seed, ok := ws.keyring.get(wallet.HDWalletID)
+		if !ok {
+			return ecdsa.PrivateKey{}, fmt.Errorf("%w: HD wallet %s of %s", ErrWalletLocked, wallet.HDWalletID, address)
+		}
+		defer wipe(seed)
+
+		return deriveKey(seed, wallet.DerivationPath)
+	}
+
+	if len(wallet.PrivateKey) == 0 {
+		return ecdsa.PrivateKey{}, fmt.Errorf("wallet %s has no private key to sign with", address)
+	}
+	if !wallet.KeyEncrypted {
+		return ecdsa.PrivateKey{}, fmt.Errorf("key of wallet %s is not encrypted, set a passphrase for it first", address)
+	}
+
+	privKeyBytes, ok := ws.keyring.get(address)
+	if !ok {
+		return ecdsa.PrivateKey{}, fmt.Errorf("%w: %s", ErrWalletLocked, address)
+	}
+	defer wipe(privKeyBytes)
+
+	return ws.walletAssember.ToECDSAPrivateKey(privKeyBytes), nil
+}
+
+// Encrypt the key of a wallet, or the seed of an HD wallet, under a new passphrase. passphrase is the current one,
+// and is ignored if the key isn't encrypted yet. The wallet is locked, ending any unlock session
+func (ws *walletService) ChangePassphrase(id string, passphrase string, newPassphrase string) error {
+	if err := checkPassphrase(newPassphrase); err != nil {
+		return err
+	}
+
+	secret, err := ws.getWalletSecret(id)
+	if err != nil {
+		return err
+	}
+
+	plaintext := secret.stored
+	if secret.encrypted {
+		plaintext, err = keycrypt.Decrypt(secret.stored, passphrase)
+		if err != nil {
+			return fmt.Errorf("%w, cannot change the passphrase of wallet %s", err, id)
+		}
+		defer wipe(plaintext)
+	}
+
+	encrypted, err := keycrypt.Encrypt(plaintext, newPassphrase)
+	if err != nil {
+		return err
+	}
+	if err := secret.save(encrypted); err != nil {
+		return err
+	}
+
+	ws.keyring.lock(secret.sessionId)
+	log.Info("changed passphrase of wallet: ", secret.sessionId)
+	return nil
+}
+
+// Encrypt every key and seed saved before keys were encrypted at rest, all under passphrase. Their passphrases can
+// be changed one by one afterwards. Keys of HD wallet addresses are dropped, since they are derived from the seed.
+// Returns how many keys and seeds were encrypted
+func (ws *walletService) EncryptStoredKeys(passphrase string) (int, error) {
+	wallets, err := ws.blockchainRepo.GetWallets()
+	if err != nil {
+		return 0, err
+	}
+	hdWallets, err := ws.blockchainRepo.GetHDWallets()
+	if err != nil {
+		return 0, err
+	}
+
+	unencrypted := make([]string, 0)
+	for _, wallet := range wallets {
+		switch {
+		case wallet.HDWalletID != "" && len(wallet.PrivateKey) > 0:
+			wallet.PrivateKey = nil
+			if err := ws.blockchainRepo.UpdateWallet(wallet); err != nil {
+				return 0, err
+			}
+		case wallet.HDWalletID == "" && len(wallet.PrivateKey) > 0 && !wallet.KeyEncrypted:
+			unencrypted = append(unencrypted, wallet.Address)
+		}
+	}
+	for _, hdWallet := range hdWallets {
+		if !hdWallet.SeedEncrypted {
+			unencrypted = append(unencrypted, hdWallet.ID)
+		}
+	}
+
+	if len(unencrypted) == 0 {
+		return 0, nil
+	}
+	if passphrase == "" {
+		return 0, fmt.Errorf("%d wallets have keys that are not encrypted, a passphrase is needed to encrypt them", len(unencrypted))
+	}
+
+	encrypted := 0
+	for _, id := range unencrypted {
+		if err := ws.ChangePassphrase(id, "", passphrase); err != nil {
+			return encrypted, fmt.Errorf("%s, encrypted %d of %d wallets", err.Error(), encrypted, len(unencrypted))
+		}
+		encrypted++
+	}
+
+	log.Infof("encrypted the keys of %d wallets", encrypted)
+	return encrypted, nil
+}
+
+// Private key of a wallet in format, for backing it up or moving it to another wallet. The passphrase of the wallet,
+// or of the HD wallet it belongs to, is needed even if the wallet is unlocked
+func (ws *walletService) ExportPrivateKey(address string, passphrase string, format string) (string, error) {
+	wallet, err := ws.GetWallet(address)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := ws.getWalletSecret(address)
+	if err != nil {
+		return "", err
+	}
+	if !secret.encrypted {
+		return "", fmt.Errorf("key of wallet %s is not encrypted, set a passphrase for it first", address)
+	}
+
+	plaintext, err := keycrypt.Decrypt(secret.stored, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("%w, cannot export the key of wallet %s", err, address)
+	}
+	defer wipe(plaintext)
+
+	// The secret of an HD wallet address is the seed of the HD wallet
+	var privKey ecdsa.PrivateKey
+	if wallet.HDWalletID != "" {
+		privKey, err = deriveKey(plaintext, wallet.DerivationPath)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		privKey = ws.walletAssember.ToECDSAPrivateKey(plaintext)
+	}
+
+	key, err := ws.encodePrivateKey(privKey, format)
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("exported the key of wallet %s as %s", address, format)
+	return key, nil
+}
+
+// Create a wallet from an existing private key in format, worked out from the key if empty. The wallet gets the
+// address of the key, and its key is encrypted under passphrase like the key of a new wallet
+func (ws *walletService) ImportPrivateKey(key string, format string, passphrase string) (reps.Wallet, error) {
+	if err := checkPassphrase(passphrase); err != nil {
+		return reps.Wallet{}, err
+	}
+
+	privKey, err := ws.decodePrivateKey(key, format)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+
+	size := (privKey.Curve.Params().BitSize + 7) / 8
+	pubKey := make([]byte, 2*size)
+	privKey.X.FillBytes(pubKey[:size])
+	privKey.Y.FillBytes(pubKey[size:])
+
+	walletAddress, err := ws.CreateAddress(pubKey)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+	if _, err := ws.blockchainRepo.GetWallet(string(walletAddress)); err == nil {
+		return reps.Wallet{}, fmt.Errorf("wallet %s already exists", walletAddress)
+	}
+
+	privKeyBytes := ws.walletAssember.ToPrivateKeyBytes(privKey)
+	encryptedKey, err := keycrypt.Encrypt(privKeyBytes, passphrase)
+	wipe(privKeyBytes)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+
+	wallet := reps.Wallet{
+		ID:           uuid.Must(uuid.NewRandom()).String(),
+		Address:      string(walletAddress),
+		PrivateKey:   encryptedKey,
+		KeyEncrypted: true,
+		PublicKey:    hex.EncodeToString(pubKey),
+	}
+
+	// Persist
+	err = ws.blockchainRepo.CreateWallet(wallet)
+	if err != nil {
+		return reps.Wallet{}, err
+	}
+
+	log.Info("imported wallet: ", wallet.Address)
+	return wallet, nil
+}
+
+// The secret that unlocks a wallet: its own private key, or the seed of the HD wallet it belongs to.
+// sessionId -> What the secret is unlocked under, the address of the wallet or the id of the HD wallet
+// stored -> The secret as it is saved, encrypted unless encrypted is false
+// save -> Replace the saved secret with an encrypted one
+type walletSecret struct {
+	sessionId string
+	stored    []byte
+	encrypted bool
+	save      func(encrypted []byte) error
+}
+
+// Find the secret of id, the address of a wallet or the id of an HD wallet
+func (ws *walletService) getWalletSecret(id string) (walletSecret, error) {
+	wallet, err := ws.blockchainRepo.GetWallet(id)
+	if err == nil && wallet.HDWalletID == "" {
+		if len(wallet.PrivateKey) == 0 {
+			return walletSecret{}, fmt.Errorf("wallet %s has no private key", id)
+		}
+
+		stored := wallet.PrivateKey
+		if !wallet.KeyEncrypted {
+			// Keys saved before they were encrypted may still be gob encoded
+			privKey := ws.walletAssember.ToECDSAPrivateKey(wallet.PrivateKey)
+			if privKey.D == nil {
+				return walletSecret{}, fmt.Errorf("key of wallet %s cannot be decoded", id)
+			}
+			stored = ws.walletAssember.ToPrivateKeyBytes(privKey)
+		}
+
+		return walletSecret{
+			sessionId: wallet.Address,
+			stored:    stored,
+			encrypted: wallet.KeyEncrypted,
+			save: func(encrypted []byte) error {
+				wallet.PrivateKey = encrypted
+				wallet.KeyEncrypted = true
+				return ws.blockchainRepo.UpdateWallet(wallet)
+			},
+		}, nil
+	}
+	if err == nil {
+		id = wallet.HDWalletID
+	}
+
+	hdWallet, err := ws.blockchainRepo.GetHDWallet(id)
+	if err != nil {
+		return walletSecret{}, fmt.Errorf("%s, wallet %s does not exist", err.Error(), id)
+	}
+
+	return walletSecret{
+		sessionId: hdWallet.ID,
+		stored:    hdWallet.Seed,
+		encrypted: hdWallet.SeedEncrypted,
+		save: func(encrypted []byte) error {
+			hdWallet.Seed = encrypted
+			hdWallet.SeedEncrypted = true
+			return ws.blockchainRepo.UpdateHDWallet(hdWallet)
+		},
+	}, nil
+}
+
+// Key of an HD wallet address, derived from the seed of the HD wallet along the address's derivation path
+func deriveKey(seed []byte, derivationPath string) (ecdsa.PrivateKey, error) {
+	path, err := hd.ParsePath(derivationPath)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+	master, err := hd.NewMaster(seed)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+	key, err := master.Derive(path)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+
+	return key.ECDSAPrivateKey()
+}
+
 // pubKeyHash = ripemd160(sha256(pubKey))
 func (ws *walletService) CreatePubKeyHash(pubKey []byte) ([]byte, error) {
 	pubHash := sha256.Sum256(pubKey)
@@ -136,41 +634,114 @@ func (ws *walletService) CreateAddress(pubKey []byte) ([]byte, error) {
 		return []byte{}, err
 	}
 
-	// Version + pubKeyHash
-	versionedPubKeyHash := append([]byte{Version}, pubKeyHash...)
-	log.Info(fmt.Sprintf("versionedPubKeyHash: %x", versionedPubKeyHash))
+	return ws.encodeAddress(Version, pubKeyHash), nil
+}
+
+// Address paying to the hash of a redeem script, scriptHash = ripemd160(sha256(redeemScript))
+func (ws *walletService) CreateScriptAddress(redeemScript []byte) []byte {
+	return ws.encodeAddress(ScriptVersion, script.Hash160(redeemScript))
+}
 
-	checksum := ws.CreateChecksum(pubKeyHash)
+// address = base58(version + hash + checksum)
+func (ws *walletService) encodeAddress(version byte, hash []byte) []byte {
+	// Version + hash
+	versionedHash := append([]byte{version}, hash...)
+	log.Info(fmt.Sprintf("versionedHash: %x", versionedHash))
 
-	// version + pubKeyHash + checksum
-	finalHash := append(versionedPubKeyHash, checksum...)
-	log.Info(fmt.Sprintf("finalHash: %x", finalHash))
+	checksum := ws.CreateChecksum(hash)
 
-	address := base58Encode(finalHash)
+	// version + hash + checksum
+	finalHash := append(versionedHash, checksum...)
+	log.Info(fmt.Sprintf("finalHash: %x", finalHash))
 
-	return address, nil
+	return base58Encode(finalHash)
 }
 
-func (ws *walletService) ValidateAddress(address string) (bool, error) {
+// Check an address is well formed: a known version, a 20 byte hash and a checksum that matches. The address doesn't
+// have to belong to a wallet in the app, so coins can be sent to addresses generated elsewhere, but then it comes back
+// with a warning, as it does when the address belongs to a retired wallet
+func (ws *walletService) ValidateAddress(address string) (reps.AddressValidation, error) {
 	log.Info("Validating address: ", address)
-	// Check if address exists in db first
-	_, err := ws.GetWallet(address)
+
+	decoded, err := base58.Decode(address)
 	if err != nil {
-		errMsg := fmt.Errorf("%s: wallet with address %s does not exist", err.Error(), address)
-		return false, errMsg
+		return reps.AddressValidation{}, fmt.Errorf("%s, address %s is not valid base58", err.Error(), address)
+	}
+	if len(decoded) != 1+hashLen+ChecksumLen {
+		return reps.AddressValidation{}, nil
+	}
+	if decoded[0] != Version && decoded[0] != ScriptVersion {
+		return reps.AddressValidation{}, nil
 	}
 
 	// Deconstruct address and get the pubKeyHash to check if it's actually valid
-	pubKeyHash := base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-ChecksumLen:]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-ChecksumLen]
+	actualChecksum := decoded[len(decoded)-ChecksumLen:]
+	pubKeyHash := decoded[1 : len(decoded)-ChecksumLen]
 	expectedChecksum := ws.CreateChecksum(pubKeyHash)
 
-	if bytes.Compare(actualChecksum, expectedChecksum) == 0 {
-		return true, nil
+	if bytes.Compare(actualChecksum, expectedChecksum) != 0 {
+		return reps.AddressValidation{}, nil
+	}
+
+	validation := reps.AddressValidation{Valid: true}
+	wallet, err := ws.blockchainRepo.GetWallet(address)
+	switch {
+	case repository.IsNotFound(err):
+		validation.Warning = fmt.Sprintf("address %s is not a wallet in the app, only whoever holds its key elsewhere can spend what is sent to it", address)
+	case err != nil:
+		return reps.AddressValidation{}, err
+	case wallet.Retired:
+		// Whoever has the leaked key can spend what is sent to it
+		validation.Warning = fmt.Sprintf("address %s belongs to a retired wallet whose key may have leaked, its coins were swept to %s", address, wallet.SweptTo)
+		log.Warn(validation.Warning)
+	}
+
+	return validation, nil
+}
+
+// Mark a wallet as retired once its coins were swept to sweptTo
+func (ws *walletService) RetireWallet(address string, sweptTo string) error {
+	wallet, err := ws.GetWallet(address)
+	if err != nil {
+		return err
 	}
 
-	return false, nil
+	wallet.Retired = true
+	wallet.SweptTo = sweptTo
+	if err := ws.blockchainRepo.UpdateWallet(wallet); err != nil {
+		return err
+	}
+
+	log.WithField("sweptTo", sweptTo).Info("Retired wallet ", address)
+	return nil
+}
+
+func checkPassphrase(passphrase string) error {
+	if len(passphrase) < MinPassphraseLen {
+		return fmt.Errorf("passphrase has to be at least %d characters", MinPassphraseLen)
+	}
+	return nil
+}
+
+// Check a public key is an uncompressed point on the P-256 curve, x and y each padded to 32 bytes
+func isPublicKey(pubKey []byte) bool {
+	curve := elliptic.P256()
+	size := (curve.Params().BitSize + 7) / 8
+	if len(pubKey) != 2*size {
+		return false
+	}
+
+	x, y := splitHalves(pubKey)
+	return curve.IsOnCurve(x, y)
+}
+
+// Hash an address pays to, without its version and checksum
+func addressHash(address string) []byte {
+	decoded := base58Decode([]byte(address))
+	if len(decoded) < 1+ChecksumLen {
+		return nil
+	}
+	return decoded[1 : len(decoded)-ChecksumLen]
 }
 
 func base58Decode(address []byte) []byte {
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	reps "github.com/brucetieu/blockchain/representations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchOnlyWalletReceivesAndSpendsThroughPSBT(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+	alice := n.newWallet(t)
+	ws := n.walletService.(*walletService)
+	ps := NewPSBTService(n.transactionService, n.walletService, n.mempoolService, n.signer)
+
+	// The key is made and kept outside the app
+	privKey, pubKey := ws.CreateKeyPair()
+	wallet, err := ws.ImportWatchOnlyWallet("", hex.EncodeToString(pubKey))
+	require.NoError(t, err)
+	assert.True(t, wallet.WatchOnly)
+	assert.Empty(t, wallet.PrivateKey)
+	address, err := ws.CreateAddress(pubKey)
+	require.NoError(t, err)
+	assert.Equal(t, string(address), wallet.Address)
+
+	n.send(t, miner, wallet.Address, 20)
+	assert.Equal(t, 20, n.balance(t, wallet.Address))
+	history, err := n.transactionService.GetAddressTransactions(wallet.Address)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+
+	_, err = n.transactionService.CreateTransaction(wallet.Address, payTo(alice, 5), reps.TransferOptions{})
+	assert.ErrorContains(t, err, "watch-only")
+
+	psbt, err := ps.CreatePSBT(wallet.Address, payTo(alice, 5), reps.TransferOptions{})
+	require.NoError(t, err)
+	_, err = ps.SignPSBTWithWallet(psbt, wallet.Address)
+	assert.ErrorContains(t, err, "watch-only")
+	signed, err := ps.SignPSBT(psbt, privKey, pubKey)
+	require.NoError(t, err)
+	finalized, err := ps.FinalizePSBT(signed)
+	require.NoError(t, err)
+	_, err = ps.BroadcastPSBT(finalized)
+	require.NoError(t, err)
+
+	n.mine(t, miner)
+	assert.Equal(t, 5, n.balance(t, alice))
+	assert.Equal(t, 15, n.balance(t, wallet.Address))
+}
+
+func TestImportWatchOnlyWalletChecksInput(t *testing.T) {
+	n := newTestNode(t)
+	ws := n.walletService.(*walletService)
+	_, pubKey := ws.CreateKeyPair()
+	_, otherPubKey := ws.CreateKeyPair()
+	otherAddress, err := ws.CreateAddress(otherPubKey)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		address   string
+		publicKey string
+		reason    string
+	}{
+		{name: "nothing", reason: "address or public key is required"},
+		{name: "bad hex", publicKey: "zz", reason: "not valid hex"},
+		{name: "not on curve", publicKey: hex.EncodeToString(make([]byte, 64)), reason: "not a point on the P-256 curve"},
+		{name: "mismatch", address: string(otherAddress), publicKey: hex.EncodeToString(pubKey), reason: "does not belong to public key"},
+		{name: "bad address", address: "1BitcoinEaterAddressDontSendf59kuE", reason: "not valid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ws.ImportWatchOnlyWallet(tt.address, tt.publicKey)
+			assert.ErrorContains(t, err, tt.reason)
+		})
+	}
+
+	// An address on its own is enough to watch
+	wallet, err := ws.ImportWatchOnlyWallet(string(otherAddress), "")
+	require.NoError(t, err)
+	assert.Empty(t, wallet.PublicKey)
+	_, err = ws.ImportWatchOnlyWallet(string(otherAddress), "")
+	assert.ErrorContains(t, err, "already exists")
+}
+
+func TestValidateAddressWarnsAboutAddressesOutsideTheApp(t *testing.T) {
+	n := newTestNode(t)
+	ws := n.walletService.(*walletService)
+	alice := n.newWallet(t)
+	_, pubKey := ws.CreateKeyPair()
+	foreign, err := ws.CreateAddress(pubKey)
+	require.NoError(t, err)
+
+	validation, err := ws.ValidateAddress(alice)
+	require.NoError(t, err)
+	assert.Equal(t, reps.AddressValidation{Valid: true}, validation)
+
+	validation, err = ws.ValidateAddress(string(foreign))
+	require.NoError(t, err)
+	assert.True(t, validation.Valid)
+	assert.Contains(t, validation.Warning, "not a wallet in the app")
+
+	// Watching it brings it into the app
+	_, err = ws.ImportWatchOnlyWallet(string(foreign), "")
+	require.NoError(t, err)
+	validation, err = ws.ValidateAddress(string(foreign))
+	require.NoError(t, err)
+	assert.Empty(t, validation.Warning)
+
+	validation, err = ws.ValidateAddress("1BitcoinEaterAddressDontSendf59kuE")
+	require.NoError(t, err)
+	assert.False(t, validation.Valid)
+}
+
+func TestWalletKeyIsEncryptedAndLocked(t *testing.T) {
+	n := newTestNode(t)
+	miner := n.newChain(t)
+
+	wallet, err := n.walletService.CreateWallet(testPassphrase)
+	require.NoError(t, err)
+	assert.True(t, wallet.KeyEncrypted)
+	n.send(t, miner, wallet.Address, 10)
+
+	_, err = n.walletService.GetPrivateKey(wallet.Address)
+	assert.ErrorIs(t, err, ErrWalletLocked)
+	_, err = n.blockchainService.AddToBlockChain(context.Background(), wallet.Address, payTo(miner, 5), reps.TransferOptions{})
+	assert.ErrorIs(t, err, ErrWalletLocked)
+
+	_, err = n.walletService.UnlockWallet(wallet.Address, "wrong passphrase", time.Hour)
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+	_, err = n.walletService.UnlockWallet(wallet.Address, testPassphrase, 2*MaxUnlockTimeout)
+	assert.Error(t, err)
+
+	expires, err := n.walletService.UnlockWallet(wallet.Address, testPassphrase, 0)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(DefaultUnlockTimeout), expires, time.Minute)
+	n.send(t, wallet.Address, miner, 5)
+
+	require.NoError(t, n.walletService.LockWallet(wallet.Address))
+	_, err = n.walletService.GetPrivateKey(wallet.Address)
+	assert.ErrorIs(t, err, ErrWalletLocked)
+}
+
+func TestUnlockSessionExpires(t *testing.T) {
+	kr := newKeyring()
+
+	kr.unlock("wallet", []byte("secret"), time.Hour)
+	secret, ok := kr.get("wallet")
+	require.True(t, ok)
+	assert.Equal(t, []byte("secret"), secret)
+
+	kr.unlock("wallet", []byte("secret"), -time.Second)
+	_, ok = kr.get("wallet")
+	assert.False(t, ok)
+}
+
+func TestChangePassphrase(t *testing.T) {
+	n := newTestNode(t)
+	address := n.newWallet(t)
+	const newPassphrase = "battery staple horse"
+
+	err := n.walletService.ChangePassphrase(address, "wrong passphrase", newPassphrase)
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+	assert.Error(t, n.walletService.ChangePassphrase(address, testPassphrase, "short"))
+
+	require.NoError(t, n.walletService.ChangePassphrase(address, testPassphrase, newPassphrase))
+	// Changing the passphrase ends the unlock session
+	_, err = n.walletService.GetPrivateKey(address)
+	assert.ErrorIs(t, err, ErrWalletLocked)
+
+	_, err = n.walletService.UnlockWallet(address, testPassphrase, time.Hour)
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+	_, err = n.walletService.UnlockWallet(address, newPassphrase, time.Hour)
+	assert.NoError(t, err)
+}
+
+// Wallets saved before keys were encrypted at rest
+func TestEncryptStoredKeys(t *testing.T) {
+	n := newTestNode(t)
+	ws := n.walletService.(*walletService)
+
+	privKey, pubKey := ws.CreateKeyPair()
+	address, err := ws.CreateAddress(pubKey)
+	require.NoError(t, err)
+	require.NoError(t, n.repo.CreateWallet(reps.Wallet{
+		ID:         "legacy",
+		Address:    string(address),
+		PrivateKey: ws.walletAssember.ToPrivateKeyBytes(privKey),
+		PublicKey:  hex.EncodeToString(pubKey),
+	}))
+
+	_, err = ws.UnlockWallet(string(address), testPassphrase, time.Hour)
+	assert.ErrorContains(t, err, "is not encrypted")
+	_, err = ws.EncryptStoredKeys("")
+	assert.Error(t, err)
+
+	encrypted, err := ws.EncryptStoredKeys(testPassphrase)
+	require.NoError(t, err)
+	assert.Equal(t, 1, encrypted)
+	wallet, err := ws.GetWallet(string(address))
+	require.NoError(t, err)
+	assert.True(t, wallet.KeyEncrypted)
+
+	_, err = ws.UnlockWallet(string(address), testPassphrase, time.Hour)
+	require.NoError(t, err)
+	unlocked, err := ws.GetPrivateKey(string(address))
+	require.NoError(t, err)
+	assert.Equal(t, privKey.D, unlocked.D)
+
+	encrypted, err = ws.EncryptStoredKeys(testPassphrase)
+	require.NoError(t, err)
+	assert.Equal(t, 0, encrypted)
+}
@@ -0,0 +1,299 @@
+package signer
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// External signers speak newline delimited JSON, one request and one response per line, matched by id:
+// {"id": 1, "method": "publicKey", "keyId": address} -> {"id": 1, "publicKey": hex}
+// {"id": 2, "method": "sign", "keyId": address, "hash": hex} -> {"id": 2, "signature": hex}
+// A request that fails gets {"id": n, "error": message} instead
+const (
+	MethodPublicKey = "publicKey"
+	MethodSign      = "sign"
+
+	// Longest line either side reads, far more than any request or response needs
+	maxLineLen = 64 * 1024
+)
+
+// How long the app waits for an external signer to answer a request
+var RequestTimeout = 10 * time.Second
+
+type request struct {
+	ID     uint64 `json:"id"`
+	Method string `json:"method"`
+	KeyID  string `json:"keyId"`
+	Hash   string `json:"hash,omitempty"`
+}
+
+type response struct {
+	ID        uint64 `json:"id"`
+	PublicKey string `json:"publicKey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Sends one request to the external signer and reads its response
+type transport interface {
+	roundTrip(req request) (response, error)
+}
+
+// Signer in another process, which holds the keys so the app never sees them
+type externalSigner struct {
+	transport transport
+	nextId    uint64
+}
+
+// Signer listening on the Unix socket at path. Each request opens its own connection
+func NewSocketSigner(path string) Signer {
+	return &externalSigner{transport: &socketTransport{path: path}}
+}
+
+// Signer started as command, answering requests on its stdin with responses on its stdout. It is started on the
+// first request, and again on the next one if it exits
+func NewCommandSigner(command string, args ...string) Signer {
+	return &externalSigner{transport: &commandTransport{command: command, args: args}}
+}
+
+func (es *externalSigner) PublicKey(keyId string) ([]byte, error) {
+	resp, err := es.call(request{Method: MethodPublicKey, KeyID: keyId})
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.DecodeString(resp.PublicKey)
+}
+
+func (es *externalSigner) SignHash(keyId string, hash []byte) ([]byte, error) {
+	resp, err := es.call(request{Method: MethodSign, KeyID: keyId, Hash: hex.EncodeToString(hash)})
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.DecodeString(resp.Signature)
+}
+
+func (es *externalSigner) call(req request) (response, error) {
+	req.ID = atomic.AddUint64(&es.nextId, 1)
+
+	resp, err := es.transport.roundTrip(req)
+	if err != nil {
+		return response{}, fmt.Errorf("%s, external signer did not answer", err.Error())
+	}
+	if resp.ID != req.ID {
+		return response{}, fmt.Errorf("external signer answered request %d instead of %d", resp.ID, req.ID)
+	}
+	if resp.Error != "" {
+		return response{}, fmt.Errorf("external signer: %s", resp.Error)
+	}
+
+	return resp, nil
+}
+
+type socketTransport struct {
+	path string
+}
+
+func (st *socketTransport) roundTrip(req request) (response, error) {
+	conn, err := net.DialTimeout("unix", st.path, RequestTimeout)
+	if err != nil {
+		return response{}, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(RequestTimeout)); err != nil {
+		return response{}, err
+	}
+
+	if err := writeLine(conn, req); err != nil {
+		return response{}, err
+	}
+
+	return readResponse(bufio.NewReaderSize(conn, maxLineLen))
+}
+
+// Requests go one at a time, since the command answers them in order
+type commandTransport struct {
+	command string
+	args    []string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func (ct *commandTransport) roundTrip(req request) (response, error) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if ct.cmd == nil {
+		if err := ct.start(); err != nil {
+			return response{}, err
+		}
+	}
+
+	type result struct {
+		resp response
+		err  error
+	}
+	done := make(chan result, 1)
+	stdin, stdout := ct.stdin, ct.stdout
+	go func() {
+		if err := writeLine(stdin, req); err != nil {
+			done <- result{err: err}
+			return
+		}
+		resp, err := readResponse(stdout)
+		done <- result{resp: resp, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			ct.stop()
+		}
+		return res.resp, res.err
+	case <-time.After(RequestTimeout):
+		// Whatever the command answers later would be taken for the response to the next request
+		ct.stop()
+		return response{}, fmt.Errorf("timed out after %s", RequestTimeout)
+	}
+}
+
+func (ct *commandTransport) start() error {
+	cmd := exec.Command(ct.command, ct.args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	log.Infof("Started external signer %s with pid %d", ct.command, cmd.Process.Pid)
+	ct.cmd = cmd
+	ct.stdin = stdin
+	ct.stdout = bufio.NewReaderSize(stdout, maxLineLen)
+	return nil
+}
+
+func (ct *commandTransport) stop() {
+	ct.stdin.Close()
+	ct.cmd.Process.Kill()
+	ct.cmd.Wait()
+	ct.cmd = nil
+}
+
+// Answer the requests read from r with responses written to w, signing with signer, until r is closed
+func Serve(r io.Reader, w io.Writer, signer Signer) error {
+	reader := bufio.NewReaderSize(r, maxLineLen)
+	for {
+		line, err := readLine(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		resp := response{}
+		if err := json.Unmarshal(line, &req); err != nil {
+			resp.Error = fmt.Sprintf("%s, request is not valid JSON", err.Error())
+		} else {
+			resp = handle(req, signer)
+		}
+
+		if err := writeLine(w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func handle(req request, signer Signer) response {
+	resp := response{ID: req.ID}
+
+	switch req.Method {
+	case MethodPublicKey:
+		pubKey, err := signer.PublicKey(req.KeyID)
+		if err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		resp.PublicKey = hex.EncodeToString(pubKey)
+	case MethodSign:
+		hash, err := hex.DecodeString(req.Hash)
+		if err != nil || len(hash) == 0 {
+			resp.Error = "hash is not valid hex"
+			return resp
+		}
+		signature, err := signer.SignHash(req.KeyID, hash)
+		if err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		log.Infof("Signed %x with the key of %s", hash, req.KeyID)
+		resp.Signature = hex.EncodeToString(signature)
+	default:
+		resp.Error = fmt.Sprintf("unknown method %s, expected %s or %s", req.Method, MethodPublicKey, MethodSign)
+	}
+
+	return resp
+}
+
+func writeLine(w io.Writer, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+func readResponse(r *bufio.Reader) (response, error) {
+	line, err := readLine(r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return response{}, err
+	}
+
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return response{}, fmt.Errorf("%s, response is not valid JSON", err.Error())
+	}
+	return resp, nil
+}
+
+// Read one line. A line longer than maxLineLen is an error rather than being read in pieces
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("line is longer than %d bytes", maxLineLen)
+	}
+	if err == io.EOF && len(line) > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return line, err
+}
@@ -0,0 +1,171 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeystore(t *testing.T) (*Keystore, []byte) {
+	t.Helper()
+
+	ks, err := OpenKeystore(t.TempDir(), "keystore passphrase")
+	require.NoError(t, err)
+	privKey := newTestKey(t)
+	require.NoError(t, ks.Add("address1", privKey))
+
+	return ks, publicKeyBytes(privKey.PublicKey)
+}
+
+func TestServe(t *testing.T) {
+	ks, pubKey := newTestKeystore(t)
+
+	in := strings.Join([]string{
+		`{"id": 1, "method": "publicKey", "keyId": "address1"}`,
+		`{"id": 2, "method": "sign", "keyId": "address1", "hash": "zz"}`,
+		`{"id": 3, "method": "publicKey", "keyId": "missing"}`,
+		`{"id": 4, "method": "export", "keyId": "address1"}`,
+		`not json`,
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	require.NoError(t, Serve(strings.NewReader(in), &out, ks))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 5)
+	assert.JSONEq(t, fmt.Sprintf(`{"id": 1, "publicKey": "%s"}`, hex.EncodeToString(pubKey)), lines[0])
+	assert.JSONEq(t, `{"id": 2, "error": "hash is not valid hex"}`, lines[1])
+	assert.JSONEq(t, `{"id": 3, "error": "signer has no key for missing"}`, lines[2])
+	assert.JSONEq(t, `{"id": 4, "error": "unknown method export, expected publicKey or sign"}`, lines[3])
+	assert.Contains(t, lines[4], "request is not valid JSON")
+}
+
+func TestServeRejectsLongLines(t *testing.T) {
+	ks, _ := newTestKeystore(t)
+
+	in := strings.Repeat("x", maxLineLen+1) + "\n"
+	err := Serve(strings.NewReader(in), &bytes.Buffer{}, ks)
+	assert.EqualError(t, err, fmt.Sprintf("line is longer than %d bytes", maxLineLen))
+}
+
+func TestSocketSigner(t *testing.T) {
+	ks, pubKey := newTestKeystore(t)
+
+	// Unix socket paths are short, t.TempDir() can be too long
+	dir, err := os.MkdirTemp("", "signer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "signer.sock")
+
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				Serve(conn, conn, ks)
+			}()
+		}
+	}()
+
+	signer := NewSocketSigner(path)
+	got, err := signer.PublicKey("address1")
+	require.NoError(t, err)
+	assert.Equal(t, pubKey, got)
+
+	hash := sha256.Sum256([]byte("transaction"))
+	signature, err := signer.SignHash("address1", hash[:])
+	require.NoError(t, err)
+	assertSigned(t, pubKey, hash[:], signature)
+
+	_, err = signer.SignHash("missing", hash[:])
+	assert.EqualError(t, err, "external signer: signer has no key for missing")
+}
+
+func TestSocketSignerWithoutListener(t *testing.T) {
+	signer := NewSocketSigner(filepath.Join(t.TempDir(), "missing.sock"))
+
+	_, err := signer.PublicKey("address1")
+	assert.ErrorContains(t, err, "external signer did not answer")
+}
+
+type stubTransport struct {
+	resp response
+}
+
+func (st stubTransport) roundTrip(req request) (response, error) {
+	return st.resp, nil
+}
+
+func TestExternalSignerChecksResponseId(t *testing.T) {
+	signer := &externalSigner{transport: stubTransport{resp: response{ID: 7, PublicKey: "00"}}}
+
+	_, err := signer.PublicKey("address1")
+	assert.EqualError(t, err, "external signer answered request 7 instead of 1")
+}
+
+// Run as the external signer process by TestCommandSigner
+func TestHelperSignerProcess(t *testing.T) {
+	dir := os.Getenv("SIGNER_TEST_KEYSTORE")
+	if dir == "" {
+		return
+	}
+
+	ks, err := OpenKeystore(dir, "keystore passphrase")
+	if err != nil {
+		os.Exit(1)
+	}
+	Serve(os.Stdin, os.Stdout, ks)
+	os.Exit(0)
+}
+
+func TestCommandSigner(t *testing.T) {
+	ks, pubKey := newTestKeystore(t)
+	os.Setenv("SIGNER_TEST_KEYSTORE", ks.dir)
+	defer os.Unsetenv("SIGNER_TEST_KEYSTORE")
+
+	signer := NewCommandSigner(os.Args[0], "-test.run=TestHelperSignerProcess")
+	got, err := signer.PublicKey("address1")
+	require.NoError(t, err)
+	assert.Equal(t, pubKey, got)
+
+	hash := sha256.Sum256([]byte("transaction"))
+	signature, err := signer.SignHash("address1", hash[:])
+	require.NoError(t, err)
+	assertSigned(t, pubKey, hash[:], signature)
+
+	// The command is started again after it exits
+	transport := signer.(*externalSigner).transport.(*commandTransport)
+	transport.mu.Lock()
+	transport.stop()
+	transport.mu.Unlock()
+	got, err = signer.PublicKey("address1")
+	require.NoError(t, err)
+	assert.Equal(t, pubKey, got)
+	transport.mu.Lock()
+	transport.stop()
+	transport.mu.Unlock()
+}
+
+func TestCommandSignerTimesOut(t *testing.T) {
+	RequestTimeout = 100 * time.Millisecond
+	defer func() { RequestTimeout = 10 * time.Second }()
+
+	signer := NewCommandSigner("sleep", "10")
+	_, err := signer.PublicKey("address1")
+	assert.EqualError(t, err, "timed out after 100ms, external signer did not answer")
+}
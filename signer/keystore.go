@@ -0,0 +1,188 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/brucetieu/blockchain/keycrypt"
+)
+
+const keyFileExt = ".json"
+
+// A key in a keystore directory, saved as <address>.json
+// PublicKey -> Hex of x and y, so the key can be listed without the passphrase
+// Key -> SEC 1 DER of the private key, encrypted with keycrypt under the passphrase of the keystore
+type keyFile struct {
+	Address   string `json:"address"`
+	PublicKey string `json:"publicKey"`
+	Key       []byte `json:"key"`
+}
+
+// Directory of private keys, one file per key, each encrypted under the passphrase the keystore is opened with.
+// A key is decrypted the first time it signs and kept in memory while the keystore is open
+type Keystore struct {
+	dir        string
+	passphrase string
+
+	mu   sync.Mutex
+	keys map[string]ecdsa.PrivateKey
+}
+
+// Open the keystore in dir, creating the directory if it doesn't exist
+func OpenKeystore(dir string, passphrase string) (*Keystore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("keystore directory is not set")
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("keystore passphrase is not set")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &Keystore{
+		dir:        dir,
+		passphrase: passphrase,
+		keys:       make(map[string]ecdsa.PrivateKey),
+	}, nil
+}
+
+// Save the private key of address, encrypted under the passphrase of the keystore
+func (ks *Keystore) Add(address string, privKey ecdsa.PrivateKey) error {
+	path, err := ks.keyPath(address)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalECPrivateKey(&privKey)
+	if err != nil {
+		return err
+	}
+	encrypted, err := keycrypt.Encrypt(der, ks.passphrase)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(keyFile{
+		Address:   address,
+		PublicKey: hex.EncodeToString(publicKeyBytes(privKey.PublicKey)),
+		Key:       encrypted,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// O_EXCL so a key is never overwritten
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Addresses of every key in the keystore
+func (ks *Keystore) KeyIds() ([]string, error) {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	keyIds := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), keyFileExt) {
+			keyIds = append(keyIds, strings.TrimSuffix(entry.Name(), keyFileExt))
+		}
+	}
+
+	return keyIds, nil
+}
+
+func (ks *Keystore) PublicKey(keyId string) ([]byte, error) {
+	file, err := ks.readKeyFile(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.DecodeString(file.PublicKey)
+}
+
+func (ks *Keystore) SignHash(keyId string, hash []byte) ([]byte, error) {
+	privKey, err := ks.privateKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return SignWithKey(privKey, hash)
+}
+
+// Decrypted key of keyId, from memory if it has signed before
+func (ks *Keystore) privateKey(keyId string) (ecdsa.PrivateKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if privKey, ok := ks.keys[keyId]; ok {
+		return privKey, nil
+	}
+
+	file, err := ks.readKeyFile(keyId)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+	der, err := keycrypt.Decrypt(file.Key, ks.passphrase)
+	if err != nil {
+		return ecdsa.PrivateKey{}, fmt.Errorf("%s, cannot decrypt key %s", err.Error(), keyId)
+	}
+	privKey, err := x509.ParseECPrivateKey(der)
+	if err != nil {
+		return ecdsa.PrivateKey{}, fmt.Errorf("%s, key %s is not an EC private key", err.Error(), keyId)
+	}
+
+	ks.keys[keyId] = *privKey
+	return *privKey, nil
+}
+
+func (ks *Keystore) readKeyFile(keyId string) (keyFile, error) {
+	path, err := ks.keyPath(keyId)
+	if err != nil {
+		return keyFile{}, err
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keyFile{}, fmt.Errorf("%w %s", ErrUnknownKey, keyId)
+	}
+	if err != nil {
+		return keyFile{}, err
+	}
+
+	var file keyFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return keyFile{}, fmt.Errorf("%s, key file of %s is not valid", err.Error(), keyId)
+	}
+	if file.Address != keyId {
+		return keyFile{}, fmt.Errorf("key file of %s holds the key of %s", keyId, file.Address)
+	}
+
+	return file, nil
+}
+
+// File of a key. Key ids are addresses, so anything that could leave the directory is refused
+func (ks *Keystore) keyPath(keyId string) (string, error) {
+	if keyId == "" || strings.ContainsAny(keyId, `/\.`) {
+		return "", fmt.Errorf("%s is not a valid key id", keyId)
+	}
+
+	return filepath.Join(ks.dir, keyId+keyFileExt), nil
+}
@@ -0,0 +1,99 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/brucetieu/blockchain/keycrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	keycrypt.Argon2Memory, keycrypt.Argon2Time, keycrypt.Argon2Threads = 64, 1, 1
+
+	os.Exit(m.Run())
+}
+
+func newTestKey(t *testing.T) ecdsa.PrivateKey {
+	t.Helper()
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return *privKey
+}
+
+// Check a signature as the script engine does, r and s each half of it
+func assertSigned(t *testing.T, pubKey []byte, hash []byte, signature []byte) {
+	t.Helper()
+
+	require.Len(t, pubKey, 64)
+	require.Len(t, signature, 64)
+	key := ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(pubKey[:32]),
+		Y:     new(big.Int).SetBytes(pubKey[32:]),
+	}
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	assert.True(t, ecdsa.Verify(&key, hash, r, s))
+}
+
+func TestKeystoreSigns(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := OpenKeystore(dir, "keystore passphrase")
+	require.NoError(t, err)
+
+	privKey := newTestKey(t)
+	require.NoError(t, ks.Add("address1", privKey))
+	assert.Error(t, ks.Add("address1", newTestKey(t)), "keys are never overwritten")
+
+	keyIds, err := ks.KeyIds()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"address1"}, keyIds)
+
+	pubKey, err := ks.PublicKey("address1")
+	require.NoError(t, err)
+	assert.Equal(t, publicKeyBytes(privKey.PublicKey), pubKey)
+
+	hash := sha256.Sum256([]byte("transaction"))
+	signature, err := ks.SignHash("address1", hash[:])
+	require.NoError(t, err)
+	assertSigned(t, pubKey, hash[:], signature)
+
+	// The key is encrypted on disk, a keystore opened under another passphrase can list it but not sign with it
+	other, err := OpenKeystore(dir, "another passphrase")
+	require.NoError(t, err)
+	_, err = other.PublicKey("address1")
+	assert.NoError(t, err)
+	_, err = other.SignHash("address1", hash[:])
+	assert.ErrorContains(t, err, keycrypt.ErrWrongPassphrase.Error())
+}
+
+func TestKeystoreRejectsUnknownKeys(t *testing.T) {
+	ks, err := OpenKeystore(t.TempDir(), "keystore passphrase")
+	require.NoError(t, err)
+
+	_, err = ks.PublicKey("missing")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = ks.SignHash("missing", make([]byte, 32))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	for _, keyId := range []string{"", "../address", "a/b", "a.b"} {
+		_, err := ks.PublicKey(keyId)
+		assert.EqualError(t, err, keyId+" is not a valid key id")
+	}
+}
+
+func TestOpenKeystoreChecksInput(t *testing.T) {
+	_, err := OpenKeystore("", "keystore passphrase")
+	assert.EqualError(t, err, "keystore directory is not set")
+
+	_, err = OpenKeystore(t.TempDir(), "")
+	assert.EqualError(t, err, "keystore passphrase is not set")
+}
@@ -0,0 +1,41 @@
+package signer
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+)
+
+var ErrUnknownKey = errors.New("signer has no key for")
+
+// Holds private keys and signs with them, so whoever signs a transaction never needs the key itself. Keys are
+// identified by the address they pay to.
+// PublicKey -> x and y of the key of keyId, each padded to the size of the curve
+// SignHash -> Sign a sighash with the key of keyId, giving r and s each padded to the size of the curve
+type Signer interface {
+	PublicKey(keyId string) ([]byte, error)
+	SignHash(keyId string, hash []byte) ([]byte, error)
+}
+
+// Sign a hash, giving r and s each padded to the size of the curve so the signature can be split in half again
+func SignWithKey(privKey ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, &privKey, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	size := (privKey.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signature, nil
+}
+
+// x and y of a public key, each padded to the size of the curve
+func publicKeyBytes(pubKey ecdsa.PublicKey) []byte {
+	size := (pubKey.Curve.Params().BitSize + 7) / 8
+	pubKeyBytes := make([]byte, 2*size)
+	pubKey.X.FillBytes(pubKeyBytes[:size])
+	pubKey.Y.FillBytes(pubKeyBytes[size:])
+	return pubKeyBytes
+}
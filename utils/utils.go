@@ -2,7 +2,9 @@ package utils
 
 import (
 	"encoding/json"
+	"math/big"
 	"strconv"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -28,3 +30,39 @@ func Pretty(data interface{}) string {
 func Int64ToByte(i int64) []byte {
 	return []byte(strconv.FormatInt(i, 10))
 }
+
+// Expand a target stored in compact form (nBits). The top byte is the size of the target in bytes,
+// the lower 3 bytes are its most significant digits
+func CompactToBig(compact uint32) *big.Int {
+	size := uint(compact >> 24)
+	mantissa := int64(compact & 0x007fffff)
+
+	target := big.NewInt(mantissa)
+	if size <= 3 {
+		return target.Rsh(target, 8*(3-size))
+	}
+	return target.Lsh(target, 8*(size-3))
+}
+
+// Pack a target into compact form (nBits). Precision beyond the 3 most significant bytes is lost
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() <= 0 {
+		return 0
+	}
+
+	size := uint32(len(target.Bytes()))
+	var mantissa uint32
+	if size <= 3 {
+		mantissa = uint32(target.Uint64()) << (8 * (3 - size))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(target, uint(8*(size-3))).Uint64())
+	}
+
+	// The mantissa is signed, so move up a byte instead of setting the sign bit
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+
+	return size<<24 | mantissa
+}